@@ -17,16 +17,18 @@
 package main
 
 import (
-	"bufio"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
 	"log"
 	"net/http"
+	"net/url"
+	"strings"
+	"sync"
 	"time"
 
-	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/api"
 
 	"github.com/netapp/kubevoltracker/resources"
 )
@@ -35,13 +37,39 @@ import (
 //   NewAPIClient function defined below?
 type APIClient struct {
 	apiURL string
+	// recorder, if set, records every line read by Watch.
+	recorder *Recorder
+	// protobuf, if set, asks the API server to send watches as protobuf.
+	// API servers that can't still send JSON, which Watch also decodes.
+	protobuf bool
+
+	// clock is the local clock, against which the API server's clock is
+	// compared.  offset is the estimated difference between them, which is
+	// only meaningful once offsetKnown is set.
+	clock       Clock
+	offsetMutex sync.Mutex
+	offset      time.Duration
+	offsetKnown bool
+}
+
+// WatchOptions holds the selectors the API server applies to a watch.  Both
+// use the API server's selector syntax (e.g., "app=web,tier!=test" or
+// "metadata.namespace!=kube-system") and may be empty.
+type WatchOptions struct {
+	LabelSelector string
+	FieldSelector string
 }
 
-// WatchEvent represents an event received by the watcher.
+// WatchEvent represents an event received by the watcher.  Err is io.EOF
+// when the stream ends normally and a *StatusError when the API server
+// reports an error, either instead of starting the watch or in an ERROR
+// event; either way, the stream is over.  The first event of a stream that
+// the API server accepts has only Opened set.
 type WatchEvent struct {
 	JSONEvent interface{} // The parsed API object associated with the event.
 	JSON      string      // The raw JSON string for the event.
 	Err       error       // Any error code associated with the event.
+	Opened    bool        // Set once the API server has accepted the watch.
 }
 
 /* Watch starts a goroutine that watches an API server endpoint.  It returns
@@ -50,7 +78,10 @@ type WatchEvent struct {
    objectToWatch is optional.  Namespace can be empty if the watch is on
    a non-namespaced resource or if the watch is global (however, see NOTE).
    ResourceVersion can be empty for bootstrapping purposes, though it probably
-   shouldn't be. */
+   shouldn't be.  Objects not matching the selectors in opts are filtered
+   out by the API server.  Events are decoded from JSON or protobuf,
+   whichever the API server sends; either way, the JSON of each event is
+   passed along with it. */
 // TODO:  This may be quite slow; consider using separate WatchEvent structs
 //   for each potential type, at the very least.
 // TODO:  If this ends up dropping events, create a buffered channel and
@@ -64,13 +95,12 @@ type WatchEvent struct {
 //   that haven't been explicitly created (as opposed to implicitly created via
 //   reference in a resource definition).
 func (a *APIClient) Watch(objectToWatch resources.ResourceType,
-	namespace string, resourceVersion string) (eventChan chan WatchEvent,
-	done chan struct{}) {
+	namespace string, resourceVersion string,
+	opts WatchOptions) (eventChan chan WatchEvent, done chan struct{}) {
 
 	var namespaceComponent string
-	var resourceVersionComponent string
+	var queryComponent string
 
-	createEvent := resourceFactoryMap[objectToWatch]
 	eventChan = make(chan WatchEvent)
 	done = make(chan struct{})
 
@@ -80,24 +110,45 @@ func (a *APIClient) Watch(objectToWatch resources.ResourceType,
 	} else {
 		namespaceComponent = ""
 	}
+	query := url.Values{}
 	if resourceVersion != "" {
-		resourceVersionComponent = fmt.Sprintf("?resourceVersion=%s",
-			resourceVersion)
-	} else {
-		resourceVersionComponent = ""
+		query.Set("resourceVersion", resourceVersion)
+	}
+	if opts.LabelSelector != "" {
+		query.Set("labelSelector", opts.LabelSelector)
+	}
+	if opts.FieldSelector != "" {
+		query.Set("fieldSelector", opts.FieldSelector)
+	}
+	if len(query) > 0 {
+		queryComponent = "?" + query.Encode()
 	}
 	watchURL := fmt.Sprintf("%s/watch/%s/%s%s", a.apiURL,
-		namespaceComponent, objectToWatch, resourceVersionComponent)
+		namespaceComponent, objectToWatch, queryComponent)
 	fmt.Println("Watching URL ", watchURL)
 	go func() {
 		defer close(eventChan)
-		resp, err := http.Get(watchURL)
+		sent := a.clock.Now()
+		resp, err := a.get(watchURL)
 		if err != nil {
 			eventChan <- WatchEvent{Err: fmt.Errorf("Unable to "+
 				"request watch for object %s at URL %s:  %s",
 				objectToWatch, watchURL, err)}
 			return
 		}
+		a.observeDate(resp, sent, a.clock.Now())
+		if err = responseError(resp); err != nil {
+			resp.Body.Close()
+			eventChan <- WatchEvent{Err: err}
+			return
+		}
+		// The caller may close the watch before it reads anything.
+		select {
+		case eventChan <- WatchEvent{Opened: true}:
+		case <-done:
+			resp.Body.Close()
+			return
+		}
 
 		// Allow for external callers to close the watch.
 		go func() {
@@ -107,78 +158,133 @@ func (a *APIClient) Watch(objectToWatch resources.ResourceType,
 
 		defer resp.Body.Close()
 
-		reader := bufio.NewReader(resp.Body)
+		stream := newWatchStream(objectToWatch, resp)
 
 		//TODO:  Add something here to safely clean up in case the
 		// master thread exits?  Do we need to use /x/net/context here?
 		// Might be necessary for breaking out of the HTTP request.
 		for {
 			startTime := time.Now()
-			line, err := reader.ReadBytes('\n')
+			event, line := stream.next()
 			endTime := time.Now()
-			if err == io.EOF {
-				eventChan <- WatchEvent{
-					Err: err,
-				}
-				return
-			}
-			if err != nil {
-				eventChan <- WatchEvent{
-					Err: fmt.Errorf("Unable to read from "+
+			if event.Err != nil && line == nil {
+				if event.Err != io.EOF {
+					event.Err = fmt.Errorf("Unable to read from "+
 						"reader for %s after %s:  %s",
 						objectToWatch,
 						endTime.Sub(startTime),
-						err)}
+						event.Err)
+				}
+				eventChan <- event
 				return
 			}
-			event := createEvent()
-			startTime = time.Now()
-			err = json.Unmarshal(line, event)
-			endTime = time.Now()
-			if err != nil {
-				var status StatusMessage
-				if err = json.Unmarshal(line, &status); err == nil {
-					eventChan <- WatchEvent{
-						Err:       io.EOF,
-						JSONEvent: status.Status,
-						JSON:      string(line),
-					}
-				} else {
-					eventChan <- WatchEvent{
-						Err: fmt.Errorf("Unable to decode "+
-							"json for %s:  %s\nJSON:\n%s",
-							objectToWatch, err, line),
-					}
-				}
+			if a.recorder != nil {
+				a.recorder.Record(objectToWatch, namespace, line)
 			}
-			if event.GetType() == "" {
-				var status unversioned.Status
-				new_err := json.Unmarshal(line, &status)
-				if new_err != nil {
-					log.Print("Failed to parse status: ", new_err)
-					log.Print("JSON: ", line)
-					eventChan <- WatchEvent{
-						Err: new_err,
-					}
-				} else {
-					log.Print("Parsed status.")
-					// Sending an EOF is a little sleazy, but it signals
-					// that the handler needs to parse the results differently.
-					// TODO:  Designate new error type?
-					eventChan <- WatchEvent{
-						Err:       io.EOF,
-						JSONEvent: status,
-						JSON:      string(line),
-					}
-				}
-			} else {
-				eventChan <- WatchEvent{JSONEvent: event, JSON: string(line)}
+			eventChan <- event
+			if event.Err != nil {
+				return
 			}
 		}
 	}()
 	return eventChan, done
 }
 
+// get requests a watch at url, asking for protobuf if the client prefers it.
+func (a *APIClient) get(url string) (*http.Response, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	if a.protobuf {
+		req.Header.Set("Accept", protobufAccept)
+	}
+	return http.DefaultClient.Do(req)
+}
+
+// decodeWatchLine decodes a single line of a watch stream on resource into
+// an event from the pool, which the receiver should release once it's done
+// with it.  ERROR events and bare Status objects are returned as
+// StatusErrors.
+func decodeWatchLine(resource resources.ResourceType,
+	line []byte) WatchEvent {
+
+	event := getEvent(resource)
+	return finishEvent(resource, event, json.Unmarshal(line, event), line)
+}
+
+// finishEvent returns the WatchEvent for line, given the event it was
+// decoded into and the error from decoding it.  The event is released
+// unless it's returned.
+func finishEvent(resource resources.ResourceType, event ResourceEvent,
+	err error, line []byte) WatchEvent {
+
+	if err == nil && event.GetType() != "" && event.GetType() != Error {
+		return WatchEvent{JSONEvent: event, JSON: string(line)}
+	}
+	releaseEvent(resource, event)
+	if statusErr := decodeStatus(line); statusErr != nil {
+		log.Print("Parsed status.")
+		return WatchEvent{Err: statusErr, JSON: string(line)}
+	}
+	if err == nil {
+		err = errors.New("No event type")
+	}
+	return WatchEvent{Err: fmt.Errorf("Unable to decode json for %s:  %s"+
+		"\nJSON:\n%s", resource, err, line)}
+}
+
+// ListNamespaces returns the names of the namespaces matching the given label
+// selector (e.g., "tenant=a,tier!=test"), or of every namespace if the
+// selector is empty.
+func (a *APIClient) ListNamespaces(selector string) ([]string, error) {
+	var list api.NamespaceList
+
+	listURL := a.apiURL + "namespaces"
+	if selector != "" {
+		listURL += "?labelSelector=" + url.QueryEscape(selector)
+	}
+	sent := a.clock.Now()
+	resp, err := http.Get(listURL)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list namespaces at URL %s:  %s",
+			listURL, err)
+	}
+	defer resp.Body.Close()
+	a.observeDate(resp, sent, a.clock.Now())
+	if err = responseError(resp); err != nil {
+		return nil, fmt.Errorf("Unable to list namespaces at URL %s:  %s",
+			listURL, err)
+	}
+	if err = json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		return nil, fmt.Errorf("Unable to decode namespace list:  %s", err)
+	}
+	names := make([]string, len(list.Items))
+	for i, ns := range list.Items {
+		names[i] = ns.Name
+	}
+	return names, nil
+}
+
+// SyncClock estimates the offset between the API server's clock and the
+// local one from a request for the API server's version.  The estimate is
+// refined by every later response, including those starting watches.
+func (a *APIClient) SyncClock() error {
+	versionURL := strings.TrimSuffix(a.apiURL, "api/v1/") + "version"
+	sent := a.clock.Now()
+	resp, err := http.Get(versionURL)
+	if err != nil {
+		return fmt.Errorf("Unable to request version at URL %s:  %s",
+			versionURL, err)
+	}
+	defer resp.Body.Close()
+	if resp.Header.Get("Date") == "" {
+		return fmt.Errorf("No Date header in response from %s", versionURL)
+	}
+	a.observeDate(resp, sent, a.clock.Now())
+	return nil
+}
+
 // NewAPIClient returns a new client that can be used to place watches
 // on the API server.  Takes the hostname/IP address and port of the Kubernetes
 // API server; e.g. 192.168.1.1:8080
@@ -188,5 +294,6 @@ func NewAPIClient(masterIpPort string) (*APIClient, error) {
 		return nil, errors.New("No master IP and port specified.  Unable to " +
 			"create APIClient.")
 	}
-	return &APIClient{"http://" + masterIpPort + "/api/v1/"}, nil
+	return &APIClient{apiURL: "http://" + masterIpPort + "/api/v1/",
+		clock: systemClock{}}, nil
 }
@@ -49,12 +49,12 @@ func TestWatches(t *testing.T) {
 
 	kubectl.DeleteTestResources()
 	a := GetAPIClient()
-	pvChan, donePV := a.Watch("persistentvolumes", "", "")
+	pvChan, donePV := a.Watch("persistentvolumes", "", "", WatchOptions{})
 	defer close(donePV)
 	pvcChan, donePVC := a.Watch("persistentvolumeclaims", watcherNS,
-		"")
+		"", WatchOptions{})
 	defer close(donePVC)
-	podChan, donePod := a.Watch("pods", watcherNS, "")
+	podChan, donePod := a.Watch("pods", watcherNS, "", WatchOptions{})
 	defer close(donePod)
 
 	if pvFileName, err = kubectl.CreatePV("nfs", 1, defaultPVAccessModes); err != nil {
@@ -76,6 +76,12 @@ func TestWatches(t *testing.T) {
 		t.Fatalf("Unable to create %s:  %s", podFileName, err)
 	}
 
+	for _, c := range []chan WatchEvent{pvChan, pvcChan, podChan} {
+		if event := <-c; !event.Opened {
+			t.Fatal("Unable to open basic watch:  ", event.Err)
+		}
+	}
+
 	event := <-pvChan
 	if event.Err != nil {
 		t.Fatal("Unable to obtain basic watch:  ", event.Err)
@@ -0,0 +1,97 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"time"
+)
+
+const (
+	// dateResolution is the resolution of the HTTP Date header.  The header
+	// is truncated, so the API server read its clock, on average, half of
+	// this after the time it reports.
+	dateResolution = time.Second
+	// offsetSmoothing is the weight given to the current estimate of the
+	// clock offset relative to each new sample.  Averaging many samples
+	// recovers the precision lost to dateResolution.
+	offsetSmoothing = 8
+)
+
+// Clock supplies the current time.  The Watcher reads the time through one
+// so that tests can control the times it records.
+type Clock interface {
+	Now() time.Time
+}
+
+// systemClock reads the local system clock.
+type systemClock struct{}
+
+func (systemClock) Now() time.Time {
+	return time.Now()
+}
+
+// serverClock estimates the API server's clock by correcting the client's
+// local clock by the offset the client has observed.
+type serverClock struct {
+	client *APIClient
+}
+
+func (c serverClock) Now() time.Time {
+	return c.client.clock.Now().Add(c.client.ClockOffset())
+}
+
+// ServerClock returns a Clock that estimates the API server's clock, based
+// on the Date headers of the client's responses so far.  Until a response
+// has been received, it reads the local clock.
+func (a *APIClient) ServerClock() Clock {
+	return serverClock{a}
+}
+
+// ClockOffset returns the estimated difference between the API server's
+// clock and the local one; it is positive if the API server's clock is
+// ahead.
+func (a *APIClient) ClockOffset() time.Duration {
+	a.offsetMutex.Lock()
+	defer a.offsetMutex.Unlock()
+	return a.offset
+}
+
+// observeDate updates the clock offset from the Date header of resp, given
+// the local times at which the request was sent and the response received.
+// Responses without a valid Date header are ignored.
+func (a *APIClient) observeDate(resp *http.Response, sent,
+	received time.Time) {
+
+	date, err := http.ParseTime(resp.Header.Get("Date"))
+	if err != nil {
+		return
+	}
+	// Assume the API server read its clock halfway through the round trip.
+	sample := date.Add(dateResolution / 2).Sub(sent.Add(
+		received.Sub(sent) / 2))
+
+	a.offsetMutex.Lock()
+	defer a.offsetMutex.Unlock()
+	if !a.offsetKnown {
+		a.offset = sample
+		a.offsetKnown = true
+	} else {
+		a.offset += (sample - a.offset) / offsetSmoothing
+	}
+	clockOffset.Set(a.offset.Seconds())
+}
@@ -0,0 +1,150 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// fakeClock always returns the same time.
+type fakeClock struct {
+	now time.Time
+}
+
+func (c fakeClock) Now() time.Time {
+	return c.now
+}
+
+var clockBase = time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+
+// getClockServer returns a fake API server whose Date headers are ahead of
+// clockBase by the offsets sent on the returned channel, one per request.
+// Watches on PVs return a single PV bound to pvc-1.
+func getClockServer(t *testing.T) (*httptest.Server, chan<- time.Duration) {
+	const pvLine = `{"type":"ADDED","object":{"metadata":{"name":"pv-1",` +
+		`"uid":"pv-1","resourceVersion":"5"},` +
+		`"spec":{"nfs":{"server":"192.0.2.1","path":"/pv-1"},` +
+		`"claimRef":{"uid":"pvc-1"}}}}` + "\n"
+
+	offsets := make(chan time.Duration, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+
+		w.Header().Set("Date",
+			clockBase.Add(<-offsets).Format(http.TimeFormat))
+		switch strings.Replace(r.URL.Path, "//", "/", -1) {
+		case "/version":
+			fmt.Fprint(w, `{"major":"1","minor":"2"}`)
+		case "/api/v1/watch/persistentvolumes":
+			fmt.Fprint(w, pvLine)
+			w.(http.Flusher).Flush()
+			<-w.(http.CloseNotifier).CloseNotify()
+		default:
+			t.Errorf("Unexpected request for %s", r.URL)
+			http.NotFound(w, r)
+		}
+	}))
+	return server, offsets
+}
+
+func TestClockOffset(t *testing.T) {
+	server, offsets := getClockServer(t)
+	defer server.Close()
+
+	client, err := NewAPIClient(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal("Unable to create client: ", err)
+	}
+	client.clock = fakeClock{clockBase}
+	if offset := client.ClockOffset(); offset != 0 {
+		t.Error("Expected no offset before any requests; got ", offset)
+	}
+
+	// The Date header is truncated, so half a second is added on average.
+	for _, c := range []struct {
+		header, expected time.Duration
+	}{
+		{90 * time.Second, 90500 * time.Millisecond},
+		{92 * time.Second, 90750 * time.Millisecond},
+		{-time.Hour, 90750*time.Millisecond +
+			(-time.Hour-90250*time.Millisecond)/offsetSmoothing},
+	} {
+		offsets <- c.header
+		if err = client.SyncClock(); err != nil {
+			t.Fatal("Unable to sync clock: ", err)
+		}
+		if offset := client.ClockOffset(); offset != c.expected {
+			t.Errorf("Expected offset %s after header %s; got %s",
+				c.expected, c.header, offset)
+		}
+	}
+	now := client.ServerClock().Now()
+	if expected := clockBase.Add(client.ClockOffset()); !now.Equal(expected) {
+		t.Errorf("Expected server clock to read %s; got %s", expected, now)
+	}
+}
+
+func TestWatchServerClock(t *testing.T) {
+	server, offsets := getClockServer(t)
+	defer server.Close()
+
+	manager := memory.New()
+	w, err := NewWatcher(nil, strings.TrimPrefix(server.URL, "http://"),
+		manager)
+	if err != nil {
+		t.Fatal("Unable to create watcher: ", err)
+	}
+	w.client.clock = fakeClock{clockBase}
+	offsets <- time.Hour
+	if err = w.Watch(resources.PVs, true); err != nil {
+		t.Fatal("Unable to watch PVs: ", err)
+	}
+	defer w.Stop(resources.PVs)
+
+	var pvcs []dbmanager.PVCRecord
+	deadline := time.Now().Add(2 * time.Second)
+	for len(pvcs) == 0 {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the bind")
+		}
+		time.Sleep(10 * time.Millisecond)
+		if pvcs, err = manager.(dbmanager.Querier).ListPVCs(); err != nil {
+			t.Fatal("Unable to list PVCs: ", err)
+		}
+	}
+	// The bind time is taken from the API server's clock, as estimated from
+	// the watch's Date header.
+	expected := clockBase.Add(time.Hour + dateResolution/2)
+	if !pvcs[0].BindTime.Equal(expected) {
+		t.Errorf("Expected bind at %s; got %s", expected, pvcs[0].BindTime)
+	}
+
+	w.SetClock(fakeClock{clockBase})
+	if now := w.clock.Now(); !now.Equal(clockBase) {
+		t.Errorf("Expected the injected clock to read %s; got %s", clockBase,
+			now)
+	}
+}
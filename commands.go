@@ -0,0 +1,524 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/loadgen"
+	"github.com/netapp/kubevoltracker/reports"
+)
+
+// command describes a subcommand of the main binary.  run receives the
+// arguments following the command name.
+type command struct {
+	usage string
+	run   func(args []string) error
+}
+
+var commands = map[string]command{
+	"chargeback": {
+		usage: "Report storage consumed in GB-hours, as CSV",
+		run:   runChargeback,
+	},
+	"describe": {
+		usage: "Show the history of a PV (describe pv NAME)",
+		run:   runDescribe,
+	},
+	"graph": {
+		usage: "Export storage relationships as DOT, GraphML, or JSON",
+		run:   runGraph,
+	},
+	"idle": {
+		usage: "List volumes that no running pod mounts, longest idle first",
+		run:   runIdle,
+	},
+	"loadtest": {
+		usage: "Feed synthetic watch events to the backend and report " +
+			"throughput and latency",
+		run: runLoadTest,
+	},
+	"prune": {
+		usage: "Archive and remove pods deleted long ago",
+		run:   runPrune,
+	},
+	"rebuild": {
+		usage: "Rebuild the database's tables from its event log",
+		run:   runRebuild,
+	},
+	"replay": {
+		usage: "Replay watch streams recorded with -record (replay DIR)",
+		run:   runReplay,
+	},
+}
+
+// commandNames returns the names of all commands in sorted order.
+func commandNames() []string {
+	names := make([]string, 0, len(commands))
+	for name := range commands {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// getQuerier returns the backend DBManager as a dbmanager.Querier, for
+// commands that need to read recorded state.  Callers are responsible for
+// calling Destroy on the returned manager.
+func getQuerier() (dbmanager.DBManager, dbmanager.Querier, error) {
+	manager := getManager()
+	q, ok := manager.(dbmanager.Querier)
+	if !ok {
+		manager.Destroy()
+		return nil, nil, errors.New("Backend does not support queries.")
+	}
+	return manager, q, nil
+}
+
+// getOutput returns a writer for the file specified by path, or stdout if
+// path is empty or "-".
+func getOutput(path string) (io.WriteCloser, error) {
+	if path == "" || path == "-" {
+		return os.Stdout, nil
+	}
+	return os.Create(path)
+}
+
+// timeFlag parses times on the command line, accepting either RFC 3339
+// timestamps or dates in the form YYYY-MM-DD.
+type timeFlag struct {
+	time.Time
+}
+
+func (t *timeFlag) String() string {
+	if t.IsZero() {
+		return ""
+	}
+	return t.Format(time.RFC3339)
+}
+
+func (t *timeFlag) Set(value string) error {
+	var err error
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t.Time, err = time.ParseInLocation(layout, value,
+			time.Local); err == nil {
+			return nil
+		}
+	}
+	return fmt.Errorf("Unable to parse time %s; expected YYYY-MM-DD or "+
+		"RFC 3339", value)
+}
+
+// confidenceFlag parses the least trustworthy time source that a report
+// should accept:  exact, observed, or inferred.
+type confidenceFlag struct {
+	dbmanager.TimeSource
+}
+
+func (c *confidenceFlag) String() string {
+	return string(c.TimeSource)
+}
+
+func (c *confidenceFlag) Set(value string) (err error) {
+	c.TimeSource, err = dbmanager.ParseTimeSource(value)
+	return
+}
+
+// parseBackend returns the backend type named by value (nfs or iscsi).
+func parseBackend(value string) (dbmanager.Table, error) {
+	backend := dbmanager.Table(strings.ToLower(value))
+	if backend != dbmanager.NFS && backend != dbmanager.ISCSI {
+		return "", fmt.Errorf("Unknown backend type %s", value)
+	}
+	return backend, nil
+}
+
+// priceFlag accumulates backend=price pairs specified on the command line.
+type priceFlag map[dbmanager.Table]float64
+
+func (p priceFlag) String() string {
+	pairs := make([]string, 0, len(p))
+	for backend, price := range p {
+		pairs = append(pairs, fmt.Sprintf("%s=%g", backend, price))
+	}
+	sort.Strings(pairs)
+	return strings.Join(pairs, ",")
+}
+
+func (p priceFlag) Set(value string) error {
+	parts := strings.SplitN(value, "=", 2)
+	if len(parts) != 2 {
+		return fmt.Errorf("Expected backend=price; got %s", value)
+	}
+	backend, err := parseBackend(parts[0])
+	if err != nil {
+		return err
+	}
+	price, err := strconv.ParseFloat(parts[1], 64)
+	if err != nil {
+		return fmt.Errorf("Unable to parse price %s:  %s", parts[1], err)
+	}
+	p[backend] = price
+	return nil
+}
+
+func runChargeback(args []string) error {
+	var (
+		start, end timeFlag
+		prices     = make(priceFlag)
+		labelKey   string
+		outPath    string
+	)
+
+	now := time.Now()
+	start.Time = time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.Local)
+	end.Time = now
+
+	fs := flag.NewFlagSet("chargeback", flag.ExitOnError)
+	fs.Var(&start, "start", "Start of the billing period "+
+		"(default: start of the current month)")
+	fs.Var(&end, "end", "End of the billing period (default: now)")
+	fs.Var(prices, "price", "Price per GB-month for a backend type, as "+
+		"backend=price (e.g., nfs=0.10); may be repeated")
+	fs.StringVar(&labelKey, "label", "", "PVC label to break usage down by")
+	fs.StringVar(&outPath, "o", "", "File to write the CSV report to "+
+		"(default: stdout)")
+	fs.Parse(args)
+
+	manager, q, err := getQuerier()
+	if err != nil {
+		return err
+	}
+	defer manager.Destroy()
+
+	opts := reports.ChargebackOptions{
+		Start:    start.Time,
+		End:      end.Time,
+		LabelKey: labelKey,
+		Prices:   prices,
+	}
+	rows, err := reports.Chargeback(q, opts)
+	if err != nil {
+		return err
+	}
+	out, err := getOutput(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return reports.WriteChargebackCSV(out, rows, opts)
+}
+
+func runIdle(args []string) error {
+	var (
+		minIdle, reclaimAfter time.Duration
+		minConfidence         confidenceFlag
+		asJSON                bool
+		outPath               string
+	)
+
+	fs := flag.NewFlagSet("idle", flag.ExitOnError)
+	fs.DurationVar(&minIdle, "min-idle", 0, "Omit volumes idle for less "+
+		"than this (e.g., 24h)")
+	fs.DurationVar(&reclaimAfter, "reclaim-after", 0, "Flag volumes idle "+
+		"for at least this long as reclaim candidates (e.g., 720h)")
+	fs.Var(&minConfidence, "min-confidence", "Omit volumes whose idle time "+
+		"is less trustworthy than this (exact, observed, or inferred)")
+	fs.BoolVar(&asJSON, "json", false, "Write the list as JSON")
+	fs.StringVar(&outPath, "o", "", "File to write the list to "+
+		"(default: stdout)")
+	fs.Parse(args)
+
+	manager, q, err := getQuerier()
+	if err != nil {
+		return err
+	}
+	defer manager.Destroy()
+
+	now := time.Now()
+	vols, err := reports.IdleVolumes(q, reports.IdleOptions{
+		Now:           now,
+		MinIdle:       minIdle,
+		ReclaimAfter:  reclaimAfter,
+		MinConfidence: minConfidence.TimeSource,
+	})
+	if err != nil {
+		return err
+	}
+	out, err := getOutput(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	if asJSON {
+		return json.NewEncoder(out).Encode(vols)
+	}
+	return reports.WriteIdleTable(out, vols, now)
+}
+
+func runDescribe(args []string) error {
+	var (
+		minConfidence confidenceFlag
+		asJSON        bool
+	)
+
+	fs := flag.NewFlagSet("describe", flag.ExitOnError)
+	fs.Var(&minConfidence, "min-confidence", "Omit events whose times are "+
+		"less trustworthy than this (exact, observed, or inferred)")
+	fs.BoolVar(&asJSON, "json", false, "Write the history as JSON")
+	fs.Usage = func() {
+		fmt.Fprintln(os.Stderr, "Usage:  describe [flags] pv NAME")
+		fs.PrintDefaults()
+	}
+	fs.Parse(args)
+	if fs.NArg() != 2 || fs.Arg(0) != "pv" {
+		fs.Usage()
+		return errors.New("Expected pv NAME.")
+	}
+
+	manager, q, err := getQuerier()
+	if err != nil {
+		return err
+	}
+	defer manager.Destroy()
+
+	histories, err := reports.DescribePV(q, fs.Arg(1),
+		minConfidence.TimeSource)
+	if err != nil {
+		return err
+	}
+	if len(histories) == 0 {
+		return fmt.Errorf("No PV named %s found.", fs.Arg(1))
+	}
+	if asJSON {
+		return json.NewEncoder(os.Stdout).Encode(histories)
+	}
+	for _, h := range histories {
+		if err = reports.WritePVHistory(os.Stdout, h); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func runGraph(args []string) error {
+	var (
+		at                       timeFlag
+		format, backend, outPath string
+		opts                     reports.GraphOptions
+		err                      error
+	)
+
+	fs := flag.NewFlagSet("graph", flag.ExitOnError)
+	fs.StringVar(&format, "format", "dot", "Output format:  dot, graphml, "+
+		"or json")
+	fs.Var(&at, "at", "Time at which to build the graph (default: now)")
+	fs.StringVar(&opts.Namespace, "namespace", "", "Only include claims "+
+		"and pods in this namespace, along with their PVs and backends")
+	fs.StringVar(&backend, "backend", "", "Only include this backend type "+
+		"(nfs or iscsi) and everything depending on it")
+	fs.StringVar(&opts.Server, "server", "", "Only include volume sources "+
+		"on this NFS server or ISCSI target portal, and everything "+
+		"depending on them")
+	fs.StringVar(&outPath, "o", "", "File to write the graph to "+
+		"(default: stdout)")
+	fs.Parse(args)
+
+	opts.At = at.Time
+	if backend != "" {
+		if opts.Backend, err = parseBackend(backend); err != nil {
+			return err
+		}
+	}
+
+	manager, q, err := getQuerier()
+	if err != nil {
+		return err
+	}
+	defer manager.Destroy()
+
+	g, err := reports.StorageGraph(q, opts)
+	if err != nil {
+		return err
+	}
+	out, err := getOutput(outPath)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+	return g.WriteGraph(out, format)
+}
+
+func runReplay(args []string) error {
+	var (
+		speed   float64
+		useMock bool
+		manager dbmanager.DBManager
+	)
+
+	fs := flag.NewFlagSet("replay", flag.ExitOnError)
+	fs.Float64Var(&speed, "speed", 0, "Replay speed relative to the "+
+		"recording (e.g., 1 for the original timing, 10 for ten times as "+
+		"fast); 0 to replay without delays")
+	fs.BoolVar(&useMock, "mock", false, "Replay into an in-memory mock "+
+		"backend instead of the database, printing what it holds")
+	fs.Parse(args)
+	if fs.NArg() != 1 {
+		return errors.New("Expected a recording directory.")
+	}
+
+	lines, err := ReadRecordings(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if useMock {
+		manager = mock.New(false)
+	} else {
+		manager = getManager()
+	}
+	defer manager.Destroy()
+
+	handled, err := newReplayWatcher(manager).Replay(lines, speed)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Replayed %d events from %d recorded lines\n", handled,
+		len(lines))
+	if m, ok := manager.(*mock.MockManager); ok {
+		fmt.Printf("Mock backend holds %d pods, %d PVs, and %d PVCs, with "+
+			"%d deletions\n", len(m.PodForUID), len(m.PVForUID),
+			len(m.PVCForUID), m.Deletions)
+	}
+	return nil
+}
+
+func runPrune(args []string) error {
+	var (
+		olderThan time.Duration
+		opts      pruneOptions
+	)
+
+	fs := flag.NewFlagSet("prune", flag.ExitOnError)
+	fs.DurationVar(&olderThan, "older-than", 0, "Prune pods deleted at "+
+		"least this long ago (e.g., 720h)")
+	fs.StringVar(&opts.ArchiveDir, "archive", "", "Directory in which to "+
+		"archive pruned pods; empty to discard them")
+	fs.StringVar(&opts.ArchiveFormat, "format", "jsonl", "Archive format:  "+
+		"jsonl, or csv for a file per table")
+	fs.Parse(args)
+	if olderThan <= 0 {
+		return errors.New("-older-than must be positive.")
+	}
+	if err := opts.validate(); err != nil {
+		return err
+	}
+
+	manager := getManager()
+	defer manager.Destroy()
+	p, ok := manager.(dbmanager.Pruner)
+	if !ok {
+		return errors.New("Backend does not support pruning.")
+	}
+
+	opts.Before = time.Now().Add(-olderThan)
+	pruned, err := prunePods(p, opts)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Pruned %d pods deleted before %s\n", pruned,
+		opts.Before.Format(time.RFC3339))
+	return nil
+}
+
+func runRebuild(args []string) error {
+	fs := flag.NewFlagSet("rebuild", flag.ExitOnError)
+	fs.Parse(args)
+	if fs.NArg() != 0 {
+		return errors.New("Unexpected arguments to rebuild.")
+	}
+
+	manager := getManager()
+	defer manager.Destroy()
+
+	start := time.Now()
+	replayed, err := newReplayWatcher(manager).Rebuild()
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Rebuilt from %d logged events in %s\n", replayed,
+		time.Since(start))
+	return nil
+}
+
+func runLoadTest(args []string) error {
+	var (
+		config   loadgen.Config
+		duration time.Duration
+		rate     float64
+		useMock  bool
+		manager  dbmanager.DBManager
+	)
+
+	fs := flag.NewFlagSet("loadtest", flag.ExitOnError)
+	fs.IntVar(&config.MaxPVs, "max-pvs", 20, "Maximum number of PVs")
+	fs.IntVar(&config.MaxPVCs, "max-pvcs", 15, "Maximum number of PVCs")
+	fs.IntVar(&config.MaxPods, "max-pods", 10, "Maximum number of pods")
+	fs.StringVar(&config.Namespace, "namespace", "test-namespace",
+		"Namespace of the generated pods and PVCs")
+	fs.Int64Var(&config.Seed, "seed", 0, "Seed for the RNG; chosen "+
+		"automatically if 0")
+	fs.DurationVar(&duration, "duration", 30*time.Second, "How long to run")
+	fs.Float64Var(&rate, "rate", 0, "Events to emit per second; 0 to emit "+
+		"them as fast as they can be handled")
+	fs.BoolVar(&useMock, "mock", false, "Use an in-memory mock backend "+
+		"instead of the database")
+	fs.Parse(args)
+
+	if config.Seed == 0 {
+		config.Seed = time.Now().UnixNano()
+	}
+	// Print the seed so that runs can be repeated.
+	fmt.Printf("RNG seed:  %d\n", config.Seed)
+	gen, err := loadgen.New(config)
+	if err != nil {
+		return err
+	}
+	if useMock {
+		manager = mock.New(false)
+	} else {
+		manager = getManager()
+	}
+	defer manager.Destroy()
+
+	stats, err := runLoad(newReplayWatcher(manager), gen, rate, duration, 0)
+	if err != nil {
+		return err
+	}
+	stats.report(os.Stdout)
+	return nil
+}
@@ -0,0 +1,1305 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package conformance provides a test suite that holds every
+// dbmanager.DBManager implementation to the same semantics.  Backends run it
+// from their own tests by calling Run with a factory for empty managers.
+//
+// Every backend must implement dbmanager.Querier, through which checks read
+// back the state it has recorded.  Checks on revisions use
+// dbmanager.RevisionStore, checks on the event log use dbmanager.EventLog,
+// and checks on pruning use dbmanager.Pruner; each is skipped for backends
+// that don't implement the interfaces it needs.
+package conformance
+
+import (
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// Every UID used by the suite starts with "test-", so that backends sharing
+// a database with other tests can clear the suite's records along with
+// their own.  The watcher namespaces are exported for the same reason.
+const (
+	WatcherNamespace    = "test-conformance-watcher"
+	WatcherNamespaceAlt = "test-conformance-watcher-alt"
+
+	namespace    = "test-conformance"
+	altNamespace = "test-conformance-alt"
+
+	pvUID    = "test-conformance-pv-001"
+	pvUID2   = "test-conformance-pv-002"
+	pvName   = "test-conformance-pv"
+	pvName2  = "test-conformance-pv2"
+	pvJSON   = "Conformance PV JSON"
+	pvcUID   = "test-conformance-pvc-001"
+	pvcUID2  = "test-conformance-pvc-002"
+	pvcUID3  = "test-conformance-pvc-003"
+	pvcName  = "test-conformance-pvc"
+	pvcName2 = "test-conformance-pvc2"
+	pvcJSON  = "Conformance PVC JSON"
+	podUID   = "test-conformance-pod-001"
+	podUID2  = "test-conformance-pod-002"
+	podUID3  = "test-conformance-pod-003"
+	podName  = "test-conformance-pod"
+	podName2 = "test-conformance-pod2"
+	podJSON  = "Conformance pod JSON"
+
+	pvStorage  = int64(1024)
+	pvcStorage = int64(512)
+
+	nfsServer    = "192.0.2.10"
+	nfsServer2   = "192.0.2.11"
+	nfsPath      = "/export/conformance"
+	iscsiPortal  = "192.0.2.10:3260"
+	iscsiIQN     = "iqn.2016-05.com.netapp:storage:conformance"
+	iscsiLUN     = 3
+	iscsiFSType  = "ext4"
+	updateJSON   = "Updated conformance JSON"
+	updateAmount = int64(2048)
+)
+
+var (
+	pvModes     = []api.PersistentVolumeAccessMode{api.ReadWriteMany}
+	pvcModes    = []api.PersistentVolumeAccessMode{api.ReadWriteOnce}
+	updateModes = []api.PersistentVolumeAccessMode{api.ReadWriteOnce,
+		api.ReadOnlyMany}
+)
+
+// Factory returns an empty DBManager for a single check.  Backends that
+// share state between managers must clear any records left by earlier
+// checks before returning.
+type Factory func(t *testing.T) dbmanager.DBManager
+
+// interfaces is a set of the optional interfaces a check needs.
+type interfaces int
+
+const (
+	revisionStoreInterface interfaces = 1 << iota
+	eventLogInterface
+	prunerInterface
+)
+
+// missing returns the name of an interface in needs that m doesn't
+// implement, or an empty string if it implements them all.
+func (needs interfaces) missing(m dbmanager.DBManager) string {
+	if _, ok := m.(dbmanager.RevisionStore); !ok &&
+		needs&revisionStoreInterface != 0 {
+		return "dbmanager.RevisionStore"
+	}
+	if _, ok := m.(dbmanager.EventLog); !ok && needs&eventLogInterface != 0 {
+		return "dbmanager.EventLog"
+	}
+	if _, ok := m.(dbmanager.Pruner); !ok && needs&prunerInterface != 0 {
+		return "dbmanager.Pruner"
+	}
+	return ""
+}
+
+var checks = []struct {
+	name  string
+	needs interfaces
+	run   func(t *testing.T, m dbmanager.DBManager)
+}{
+	{"Insert", 0, checkInsert},
+	{"DuplicateInsert", 0, checkDuplicateInsert},
+	{"BindBeforeInsert", 0, checkBindBeforeInsert},
+	{"BindAfterInsert", 0, checkBindAfterInsert},
+	{"PodMount", 0, checkPodMount},
+	{"LatePVCPodMount", 0, checkLatePVCPodMount},
+	{"PVCSeenBeforePod", 0, checkPVCSeenBeforePod},
+	{"DeletedPodMount", 0, checkDeletedPodMount},
+	{"PodMountNamespace", 0, checkPodMountNamespace},
+	{"Delete", 0, checkDelete},
+	{"TimeSources", 0, checkTimeSources},
+	{"Update", 0, checkUpdate},
+	{"ResourceVersion", 0, checkResourceVersion},
+	{"ObjectResourceVersion", 0, checkObjectResourceVersion},
+	{"Revisions", revisionStoreInterface, checkRevisions},
+	{"RevisionRetention", revisionStoreInterface, checkRevisionRetention},
+	{"EventLog", eventLogInterface, checkEventLog},
+	{"ClearDerived", eventLogInterface, checkClearDerived},
+	{"Prune", prunerInterface, checkPrune},
+	{"PruneEventLog", eventLogInterface | prunerInterface,
+		checkPruneEventLog},
+}
+
+// Run runs every conformance check against managers returned by newManager,
+// skipping those that need optional interfaces the managers don't
+// implement, and fails if the managers don't implement dbmanager.Querier.
+// Each check's name is logged before it runs, so that failures can be
+// traced to it; a check that fails fatally stops the rest.
+func Run(t *testing.T, newManager Factory) {
+	for _, check := range checks {
+		m := newManager(t)
+		if _, ok := m.(dbmanager.Querier); !ok {
+			t.Fatal("Backend doesn't implement dbmanager.Querier")
+		}
+		if missing := check.needs.missing(m); missing != "" {
+			t.Logf("Skipping %s; backend doesn't implement %s", check.name,
+				missing)
+			continue
+		}
+		t.Logf("Running %s", check.name)
+		check.run(t, m)
+	}
+}
+
+// at returns a time n seconds after base.  Times are whole seconds so that
+// backends that truncate them (e.g., to the microsecond) still compare equal.
+func at(base time.Time, n int) unversioned.Time {
+	return unversioned.NewTime(base.Add(time.Duration(n) * time.Second))
+}
+
+func newBase() time.Time {
+	return time.Now().Truncate(time.Second)
+}
+
+// accessModeString is the form in which backends report access modes.
+func accessModeString(modes []api.PersistentVolumeAccessMode) string {
+	s := ""
+	for i, mode := range modes {
+		if i > 0 {
+			s += ","
+		}
+		s += string(mode)
+	}
+	return s
+}
+
+func querier(t *testing.T, m dbmanager.DBManager) dbmanager.Querier {
+	q, ok := m.(dbmanager.Querier)
+	if !ok {
+		t.Fatal("Backend doesn't implement dbmanager.Querier")
+	}
+	return q
+}
+
+func findPV(t *testing.T, q dbmanager.Querier, uid types.UID,
+) dbmanager.PVRecord {
+	pvs, err := q.ListPVs()
+	if err != nil {
+		t.Fatal("Unable to list PVs:  ", err)
+	}
+	for _, pv := range pvs {
+		if pv.UID == uid {
+			return pv
+		}
+	}
+	t.Fatalf("PV %s not recorded", uid)
+	return dbmanager.PVRecord{}
+}
+
+func findPVC(t *testing.T, q dbmanager.Querier, uid types.UID,
+) dbmanager.PVCRecord {
+	pvcs, err := q.ListPVCs()
+	if err != nil {
+		t.Fatal("Unable to list PVCs:  ", err)
+	}
+	for _, pvc := range pvcs {
+		if pvc.UID == uid {
+			return pvc
+		}
+	}
+	t.Fatalf("PVC %s not recorded", uid)
+	return dbmanager.PVCRecord{}
+}
+
+type mountsByContainer []dbmanager.PodMountRecord
+
+func (m mountsByContainer) Len() int      { return len(m) }
+func (m mountsByContainer) Swap(i, j int) { m[i], m[j] = m[j], m[i] }
+func (m mountsByContainer) Less(i, j int) bool {
+	if m[i].ContainerName != m[j].ContainerName {
+		return m[i].ContainerName < m[j].ContainerName
+	}
+	return m[i].PVCName < m[j].PVCName
+}
+
+// podMounts returns the mounts recorded for a pod, sorted by container and
+// PVC name.
+func podMounts(t *testing.T, q dbmanager.Querier, uid types.UID,
+) []dbmanager.PodMountRecord {
+	mounts, err := q.ListPodMounts()
+	if err != nil {
+		t.Fatal("Unable to list pod mounts:  ", err)
+	}
+	var ret []dbmanager.PodMountRecord
+	for _, mount := range mounts {
+		if mount.PodUID == uid {
+			ret = append(ret, mount)
+		}
+	}
+	sort.Sort(mountsByContainer(ret))
+	return ret
+}
+
+// singleMount returns the only mount recorded for a pod.
+func singleMount(t *testing.T, q dbmanager.Querier, uid types.UID,
+) dbmanager.PodMountRecord {
+	mounts := podMounts(t, q, uid)
+	if len(mounts) != 1 {
+		t.Fatalf("Expected one mount for pod %s; got %d:  %v", uid,
+			len(mounts), mounts)
+	}
+	return mounts[0]
+}
+
+func mountContainer(name string, mounts ...resources.VolumeMount,
+) resources.ContainerDesc {
+	return resources.ContainerDesc{
+		Name:      name,
+		Image:     "busybox",
+		Command:   "/bin/sh",
+		PVCMounts: mounts,
+	}
+}
+
+func insertPVC(m dbmanager.DBManager, uid types.UID, name string,
+	createTime unversioned.Time, rv string) {
+
+	m.InsertPVC(uid, name, createTime, namespace, pvcStorage, pvcModes,
+		pvcJSON, WatcherNamespace, rv)
+}
+
+func insertPod(m dbmanager.DBManager, uid types.UID, name string,
+	createTime unversioned.Time, rv string,
+	containers ...resources.ContainerDesc) {
+
+	m.InsertPod(uid, name, createTime, namespace, containers, podJSON,
+		WatcherNamespace, rv)
+}
+
+func checkInsert(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	nfsID := m.InsertNFS(nfsServer, nfsPath)
+	if id := m.InsertNFS(nfsServer, nfsPath); id != nfsID {
+		t.Errorf("Duplicate NFS source got ID %d; expected %d", id, nfsID)
+	}
+	if id := m.InsertNFS(nfsServer2, nfsPath); id == nfsID {
+		t.Error("Distinct NFS sources got the same ID.")
+	}
+	iscsiID := m.InsertISCSI(iscsiPortal, iscsiIQN, iscsiLUN, iscsiFSType)
+	if id := m.InsertISCSI(iscsiPortal, iscsiIQN, iscsiLUN,
+		iscsiFSType); id != iscsiID {
+		t.Errorf("Duplicate ISCSI source got ID %d; expected %d", id,
+			iscsiID)
+	}
+	if id := m.InsertISCSI(iscsiPortal, iscsiIQN, iscsiLUN+1,
+		iscsiFSType); id == iscsiID {
+		t.Error("Distinct ISCSI sources got the same ID.")
+	}
+
+	m.InsertPV(pvUID, pvName, at(base, 0), nfsID, dbmanager.NFS, pvStorage,
+		pvModes, pvJSON, "100")
+	m.InsertPV(pvUID2, pvName2, at(base, 0), iscsiID, dbmanager.ISCSI,
+		pvStorage, pvModes, pvJSON, "101")
+	insertPVC(m, pvcUID, pvcName, at(base, 1), "200")
+	insertPod(m, podUID, podName, at(base, 2), "300",
+		mountContainer("container-b"), mountContainer("container-a"))
+
+	pv := findPV(t, q, pvUID)
+	if pv.Name != pvName || pv.Storage != pvStorage || pv.JSON != pvJSON ||
+		pv.AccessModes != accessModeString(pvModes) {
+		t.Errorf("Incorrect attributes for PV:  %+v", pv)
+	}
+	if !pv.CreateTime.Equal(at(base, 0).Time) || !pv.DeleteTime.IsZero() {
+		t.Errorf("Incorrect times for PV:  %s, %s", pv.CreateTime,
+			pv.DeleteTime)
+	}
+	if pv.BackendType != dbmanager.NFS || pv.BackendID != nfsID {
+		t.Errorf("Incorrect backend for PV; expected %s %d, got %s %d",
+			dbmanager.NFS, nfsID, pv.BackendType, pv.BackendID)
+	}
+	pv = findPV(t, q, pvUID2)
+	if pv.BackendType != dbmanager.ISCSI || pv.BackendID != iscsiID {
+		t.Errorf("Incorrect backend for PV; expected %s %d, got %s %d",
+			dbmanager.ISCSI, iscsiID, pv.BackendType, pv.BackendID)
+	}
+
+	pvc := findPVC(t, q, pvcUID)
+	if pvc.Name != pvcName || pvc.Namespace != namespace ||
+		pvc.Storage != pvcStorage || pvc.JSON != pvcJSON ||
+		pvc.AccessModes != accessModeString(pvcModes) {
+		t.Errorf("Incorrect attributes for PVC:  %+v", pvc)
+	}
+	if !pvc.CreateTime.Equal(at(base, 1).Time) || !pvc.BindTime.IsZero() ||
+		!pvc.DeleteTime.IsZero() || pvc.PVUID != "" {
+		t.Errorf("Unbound PVC has unexpected times or binding:  %+v", pvc)
+	}
+
+	containers, err := q.ListContainers()
+	if err != nil {
+		t.Fatal("Unable to list containers:  ", err)
+	}
+	var names []string
+	for _, c := range containers {
+		if c.PodUID != podUID {
+			continue
+		}
+		if c.Image != "busybox" || c.Command != "/bin/sh" {
+			t.Errorf("Incorrect attributes for container:  %+v", c)
+		}
+		names = append(names, c.Name)
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "container-a" ||
+		names[1] != "container-b" {
+		t.Errorf("Expected containers container-a and container-b; got %v",
+			names)
+	}
+
+	nfs, err := q.ListNFS()
+	if err != nil {
+		t.Fatal("Unable to list NFS sources:  ", err)
+	}
+	found := false
+	for _, n := range nfs {
+		if n.ID == nfsID {
+			found = true
+			if n.Server != nfsServer || n.Path != nfsPath {
+				t.Errorf("Incorrect NFS source:  %+v", n)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("NFS source %d not recorded", nfsID)
+	}
+	iscsi, err := q.ListISCSI()
+	if err != nil {
+		t.Fatal("Unable to list ISCSI sources:  ", err)
+	}
+	found = false
+	for _, i := range iscsi {
+		if i.ID == iscsiID {
+			found = true
+			if i.TargetPortal != iscsiPortal || i.IQN != iscsiIQN ||
+				i.LUN != iscsiLUN || i.FSType != iscsiFSType {
+				t.Errorf("Incorrect ISCSI source:  %+v", i)
+			}
+		}
+	}
+	if !found {
+		t.Errorf("ISCSI source %d not recorded", iscsiID)
+	}
+}
+
+// Relists deliver objects that have already been inserted as new, so a
+// second insert of a pod or PV is ignored rather than applied or fatal.
+func checkDuplicateInsert(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	nfsID := m.InsertNFS(nfsServer, nfsPath)
+	m.InsertPV(pvUID, pvName, at(base, 0), nfsID, dbmanager.NFS, pvStorage,
+		pvModes, pvJSON, "100")
+	m.InsertPV(pvUID, pvName2, at(base, 1), nfsID, dbmanager.NFS,
+		updateAmount, updateModes, updateJSON, "101")
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "200")
+	insertPod(m, podUID, podName, at(base, 1), "300",
+		mountContainer("container", resources.VolumeMount{Name: pvcName}))
+	insertPod(m, podUID, podName2, at(base, 2), "301",
+		mountContainer("container", resources.VolumeMount{Name: pvcName}),
+		mountContainer("container2", resources.VolumeMount{Name: pvcName}))
+
+	pv := findPV(t, q, pvUID)
+	if pv.Name != pvName || !pv.CreateTime.Equal(at(base, 0).Time) ||
+		pv.Storage != pvStorage || pv.JSON != pvJSON {
+		t.Errorf("Duplicate insert altered PV:  %+v", pv)
+	}
+	mount := singleMount(t, q, podUID)
+	if mount.PodName != podName ||
+		!mount.PodCreateTime.Equal(at(base, 1).Time) ||
+		mount.PVCUID != pvcUID {
+		t.Errorf("Duplicate insert altered pod:  %+v", mount)
+	}
+	containers, err := q.ListContainers()
+	if err != nil {
+		t.Fatal("Unable to list containers:  ", err)
+	}
+	n := 0
+	for _, c := range containers {
+		if c.PodUID == podUID {
+			n++
+		}
+	}
+	if n != 1 {
+		t.Errorf("Expected one container for pod %s; got %d", podUID, n)
+	}
+}
+
+// Binds are reported through the PV watch, so they can be processed before
+// the PVC's creation event.  The partial record must survive the insert.
+func checkBindBeforeInsert(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	m.BindPVC(pvUID, pvcUID, at(base, 2), dbmanager.TimeObserved, "100")
+	pvc := findPVC(t, q, pvcUID)
+	if pvc.PVUID != pvUID || !pvc.BindTime.Equal(at(base, 2).Time) {
+		t.Errorf("Incorrect binding before insert:  %+v", pvc)
+	}
+
+	insertPVC(m, pvcUID, pvcName, at(base, 1), "200")
+	pvc = findPVC(t, q, pvcUID)
+	if pvc.PVUID != pvUID || !pvc.BindTime.Equal(at(base, 2).Time) {
+		t.Errorf("Binding lost on insert:  %+v", pvc)
+	}
+	if pvc.Name != pvcName || pvc.Namespace != namespace ||
+		pvc.Storage != pvcStorage || !pvc.CreateTime.Equal(at(base, 1).Time) {
+		t.Errorf("Incorrect attributes after insert:  %+v", pvc)
+	}
+}
+
+func checkBindAfterInsert(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "200")
+	m.BindPVC(pvUID, pvcUID, at(base, 1), dbmanager.TimeObserved, "100")
+	pvc := findPVC(t, q, pvcUID)
+	if pvc.PVUID != pvUID || !pvc.BindTime.Equal(at(base, 1).Time) {
+		t.Errorf("Incorrect binding:  %+v", pvc)
+	}
+	if pvc.Name != pvcName || !pvc.CreateTime.Equal(at(base, 0).Time) {
+		t.Errorf("Bind altered PVC attributes:  %+v", pvc)
+	}
+}
+
+// A mount resolves to the most recently created PVC with the given name
+// that existed when the pod was created.
+func checkPodMount(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "200")
+	m.DeletePVC(pvcUID, at(base, 1), dbmanager.TimeExact,
+		WatcherNamespace, "201")
+	insertPVC(m, pvcUID2, pvcName, at(base, 2), "202")
+	insertPVC(m, pvcUID3, pvcName2, at(base, 2), "203")
+	insertPod(m, podUID, podName, at(base, 3), "300",
+		mountContainer("container",
+			resources.VolumeMount{Name: pvcName, ReadOnly: true},
+			resources.VolumeMount{Name: pvcName2}))
+
+	mounts := podMounts(t, q, podUID)
+	if len(mounts) != 2 {
+		t.Fatalf("Expected two mounts; got %v", mounts)
+	}
+	if mounts[0].PVCName != pvcName || mounts[0].PVCUID != pvcUID2 ||
+		!mounts[0].ReadOnly {
+		t.Errorf("Expected read-only mount of PVC %s; got %+v", pvcUID2,
+			mounts[0])
+	}
+	if mounts[1].PVCName != pvcName2 || mounts[1].PVCUID != pvcUID3 ||
+		mounts[1].ReadOnly {
+		t.Errorf("Expected read-write mount of PVC %s; got %+v", pvcUID3,
+			mounts[1])
+	}
+	for _, mount := range mounts {
+		if mount.ContainerName != "container" || mount.PodName != podName ||
+			mount.Namespace != namespace ||
+			!mount.PodCreateTime.Equal(at(base, 3).Time) ||
+			!mount.PodDeleteTime.IsZero() {
+			t.Errorf("Incorrect pod attributes for mount:  %+v", mount)
+		}
+	}
+}
+
+// A mount of a PVC that hasn't been seen yet is recorded by name and
+// resolved once the PVC is inserted.  A pod deleted before the PVC was
+// created never started, so its mounts are discarded, just as when the PVC
+// is seen first (see checkDeletedPodMount).
+func checkLatePVCPodMount(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	insertPod(m, podUID, podName, at(base, 0), "300",
+		mountContainer("container", resources.VolumeMount{Name: pvcName}))
+	insertPod(m, podUID2, podName2, at(base, 0), "301",
+		mountContainer("container", resources.VolumeMount{Name: pvcName2}))
+	mount := singleMount(t, q, podUID)
+	if mount.PVCName != pvcName || mount.PVCUID != "" {
+		t.Errorf("Expected unresolved mount of %s; got %+v", pvcName, mount)
+	}
+
+	m.DeletePod(podUID2, at(base, 1), dbmanager.TimeExact,
+		WatcherNamespace, "302")
+	insertPVC(m, pvcUID, pvcName, at(base, 1), "200")
+	insertPVC(m, pvcUID2, pvcName2, at(base, 2), "201")
+
+	mount = singleMount(t, q, podUID)
+	if mount.PVCUID != pvcUID {
+		t.Errorf("Expected mount to resolve to %s; got %+v", pvcUID, mount)
+	}
+	if mounts := podMounts(t, q, podUID2); len(mounts) != 0 {
+		t.Errorf("Expected no mounts for unstarted pod; got %v", mounts)
+	}
+}
+
+// A PVC created shortly after a pod may be processed before it; the mount
+// then resolves to the earliest such PVC.
+func checkPVCSeenBeforePod(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	insertPVC(m, pvcUID2, pvcName, at(base, 2), "200")
+	insertPVC(m, pvcUID, pvcName, at(base, 1), "201")
+	insertPod(m, podUID, podName, at(base, 0), "300",
+		mountContainer("container", resources.VolumeMount{Name: pvcName}))
+
+	mount := singleMount(t, q, podUID)
+	if mount.PVCUID != pvcUID {
+		t.Errorf("Expected mount to resolve to %s; got %+v", pvcUID, mount)
+	}
+}
+
+// A pod deleted before the PVC it mounts was created never started, so its
+// mounts are discarded.
+func checkDeletedPodMount(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	insertPod(m, podUID, podName, at(base, 0), "300",
+		mountContainer("container", resources.VolumeMount{Name: pvcName}))
+	insertPVC(m, pvcUID, pvcName, at(base, 2), "200")
+	m.DeletePod(podUID, at(base, 1), dbmanager.TimeExact,
+		WatcherNamespace, "301")
+
+	if mounts := podMounts(t, q, podUID); len(mounts) != 0 {
+		t.Errorf("Expected no mounts for unstarted pod; got %v", mounts)
+	}
+}
+
+// Mounts only resolve to PVCs in the pod's namespace, however the PVCs of
+// other namespaces are named, created, or deleted.
+func checkPodMountNamespace(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	m.InsertPod(podUID2, podName2, at(base, 0), altNamespace,
+		[]resources.ContainerDesc{mountContainer("container",
+			resources.VolumeMount{Name: pvcName})}, podJSON,
+		WatcherNamespace, "300")
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "200")
+	if mount := singleMount(t, q, podUID2); mount.PVCUID != "" {
+		t.Errorf("Mount resolved to PVC %s in another namespace",
+			mount.PVCUID)
+	}
+
+	m.InsertPVC(pvcUID2, pvcName, at(base, 1), altNamespace, pvcStorage,
+		pvcModes, pvcJSON, WatcherNamespace, "201")
+	insertPod(m, podUID, podName, at(base, 2), "301",
+		mountContainer("container", resources.VolumeMount{Name: pvcName}))
+	m.DeletePVC(pvcUID2, at(base, 3), dbmanager.TimeExact,
+		WatcherNamespace, "202")
+
+	if mount := singleMount(t, q, podUID); mount.PVCUID != pvcUID {
+		t.Errorf("Expected mount to resolve to %s; got %+v", pvcUID, mount)
+	}
+	if mount := singleMount(t, q, podUID2); mount.PVCUID != pvcUID2 {
+		t.Errorf("Expected mount to resolve to %s; got %+v", pvcUID2,
+			mount)
+	}
+}
+
+func checkDelete(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	nfsID := m.InsertNFS(nfsServer, nfsPath)
+	m.InsertPV(pvUID, pvName, at(base, 0), nfsID, dbmanager.NFS, pvStorage,
+		pvModes, pvJSON, "100")
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "200")
+	m.BindPVC(pvUID, pvcUID, at(base, 1), dbmanager.TimeObserved, "101")
+	insertPod(m, podUID, podName, at(base, 2), "300",
+		mountContainer("container", resources.VolumeMount{Name: pvcName}))
+
+	m.DeletePod(podUID, at(base, 3), dbmanager.TimeExact,
+		WatcherNamespace, "301")
+	m.DeletePVC(pvcUID, at(base, 4), dbmanager.TimeExact,
+		WatcherNamespace, "201")
+	m.DeletePV(pvUID, at(base, 5), dbmanager.TimeExact, "102")
+
+	mount := singleMount(t, q, podUID)
+	if mount.PVCUID != pvcUID ||
+		!mount.PodDeleteTime.Equal(at(base, 3).Time) {
+		t.Errorf("Incorrect mount for deleted pod:  %+v", mount)
+	}
+	pvc := findPVC(t, q, pvcUID)
+	if !pvc.DeleteTime.Equal(at(base, 4).Time) || pvc.PVUID != pvUID {
+		t.Errorf("Incorrect record for deleted PVC:  %+v", pvc)
+	}
+	pv := findPV(t, q, pvUID)
+	if !pv.DeleteTime.Equal(at(base, 5).Time) || pv.Name != pvName {
+		t.Errorf("Incorrect record for deleted PV:  %+v", pv)
+	}
+}
+
+func checkTimeSources(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	nfsID := m.InsertNFS(nfsServer, nfsPath)
+	m.InsertPV(pvUID, pvName, at(base, 0), nfsID, dbmanager.NFS, pvStorage,
+		pvModes, pvJSON, "100")
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "200")
+	m.BindPVC(pvUID, pvcUID, at(base, 1), dbmanager.TimeInferred, "101")
+	insertPod(m, podUID, podName, at(base, 2), "300",
+		mountContainer("container", resources.VolumeMount{Name: pvcName}))
+
+	pvc := findPVC(t, q, pvcUID)
+	if pvc.BindTimeSource != dbmanager.TimeInferred ||
+		pvc.DeleteTimeSource != dbmanager.TimeUnknown {
+		t.Errorf("Incorrect time sources for bound PVC:  %+v", pvc)
+	}
+
+	m.DeletePod(podUID, at(base, 3), dbmanager.TimeExact,
+		WatcherNamespace, "301")
+	m.DeletePVC(pvcUID, at(base, 4), dbmanager.TimeObserved,
+		WatcherNamespace, "201")
+	m.DeletePV(pvUID, at(base, 5), dbmanager.TimeInferred, "102")
+
+	mount := singleMount(t, q, podUID)
+	if mount.PodDeleteTimeSource != dbmanager.TimeExact {
+		t.Errorf("Incorrect time source for deleted pod:  %+v", mount)
+	}
+	pvc = findPVC(t, q, pvcUID)
+	if pvc.BindTimeSource != dbmanager.TimeInferred ||
+		pvc.DeleteTimeSource != dbmanager.TimeObserved {
+		t.Errorf("Incorrect time sources for deleted PVC:  %+v", pvc)
+	}
+	pv := findPV(t, q, pvUID)
+	if pv.DeleteTimeSource != dbmanager.TimeInferred {
+		t.Errorf("Incorrect time source for deleted PV:  %+v", pv)
+	}
+}
+
+func checkUpdate(t *testing.T, m dbmanager.DBManager) {
+	q := querier(t, m)
+	base := newBase()
+
+	nfsID := m.InsertNFS(nfsServer, nfsPath)
+	iscsiID := m.InsertISCSI(iscsiPortal, iscsiIQN, iscsiLUN, iscsiFSType)
+	m.InsertPV(pvUID, pvName, at(base, 0), nfsID, dbmanager.NFS, pvStorage,
+		pvModes, pvJSON, "100")
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "200")
+	m.BindPVC(pvUID, pvcUID, at(base, 1), dbmanager.TimeObserved, "101")
+
+	m.UpdatePV(pvUID, iscsiID, dbmanager.ISCSI, updateAmount, updateModes,
+		updateJSON, "102")
+	m.UpdatePVC(pvcUID, updateAmount, updateModes, updateJSON,
+		WatcherNamespace, "201")
+
+	pv := findPV(t, q, pvUID)
+	if pv.BackendType != dbmanager.ISCSI || pv.BackendID != iscsiID ||
+		pv.Storage != updateAmount || pv.JSON != updateJSON ||
+		pv.AccessModes != accessModeString(updateModes) {
+		t.Errorf("Incorrect attributes for updated PV:  %+v", pv)
+	}
+	if pv.Name != pvName || !pv.CreateTime.Equal(at(base, 0).Time) {
+		t.Errorf("Update altered PV identity:  %+v", pv)
+	}
+	pvc := findPVC(t, q, pvcUID)
+	if pvc.Storage != updateAmount || pvc.JSON != updateJSON ||
+		pvc.AccessModes != accessModeString(updateModes) {
+		t.Errorf("Incorrect attributes for updated PVC:  %+v", pvc)
+	}
+	if pvc.Name != pvcName || pvc.PVUID != pvUID ||
+		!pvc.BindTime.Equal(at(base, 1).Time) {
+		t.Errorf("Update altered PVC identity or binding:  %+v", pvc)
+	}
+}
+
+// Every write records the resource version of the event that caused it, so
+// that watches can resume.  PV events, including binds, are tracked under
+// resources.PVNamespace; the others under the watcher's namespace.
+func checkResourceVersion(t *testing.T, m dbmanager.DBManager) {
+	base := newBase()
+	expectRV := func(resource resources.ResourceType, ns, rv string) {
+		if got := m.GetRV(resource, ns); got != rv {
+			t.Errorf("Expected RV %s for %s in namespace %s; got %s", rv,
+				resource, ns, got)
+		}
+	}
+
+	m.InsertPod(podUID2, podName2, at(base, 0), namespace, nil, podJSON,
+		WatcherNamespaceAlt, "50")
+	insertPod(m, podUID, podName, at(base, 0), "60")
+	expectRV(resources.Pods, WatcherNamespace, "60")
+	expectRV(resources.Pods, WatcherNamespaceAlt, "50")
+	m.DeletePod(podUID, at(base, 1), dbmanager.TimeExact,
+		WatcherNamespace, "61")
+	expectRV(resources.Pods, WatcherNamespace, "61")
+	expectRV(resources.Pods, WatcherNamespaceAlt, "50")
+
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "70")
+	expectRV(resources.PVCs, WatcherNamespace, "70")
+	m.UpdatePVC(pvcUID, updateAmount, updateModes, updateJSON,
+		WatcherNamespace, "71")
+	expectRV(resources.PVCs, WatcherNamespace, "71")
+	m.DeletePVC(pvcUID, at(base, 1), dbmanager.TimeExact,
+		WatcherNamespace, "72")
+	expectRV(resources.PVCs, WatcherNamespace, "72")
+	expectRV(resources.Pods, WatcherNamespace, "61")
+
+	nfsID := m.InsertNFS(nfsServer, nfsPath)
+	m.InsertPV(pvUID, pvName, at(base, 0), nfsID, dbmanager.NFS, pvStorage,
+		pvModes, pvJSON, "80")
+	expectRV(resources.PVs, resources.PVNamespace, "80")
+	m.UpdatePV(pvUID, nfsID, dbmanager.NFS, updateAmount, pvModes, pvJSON,
+		"81")
+	expectRV(resources.PVs, resources.PVNamespace, "81")
+	m.BindPVC(pvUID, pvcUID, at(base, 1), dbmanager.TimeObserved, "82")
+	expectRV(resources.PVs, resources.PVNamespace, "82")
+	m.DeletePV(pvUID, at(base, 2), dbmanager.TimeExact, "83")
+	expectRV(resources.PVs, resources.PVNamespace, "83")
+	expectRV(resources.PVCs, WatcherNamespace, "72")
+}
+
+// Writes also record the last resource version applied to each object, and
+// neither kind of resource version ever moves backwards, so that stale and
+// duplicate events can be recognized.  Binds are tracked under the PV.
+func checkObjectResourceVersion(t *testing.T, m dbmanager.DBManager) {
+	base := newBase()
+	expectObjectRV := func(uid types.UID, rv string) {
+		if got := m.ObjectRV(uid); got != rv {
+			t.Errorf("Expected RV %s for %s; got %s", rv, uid, got)
+		}
+	}
+
+	expectObjectRV(podUID, "")
+	insertPod(m, podUID, podName, at(base, 0), "60")
+	insertPod(m, podUID2, podName2, at(base, 0), "59")
+	expectObjectRV(podUID, "60")
+	expectObjectRV(podUID2, "59")
+	if rv := m.GetRV(resources.Pods, WatcherNamespace); rv != "60" {
+		t.Errorf("Expected RV 60 to survive an older event; got %s", rv)
+	}
+	m.DeletePod(podUID, at(base, 1), dbmanager.TimeExact,
+		WatcherNamespace, "61")
+	expectObjectRV(podUID, "61")
+	m.DeletePod(podUID2, at(base, 1), dbmanager.TimeExact,
+		WatcherNamespace, "9")
+	expectObjectRV(podUID2, "59")
+	if rv := m.GetRV(resources.Pods, WatcherNamespace); rv != "61" {
+		t.Errorf("Expected RV 61 to survive an older event; got %s", rv)
+	}
+
+	nfsID := m.InsertNFS(nfsServer, nfsPath)
+	m.InsertPV(pvUID, pvName, at(base, 0), nfsID, dbmanager.NFS, pvStorage,
+		pvModes, pvJSON, "80")
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "79")
+	m.BindPVC(pvUID, pvcUID, at(base, 1), dbmanager.TimeObserved, "100")
+	expectObjectRV(pvUID, "100")
+	expectObjectRV(pvcUID, "79")
+	m.UpdatePV(pvUID, nfsID, dbmanager.NFS, updateAmount, pvModes, pvJSON,
+		"100")
+	expectObjectRV(pvUID, "100")
+	if rv := m.GetRV(resources.PVs, resources.PVNamespace); rv != "100" {
+		t.Errorf("Expected RV 100 for PVs; got %s", rv)
+	}
+}
+
+func revisionStore(t *testing.T,
+	m dbmanager.DBManager) dbmanager.RevisionStore {
+
+	rs, ok := m.(dbmanager.RevisionStore)
+	if !ok {
+		t.Fatal("Backend doesn't implement dbmanager.RevisionStore")
+	}
+	// Backends may be shared between checks, so reset the policy.
+	rs.SetRevisionRetention(dbmanager.RevisionRetention{})
+	return rs
+}
+
+func revision(uid types.UID, rv string, eventType string,
+	eventTime time.Time, json string) dbmanager.RevisionRecord {
+
+	return dbmanager.RevisionRecord{
+		UID:             uid,
+		ResourceVersion: rv,
+		Resource:        resources.Pods,
+		EventType:       eventType,
+		EventTime:       eventTime,
+		JSON:            json,
+	}
+}
+
+func recordRevision(t *testing.T, rs dbmanager.RevisionStore,
+	r dbmanager.RevisionRecord) {
+
+	if err := rs.RecordRevision(r); err != nil {
+		t.Fatalf("Unable to record revision %s of %s:  %s",
+			r.ResourceVersion, r.UID, err)
+	}
+}
+
+// revisionRVs returns the resource versions of the stored revisions of an
+// object, in the order they were recorded.
+func revisionRVs(t *testing.T, rs dbmanager.RevisionStore,
+	uid types.UID) []string {
+
+	revs, err := rs.ListRevisions(uid)
+	if err != nil {
+		t.Fatalf("Unable to list revisions of %s:  %s", uid, err)
+	}
+	rvs := make([]string, len(revs))
+	for i, r := range revs {
+		rvs[i] = r.ResourceVersion
+	}
+	return rvs
+}
+
+func expectRVs(t *testing.T, rs dbmanager.RevisionStore, uid types.UID,
+	expected ...string) {
+
+	got := revisionRVs(t, rs, uid)
+	if strings.Join(got, ",") != strings.Join(expected, ",") {
+		t.Errorf("Expected revisions %v of %s; got %v", expected, uid, got)
+	}
+}
+
+func checkRevisions(t *testing.T, m dbmanager.DBManager) {
+	rs := revisionStore(t, m)
+	base := newBase()
+
+	// Bodies larger than a MySQL TEXT column must survive.
+	large := `{"data":"` + strings.Repeat("x", 100*1024) + `"}`
+	recordRevision(t, rs, revision(podUID, "10", "ADDED", base, podJSON))
+	recordRevision(t, rs, revision(podUID, "12", "MODIFIED",
+		base.Add(time.Second), large))
+	recordRevision(t, rs, revision(podUID2, "11", "ADDED", base, podJSON))
+	recordRevision(t, rs, revision(podUID, "13", "DELETED",
+		base.Add(2*time.Second), updateJSON))
+
+	r, err := rs.GetRevision(podUID, "12")
+	if err != nil {
+		t.Fatal("Unable to get revision:  ", err)
+	}
+	if r.UID != podUID || r.ResourceVersion != "12" ||
+		r.Resource != resources.Pods || r.EventType != "MODIFIED" ||
+		!r.EventTime.Equal(base.Add(time.Second)) {
+		t.Errorf("Incorrect attributes for revision:  %s %s %s %s %s", r.UID,
+			r.ResourceVersion, r.Resource, r.EventType, r.EventTime)
+	}
+	if r.JSON != large {
+		t.Errorf("Large revision body corrupted; got %d bytes, expected %d",
+			len(r.JSON), len(large))
+	}
+	if _, err = rs.GetRevision(podUID, "11"); err != dbmanager.ErrNoRevision {
+		t.Errorf("Expected ErrNoRevision for another object's RV; got %v",
+			err)
+	}
+	expectRVs(t, rs, podUID, "10", "12", "13")
+	expectRVs(t, rs, podUID2, "11")
+
+	// Recording a revision again replaces it in place.
+	recordRevision(t, rs, revision(podUID, "12", "MODIFIED",
+		base.Add(time.Second), pvJSON))
+	expectRVs(t, rs, podUID, "10", "12", "13")
+	if r, err = rs.GetRevision(podUID, "12"); err != nil ||
+		r.JSON != pvJSON {
+		t.Errorf("Revision not replaced:  %q, %v", r.JSON, err)
+	}
+}
+
+func checkRevisionRetention(t *testing.T, m dbmanager.DBManager) {
+	rs := revisionStore(t, m)
+	now := time.Now().Truncate(time.Second)
+
+	rs.SetRevisionRetention(dbmanager.RevisionRetention{MaxPerObject: 2})
+	for _, rv := range []string{"10", "11", "12", "13"} {
+		recordRevision(t, rs, revision(podUID, rv, "MODIFIED", now, podJSON))
+	}
+	recordRevision(t, rs, revision(podUID2, "20", "ADDED", now, podJSON))
+	expectRVs(t, rs, podUID, "12", "13")
+	expectRVs(t, rs, podUID2, "20")
+	if _, err := rs.GetRevision(podUID, "10"); err != dbmanager.ErrNoRevision {
+		t.Errorf("Expected ErrNoRevision for pruned revision; got %v", err)
+	}
+
+	// The latest revision is kept regardless of its age.
+	rs.SetRevisionRetention(dbmanager.RevisionRetention{MaxAge: time.Hour})
+	recordRevision(t, rs, revision(podUID3, "14", "MODIFIED",
+		now.Add(-3*time.Hour), podJSON))
+	expectRVs(t, rs, podUID3, "14")
+	recordRevision(t, rs, revision(podUID3, "15", "MODIFIED",
+		now.Add(-30*time.Minute), podJSON))
+	recordRevision(t, rs, revision(podUID3, "16", "DELETED", now, podJSON))
+	expectRVs(t, rs, podUID3, "15", "16")
+}
+
+func eventLog(t *testing.T, m dbmanager.DBManager) dbmanager.EventLog {
+	el, ok := m.(dbmanager.EventLog)
+	if !ok {
+		t.Fatal("Backend doesn't implement dbmanager.EventLog")
+	}
+	return el
+}
+
+func appendEvent(t *testing.T, el dbmanager.EventLog,
+	e dbmanager.EventRecord) {
+
+	if err := el.AppendEvent(e); err != nil {
+		t.Fatal("Unable to append event:  ", err)
+	}
+}
+
+// loggedEvents pages through the entire log, pageSize events at a time,
+// returning the events appended by the suite.
+func loggedEvents(t *testing.T, el dbmanager.EventLog,
+	pageSize int) []dbmanager.EventRecord {
+
+	var (
+		ret   []dbmanager.EventRecord
+		after int64
+	)
+
+	for {
+		events, err := el.ListEvents(after, pageSize)
+		if err != nil {
+			t.Fatal("Unable to list events:  ", err)
+		}
+		if len(events) > pageSize {
+			t.Fatalf("Asked for %d events; got %d", pageSize, len(events))
+		}
+		if len(events) == 0 {
+			return ret
+		}
+		for _, e := range events {
+			if e.ID <= after {
+				t.Fatalf("Event IDs out of order:  %d after %d", e.ID,
+					after)
+			}
+			after = e.ID
+			if e.Namespace == WatcherNamespace ||
+				e.Namespace == WatcherNamespaceAlt {
+				ret = append(ret, e)
+			}
+		}
+	}
+}
+
+func checkEventLog(t *testing.T, m dbmanager.DBManager) {
+	el := eventLog(t, m)
+	base := newBase()
+
+	appended := []dbmanager.EventRecord{
+		{Time: base, Resource: resources.Pods, Namespace: WatcherNamespace,
+			UID: podUID, JSON: podJSON},
+		{Time: base, Resource: resources.PVCs,
+			Namespace: WatcherNamespaceAlt, UID: pvcUID, JSON: pvcJSON,
+			Resync: true},
+		{Time: base.Add(time.Second), Resource: resources.Pods,
+			Namespace: WatcherNamespace, UID: podUID, JSON: updateJSON},
+	}
+	for _, e := range appended {
+		// The ID is assigned by the backend.
+		e.ID = 1000
+		appendEvent(t, el, e)
+	}
+
+	got := loggedEvents(t, el, 2)
+	if len(got) != len(appended) {
+		t.Fatalf("Expected %d logged events; got %d:  %v", len(appended),
+			len(got), got)
+	}
+	for i, e := range got {
+		expected := appended[i]
+		if !e.Time.Equal(expected.Time) || e.Resource != expected.Resource ||
+			e.Namespace != expected.Namespace || e.UID != expected.UID ||
+			e.JSON != expected.JSON || e.Resync != expected.Resync {
+			t.Errorf("Event %d logged incorrectly; expected %v, got %v", i,
+				expected, e)
+		}
+	}
+	events, err := el.ListEvents(got[0].ID, 1)
+	if err != nil || len(events) != 1 || events[0].ID != got[1].ID {
+		t.Errorf("Expected event %d after event %d; got %v, %v", got[1].ID,
+			got[0].ID, events, err)
+	}
+}
+
+func checkClearDerived(t *testing.T, m dbmanager.DBManager) {
+	el := eventLog(t, m)
+	q := querier(t, m)
+	base := newBase()
+
+	nfsID := m.InsertNFS(nfsServer, nfsPath)
+	m.InsertPV(pvUID, pvName, at(base, 0), nfsID, dbmanager.NFS, pvStorage,
+		pvModes, pvJSON, "80")
+	m.InsertISCSI(iscsiPortal, iscsiIQN, iscsiLUN, iscsiFSType)
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "81")
+	m.BindPVC(pvUID, pvcUID, at(base, 1), dbmanager.TimeObserved, "82")
+	insertPod(m, podUID, podName, at(base, 2), "83", mountContainer("c1",
+		resources.VolumeMount{Name: pvcName}))
+	appendEvent(t, el, dbmanager.EventRecord{Time: base,
+		Resource: resources.Pods, Namespace: WatcherNamespace,
+		JSON: podJSON})
+
+	if err := el.ClearDerived(); err != nil {
+		t.Fatal("Unable to clear derived tables:  ", err)
+	}
+	pvs, err := q.ListPVs()
+	if err != nil || len(pvs) != 0 {
+		t.Errorf("Expected no PVs; got %v, %v", pvs, err)
+	}
+	pvcs, err := q.ListPVCs()
+	if err != nil || len(pvcs) != 0 {
+		t.Errorf("Expected no PVCs; got %v, %v", pvcs, err)
+	}
+	mounts, err := q.ListPodMounts()
+	if err != nil || len(mounts) != 0 {
+		t.Errorf("Expected no pod mounts; got %v, %v", mounts, err)
+	}
+	containers, err := q.ListContainers()
+	if err != nil || len(containers) != 0 {
+		t.Errorf("Expected no containers; got %v, %v", containers, err)
+	}
+	nfs, err := q.ListNFS()
+	if err != nil || len(nfs) != 0 {
+		t.Errorf("Expected no NFS sources; got %v, %v", nfs, err)
+	}
+	iscsi, err := q.ListISCSI()
+	if err != nil || len(iscsi) != 0 {
+		t.Errorf("Expected no ISCSI sources; got %v, %v", iscsi, err)
+	}
+
+	// Everything that isn't derived from the log survives.
+	if rv := m.GetRV(resources.Pods, WatcherNamespace); rv != "83" {
+		t.Errorf("Expected RV 83 to survive; got %s", rv)
+	}
+	if events := loggedEvents(t, el, 10); len(events) != 1 {
+		t.Errorf("Expected the logged event to survive; got %v", events)
+	}
+	// The object RVs describe the derived tables, so they go with them.
+	if rv := m.ObjectRV(podUID); rv != "" {
+		t.Errorf("Expected no RV for %s; got %s", podUID, rv)
+	}
+
+	// The same objects can then be inserted again.
+	nfsID = m.InsertNFS(nfsServer, nfsPath)
+	m.InsertPV(pvUID, pvName, at(base, 0), nfsID, dbmanager.NFS, pvStorage,
+		pvModes, pvJSON, "80")
+	if pv := findPV(t, q, pvUID); pv.Name != pvName {
+		t.Errorf("Expected PV %s after rebuilding; got %s", pvName, pv.Name)
+	}
+}
+
+func pruner(t *testing.T, m dbmanager.DBManager) dbmanager.Pruner {
+	p, ok := m.(dbmanager.Pruner)
+	if !ok {
+		t.Fatal("Backend doesn't implement dbmanager.Pruner")
+	}
+	return p
+}
+
+// deletedPodUIDs returns the UIDs of the pods deleted before cutoff, in the
+// order DeletedPods returns them.
+func deletedPodUIDs(t *testing.T, p dbmanager.Pruner, cutoff time.Time,
+	limit int) []string {
+
+	pods, err := p.DeletedPods(cutoff, limit)
+	if err != nil {
+		t.Fatal("Unable to list deleted pods:  ", err)
+	}
+	uids := make([]string, len(pods))
+	for i, pod := range pods {
+		uids[i] = string(pod.UID)
+	}
+	return uids
+}
+
+// mountSummary returns the only mount summary for the suite's namespace.
+func mountSummary(t *testing.T,
+	p dbmanager.Pruner) dbmanager.MountSummaryRecord {
+
+	summaries, err := p.ListMountSummaries()
+	if err != nil {
+		t.Fatal("Unable to list mount summaries:  ", err)
+	}
+	var ret []dbmanager.MountSummaryRecord
+	for _, s := range summaries {
+		if s.Namespace == namespace {
+			ret = append(ret, s)
+		}
+	}
+	if len(ret) != 1 {
+		t.Fatalf("Expected one mount summary; got %v", ret)
+	}
+	return ret[0]
+}
+
+func checkPrune(t *testing.T, m dbmanager.DBManager) {
+	p := pruner(t, m)
+	q := querier(t, m)
+	base := newBase()
+	mount := resources.VolumeMount{Name: pvcName}
+	readOnlyMount := resources.VolumeMount{Name: pvcName, ReadOnly: true}
+
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "70")
+	insertPod(m, podUID, podName, at(base, 1), "60",
+		mountContainer("c1", mount), mountContainer("c2", readOnlyMount))
+	insertPod(m, podUID2, podName2, at(base, 2), "61",
+		mountContainer("c1", mount))
+	insertPod(m, podUID3, podName, at(base, 3), "62",
+		mountContainer("c1", mount))
+	m.DeletePod(podUID, at(base, 10), dbmanager.TimeExact,
+		WatcherNamespace, "63")
+	m.DeletePod(podUID2, at(base, 5), dbmanager.TimeExact,
+		WatcherNamespace, "64")
+
+	pods, err := p.DeletedPods(at(base, 20).Time, 10)
+	if err != nil {
+		t.Fatal("Unable to list deleted pods:  ", err)
+	}
+	if len(pods) != 2 || pods[0].UID != podUID2 || pods[1].UID != podUID {
+		t.Fatalf("Expected pods %s and %s, in order; got %v", podUID2,
+			podUID, pods)
+	}
+	pod := pods[1]
+	if pod.Name != podName || pod.Namespace != namespace ||
+		!pod.CreateTime.Equal(at(base, 1).Time) ||
+		!pod.DeleteTime.Equal(at(base, 10).Time) || pod.JSON != podJSON ||
+		pod.DeleteTimeSource != dbmanager.TimeExact {
+		t.Errorf("Incorrect attributes for deleted pod:  %v", pod)
+	}
+	if len(pod.Containers) != 2 || len(pod.Mounts) != 2 {
+		t.Errorf("Expected two containers and mounts; got %v and %v",
+			pod.Containers, pod.Mounts)
+	}
+	for _, mount := range pod.Mounts {
+		if mount.PVCUID != pvcUID || mount.PodUID != podUID ||
+			mount.ReadOnly != (mount.ContainerName == "c2") {
+			t.Errorf("Incorrect mount for deleted pod:  %v", mount)
+		}
+	}
+	uids := deletedPodUIDs(t, p, at(base, 7).Time, 10)
+	if strings.Join(uids, ",") != podUID2 {
+		t.Errorf("Expected only %s to be deleted by the cutoff; got %v",
+			podUID2, uids)
+	}
+	uids = deletedPodUIDs(t, p, at(base, 20).Time, 1)
+	if strings.Join(uids, ",") != podUID2 {
+		t.Errorf("Expected only %s within the limit; got %v", podUID2, uids)
+	}
+
+	// Pods that haven't been deleted are left alone.
+	if err = p.PrunePods([]types.UID{podUID, podUID2,
+		podUID3}); err != nil {
+		t.Fatal("Unable to prune pods:  ", err)
+	}
+	if uids = deletedPodUIDs(t, p, at(base, 20).Time, 10); len(uids) != 0 {
+		t.Error("Expected pruned pods to be gone; got ", uids)
+	}
+	if mounts := podMounts(t, q, podUID); len(mounts) != 0 {
+		t.Error("Expected pruned mounts to be gone; got ", mounts)
+	}
+	containers, err := q.ListContainers()
+	if err != nil {
+		t.Fatal("Unable to list containers:  ", err)
+	}
+	for _, c := range containers {
+		if c.PodUID == podUID || c.PodUID == podUID2 {
+			t.Error("Pruned container remains:  ", c)
+		}
+	}
+	singleMount(t, q, podUID3)
+	if rv := m.ObjectRV(podUID); rv != "" {
+		t.Errorf("Expected no RV for pruned pod %s; got %s", podUID, rv)
+	}
+	if rv := m.ObjectRV(podUID3); rv != "62" {
+		t.Errorf("Expected RV 62 for %s; got %s", podUID3, rv)
+	}
+
+	// The first pod is counted once, despite mounting the PVC twice.
+	s := mountSummary(t, p)
+	if s.PVCUID != pvcUID || s.PVCName != pvcName || s.Pods != 2 ||
+		!s.FirstMounted.Equal(at(base, 1).Time) ||
+		!s.LastUnmounted.Equal(at(base, 10).Time) {
+		t.Errorf("Incorrect mount summary:  %v", s)
+	}
+
+	m.DeletePod(podUID3, at(base, 30), dbmanager.TimeExact,
+		WatcherNamespace, "65")
+	if err = p.PrunePods([]types.UID{podUID3}); err != nil {
+		t.Fatal("Unable to prune pods:  ", err)
+	}
+	s = mountSummary(t, p)
+	if s.Pods != 3 || !s.FirstMounted.Equal(at(base, 1).Time) ||
+		!s.LastUnmounted.Equal(at(base, 30).Time) {
+		t.Errorf("Incorrect mount summary after pruning again:  %v", s)
+	}
+}
+
+// checkPruneEventLog checks that pruning a pod removes its logged events,
+// and that clearing the derived tables keeps the mount summaries, so that a
+// rebuild neither restores pruned pods nor loses what remains of them.
+func checkPruneEventLog(t *testing.T, m dbmanager.DBManager) {
+	p := pruner(t, m)
+	el := eventLog(t, m)
+	base := newBase()
+	mount := resources.VolumeMount{Name: pvcName}
+
+	insertPVC(m, pvcUID, pvcName, at(base, 0), "90")
+	insertPod(m, podUID, podName, at(base, 1), "91",
+		mountContainer("c1", mount))
+	insertPod(m, podUID2, podName2, at(base, 2), "92",
+		mountContainer("c1", mount))
+	m.DeletePod(podUID, at(base, 5), dbmanager.TimeExact,
+		WatcherNamespace, "93")
+	for _, e := range []dbmanager.EventRecord{
+		{UID: pvcUID, Resource: resources.PVCs, JSON: pvcJSON},
+		{UID: podUID, Resource: resources.Pods, JSON: podJSON},
+		{UID: podUID2, Resource: resources.Pods, JSON: podJSON},
+		{UID: podUID, Resource: resources.Pods, JSON: updateJSON},
+	} {
+		e.Time = base
+		e.Namespace = WatcherNamespace
+		appendEvent(t, el, e)
+	}
+
+	if err := p.PrunePods([]types.UID{podUID, podUID2}); err != nil {
+		t.Fatal("Unable to prune pods:  ", err)
+	}
+	var uids []string
+	for _, e := range loggedEvents(t, el, 10) {
+		uids = append(uids, string(e.UID))
+	}
+	if strings.Join(uids, ",") != pvcUID+","+podUID2 {
+		t.Errorf("Expected only the events of %s and %s to remain; got %v",
+			pvcUID, podUID2, uids)
+	}
+
+	if err := el.ClearDerived(); err != nil {
+		t.Fatal("Unable to clear derived tables:  ", err)
+	}
+	if s := mountSummary(t, p); s.Pods != 1 || s.PVCName != pvcName {
+		t.Errorf("Expected the mount summary to survive; got %v", s)
+	}
+}
@@ -0,0 +1,60 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dbmanager
+
+import (
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// EventRecord is a single watch event, as appended to the event log.
+type EventRecord struct {
+	// ID is assigned by the backend and increases in the order events were
+	// appended.
+	ID        int64
+	Time      time.Time // When the event was received.
+	Resource  resources.ResourceType
+	Namespace string    // The watched namespace; empty for all namespaces.
+	UID       types.UID // The UID of the object the event describes.
+	JSON      string    // The event, as read from the watch stream.
+	// Resync is set for events received while the watcher was listing
+	// existing objects, rather than watching for changes, so that a rebuild
+	// can infer the same time sources.
+	Resync bool
+}
+
+// EventLog is implemented by backends that append every watch event to a
+// log before applying it.  The remaining tables can then be rebuilt from the
+// log whenever the logic deriving them changes.  Logged events are never
+// modified, and are only removed when the pods they describe are pruned (see
+// Pruner).  As with Querier, callers should type-assert for it.
+type EventLog interface {
+	// AppendEvent adds e to the end of the log, ignoring its ID.
+	AppendEvent(e EventRecord) error
+	// ListEvents returns up to limit logged events with IDs greater than
+	// after, in the order they were appended.
+	ListEvents(after int64, limit int) ([]EventRecord, error)
+	// ClearDerived deletes every pod, PV, PVC, mount, container, volume
+	// source, and per-object resource version, so that they can be rebuilt
+	// from the log.  The log itself, the resource versions from which
+	// watches resume, revisions, leases, and mount summaries are kept; the
+	// summaries describe pods whose events are no longer logged.
+	ClearDerived() error
+}
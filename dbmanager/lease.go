@@ -0,0 +1,47 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dbmanager
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrFenced is returned for writes made after the writer's lease has passed
+// to another holder.
+var ErrFenced = errors.New("Lease held by another tracker; refusing to " +
+	"write")
+
+// Leaser is implemented by backends that can coordinate leader election
+// between trackers sharing the same database.  A lease is held by a single
+// holder until it expires or is released.  Each time it changes hands, its
+// token increases; backends use the token to fence off writes from holders
+// that have lost the lease without noticing.  As with Querier, callers
+// should obtain a Leaser by type assertion on a DBManager.
+type Leaser interface {
+	// AcquireLease acquires the lease called name for holder, or renews it
+	// if holder already has it, so that it is held for at least ttl.  It
+	// returns whether holder holds the lease and, if so, its token.
+	AcquireLease(name, holder string, ttl time.Duration) (token int64,
+		held bool, err error)
+	// ReleaseLease gives up the lease called name if holder holds it, so
+	// that another holder can acquire it without waiting for it to expire.
+	ReleaseLease(name, holder string) error
+	// Fence causes all subsequent writes to fail with ErrFenced unless the
+	// lease called name still has the given token.
+	Fence(name string, token int64)
+}
@@ -0,0 +1,66 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memory
+
+import (
+	"sort"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+func (m *memoryManager) AppendEvent(e dbmanager.EventRecord) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.lastEventID++
+	e.ID = m.lastEventID
+	m.events = append(m.events, e)
+	return nil
+}
+
+func (m *memoryManager) ListEvents(after int64,
+	limit int) ([]dbmanager.EventRecord, error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	first := sort.Search(len(m.events), func(i int) bool {
+		return m.events[i].ID > after
+	})
+	if first == len(m.events) {
+		return nil, nil
+	}
+	events := m.events[first:]
+	if len(events) > limit {
+		events = events[:limit]
+	}
+	return append([]dbmanager.EventRecord(nil), events...), nil
+}
+
+func (m *memoryManager) ClearDerived() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.pvs = make(map[types.UID]*dbmanager.PVRecord)
+	m.pvcs = make(map[types.UID]*dbmanager.PVCRecord)
+	m.pods = make(map[types.UID]*pod)
+	m.podMounts = nil
+	m.containers = nil
+	m.nfs = nil
+	m.iscsi = nil
+	m.objectRVs = make(map[types.UID]string)
+	return nil
+}
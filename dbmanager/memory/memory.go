@@ -0,0 +1,467 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package memory provides an in-memory implementation of dbmanager that
+// models the same tables as the MySQL backend and resolves pod mounts the
+// same way.  Nothing is persisted, so it is intended for tests, demos, and
+// ephemeral clusters.
+package memory
+
+import (
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+type pod struct {
+	uid        types.UID
+	name       string
+	createTime time.Time
+	deleteTime time.Time
+	// deleteTimeSource says where deleteTime came from.
+	deleteTimeSource dbmanager.TimeSource
+	namespace        string
+	json             string
+}
+
+// podMount mirrors a row of the pod_mount table.  pvcUID is empty until a
+// PVC with the name pvcName has been matched to the mount.
+type podMount struct {
+	podUID        types.UID
+	pvcUID        types.UID
+	containerName string
+	pvcName       string
+	readOnly      bool
+}
+
+type rvKey struct {
+	resource  resources.ResourceType
+	namespace string
+}
+
+type memoryManager struct {
+	// Every method holds mutex for its duration, so that each call is
+	// atomic, much as each MySQL call runs in a single transaction.
+	mutex sync.Mutex
+
+	pvs        map[types.UID]*dbmanager.PVRecord
+	pvcs       map[types.UID]*dbmanager.PVCRecord
+	pods       map[types.UID]*pod
+	podMounts  []*podMount
+	containers []dbmanager.ContainerRecord
+	// NFS and ISCSI IDs start from 1, as with AUTO_INCREMENT; the record
+	// with ID n is at index n-1.
+	nfs   []dbmanager.NFSRecord
+	iscsi []dbmanager.ISCSIRecord
+	rvs   map[rvKey]string
+	// objectRVs holds the latest RV applied to each object.
+	objectRVs map[types.UID]string
+
+	revisions map[types.UID][]*revision
+	retention dbmanager.RevisionRetention
+
+	// events are kept in order of ID, which, as with AUTO_INCREMENT, isn't
+	// reused once the event is pruned.
+	events      []dbmanager.EventRecord
+	lastEventID int64
+
+	summaries []*dbmanager.MountSummaryRecord
+}
+
+// New returns an empty in-memory DBManager.
+func New() dbmanager.DBManager {
+	return &memoryManager{
+		pvs:  make(map[types.UID]*dbmanager.PVRecord),
+		pvcs: make(map[types.UID]*dbmanager.PVCRecord),
+		pods: make(map[types.UID]*pod),
+		rvs:  make(map[rvKey]string),
+
+		objectRVs: make(map[types.UID]string),
+
+		revisions: make(map[types.UID][]*revision),
+	}
+}
+
+func (m *memoryManager) Destroy() {
+	return
+}
+
+func (m *memoryManager) ValidateConnection() error {
+	// There's nothing to connect to.
+	return nil
+}
+
+func accessModeString(accessModes []api.PersistentVolumeAccessMode) string {
+	stringAccessModes := make([]string, len(accessModes))
+	for i, mode := range accessModes {
+		stringAccessModes[i] = string(mode)
+	}
+	return strings.Join(stringAccessModes, ",")
+}
+
+func checkBackendType(backendType dbmanager.Table) {
+	if backendType != dbmanager.NFS && backendType != dbmanager.ISCSI {
+		log.Fatal("Unknown backend type:  ", backendType)
+	}
+}
+
+// matchPVC returns the UID of the PVC that a mount of the PVC called name by
+// a pod in namespace created at podTime refers to, or the empty string if
+// there is none.  As with mySQLManager, this is the most recently created PVC
+// in the namespace that existed when the pod was created or, failing that,
+// the first one created after it.
+func (m *memoryManager) matchPVC(name, namespace string,
+	podTime time.Time) types.UID {
+
+	var before, after *dbmanager.PVCRecord
+
+	for _, pvc := range m.pvcs {
+		// PVCs known only from a bind have no name or creation time yet.
+		if pvc.Name != name || pvc.Namespace != namespace ||
+			pvc.CreateTime.IsZero() {
+
+			continue
+		}
+		if !pvc.CreateTime.After(podTime) {
+			if !pvc.DeleteTime.IsZero() && pvc.DeleteTime.Before(podTime) {
+				continue
+			}
+			if before == nil || laterPVC(pvc, before) {
+				before = pvc
+			}
+		}
+		if !pvc.CreateTime.Before(podTime) {
+			if !pvc.DeleteTime.IsZero() && !pvc.DeleteTime.After(podTime) {
+				continue
+			}
+			if after == nil || laterPVC(after, pvc) {
+				after = pvc
+			}
+		}
+	}
+	switch {
+	case before != nil:
+		return before.UID
+	case after != nil:
+		return after.UID
+	}
+	return ""
+}
+
+// resolveMounts matches every mount of the PVC called name in namespace
+// again, after a PVC of that name has been inserted or deleted there, so that
+// each mount ends up matched as if its pod had been inserted after every PVC
+// event; the pod and PVC watches can be handled in any order.  As in
+// DeletePod, a deleted pod with a mount matched to a PVC created after the
+// deletion never started, so its mounts are discarded.  This breaks if we
+// lose events.
+func (m *memoryManager) resolveMounts(name, namespace string) {
+	unstarted := make(map[types.UID]bool)
+	for _, mount := range m.podMounts {
+		p := m.pods[mount.podUID]
+		if mount.pvcName != name || p == nil || p.namespace != namespace {
+			continue
+		}
+		mount.pvcUID = m.matchPVC(name, namespace, p.createTime)
+		if mount.pvcUID != "" && !p.deleteTime.IsZero() &&
+			m.pvcs[mount.pvcUID].CreateTime.After(p.deleteTime) {
+			unstarted[p.uid] = true
+		}
+	}
+	if len(unstarted) == 0 {
+		return
+	}
+	mounts := m.podMounts[:0]
+	for _, mount := range m.podMounts {
+		if !unstarted[mount.podUID] {
+			mounts = append(mounts, mount)
+		}
+	}
+	m.podMounts = mounts
+}
+
+// laterPVC orders PVCs by creation time, breaking ties by UID so that mount
+// resolution doesn't depend on map iteration order.
+func laterPVC(a, b *dbmanager.PVCRecord) bool {
+	if !a.CreateTime.Equal(b.CreateTime) {
+		return a.CreateTime.After(b.CreateTime)
+	}
+	return a.UID > b.UID
+}
+
+func (m *memoryManager) InsertPod(uid types.UID, name string,
+	createTime unversioned.Time, namespace string,
+	containers []resources.ContainerDesc, json, watcherNS, rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	log.Print("Adding pod with UID ", uid)
+	// As with mySQLManager, duplicates are ignored, resource version and
+	// all; a relist delivers the pods we've already seen as new.
+	if _, ok := m.pods[uid]; ok {
+		log.Print("Inserted duplicate key")
+		return
+	}
+	m.pods[uid] = &pod{uid: uid, name: name, createTime: createTime.Time,
+		namespace: namespace, json: json}
+	for _, container := range containers {
+		m.containers = append(m.containers, dbmanager.ContainerRecord{
+			PodUID:  uid,
+			Name:    container.Name,
+			Image:   container.Image,
+			Command: container.Command,
+		})
+		for _, pvc := range container.PVCMounts {
+			m.podMounts = append(m.podMounts, &podMount{
+				podUID:        uid,
+				pvcUID:        m.matchPVC(pvc.Name, namespace, createTime.Time),
+				containerName: container.Name,
+				pvcName:       pvc.Name,
+				readOnly:      pvc.ReadOnly,
+			})
+		}
+	}
+	m.setRV(resources.Pods, watcherNS, uid, rv)
+}
+
+func (m *memoryManager) InsertPV(uid types.UID, name string,
+	createTime unversioned.Time, backendID int, backendType dbmanager.Table,
+	storage int64, accessModes []api.PersistentVolumeAccessMode, json,
+	rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	checkBackendType(backendType)
+	if _, ok := m.pvs[uid]; ok {
+		log.Print("Inserted duplicate key")
+		return
+	}
+	m.pvs[uid] = &dbmanager.PVRecord{
+		UID:         uid,
+		Name:        name,
+		CreateTime:  createTime.Time,
+		Storage:     storage,
+		AccessModes: accessModeString(accessModes),
+		BackendType: backendType,
+		BackendID:   backendID,
+		JSON:        json,
+	}
+	m.setRV(resources.PVs, resources.PVNamespace, uid, rv)
+}
+
+func (m *memoryManager) InsertPVC(uid types.UID, name string,
+	createTime unversioned.Time, namespace string, storage int64,
+	accessModes []api.PersistentVolumeAccessMode,
+	json, watcherNS, rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	// The PVC may already have a partial record, thanks to its PV entering
+	// the bound state before this creation event was processed.
+	pvc, ok := m.pvcs[uid]
+	if !ok {
+		pvc = &dbmanager.PVCRecord{UID: uid}
+		m.pvcs[uid] = pvc
+	}
+	pvc.Name = name
+	pvc.CreateTime = createTime.Time
+	pvc.Namespace = namespace
+	pvc.Storage = storage
+	pvc.AccessModes = accessModeString(accessModes)
+	pvc.JSON = json
+
+	m.resolveMounts(name, namespace)
+	m.setRV(resources.PVCs, watcherNS, uid, rv)
+}
+
+func (m *memoryManager) InsertNFS(ipAddr, path string) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, nfs := range m.nfs {
+		if nfs.Server == ipAddr && nfs.Path == path {
+			return nfs.ID
+		}
+	}
+	id := len(m.nfs) + 1
+	m.nfs = append(m.nfs, dbmanager.NFSRecord{ID: id, Server: ipAddr,
+		Path: path})
+	return id
+}
+
+func (m *memoryManager) InsertISCSI(
+	targetPortal, iqn string, lun int, fsType string,
+) int {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	record := dbmanager.ISCSIRecord{TargetPortal: targetPortal, IQN: iqn,
+		LUN: lun, FSType: fsType}
+	for _, iscsi := range m.iscsi {
+		record.ID = iscsi.ID
+		if iscsi == record {
+			return iscsi.ID
+		}
+	}
+	record.ID = len(m.iscsi) + 1
+	m.iscsi = append(m.iscsi, record)
+	return record.ID
+}
+
+func (m *memoryManager) UpdatePV(
+	uid types.UID, backendID int, backendType dbmanager.Table, storage int64,
+	accessModes []api.PersistentVolumeAccessMode, json, rv string,
+) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	checkBackendType(backendType)
+	if pv, ok := m.pvs[uid]; ok {
+		pv.BackendType = backendType
+		pv.BackendID = backendID
+		pv.Storage = storage
+		pv.AccessModes = accessModeString(accessModes)
+		pv.JSON = json
+	}
+	m.setRV(resources.PVs, resources.PVNamespace, uid, rv)
+}
+
+func (m *memoryManager) UpdatePVC(uid types.UID, storage int64,
+	accessModes []api.PersistentVolumeAccessMode,
+	json, watcherNS, rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if pvc, ok := m.pvcs[uid]; ok {
+		pvc.Storage = storage
+		pvc.AccessModes = accessModeString(accessModes)
+		pvc.JSON = json
+	}
+	m.setRV(resources.PVCs, watcherNS, uid, rv)
+}
+
+func (m *memoryManager) BindPVC(pvUID types.UID, pvcUID types.UID,
+	bindTime unversioned.Time, timeSource dbmanager.TimeSource, rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	pvc, ok := m.pvcs[pvcUID]
+	if !ok {
+		pvc = &dbmanager.PVCRecord{UID: pvcUID}
+		m.pvcs[pvcUID] = pvc
+	}
+	pvc.PVUID = pvUID
+	pvc.BindTime = bindTime.Time
+	pvc.BindTimeSource = timeSource
+	// The resource version corresponds to the PV, not the PVC.
+	m.setRV(resources.PVs, resources.PVNamespace, pvUID, rv)
+}
+
+func (m *memoryManager) DeletePod(uid types.UID, deleteTime unversioned.Time,
+	timeSource dbmanager.TimeSource, watcherNS, rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if p, ok := m.pods[uid]; ok {
+		p.deleteTime = deleteTime.Time
+		p.deleteTimeSource = timeSource
+	}
+	// If any of the pod's mounts was matched to a PVC created after the pod
+	// was deleted, the pod never succeeded in initializing, so none of its
+	// mounts are valid.
+	bad := false
+	for _, mount := range m.podMounts {
+		if mount.podUID != uid || mount.pvcUID == "" {
+			continue
+		}
+		pvc := m.pvcs[mount.pvcUID]
+		if pvc != nil && pvc.CreateTime.After(deleteTime.Time) {
+			bad = true
+		}
+	}
+	if bad {
+		mounts := m.podMounts[:0]
+		for _, mount := range m.podMounts {
+			if mount.podUID != uid {
+				mounts = append(mounts, mount)
+			}
+		}
+		m.podMounts = mounts
+	}
+	m.setRV(resources.Pods, watcherNS, uid, rv)
+}
+
+func (m *memoryManager) DeletePV(uid types.UID, deleteTime unversioned.Time,
+	timeSource dbmanager.TimeSource, rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if pv, ok := m.pvs[uid]; ok {
+		pv.DeleteTime = deleteTime.Time
+		pv.DeleteTimeSource = timeSource
+	}
+	m.setRV(resources.PVs, resources.PVNamespace, uid, rv)
+}
+
+func (m *memoryManager) DeletePVC(uid types.UID, deleteTime unversioned.Time,
+	timeSource dbmanager.TimeSource, watcherNS, rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if pvc, ok := m.pvcs[uid]; ok {
+		pvc.DeleteTime = deleteTime.Time
+		pvc.DeleteTimeSource = timeSource
+		m.resolveMounts(pvc.Name, pvc.Namespace)
+	}
+	m.setRV(resources.PVCs, watcherNS, uid, rv)
+}
+
+// setRV records rv as the latest RV for resource in the watched namespace and
+// for the object with the given UID, unless either has already seen a newer
+// one.  The caller must hold the mutex.
+func (m *memoryManager) setRV(resource resources.ResourceType,
+	namespace string, uid types.UID, rv string) {
+
+	if rv == "" {
+		return
+	}
+	key := rvKey{resource, namespace}
+	if dbmanager.NewerRV(rv, m.rvs[key]) {
+		m.rvs[key] = rv
+	}
+	if dbmanager.NewerRV(rv, m.objectRVs[uid]) {
+		m.objectRVs[uid] = rv
+	}
+}
+
+func (m *memoryManager) GetRV(resource resources.ResourceType,
+	namespace string) string {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.rvs[rvKey{resource, namespace}]
+}
+
+func (m *memoryManager) ObjectRV(uid types.UID) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.objectRVs[uid]
+}
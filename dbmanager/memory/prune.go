@@ -0,0 +1,175 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memory
+
+import (
+	"sort"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+// podsByDeletion sorts pods by delete time, breaking ties by UID, as with
+// the ORDER BY in mySQLManager.
+type podsByDeletion []*pod
+
+func (p podsByDeletion) Len() int      { return len(p) }
+func (p podsByDeletion) Swap(i, j int) { p[i], p[j] = p[j], p[i] }
+func (p podsByDeletion) Less(i, j int) bool {
+	if !p[i].deleteTime.Equal(p[j].deleteTime) {
+		return p[i].deleteTime.Before(p[j].deleteTime)
+	}
+	return p[i].uid < p[j].uid
+}
+
+func (m *memoryManager) DeletedPods(cutoff time.Time,
+	limit int) ([]dbmanager.PodRecord, error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var deleted podsByDeletion
+	for _, p := range m.pods {
+		if !p.deleteTime.IsZero() && p.deleteTime.Before(cutoff) {
+			deleted = append(deleted, p)
+		}
+	}
+	sort.Sort(deleted)
+	if len(deleted) > limit {
+		deleted = deleted[:limit]
+	}
+
+	ret := make([]dbmanager.PodRecord, len(deleted))
+	for i, p := range deleted {
+		ret[i] = dbmanager.PodRecord{
+			UID:        p.uid,
+			Name:       p.name,
+			Namespace:  p.namespace,
+			CreateTime: p.createTime,
+			DeleteTime: p.deleteTime,
+			JSON:       p.json,
+
+			DeleteTimeSource: p.deleteTimeSource,
+		}
+		for _, c := range m.containers {
+			if c.PodUID == p.uid {
+				ret[i].Containers = append(ret[i].Containers, c)
+			}
+		}
+		for _, mount := range m.podMounts {
+			if mount.podUID == p.uid {
+				ret[i].Mounts = append(ret[i].Mounts,
+					dbmanager.PodMountRecord{
+						PodUID:        p.uid,
+						PodName:       p.name,
+						Namespace:     p.namespace,
+						PodCreateTime: p.createTime,
+						PodDeleteTime: p.deleteTime,
+						ContainerName: mount.containerName,
+						PVCName:       mount.pvcName,
+						PVCUID:        mount.pvcUID,
+						ReadOnly:      mount.readOnly,
+
+						PodDeleteTimeSource: p.deleteTimeSource,
+					})
+			}
+		}
+	}
+	return ret, nil
+}
+
+func (m *memoryManager) PrunePods(uids []types.UID) error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, uid := range uids {
+		p, ok := m.pods[uid]
+		if !ok || p.deleteTime.IsZero() {
+			continue
+		}
+		// Each PVC is counted once per pod, however many of its
+		// containers mount it.
+		summarized := make(map[podMount]bool)
+		mounts := m.podMounts[:0]
+		for _, mount := range m.podMounts {
+			if mount.podUID != uid {
+				mounts = append(mounts, mount)
+				continue
+			}
+			key := podMount{pvcUID: mount.pvcUID, pvcName: mount.pvcName}
+			if !summarized[key] {
+				m.summarize(p, mount)
+				summarized[key] = true
+			}
+		}
+		m.podMounts = mounts
+		containers := m.containers[:0]
+		for _, c := range m.containers {
+			if c.PodUID != uid {
+				containers = append(containers, c)
+			}
+		}
+		m.containers = containers
+		events := m.events[:0]
+		for _, e := range m.events {
+			if e.UID != uid {
+				events = append(events, e)
+			}
+		}
+		m.events = events
+		delete(m.pods, uid)
+		delete(m.objectRVs, uid)
+	}
+	return nil
+}
+
+// summarize adds a mount by the pruned pod p to the mount summaries.
+func (m *memoryManager) summarize(p *pod, mount *podMount) {
+	for _, s := range m.summaries {
+		if s.PVCUID == mount.pvcUID && s.PVCName == mount.pvcName &&
+			s.Namespace == p.namespace {
+			s.Pods++
+			if p.createTime.Before(s.FirstMounted) {
+				s.FirstMounted = p.createTime
+			}
+			if p.deleteTime.After(s.LastUnmounted) {
+				s.LastUnmounted = p.deleteTime
+			}
+			return
+		}
+	}
+	m.summaries = append(m.summaries, &dbmanager.MountSummaryRecord{
+		PVCUID:        mount.pvcUID,
+		PVCName:       mount.pvcName,
+		Namespace:     p.namespace,
+		Pods:          1,
+		FirstMounted:  p.createTime,
+		LastUnmounted: p.deleteTime,
+	})
+}
+
+func (m *memoryManager) ListMountSummaries() ([]dbmanager.MountSummaryRecord,
+	error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	ret := make([]dbmanager.MountSummaryRecord, len(m.summaries))
+	for i, s := range m.summaries {
+		ret[i] = *s
+	}
+	return ret, nil
+}
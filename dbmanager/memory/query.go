@@ -0,0 +1,112 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memory
+
+import (
+	"sort"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+type uidList []types.UID
+
+func (u uidList) Len() int           { return len(u) }
+func (u uidList) Swap(i, j int)      { u[i], u[j] = u[j], u[i] }
+func (u uidList) Less(i, j int) bool { return u[i] < u[j] }
+
+// Records are returned sorted by UID, or in insertion order for tables
+// without one, so that listings are deterministic.
+
+func (m *memoryManager) ListPVs() ([]dbmanager.PVRecord, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	uids := make(uidList, 0, len(m.pvs))
+	for uid := range m.pvs {
+		uids = append(uids, uid)
+	}
+	sort.Sort(uids)
+	ret := make([]dbmanager.PVRecord, len(uids))
+	for i, uid := range uids {
+		ret[i] = *m.pvs[uid]
+	}
+	return ret, nil
+}
+
+func (m *memoryManager) ListPVCs() ([]dbmanager.PVCRecord, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	uids := make(uidList, 0, len(m.pvcs))
+	for uid := range m.pvcs {
+		uids = append(uids, uid)
+	}
+	sort.Sort(uids)
+	ret := make([]dbmanager.PVCRecord, len(uids))
+	for i, uid := range uids {
+		ret[i] = *m.pvcs[uid]
+	}
+	return ret, nil
+}
+
+func (m *memoryManager) ListPodMounts() ([]dbmanager.PodMountRecord, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var ret []dbmanager.PodMountRecord
+	for _, mount := range m.podMounts {
+		// As with the join in mySQLManager, mounts are only listed along
+		// with their pods.
+		p, ok := m.pods[mount.podUID]
+		if !ok {
+			continue
+		}
+		ret = append(ret, dbmanager.PodMountRecord{
+			PodUID:        p.uid,
+			PodName:       p.name,
+			Namespace:     p.namespace,
+			PodCreateTime: p.createTime,
+			PodDeleteTime: p.deleteTime,
+			ContainerName: mount.containerName,
+			PVCName:       mount.pvcName,
+			PVCUID:        mount.pvcUID,
+			ReadOnly:      mount.readOnly,
+
+			PodDeleteTimeSource: p.deleteTimeSource,
+		})
+	}
+	return ret, nil
+}
+
+func (m *memoryManager) ListContainers() ([]dbmanager.ContainerRecord,
+	error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]dbmanager.ContainerRecord(nil), m.containers...), nil
+}
+
+func (m *memoryManager) ListNFS() ([]dbmanager.NFSRecord, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]dbmanager.NFSRecord(nil), m.nfs...), nil
+}
+
+func (m *memoryManager) ListISCSI() ([]dbmanager.ISCSIRecord, error) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return append([]dbmanager.ISCSIRecord(nil), m.iscsi...), nil
+}
@@ -0,0 +1,118 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package memory
+
+import (
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+// revision mirrors a row of the resource_revision table.  Each object's
+// revisions are kept in the order they were recorded.
+type revision struct {
+	record dbmanager.RevisionRecord // JSON is left empty.
+	body   []byte                   // The compressed JSON.
+}
+
+func (m *memoryManager) SetRevisionRetention(
+	policy dbmanager.RevisionRetention) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.retention = policy
+}
+
+func (m *memoryManager) RecordRevision(r dbmanager.RevisionRecord) error {
+	body, err := dbmanager.CompressRevision(r.JSON)
+	if err != nil {
+		return err
+	}
+	r.JSON = ""
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	revs := m.revisions[r.UID]
+	replaced := false
+	for _, rev := range revs {
+		if rev.record.ResourceVersion == r.ResourceVersion {
+			rev.record = r
+			rev.body = body
+			replaced = true
+		}
+	}
+	if !replaced {
+		revs = append(revs, &revision{record: r, body: body})
+	}
+
+	// The most recently recorded revision is always kept.
+	if m.retention.MaxAge > 0 {
+		cutoff := time.Now().Add(-m.retention.MaxAge)
+		kept := revs[:0]
+		for i, rev := range revs {
+			if i == len(revs)-1 || !rev.record.EventTime.Before(cutoff) {
+				kept = append(kept, rev)
+			}
+		}
+		revs = kept
+	}
+	if max := m.retention.MaxPerObject; max > 0 && len(revs) > max {
+		revs = append([]*revision(nil), revs[len(revs)-max:]...)
+	}
+	m.revisions[r.UID] = revs
+	return nil
+}
+
+func (m *memoryManager) GetRevision(uid types.UID,
+	rv string) (dbmanager.RevisionRecord, error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	for _, rev := range m.revisions[uid] {
+		if rev.record.ResourceVersion == rv {
+			return rev.decompress()
+		}
+	}
+	return dbmanager.RevisionRecord{UID: uid, ResourceVersion: rv},
+		dbmanager.ErrNoRevision
+}
+
+func (m *memoryManager) ListRevisions(
+	uid types.UID) ([]dbmanager.RevisionRecord, error) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	var ret []dbmanager.RevisionRecord
+	for _, rev := range m.revisions[uid] {
+		r, err := rev.decompress()
+		if err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+	return ret, nil
+}
+
+func (rev *revision) decompress() (dbmanager.RevisionRecord, error) {
+	var err error
+
+	r := rev.record
+	r.JSON, err = dbmanager.DecompressRevision(rev.body)
+	return r, err
+}
@@ -0,0 +1,212 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package testutils provides utility methods for filling an in-memory
+// backend with fixtures for tests.
+package testutils
+
+import (
+	"log"
+	"strings"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// Fixture holds the records that a test expects a backend to list.  Pods
+// may be given along with their containers and mounts, as in PodRecord, or
+// only through Containers and Mounts, as a Querier lists them; a pod that
+// is only given through Mounts takes its name, namespace, and times from its
+// first mount.  Mounts that name a PVC by UID alone refer to the PVC with
+// that UID in PVCs.  NFS and ISCSI records must be numbered from 1, in
+// order.
+type Fixture struct {
+	NFS        []dbmanager.NFSRecord
+	ISCSI      []dbmanager.ISCSIRecord
+	PVs        []dbmanager.PVRecord
+	PVCs       []dbmanager.PVCRecord
+	Pods       []dbmanager.PodRecord
+	Containers []dbmanager.ContainerRecord
+	Mounts     []dbmanager.PodMountRecord
+}
+
+func accessModes(modes string) []api.PersistentVolumeAccessMode {
+	var ret []api.PersistentVolumeAccessMode
+	for _, mode := range strings.Split(modes, ",") {
+		if mode != "" {
+			ret = append(ret, api.PersistentVolumeAccessMode(mode))
+		}
+	}
+	return ret
+}
+
+// pods returns the pods in f with all of their containers and mounts, in
+// the order in which they first appear.
+func (f Fixture) pods() []dbmanager.PodRecord {
+	var pods []dbmanager.PodRecord
+	index := make(map[types.UID]int)
+
+	find := func(uid types.UID) *dbmanager.PodRecord {
+		i, ok := index[uid]
+		if !ok {
+			i = len(pods)
+			index[uid] = i
+			pods = append(pods, dbmanager.PodRecord{UID: uid})
+		}
+		return &pods[i]
+	}
+	for _, p := range f.Pods {
+		*find(p.UID) = p
+	}
+	for _, c := range f.Containers {
+		p := find(c.PodUID)
+		p.Containers = append(p.Containers, c)
+	}
+	for _, mount := range f.Mounts {
+		p := find(mount.PodUID)
+		if p.CreateTime.IsZero() {
+			p.Name = mount.PodName
+			p.Namespace = mount.Namespace
+			p.CreateTime = mount.PodCreateTime
+			p.DeleteTime = mount.PodDeleteTime
+			p.DeleteTimeSource = mount.PodDeleteTimeSource
+		}
+		p.Mounts = append(p.Mounts, mount)
+	}
+	return pods
+}
+
+// containers returns the containers of p along with the PVCs that each one
+// mounts, adding any container that is only named by a mount.
+func (f Fixture) containers(p dbmanager.PodRecord) []resources.ContainerDesc {
+	var containers []resources.ContainerDesc
+	index := make(map[string]int)
+
+	for _, c := range p.Containers {
+		index[c.Name] = len(containers)
+		containers = append(containers, resources.ContainerDesc{
+			Name:    c.Name,
+			Image:   c.Image,
+			Command: c.Command,
+		})
+	}
+	for _, mount := range p.Mounts {
+		i, ok := index[mount.ContainerName]
+		if !ok {
+			i = len(containers)
+			index[mount.ContainerName] = i
+			containers = append(containers,
+				resources.ContainerDesc{Name: mount.ContainerName})
+		}
+		name := mount.PVCName
+		if name == "" {
+			for _, pvc := range f.PVCs {
+				if pvc.UID == mount.PVCUID {
+					name = pvc.Name
+				}
+			}
+		}
+		containers[i].PVCMounts = append(containers[i].PVCMounts,
+			resources.VolumeMount{Name: name, ReadOnly: mount.ReadOnly})
+	}
+	return containers
+}
+
+// NewManager returns an in-memory backend holding the records in f.  The
+// records are written through the DBManager methods, as the watchers would
+// write them, so each mount is resolved to a PVC by the backend itself; the
+// PVCs in f must be named and timed so that it picks the PVC UID given for
+// each mount, or NewManager fails.
+func NewManager(f Fixture) dbmanager.DBManager {
+	m := memory.New()
+	for _, nfs := range f.NFS {
+		if id := m.InsertNFS(nfs.Server, nfs.Path); id != nfs.ID {
+			log.Fatalf("NFS record %d inserted with ID %d", nfs.ID, id)
+		}
+	}
+	for _, iscsi := range f.ISCSI {
+		id := m.InsertISCSI(iscsi.TargetPortal, iscsi.IQN, iscsi.LUN,
+			iscsi.FSType)
+		if id != iscsi.ID {
+			log.Fatalf("ISCSI record %d inserted with ID %d", iscsi.ID, id)
+		}
+	}
+	for _, pv := range f.PVs {
+		m.InsertPV(pv.UID, pv.Name, unversioned.NewTime(pv.CreateTime),
+			pv.BackendID, pv.BackendType, pv.Storage,
+			accessModes(pv.AccessModes), pv.JSON, "")
+		if !pv.DeleteTime.IsZero() {
+			m.DeletePV(pv.UID, unversioned.NewTime(pv.DeleteTime),
+				pv.DeleteTimeSource, "")
+		}
+	}
+	for _, pvc := range f.PVCs {
+		m.InsertPVC(pvc.UID, pvc.Name, unversioned.NewTime(pvc.CreateTime),
+			pvc.Namespace, pvc.Storage, accessModes(pvc.AccessModes),
+			pvc.JSON, pvc.Namespace, "")
+		if pvc.PVUID != "" {
+			m.BindPVC(pvc.PVUID, pvc.UID, unversioned.NewTime(pvc.BindTime),
+				pvc.BindTimeSource, "")
+		}
+		if !pvc.DeleteTime.IsZero() {
+			m.DeletePVC(pvc.UID, unversioned.NewTime(pvc.DeleteTime),
+				pvc.DeleteTimeSource, pvc.Namespace, "")
+		}
+	}
+	for _, p := range f.pods() {
+		m.InsertPod(p.UID, p.Name, unversioned.NewTime(p.CreateTime),
+			p.Namespace, f.containers(p), p.JSON, p.Namespace, "")
+		if !p.DeleteTime.IsZero() {
+			m.DeletePod(p.UID, unversioned.NewTime(p.DeleteTime),
+				p.DeleteTimeSource, p.Namespace, "")
+		}
+	}
+	checkMounts(m.(dbmanager.Querier), f.pods())
+	return m
+}
+
+// checkMounts checks that q resolved each mount in pods to the PVC UID
+// given for it, if any.
+func checkMounts(q dbmanager.Querier, pods []dbmanager.PodRecord) {
+	mounts, err := q.ListPodMounts()
+	if err != nil {
+		log.Fatal("Unable to list pod mounts:  ", err)
+	}
+	for _, p := range pods {
+		for _, want := range p.Mounts {
+			if want.PVCUID == "" {
+				continue
+			}
+			found := false
+			for _, got := range mounts {
+				if got.PodUID == p.UID &&
+					got.ContainerName == want.ContainerName &&
+					got.PVCUID == want.PVCUID {
+					found = true
+				}
+			}
+			if !found {
+				log.Fatalf("Mount of %s by pod %s not resolved to it",
+					want.PVCUID, p.UID)
+			}
+		}
+	}
+}
@@ -0,0 +1,78 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mock
+
+import (
+	"sync"
+	"time"
+)
+
+type lease struct {
+	holder  string
+	token   int64
+	expires time.Time
+}
+
+var (
+	leaseMutex sync.Mutex
+	leases     = make(map[string]*lease)
+)
+
+// ResetLeases forgets every lease, for use between tests.
+func ResetLeases() {
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+	leases = make(map[string]*lease)
+}
+
+func (m *MockManager) AcquireLease(name, holder string,
+	ttl time.Duration) (int64, bool, error) {
+
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+	now := time.Now()
+	l, ok := leases[name]
+	switch {
+	case !ok:
+		l = &lease{holder: holder, token: 1}
+		leases[name] = l
+	case l.holder == holder:
+	case !now.Before(l.expires):
+		l.holder = holder
+		l.token++
+	default:
+		return 0, false, nil
+	}
+	l.expires = now.Add(ttl)
+	return l.token, true, nil
+}
+
+func (m *MockManager) ReleaseLease(name, holder string) error {
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+	if l, ok := leases[name]; ok && l.holder == holder {
+		l.expires = time.Now()
+	}
+	return nil
+}
+
+func (m *MockManager) Fence(name string, token int64) {
+	leaseMutex.Lock()
+	defer leaseMutex.Unlock()
+	m.FenceName = name
+	m.FenceToken = token
+}
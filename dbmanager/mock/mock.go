@@ -16,30 +16,27 @@
 
 // Package mock provides a mock implementation for dbmanager.  It stores
 // resources in a set of public maps that test programs can use to verify
-// correctness.
+// correctness.  Everything it's given is also recorded by an in-memory
+// backend, through which it tracks binds and pod mounts and implements
+// dbmanager.Querier.
 package mock
 
 import (
 	"log"
+	"sync"
 
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/unversioned"
 	"k8s.io/kubernetes/pkg/types"
 
 	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory"
 	"github.com/netapp/kubevoltracker/resources"
 )
 
-type nfsID struct {
-	ipAddr string
-	path   string
-}
-
-type iscsiID struct {
-	targetPortal string
-	iqn          string
-	lun          int
-	fsType       string
+type rvKey struct {
+	resource  resources.ResourceType
+	namespace string
 }
 
 type ResourceAttrs interface {
@@ -81,11 +78,17 @@ type PVCAttrs struct {
 func (p *PVCAttrs) GetName() string   { return p.Name }
 func (p *PVCAttrs) GetUID() types.UID { return p.UID }
 
+// recorder is the part of the in-memory backend used by a MockManager.
+type recorder interface {
+	dbmanager.DBManager
+	dbmanager.Querier
+}
+
 type MockManager struct {
-	nfsIDMap    map[nfsID]int
-	iscsiIDMap  map[iscsiID]int
-	lastNFSID   int
-	lastISCSIID int
+	// recorded holds the history of every resource, including binds, pod
+	// mounts, and deletions, which the public maps don't.  It also assigns
+	// NFS and ISCSI IDs.
+	recorded recorder
 
 	PodForUID map[types.UID]ResourceAttrs
 	PVForUID  map[types.UID]ResourceAttrs
@@ -93,6 +96,22 @@ type MockManager struct {
 	Deletions int
 
 	invalidRVs bool
+
+	// The latest RV stored for each resource type and watched namespace, so
+	// that watches can be resumed, and for each object.
+	rvs       map[rvKey]string
+	objectRVs map[types.UID]string
+
+	// mutex serializes calls from the watches for different resources,
+	// which run concurrently.  Test programs that read the public maps while
+	// watches are running must arrange their own synchronization.
+	mutex sync.Mutex
+
+	// Leases are shared by every MockManager, much as every tracker would
+	// share a single database, and FenceName and FenceToken record the last
+	// call to Fence.  Writes are not actually fenced.
+	FenceName  string
+	FenceToken int64
 }
 
 func (m *MockManager) Destroy() {
@@ -104,8 +123,18 @@ func (m *MockManager) InsertPod(uid types.UID, name string,
 	containers []resources.ContainerDesc,
 	json, watcherNS, rv string) {
 
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	// As with the other backends, duplicates are ignored.
+	if _, ok := m.PodForUID[uid]; ok {
+		log.Printf("Inserted duplicate key:  pod %s", uid)
+		return
+	}
+	m.recorded.InsertPod(uid, name, createTime, namespace, containers, json,
+		watcherNS, rv)
 	m.PodForUID[uid] = &PodAttrs{Name: name, CreateTime: createTime,
 		Namespace: namespace, Containers: containers, UID: uid}
+	m.setRV(resources.Pods, watcherNS, uid, rv)
 }
 
 func (m *MockManager) InsertPV(
@@ -113,6 +142,12 @@ func (m *MockManager) InsertPV(
 	backendType dbmanager.Table, storage int64,
 	accessModes []api.PersistentVolumeAccessMode, json, rv string,
 ) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	if _, ok := m.PVForUID[uid]; ok {
+		log.Printf("Inserted duplicate key:  PV %s", uid)
+		return
+	}
 	nfsID := 0
 	iscsiID := 0
 
@@ -124,65 +159,82 @@ func (m *MockManager) InsertPV(
 	default:
 		log.Fatal("Unrecognized backend type when inserting PV:  ", backendType)
 	}
+	m.recorded.InsertPV(uid, name, createTime, backendID, backendType,
+		storage, accessModes, json, rv)
 	m.PVForUID[uid] = &PVAttrs{Name: name, CreateTime: createTime,
 		NFSID: nfsID, ISCSIID: iscsiID, Storage: storage, UID: uid}
+	m.setRV(resources.PVs, resources.PVNamespace, uid, rv)
 }
 
 func (m *MockManager) InsertPVC(uid types.UID, name string,
 	createTime unversioned.Time, namespace string, storage int64,
 	accessModes []api.PersistentVolumeAccessMode,
 	json, watcherNS, rv string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recorded.InsertPVC(uid, name, createTime, namespace, storage,
+		accessModes, json, watcherNS, rv)
 	m.PVCForUID[uid] = &PVCAttrs{Name: name, CreateTime: createTime,
 		Namespace: namespace, Storage: storage, UID: uid}
+	m.setRV(resources.PVCs, watcherNS, uid, rv)
 }
 
 func (m *MockManager) InsertNFS(ipAddr, path string) int {
-	newNFSID := nfsID{ipAddr, path}
-	if id, ok := m.nfsIDMap[newNFSID]; ok {
-		return id
-	}
-	m.lastNFSID++
-	m.nfsIDMap[newNFSID] = m.lastNFSID
-	return m.lastNFSID
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.recorded.InsertNFS(ipAddr, path)
 }
 
 func (m *MockManager) InsertISCSI(
 	targetPortal, iqn string, lun int, fsType string,
 ) int {
-	newISCSIID := iscsiID{targetPortal, iqn, lun, fsType}
-	if id, ok := m.iscsiIDMap[newISCSIID]; ok {
-		return id
-	}
-	m.lastISCSIID++
-	m.iscsiIDMap[newISCSIID] = m.lastISCSIID
-	return m.lastISCSIID
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.recorded.InsertISCSI(targetPortal, iqn, lun, fsType)
 }
 
 func (m *MockManager) BindPVC(pvUID types.UID, pvcUID types.UID,
-	bindTime unversioned.Time, rv string) {
-	return
+	bindTime unversioned.Time, timeSource dbmanager.TimeSource, rv string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recorded.BindPVC(pvUID, pvcUID, bindTime, timeSource, rv)
+	m.setRV(resources.PVs, resources.PVNamespace, pvUID, rv)
 }
 
 func (m *MockManager) DeletePod(uid types.UID, deleteTime unversioned.Time,
-	watcherNS, rv string) {
+	timeSource dbmanager.TimeSource, watcherNS, rv string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recorded.DeletePod(uid, deleteTime, timeSource, watcherNS, rv)
 	delete(m.PodForUID, uid)
 	m.Deletions++
+	m.setRV(resources.Pods, watcherNS, uid, rv)
 }
 func (m *MockManager) DeletePV(uid types.UID, deleteTime unversioned.Time,
-	rv string) {
+	timeSource dbmanager.TimeSource, rv string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recorded.DeletePV(uid, deleteTime, timeSource, rv)
 	delete(m.PVForUID, uid)
 	m.Deletions++
+	m.setRV(resources.PVs, resources.PVNamespace, uid, rv)
 }
 func (m *MockManager) DeletePVC(uid types.UID, deleteTime unversioned.Time,
-	watcherNS, rv string) {
+	timeSource dbmanager.TimeSource, watcherNS, rv string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recorded.DeletePVC(uid, deleteTime, timeSource, watcherNS, rv)
 	delete(m.PVCForUID, uid)
 	m.Deletions++
+	m.setRV(resources.PVCs, watcherNS, uid, rv)
 }
 
 func (m *MockManager) UpdatePV(
 	uid types.UID, backendID int, backendType dbmanager.Table, storage int64,
 	accessModes []api.PersistentVolumeAccessMode, json, rv string,
 ) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
 	nfsID := 0
 	iscsiID := 0
 
@@ -194,27 +246,82 @@ func (m *MockManager) UpdatePV(
 	default:
 		log.Fatal("Unrecognized backend type when inserting PV:  ", backendType)
 	}
+	m.recorded.UpdatePV(uid, backendID, backendType, storage, accessModes,
+		json, rv)
 	pv := m.PVForUID[uid].(*PVAttrs)
 	pv.NFSID = nfsID
 	pv.ISCSIID = iscsiID
 	pv.Storage = storage
+	m.setRV(resources.PVs, resources.PVNamespace, uid, rv)
 }
 
 func (m *MockManager) UpdatePVC(uid types.UID, storage int64,
 	accessModes []api.PersistentVolumeAccessMode,
 	json, watcherNS, rv string) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.recorded.UpdatePVC(uid, storage, accessModes, json, watcherNS, rv)
 	pvc := m.PVCForUID[uid].(*PVCAttrs)
 	pvc.Storage = storage
+	m.setRV(resources.PVCs, watcherNS, uid, rv)
 }
 
 func (m *MockManager) GetRV(resource resources.ResourceType,
 	namespace string) string {
-	// TODO:  Actually emulate changing rvs over time?
-
 	if m.invalidRVs {
 		return "1"
 	}
-	return ""
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.rvs[rvKey{resource, namespace}]
+}
+
+func (m *MockManager) ObjectRV(uid types.UID) string {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	return m.objectRVs[uid]
+}
+
+// setRV records rv as the latest RV for resource in the watched namespace and
+// for the object with the given UID, unless either has already seen a newer
+// one.  The caller must hold the mutex.
+func (m *MockManager) setRV(resource resources.ResourceType,
+	namespace string, uid types.UID, rv string) {
+
+	if rv == "" {
+		return
+	}
+	key := rvKey{resource, namespace}
+	if dbmanager.NewerRV(rv, m.rvs[key]) {
+		m.rvs[key] = rv
+	}
+	if dbmanager.NewerRV(rv, m.objectRVs[uid]) {
+		m.objectRVs[uid] = rv
+	}
+}
+
+func (m *MockManager) ListPVs() ([]dbmanager.PVRecord, error) {
+	return m.recorded.ListPVs()
+}
+
+func (m *MockManager) ListPVCs() ([]dbmanager.PVCRecord, error) {
+	return m.recorded.ListPVCs()
+}
+
+func (m *MockManager) ListPodMounts() ([]dbmanager.PodMountRecord, error) {
+	return m.recorded.ListPodMounts()
+}
+
+func (m *MockManager) ListContainers() ([]dbmanager.ContainerRecord, error) {
+	return m.recorded.ListContainers()
+}
+
+func (m *MockManager) ListNFS() ([]dbmanager.NFSRecord, error) {
+	return m.recorded.ListNFS()
+}
+
+func (m *MockManager) ListISCSI() ([]dbmanager.ISCSIRecord, error) {
+	return m.recorded.ListISCSI()
 }
 
 func (m *MockManager) ValidateConnection() error {
@@ -224,14 +331,13 @@ func (m *MockManager) ValidateConnection() error {
 
 func New(invalidRVs bool) dbmanager.DBManager {
 	return &MockManager{
-		nfsIDMap:    make(map[nfsID]int),
-		iscsiIDMap:  make(map[iscsiID]int),
-		lastNFSID:   0,
-		lastISCSIID: 0,
-		PodForUID:   make(map[types.UID]ResourceAttrs),
-		PVForUID:    make(map[types.UID]ResourceAttrs),
-		PVCForUID:   make(map[types.UID]ResourceAttrs),
-		Deletions:   0,
-		invalidRVs:  invalidRVs,
+		recorded:   memory.New().(recorder),
+		PodForUID:  make(map[types.UID]ResourceAttrs),
+		PVForUID:   make(map[types.UID]ResourceAttrs),
+		PVCForUID:  make(map[types.UID]ResourceAttrs),
+		Deletions:  0,
+		invalidRVs: invalidRVs,
+		rvs:        make(map[rvKey]string),
+		objectRVs:  make(map[types.UID]string),
 	}
 }
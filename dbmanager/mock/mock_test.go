@@ -18,6 +18,9 @@ package mock
 
 import (
 	"testing"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/conformance"
 )
 
 const (
@@ -79,3 +82,9 @@ func TestInsertISCSI(t *testing.T) {
 		t.Error("Expected duplicate ISCSI ID for duplicate lun data.")
 	}
 }
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) dbmanager.DBManager {
+		return New(false)
+	})
+}
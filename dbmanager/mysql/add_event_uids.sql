@@ -0,0 +1,14 @@
+-- Adds the uid column to an event_log table created before it existed, so
+-- that pruning removes the events of pruned pods.  The UID of each logged
+-- event is taken from the first "uid" in its body, which the API server
+-- always writes in the object's metadata before any owner references.
+-- Events of pods that were pruned before the column existed are then
+-- removed, so that rebuilding doesn't restore those pods.  No tracker should
+-- be writing to the database while this runs.
+ALTER TABLE event_log ADD COLUMN uid VARCHAR(64) NOT NULL DEFAULT ''
+	AFTER namespace, ADD KEY (uid);
+UPDATE event_log SET uid = SUBSTRING_INDEX(SUBSTRING_INDEX(SUBSTRING_INDEX(
+	body, '"uid":"', 2), '"uid":"', -1), '"', 1)
+	WHERE body LIKE '%"uid":"%';
+DELETE FROM event_log WHERE resource = 'pods' AND uid NOT IN
+	(SELECT uid FROM pod);
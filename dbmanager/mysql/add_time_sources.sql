@@ -0,0 +1,9 @@
+-- Adds the time source columns to a database created before they existed.
+-- Pod deletion times always came from the pod itself, so they are marked
+-- exact; PV and PVC times are left unknown, since they may have been either.
+ALTER TABLE pv ADD COLUMN delete_time_source VARCHAR(16) AFTER delete_time;
+ALTER TABLE pvc ADD COLUMN bind_time_source VARCHAR(16) AFTER bind_time;
+ALTER TABLE pvc ADD COLUMN delete_time_source VARCHAR(16) AFTER delete_time;
+ALTER TABLE pod ADD COLUMN delete_time_source VARCHAR(16) AFTER delete_time;
+ALTER TABLE event_log ADD COLUMN resync BOOL NOT NULL DEFAULT FALSE;
+UPDATE pod SET delete_time_source = 'exact' WHERE delete_time IS NOT NULL;
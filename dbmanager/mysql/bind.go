@@ -33,8 +33,9 @@ func (m *mySQLManager) initBindStatements() (err error) {
 	m.bindStatements = make(map[dbmanager.Table]*sql.Stmt)
 
 	m.bindStatements[dbmanager.PVC], err = m.db.Prepare(
-		"INSERT INTO pvc (uid, pv_uid, bind_time) VALUES (?, ?, ?) " +
-			"ON DUPLICATE KEY UPDATE pv_uid = ?, bind_time = ?",
+		"INSERT INTO pvc (uid, pv_uid, bind_time, bind_time_source) VALUES " +
+			"(?, ?, ?, ?) ON DUPLICATE KEY UPDATE pv_uid = ?, bind_time = ?, " +
+			"bind_time_source = ?",
 	)
 	if err != nil {
 		log.Print("Unable to create PVC bind statement: ", err)
@@ -55,7 +56,7 @@ func (m *mySQLManager) destroyBindStatements() {
 }
 
 func (m *mySQLManager) BindPVC(pvUID types.UID, pvcUID types.UID,
-	bindTime unversioned.Time, rv string) {
+	bindTime unversioned.Time, timeSource dbmanager.TimeSource, rv string) {
 
 	var err error
 
@@ -63,7 +64,8 @@ func (m *mySQLManager) BindPVC(pvUID types.UID, pvcUID types.UID,
 		func(tx *sql.Tx) error {
 			rows, err := m.doTxStatementCheckRows(tx, "bind", dbmanager.PVC,
 				m.bindStatements, string(pvcUID), string(pvUID),
-				bindTime.Time, string(pvUID), bindTime.Time)
+				bindTime.Time, string(timeSource), string(pvUID),
+				bindTime.Time, string(timeSource))
 			if err != nil {
 				return err
 			}
@@ -74,7 +76,8 @@ func (m *mySQLManager) BindPVC(pvUID types.UID, pvcUID types.UID,
 			}
 			// This looks odd, but the resource version will correspond to the
 			// RV of the PV, not the PVC.
-			return m.updateRV(tx, resources.PVs, resources.PVNamespace, rv)
+			return m.updateRV(tx, resources.PVs, resources.PVNamespace, pvUID,
+				rv)
 		},
 	)
 	if err != nil {
@@ -50,7 +50,8 @@ func TestBasicBind(t *testing.T) {
 	rv++
 
 	bind_time := unversioned.Now()
-	manager.BindPVC(pv_uid, pvc_uid, bind_time, strconv.Itoa(rv))
+	manager.BindPVC(pv_uid, pvc_uid, bind_time, dbmanager.TimeObserved,
+		strconv.Itoa(rv))
 
 	correct := tu.ValidateResult(t, "SELECT uid, name, create_time,"+
 		" bind_time, delete_time, pv_uid, namespace, json FROM pvc WHERE uid "+
@@ -83,7 +84,7 @@ func TestOutOfOrderBind(t *testing.T) {
 		pv_storage, pv_access_modes, pv_json, "400")
 
 	bind_time := unversioned.Now()
-	manager.BindPVC(pv_uid, pvc_uid, bind_time, "401")
+	manager.BindPVC(pv_uid, pvc_uid, bind_time, dbmanager.TimeObserved, "401")
 	tu.ValidateResourceVersion(t, resources.PVs, resources.PVNamespace, "401")
 
 	correct := tu.ValidateResult(t, "SELECT uid, create_time, bind_time, "+
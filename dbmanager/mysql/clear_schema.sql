@@ -5,5 +5,10 @@ DROP TABLE IF EXISTS pod;
 DROP TABLE IF EXISTS pod_mount;
 DROP TABLE IF EXISTS container;
 DROP TABLE IF EXISTS resource_version;
+DROP TABLE IF EXISTS object_version;
 DROP TABLE IF EXISTS nfs;
 DROP TABLE IF EXISTS iscsi;
+DROP TABLE IF EXISTS lease;
+DROP TABLE IF EXISTS resource_revision;
+DROP TABLE IF EXISTS event_log;
+DROP TABLE IF EXISTS mount_summary;
@@ -0,0 +1,44 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mysql
+
+import (
+	"log"
+	"testing"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/conformance"
+)
+
+func TestConformance(t *testing.T) {
+	conformance.Run(t, func(t *testing.T) dbmanager.DBManager {
+		manager.clearTestTables()
+		_, err := manager.db.Exec("DELETE FROM resource_version WHERE "+
+			"namespace LIKE ? OR namespace LIKE ?",
+			conformance.WatcherNamespace, conformance.WatcherNamespaceAlt)
+		if err != nil {
+			log.Fatal("Unable to delete conformance resource versions: ", err)
+		}
+		_, err = manager.db.Exec("DELETE FROM event_log WHERE namespace "+
+			"LIKE ? OR namespace LIKE ?", conformance.WatcherNamespace,
+			conformance.WatcherNamespaceAlt)
+		if err != nil {
+			log.Fatal("Unable to delete conformance events: ", err)
+		}
+		return manager
+	})
+}
@@ -34,24 +34,24 @@ func (m *mySQLManager) initDeleteStatements() (err error) {
 
 	m.deleteStatements = make(map[dbmanager.Table]*sql.Stmt)
 
-	deleteStmt, err = m.db.Prepare("UPDATE pod SET delete_time=? WHERE " +
-		"uid=?")
+	deleteStmt, err = m.db.Prepare("UPDATE pod SET delete_time=?, " +
+		"delete_time_source=? WHERE uid=?")
 	if err != nil {
 		log.Print("Error creating pod delete statement:  ", err)
 		return
 	}
 	m.deleteStatements[dbmanager.Pod] = deleteStmt
 
-	deleteStmt, err = m.db.Prepare("UPDATE pvc SET delete_time=? WHERE " +
-		"uid=?")
+	deleteStmt, err = m.db.Prepare("UPDATE pvc SET delete_time=?, " +
+		"delete_time_source=? WHERE uid=?")
 	if err != nil {
 		log.Print("Error creating pvc delete statement:  ", err)
 		return
 	}
 	m.deleteStatements[dbmanager.PVC] = deleteStmt
 
-	deleteStmt, err = m.db.Prepare("UPDATE pv SET delete_time=? WHERE " +
-		"uid=?")
+	deleteStmt, err = m.db.Prepare("UPDATE pv SET delete_time=?, " +
+		"delete_time_source=? WHERE uid=?")
 	if err != nil {
 		log.Print("Error creating pv delete statement:  ", err)
 		return
@@ -72,13 +72,14 @@ func (m *mySQLManager) initDeleteStatements() (err error) {
 }
 
 func (m *mySQLManager) DeletePod(uid types.UID, deleteTime unversioned.Time,
-	watcher_ns, rv string) {
+	timeSource dbmanager.TimeSource, watcher_ns, rv string) {
 	var err error
 
 	err = m.runTx(
 		func(tx *sql.Tx) error {
 			if err = m.doTxStatement(tx, "delete", dbmanager.Pod,
-				m.deleteStatements, deleteTime.Time, string(uid)); err != nil {
+				m.deleteStatements, deleteTime.Time, string(timeSource),
+				string(uid)); err != nil {
 				err = fmt.Errorf("Basic delete failed:  %s\n", err)
 				return err
 			}
@@ -107,7 +108,7 @@ func (m *mySQLManager) DeletePod(uid types.UID, deleteTime unversioned.Time,
 					return err
 				}
 			}
-			return m.updateRV(tx, resources.Pods, watcher_ns, rv)
+			return m.updateRV(tx, resources.Pods, watcher_ns, uid, rv)
 		},
 	)
 	if err != nil {
@@ -115,18 +116,39 @@ func (m *mySQLManager) DeletePod(uid types.UID, deleteTime unversioned.Time,
 	}
 }
 
+// resolveMounts matches every mount of the PVC called name in namespace
+// again, after a PVC of that name has been inserted or deleted there, so that
+// each mount ends up matched as if its pod had been inserted after every PVC
+// event.  Mounts of pods that never started are cleared.
+func (m *mySQLManager) resolveMounts(tx *sql.Tx, name,
+	namespace string) error {
+
+	_, err := tx.Stmt(m.resolvePVCMounts).Exec(name, namespace)
+	if err != nil {
+		return fmt.Errorf("Unable to match mounts of %s/%s:  %s", namespace,
+			name, err)
+	}
+	_, err = tx.Stmt(m.clearUnstartedMounts).Exec(name, namespace)
+	if err != nil {
+		return fmt.Errorf("Unable to clear mounts of unstarted pods:  %s",
+			err)
+	}
+	return nil
+}
+
 func (m *mySQLManager) DeletePV(uid types.UID, deleteTime unversioned.Time,
-	rv string) {
+	timeSource dbmanager.TimeSource, rv string) {
 
 	var err error
 
 	err = m.runTx(
 		func(tx *sql.Tx) error {
 			if err = m.doTxStatement(tx, "delete", dbmanager.PV,
-				m.deleteStatements, deleteTime.Time, string(uid)); err != nil {
+				m.deleteStatements, deleteTime.Time, string(timeSource),
+				string(uid)); err != nil {
 				return err
 			}
-			return m.updateRV(tx, resources.PVs, resources.PVNamespace, rv)
+			return m.updateRV(tx, resources.PVs, resources.PVNamespace, uid, rv)
 		},
 	)
 	if err != nil {
@@ -135,16 +157,31 @@ func (m *mySQLManager) DeletePV(uid types.UID, deleteTime unversioned.Time,
 }
 
 func (m *mySQLManager) DeletePVC(uid types.UID, deleteTime unversioned.Time,
-	watcher_ns, rv string) {
+	timeSource dbmanager.TimeSource, watcher_ns, rv string) {
 	var err error
 
 	err = m.runTx(
 		func(tx *sql.Tx) error {
 			if err = m.doTxStatement(tx, "delete", dbmanager.PVC,
-				m.deleteStatements, deleteTime.Time, string(uid)); err != nil {
+				m.deleteStatements, deleteTime.Time, string(timeSource),
+				string(uid)); err != nil {
 				return err
 			}
-			return m.updateRV(tx, resources.PVCs, watcher_ns, rv)
+			// PVCs known only from a bind have no name yet, and so no
+			// mounts.
+			var name, namespace sql.NullString
+			err = tx.QueryRow("SELECT name, namespace FROM pvc WHERE "+
+				"uid = ?", string(uid)).Scan(&name, &namespace)
+			if err != nil && err != sql.ErrNoRows {
+				return fmt.Errorf("Unable to find PVC %s:  %s", uid, err)
+			}
+			if name.Valid {
+				err = m.resolveMounts(tx, name.String, namespace.String)
+				if err != nil {
+					return err
+				}
+			}
+			return m.updateRV(tx, resources.PVCs, watcher_ns, uid, rv)
 		},
 	)
 	if err != nil {
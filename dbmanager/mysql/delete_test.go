@@ -37,7 +37,8 @@ func TestDeletePod(t *testing.T) {
 	delete_time := unversioned.NewTime(pod_time.Add(time.Second))
 	manager.InsertPod(pod_uid, pod_name, pod_time, test_ns, nil, pod_json,
 		watcher_ns, insertRV)
-	manager.DeletePod(pod_uid, delete_time, watcher_ns, deleteRV)
+	manager.DeletePod(pod_uid, delete_time, dbmanager.TimeExact, watcher_ns,
+		deleteRV)
 	correct := tu.ValidateResult(t,
 		"SELECT uid, name, create_time, delete_time,"+
 			"namespace, json FROM pod WHERE uid LIKE '"+pod_uid+"'",
@@ -63,7 +64,8 @@ func TestDeletePVC(t *testing.T) {
 	deleteTime := unversioned.NewTime(pvcTime.Add(time.Second))
 	manager.InsertPVC(pvc_uid, pvc_name, pvcTime, test_ns, pvc_storage,
 		pvc_access_modes, pvc_json, watcher_ns, insertRV)
-	manager.DeletePVC(pvc_uid, deleteTime, watcher_ns, deleteRV)
+	manager.DeletePVC(pvc_uid, deleteTime, dbmanager.TimeExact, watcher_ns,
+		deleteRV)
 	correct := tu.ValidateResult(t,
 		"SELECT uid, name, create_time, delete_time,"+
 			"bind_time, pv_uid, namespace, json FROM pvc WHERE uid LIKE '"+
@@ -96,7 +98,7 @@ func TestDeletePV(t *testing.T) {
 	deleteTime := unversioned.NewTime(pvTime.Add(time.Second))
 	manager.InsertPV(pv_uid, pv_name, pvTime, nfsID, dbmanager.NFS, pv_storage,
 		pv_access_modes, pv_json, insertRV)
-	manager.DeletePV(pv_uid, deleteTime, deleteRV)
+	manager.DeletePV(pv_uid, deleteTime, dbmanager.TimeExact, deleteRV)
 	correct := tu.ValidateResult(t,
 		"SELECT uid, name, create_time, delete_time,"+
 			" nfs_id, json FROM pv WHERE uid like '"+pv_uid+"'",
@@ -140,7 +142,8 @@ func TestFixPodMount(t *testing.T) {
 	manager.InsertPod(pod_mount_uid, pod_mount_name, pod_time, test_ns,
 		[]resources.ContainerDesc{multiMountContainer}, pod_mount_json,
 		watcher_ns, "8")
-	manager.DeletePod(pod_mount_uid, pod_delete_time, watcher_ns, "9")
+	manager.DeletePod(pod_mount_uid, pod_delete_time, dbmanager.TimeExact,
+		watcher_ns, "9")
 	if correct := tu.ValidateResult(t,
 		"SELECT count(*) FROM pod_mount WHERE pod_uid LIKE '"+pod_mount_uid+
 			"'",
@@ -154,8 +157,8 @@ func TestFixPodMount(t *testing.T) {
 		pod_future_time, test_ns_alt,
 		[]resources.ContainerDesc{multiMountContainer},
 		pod_mount_future_json, watcher_ns, "10")
-	manager.DeletePod(pod_mount_future_uid, pod_future_delete, watcher_ns,
-		"11")
+	manager.DeletePod(pod_mount_future_uid, pod_future_delete,
+		dbmanager.TimeExact, watcher_ns, "11")
 	if correct := tu.ValidateResult(t,
 		"SELECT pod_uid, pvc_uid, pvc_name FROM "+
 			"pod_mount WHERE pod_uid LIKE '"+pod_mount_future_uid+"' AND "+
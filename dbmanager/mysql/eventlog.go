@@ -0,0 +1,118 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/go-sql-driver/mysql"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// derivedTables lists the tables that ClearDerived empties.  mount_summary
+// isn't among them, since the events of the pods it summarizes are pruned
+// along with the pods.
+var derivedTables = []dbmanager.Table{dbmanager.PodMount, dbmanager.Container,
+	dbmanager.Pod, dbmanager.PVC, dbmanager.PV, dbmanager.NFS,
+	dbmanager.ISCSI, dbmanager.ObjectVersion}
+
+func (m *mySQLManager) initEventLogQueries() (err error) {
+	m.eventLogQueries = make(map[string]*sql.Stmt)
+	queries := map[string]string{
+		"append": "INSERT INTO event_log (receive_time, resource, " +
+			"namespace, uid, body, resync) VALUES (?, ?, ?, ?, ?, ?)",
+		"list": "SELECT id, receive_time, resource, namespace, uid, body, " +
+			"resync FROM event_log WHERE id > ? ORDER BY id LIMIT ?",
+	}
+	for name, query := range queries {
+		m.eventLogQueries[name], err = m.db.Prepare(query)
+		if err != nil {
+			log.Printf("Unable to create event log %s query:  %s", name, err)
+			return
+		}
+	}
+	return
+}
+
+func (m *mySQLManager) destroyEventLogQueries() {
+	for _, stmt := range m.eventLogQueries {
+		stmt.Close()
+	}
+}
+
+func (m *mySQLManager) AppendEvent(e dbmanager.EventRecord) error {
+	return m.runTx(func(tx *sql.Tx) error {
+		_, err := tx.Stmt(m.eventLogQueries["append"]).Exec(e.Time,
+			string(e.Resource), e.Namespace, string(e.UID), e.JSON,
+			e.Resync)
+		if err != nil {
+			return fmt.Errorf("Unable to append %s event:  %s", e.Resource,
+				err)
+		}
+		return nil
+	})
+}
+
+func (m *mySQLManager) ListEvents(after int64,
+	limit int) ([]dbmanager.EventRecord, error) {
+
+	var ret []dbmanager.EventRecord
+
+	rows, err := m.eventLogQueries["list"].Query(after, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list events:  %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			e           dbmanager.EventRecord
+			receiveTime mysql.NullTime
+			resource    string
+			uid         string
+		)
+		if err = rows.Scan(&e.ID, &receiveTime, &resource, &e.Namespace,
+			&uid, &e.JSON, &e.Resync); err != nil {
+			return nil, fmt.Errorf("Unable to scan event row:  %s", err)
+		}
+		e.Time = receiveTime.Time
+		e.Resource = resources.ResourceType(resource)
+		e.UID = types.UID(uid)
+		ret = append(ret, e)
+	}
+	return ret, rows.Err()
+}
+
+// ClearDerived empties the derived tables in a single transaction, so that
+// a failure leaves them as they were.  DELETE is used rather than TRUNCATE,
+// which would commit implicitly.
+func (m *mySQLManager) ClearDerived() error {
+	return m.runTx(func(tx *sql.Tx) error {
+		for _, table := range derivedTables {
+			if _, err := tx.Exec("DELETE FROM " + string(table)); err != nil {
+				return fmt.Errorf("Unable to clear table %s:  %s", table,
+					err)
+			}
+		}
+		return nil
+	})
+}
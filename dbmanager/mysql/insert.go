@@ -90,7 +90,8 @@ func (m *mySQLManager) initInsertStatements() (err error) {
 			"FROM pvc WHERE create_time = (SELECT MAX(create_time) FROM pvc " +
 			"WHERE create_time <= ? and " +
 			"(delete_time IS NULL OR delete_time >= ?)" +
-			" and name like ?) and name like ?;")
+			" and name like ? and namespace = ?) and name like ? and " +
+			"namespace = ?;")
 	if err != nil {
 		log.Print("Unable to create PodMounts insert statement: ", err)
 		return err
@@ -103,7 +104,8 @@ func (m *mySQLManager) initInsertStatements() (err error) {
 			"FROM pvc WHERE create_time = (SELECT MIN(create_time) FROM pvc " +
 			"WHERE create_time >= ? AND " +
 			"(delete_time IS NULL OR delete_time > ?)" +
-			" AND name LIKE ?) AND name LIKE ?;")
+			" AND name LIKE ? AND namespace = ?) AND name LIKE ? AND " +
+			"namespace = ?;")
 	if err != nil {
 		log.Print("Unable to create PodMount insert statement for PVCs "+
 			"created after the pod: ", err)
@@ -121,19 +123,40 @@ func (m *mySQLManager) initInsertStatements() (err error) {
 	}
 	m.fallbackPodMount = insertStmt
 
-	// We need to update all entries corresponding to pods that haven't been
-	// deleted, since they may match this PVC.  We're assuming that
-	// users don't delete PVCs that are currently in use, so we won't see
-	// a legit entry get clobbered.  We may, however, see erroneous entries
-	// for a bit while things catch up.
+	// Every mount of a PVC's name in its namespace is matched again
+	// whenever a PVC of that name is inserted or deleted there, in the same
+	// way as when the pod is inserted, so that the result doesn't depend on
+	// the order in which the pod and PVC watches were handled.  Ties are
+	// broken by UID, as in memoryManager.
 	// NOTE THAT THIS BREAKS IF WE LOSE EVENTS.
-	m.addPVCPodMount, err = m.db.Prepare("UPDATE pod_mount m, pod p SET " +
-		"m.pvc_uid = ? WHERE m.pvc_name LIKE ? and m.pod_uid = p.uid AND " +
-		"p.delete_time IS NULL")
+	m.resolvePVCMounts, err = m.db.Prepare("UPDATE pod_mount m JOIN pod p " +
+		"ON m.pod_uid = p.uid SET m.pvc_uid = COALESCE((SELECT c.uid FROM " +
+		"pvc c WHERE c.name = m.pvc_name AND c.namespace = p.namespace " +
+		"AND c.create_time <= p.create_time AND (c.delete_time IS NULL OR " +
+		"c.delete_time >= p.create_time) ORDER BY c.create_time DESC, " +
+		"c.uid DESC LIMIT 1), (SELECT c.uid FROM pvc c WHERE c.name = " +
+		"m.pvc_name AND c.namespace = p.namespace AND c.create_time >= " +
+		"p.create_time AND (c.delete_time IS NULL OR c.delete_time > " +
+		"p.create_time) ORDER BY c.create_time, c.uid LIMIT 1)) WHERE " +
+		"m.pvc_name = ? AND p.namespace = ?")
 	if err != nil {
-		log.Print("Unable to create query to add a PVC UID to an existing",
-			"pod_mount entry: ", err)
-		m.addPVCPodMount = nil
+		log.Print("Unable to create query to match existing pod_mount "+
+			"entries to PVCs: ", err)
+		m.resolvePVCMounts = nil
+		return err
+	}
+
+	// As in DeletePod, a deleted pod with a mount matched to a PVC created
+	// after the deletion never started, so all of its mounts go.
+	m.clearUnstartedMounts, err = m.db.Prepare("DELETE m FROM pod_mount m " +
+		"JOIN pod p ON m.pod_uid = p.uid JOIN pod_mount u ON u.pod_uid = " +
+		"p.uid JOIN pvc c ON c.uid = u.pvc_uid WHERE u.pvc_name = ? AND " +
+		"p.namespace = ? AND p.delete_time IS NOT NULL AND c.create_time > " +
+		"p.delete_time")
+	if err != nil {
+		log.Print("Unable to create query to clear the mounts of pods that "+
+			"never started: ", err)
+		m.clearUnstartedMounts = nil
 		return err
 	}
 
@@ -160,17 +183,17 @@ func (m *mySQLManager) destroyInsertStatements() {
 }
 
 func (m *mySQLManager) insertPodMount(tx *sql.Tx, uid types.UID,
-	containerName string, pvcMount resources.VolumeMount,
+	namespace, containerName string, pvcMount resources.VolumeMount,
 	createTime unversioned.Time) error {
 
 	// The insert statement for PodMount takes as parameters the pod
-	// uid, the pod's creation time, and the PVC's name and finds the
-	// PVC created closest to the pod's creation time without exceeding
-	// it.
+	// uid, the pod's creation time, and the PVC's name and namespace and
+	// finds the PVC created closest to the pod's creation time without
+	// exceeding it.
 	rows, err := m.doTxStatementCheckRows(tx, "insert",
 		dbmanager.PodMount, m.insertStatements, string(uid), containerName,
 		pvcMount.Name, pvcMount.ReadOnly, createTime.Time, createTime.Time,
-		pvcMount.Name, pvcMount.Name)
+		pvcMount.Name, namespace, pvcMount.Name, namespace)
 	if err != nil {
 		return err
 	}
@@ -187,7 +210,7 @@ func (m *mySQLManager) insertPodMount(tx *sql.Tx, uid types.UID,
 	// See if the PVC was created after the pod.
 	result, err := tx.Stmt(m.latePVCPodMount).Exec(string(uid), containerName,
 		pvcMount.Name, pvcMount.ReadOnly, createTime.Time, createTime.Time,
-		pvcMount.Name, pvcMount.Name)
+		pvcMount.Name, namespace, pvcMount.Name, namespace)
 	if err != nil {
 		return err
 	}
@@ -249,10 +272,11 @@ func (m *mySQLManager) InsertPod(uid types.UID, name string,
 				return err
 			}
 			for _, pvc := range container.PVCMounts {
-				m.insertPodMount(tx, uid, container.Name, pvc, createTime)
+				m.insertPodMount(tx, uid, namespace, container.Name, pvc,
+					createTime)
 			}
 		}
-		err = m.updateRV(tx, resources.Pods, watcherNS, rv)
+		err = m.updateRV(tx, resources.Pods, watcherNS, uid, rv)
 		if err != nil {
 			log.Fatalf("Unable to update pod resource version in namespace %s:"+
 				" %s\n", watcherNS, err)
@@ -291,7 +315,7 @@ func (m *mySQLManager) InsertPV(uid types.UID, name string,
 		); err != nil {
 			return err
 		}
-		err = m.updateRV(tx, resources.PVs, resources.PVNamespace, rv)
+		err = m.updateRV(tx, resources.PVs, resources.PVNamespace, uid, rv)
 		return err
 	})
 	if err != nil {
@@ -320,12 +344,10 @@ func (m *mySQLManager) InsertPVC(uid types.UID, name string,
 			err = fmt.Errorf("PVC insert with uid %s affected unexpected "+
 				"number of rows: %d\n", uid, rows)
 		}
-		_, err = tx.Stmt(m.addPVCPodMount).Exec(string(uid), name)
-		if err != nil {
-			err = fmt.Errorf("Unable to update PVC mount table:  %s", err)
+		if err = m.resolveMounts(tx, name, namespace); err != nil {
 			return err
 		}
-		err = m.updateRV(tx, resources.PVCs, watcherNS, rv)
+		err = m.updateRV(tx, resources.PVCs, watcherNS, uid, rv)
 		return err
 	})
 	if err != nil {
@@ -353,6 +375,9 @@ func (m *mySQLManager) InsertNFS(ipAddr, path string) int {
 			log.Fatal("Unable to commit transaction: ", err)
 		}
 	}()
+	if err = m.checkFence(tx); err != nil {
+		return -1
+	}
 	nfsID = m.checkNFSExists(tx, ipAddr, path)
 	if nfsID > 0 {
 		return nfsID
@@ -297,7 +297,8 @@ func TestLatePVCMount(t *testing.T) {
 
 	manager.InsertPVC(pvc_old_uid, pod_mount_pvc_name, pvc_old_time, test_ns,
 		pvc_storage, pvc_access_modes, pvc_old_json, watcher_ns, "5")
-	manager.DeletePVC(pvc_old_uid, pvc_old_delete, watcher_ns, "6")
+	manager.DeletePVC(pvc_old_uid, pvc_old_delete, dbmanager.TimeExact,
+		watcher_ns, "6")
 	manager.InsertPVC(pvc_current_uid, pod_mount_pvc_name, pvc_current_time,
 		test_ns_alt, pvc_storage, pvc_access_modes, pvc_current_json,
 		watcher_ns_alt, "7")
@@ -329,7 +330,8 @@ func TestLatePVCLatePodMount(t *testing.T) {
 		watcher_ns, "8")
 	manager.InsertPVC(pvc_old_uid, pod_mount_pvc_name, pvc_old_time, test_ns,
 		pvc_storage, pvc_access_modes, pvc_old_json, watcher_ns, "5")
-	manager.DeletePVC(pvc_old_uid, pvc_old_delete, watcher_ns, "6")
+	manager.DeletePVC(pvc_old_uid, pvc_old_delete, dbmanager.TimeExact,
+		watcher_ns, "6")
 	manager.InsertPVC(pvc_current_uid, pod_mount_pvc_name, pvc_current_time,
 		test_ns_alt, pvc_storage, pvc_access_modes, pvc_current_json,
 		watcher_ns_alt, "7")
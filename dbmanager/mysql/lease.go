@@ -0,0 +1,146 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+// Expiration times are computed with NOW(6) so that they only depend on the
+// database's clock.
+func (m *mySQLManager) initLeaseQueries() (err error) {
+	m.leaseQueries = make(map[string]*sql.Stmt)
+	queries := map[string]string{
+		"select": "SELECT holder, token, expire_time <= NOW(6) FROM lease " +
+			"WHERE name = ? FOR UPDATE",
+		"insert": "INSERT INTO lease (name, holder, token, expire_time) " +
+			"VALUES (?, ?, 1, NOW(6) + INTERVAL ? MICROSECOND)",
+		"renew": "UPDATE lease SET expire_time = NOW(6) + INTERVAL ? " +
+			"MICROSECOND WHERE name = ?",
+		"takeover": "UPDATE lease SET holder = ?, token = token + 1, " +
+			"expire_time = NOW(6) + INTERVAL ? MICROSECOND WHERE name = ?",
+		"release": "UPDATE lease SET expire_time = NOW(6) WHERE name = ? " +
+			"AND holder = ?",
+		// The shared lock keeps the lease from changing hands until the
+		// fenced transaction commits.
+		"fence": "SELECT token FROM lease WHERE name = ? LOCK IN SHARE MODE",
+	}
+	for name, query := range queries {
+		m.leaseQueries[name], err = m.db.Prepare(query)
+		if err != nil {
+			log.Printf("Unable to create lease %s query:  %s", name, err)
+			return
+		}
+	}
+	return
+}
+
+func (m *mySQLManager) destroyLeaseQueries() {
+	for _, stmt := range m.leaseQueries {
+		stmt.Close()
+	}
+}
+
+// AcquireLease can't use runTx, since a duplicate key error on insert means
+// that another holder beat us to creating the lease, rather than something
+// that can be ignored.
+func (m *mySQLManager) AcquireLease(name, holder string,
+	ttl time.Duration) (token int64, held bool, err error) {
+
+	var (
+		current string
+		expired bool
+	)
+
+	micros := int64(ttl / time.Microsecond)
+	tx, err := m.db.Begin()
+	if err != nil {
+		return 0, false, fmt.Errorf("Unable to start transaction:  %s", err)
+	}
+	defer func() {
+		if err != nil {
+			tx.Rollback()
+			return
+		}
+		if err = tx.Commit(); err != nil {
+			held = false
+		}
+	}()
+
+	err = tx.Stmt(m.leaseQueries["select"]).QueryRow(name).Scan(&current,
+		&token, &expired)
+	switch {
+	case err == sql.ErrNoRows:
+		// If another holder inserts the lease first, this fails with a
+		// duplicate key error, and we'll see its row next time around.
+		_, err = tx.Stmt(m.leaseQueries["insert"]).Exec(name, holder, micros)
+		if mysqlErr, ok := err.(*mysql.MySQLError); ok &&
+			mysqlErr.Number == ErrDuplicateKey {
+			return 0, false, nil
+		}
+		return 1, err == nil, err
+	case err != nil:
+		return 0, false, fmt.Errorf("Unable to read lease %s:  %s", name,
+			err)
+	case current == holder:
+		_, err = tx.Stmt(m.leaseQueries["renew"]).Exec(micros, name)
+		return token, err == nil, err
+	case expired:
+		_, err = tx.Stmt(m.leaseQueries["takeover"]).Exec(holder, micros,
+			name)
+		return token + 1, err == nil, err
+	}
+	return 0, false, nil
+}
+
+func (m *mySQLManager) ReleaseLease(name, holder string) error {
+	_, err := m.leaseQueries["release"].Exec(name, holder)
+	return err
+}
+
+func (m *mySQLManager) Fence(name string, token int64) {
+	m.fenceMutex.Lock()
+	defer m.fenceMutex.Unlock()
+	m.fenceName = name
+	m.fenceToken = token
+}
+
+// checkFence returns dbmanager.ErrFenced if writes are fenced and the lease
+// has passed to another holder.  It must be called within the transaction
+// being fenced.
+func (m *mySQLManager) checkFence(tx *sql.Tx) error {
+	var token int64
+
+	m.fenceMutex.Lock()
+	name, expected := m.fenceName, m.fenceToken
+	m.fenceMutex.Unlock()
+	if name == "" {
+		return nil
+	}
+	err := tx.Stmt(m.leaseQueries["fence"]).QueryRow(name).Scan(&token)
+	if err == sql.ErrNoRows || (err == nil && token != expected) {
+		return dbmanager.ErrFenced
+	}
+	return err
+}
@@ -0,0 +1,67 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mysql
+
+import (
+	"database/sql"
+	"testing"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+func TestLease(t *testing.T) {
+	manager.clearTestTables()
+	defer manager.Fence("", 0)
+
+	token, held, err := manager.AcquireLease(test_lease, "holder-1",
+		time.Minute)
+	if err != nil || !held || token != 1 {
+		t.Fatalf("Expected to acquire new lease with token 1; got %d, %t, "+
+			"%v", token, held, err)
+	}
+	token, held, err = manager.AcquireLease(test_lease, "holder-2",
+		time.Minute)
+	if err != nil || held {
+		t.Fatalf("Acquired lease held by another holder:  %t, %v", held, err)
+	}
+	token, held, err = manager.AcquireLease(test_lease, "holder-1",
+		time.Minute)
+	if err != nil || !held || token != 1 {
+		t.Fatalf("Unable to renew lease:  %d, %t, %v", token, held, err)
+	}
+
+	manager.Fence(test_lease, token)
+	noop := func(tx *sql.Tx) error { return nil }
+	if err = manager.runTx(noop); err != nil {
+		t.Error("Fenced write failed while holding lease: ", err)
+	}
+
+	if err = manager.ReleaseLease(test_lease, "holder-1"); err != nil {
+		t.Fatal("Unable to release lease: ", err)
+	}
+	token, held, err = manager.AcquireLease(test_lease, "holder-2",
+		time.Minute)
+	if err != nil || !held || token != 2 {
+		t.Fatalf("Expected to take over released lease with token 2; got "+
+			"%d, %t, %v", token, held, err)
+	}
+	if err = manager.runTx(noop); err != dbmanager.ErrFenced {
+		t.Errorf("Expected write from deposed holder to be fenced; got %v",
+			err)
+	}
+}
@@ -0,0 +1,33 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mysql
+
+import (
+	"github.com/netapp/kubevoltracker/metrics"
+)
+
+var (
+	txLatency = metrics.NewHistogramVec(
+		"kubevoltracker_db_transaction_seconds",
+		"Time taken to run a database transaction, including retries.",
+		metrics.DefBuckets,
+	)
+	deadlockRetries = metrics.NewCounterVec(
+		"kubevoltracker_db_deadlock_retries_total",
+		"Database transactions retried due to deadlocks.",
+	)
+)
@@ -22,6 +22,7 @@ import (
 	"database/sql"
 	"fmt"
 	"log"
+	"sync"
 	"time"
 
 	"github.com/go-sql-driver/mysql"
@@ -49,16 +50,38 @@ type mySQLManager struct {
 	updateStatements map[dbmanager.Table]*sql.Stmt
 
 	existenceQueries map[dbmanager.Table]*sql.Stmt
+	listQueries      map[dbmanager.Table]*sql.Stmt
 
 	lastIDQuery      *sql.Stmt
 	latePVCPodMount  *sql.Stmt // Used if the PVC was created after the pod.
 	fallbackPodMount *sql.Stmt // Used if we haven't seen the PVC yet.
-	addPVCPodMount   *sql.Stmt
+
+	resolvePVCMounts     *sql.Stmt // Matches mounts when PVCs change.
+	clearUnstartedMounts *sql.Stmt
 
 	clearBadPodMount *sql.Stmt // Cleans up incorrect pod mounts from latePVCPodMount
 
 	updateRVQuery *sql.Stmt
 	getRVQuery    *sql.Stmt
+	// rvQueries holds the remaining resource version queries, including
+	// those for the per-object resource versions.
+	rvQueries map[string]*sql.Stmt
+
+	leaseQueries map[string]*sql.Stmt
+
+	revisionQueries map[string]*sql.Stmt
+	// retention is applied to each object's revisions as they're recorded.
+	retentionMutex sync.Mutex
+	retention      dbmanager.RevisionRetention
+
+	eventLogQueries map[string]*sql.Stmt
+	pruneQueries    map[string]*sql.Stmt
+
+	// If fenceName is set, writes fail unless the named lease still has
+	// fenceToken.
+	fenceMutex sync.Mutex
+	fenceName  string
+	fenceToken int64
 }
 
 // Destroy tears down all structures associated with a mySQLManager object,
@@ -71,7 +94,12 @@ func (dbm *mySQLManager) Destroy() {
 	dbm.destroyBindStatements()
 
 	dbm.destroyExistenceQueries()
+	dbm.destroyListQueries()
 	dbm.destroyRVQueries()
+	dbm.destroyLeaseQueries()
+	dbm.destroyRevisionQueries()
+	dbm.destroyEventLogQueries()
+	dbm.destroyPruneQueries()
 
 	if dbm.lastIDQuery != nil {
 		dbm.lastIDQuery.Close()
@@ -82,8 +110,11 @@ func (dbm *mySQLManager) Destroy() {
 	if dbm.fallbackPodMount != nil {
 		dbm.fallbackPodMount.Close()
 	}
-	if dbm.addPVCPodMount != nil {
-		dbm.addPVCPodMount.Close()
+	if dbm.resolvePVCMounts != nil {
+		dbm.resolvePVCMounts.Close()
+	}
+	if dbm.clearUnstartedMounts != nil {
+		dbm.clearUnstartedMounts.Close()
 	}
 	if dbm.clearBadPodMount != nil {
 		dbm.clearBadPodMount.Close()
@@ -126,6 +157,9 @@ func (m *mySQLManager) runTxActual(txFunc func(tx *sql.Tx) error) (err error) {
 		}
 		err = tx.Commit()
 	}()
+	if err = m.checkFence(tx); err != nil {
+		return
+	}
 	err = txFunc(tx)
 	return
 }
@@ -133,15 +167,21 @@ func (m *mySQLManager) runTxActual(txFunc func(tx *sql.Tx) error) (err error) {
 // runTx serves as a wrapper around runTxActual to make it easier to retry
 // the function if a deadlock results.
 func (m *mySQLManager) runTx(txFunc func(tx *sql.Tx) error) (err error) {
+	start := time.Now()
+	defer func() {
+		txLatency.Observe(time.Since(start).Seconds())
+	}()
+
 	success := false
 	for !success && err == nil {
-		err := m.runTxActual(txFunc)
+		err = m.runTxActual(txFunc)
 		if err == nil {
 			success = true
 		} else if mySQLErr, ok := err.(*mysql.MySQLError); ok && mySQLErr.Number == deadlockErrNo {
 			// If the error is a deadlock, we need to retry
 			// TODO:  Insert max number of attempts?
 			err = nil
+			deadlockRetries.Inc()
 			// TODO:  Is this sleep really necessary?
 			time.Sleep(time.Millisecond * 50)
 		}
@@ -197,6 +237,11 @@ func (m *mySQLManager) ValidateConnection() error {
 	return err
 }
 
+// Ping checks the connection once, unlike ValidateConnection.
+func (m *mySQLManager) Ping() error {
+	return m.db.Ping()
+}
+
 // NewParams returns a DBManager instance backed by a MySQL database, using
 // the supplied parameter string to modify the connection, as described here:
 // https://github.com/go-sql-driver/mysql
@@ -258,6 +303,36 @@ func NewParams(username, password, dbAddr, dbName string,
 		log.Fatal("Unable to create resource version queries")
 	}
 
+	err = m.initListQueries()
+	if err != nil {
+		log.Fatal("Unable to create list queries")
+		goto cleanup
+	}
+
+	err = m.initLeaseQueries()
+	if err != nil {
+		log.Fatal("Unable to create lease queries")
+		goto cleanup
+	}
+
+	err = m.initRevisionQueries()
+	if err != nil {
+		log.Fatal("Unable to create revision queries")
+		goto cleanup
+	}
+
+	err = m.initEventLogQueries()
+	if err != nil {
+		log.Fatal("Unable to create event log queries")
+		goto cleanup
+	}
+
+	err = m.initPruneQueries()
+	if err != nil {
+		log.Fatal("Unable to create prune queries")
+		goto cleanup
+	}
+
 	m.lastIDQuery, err = m.db.Prepare("SELECT LAST_INSERT_ID()")
 	if err != nil {
 		log.Fatal("Unable to prepare statement to get the most recent " +
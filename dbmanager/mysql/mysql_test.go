@@ -107,6 +107,8 @@ const (
 
 	pvc_update_storage = int64(900)
 	pvc_update_json    = "Updated PVC JSON"
+
+	test_lease = "test-lease"
 )
 
 var (
@@ -198,6 +200,25 @@ func (manager *mySQLManager) clearTestTables() {
 	if err != nil {
 		log.Fatal("Unable to delete resource versions: ", err)
 	}
+	_, err = manager.db.Exec("DELETE FROM object_version WHERE uid " +
+		"LIKE 'test-%';")
+	if err != nil {
+		log.Fatal("Unable to delete test object resource versions: ", err)
+	}
+	_, err = manager.db.Exec("DELETE FROM lease WHERE name LIKE 'test-%';")
+	if err != nil {
+		log.Fatal("Unable to delete test leases: ", err)
+	}
+	_, err = manager.db.Exec("DELETE FROM resource_revision WHERE uid " +
+		"LIKE 'test-%';")
+	if err != nil {
+		log.Fatal("Unable to delete test revisions: ", err)
+	}
+	_, err = manager.db.Exec("DELETE FROM mount_summary WHERE namespace " +
+		"LIKE 'test-%';")
+	if err != nil {
+		log.Fatal("Unable to delete test mount summaries: ", err)
+	}
 }
 
 func TestMain(m *testing.M) {
@@ -0,0 +1,273 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+func (m *mySQLManager) initPruneQueries() (err error) {
+	m.pruneQueries = make(map[string]*sql.Stmt)
+	queries := map[string]string{
+		"deleted": "SELECT uid, name, namespace, create_time, delete_time, " +
+			"delete_time_source, json FROM pod WHERE delete_time < ? ORDER " +
+			"BY delete_time, uid LIMIT ?",
+		"containers": "SELECT name, image, command FROM container WHERE " +
+			"pod_uid = ? ORDER BY id",
+		"mounts": "SELECT container_name, pvc_name, pvc_uid, read_only " +
+			"FROM pod_mount WHERE pod_uid = ?",
+		"pod": "SELECT namespace, create_time, delete_time FROM pod WHERE " +
+			"uid = ? AND delete_time IS NOT NULL FOR UPDATE",
+		// Each PVC is counted once per pod, however many of its containers
+		// mount it.
+		"mountedPVCs": "SELECT DISTINCT IFNULL(pvc_uid, ''), " +
+			"IFNULL(pvc_name, '') FROM pod_mount WHERE pod_uid = ?",
+		"findSummary": "SELECT id FROM mount_summary WHERE pvc_uid = ? AND " +
+			"pvc_name = ? AND namespace = ? FOR UPDATE",
+		"updateSummary": "UPDATE mount_summary SET pods = pods + 1, " +
+			"first_mounted = LEAST(first_mounted, ?), last_unmounted = " +
+			"GREATEST(last_unmounted, ?) WHERE id = ?",
+		"insertSummary": "INSERT INTO mount_summary (pvc_uid, pvc_name, " +
+			"namespace, pods, first_mounted, last_unmounted) VALUES (?, ?, " +
+			"?, 1, ?, ?)",
+		"deleteMounts":     "DELETE FROM pod_mount WHERE pod_uid = ?",
+		"deleteContainers": "DELETE FROM container WHERE pod_uid = ?",
+		"deletePod":        "DELETE FROM pod WHERE uid = ?",
+		"deleteObjectRV":   "DELETE FROM object_version WHERE uid = ?",
+		"deleteEvents":     "DELETE FROM event_log WHERE uid = ?",
+		"summaries": "SELECT pvc_uid, pvc_name, namespace, pods, " +
+			"first_mounted, last_unmounted FROM mount_summary ORDER BY id",
+	}
+	for name, query := range queries {
+		m.pruneQueries[name], err = m.db.Prepare(query)
+		if err != nil {
+			log.Printf("Unable to create prune %s query:  %s", name, err)
+			return
+		}
+	}
+	return
+}
+
+func (m *mySQLManager) destroyPruneQueries() {
+	for _, stmt := range m.pruneQueries {
+		stmt.Close()
+	}
+}
+
+func (m *mySQLManager) DeletedPods(cutoff time.Time,
+	limit int) ([]dbmanager.PodRecord, error) {
+
+	var ret []dbmanager.PodRecord
+
+	rows, err := m.pruneQueries["deleted"].Query(cutoff, limit)
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list deleted pods:  %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			p                      dbmanager.PodRecord
+			uid                    string
+			createTime, deleteTime mysql.NullTime
+			deleteSource           sql.NullString
+		)
+		if err = rows.Scan(&uid, &p.Name, &p.Namespace, &createTime,
+			&deleteTime, &deleteSource, &p.JSON); err != nil {
+			return nil, fmt.Errorf("Unable to scan pod row:  %s", err)
+		}
+		p.UID = types.UID(uid)
+		p.CreateTime = createTime.Time
+		p.DeleteTime = deleteTime.Time
+		p.DeleteTimeSource = dbmanager.TimeSource(deleteSource.String)
+		ret = append(ret, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+	for i := range ret {
+		if err = m.getPodDetails(&ret[i]); err != nil {
+			return nil, err
+		}
+	}
+	return ret, nil
+}
+
+// getPodDetails fills in the containers and mounts of p.
+func (m *mySQLManager) getPodDetails(p *dbmanager.PodRecord) error {
+	rows, err := m.pruneQueries["containers"].Query(string(p.UID))
+	if err != nil {
+		return fmt.Errorf("Unable to list containers of %s:  %s", p.UID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			c       = dbmanager.ContainerRecord{PodUID: p.UID}
+			command sql.NullString
+		)
+		if err = rows.Scan(&c.Name, &c.Image, &command); err != nil {
+			return fmt.Errorf("Unable to scan container row:  %s", err)
+		}
+		c.Command = command.String
+		p.Containers = append(p.Containers, c)
+	}
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	rows, err = m.pruneQueries["mounts"].Query(string(p.UID))
+	if err != nil {
+		return fmt.Errorf("Unable to list mounts of %s:  %s", p.UID, err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			containerName, pvcName sql.NullString
+			pvcUID                 sql.NullString
+			readOnly               sql.NullBool
+		)
+		if err = rows.Scan(&containerName, &pvcName, &pvcUID,
+			&readOnly); err != nil {
+			return fmt.Errorf("Unable to scan pod mount row:  %s", err)
+		}
+		p.Mounts = append(p.Mounts, dbmanager.PodMountRecord{
+			PodUID:        p.UID,
+			PodName:       p.Name,
+			Namespace:     p.Namespace,
+			PodCreateTime: p.CreateTime,
+			PodDeleteTime: p.DeleteTime,
+			ContainerName: containerName.String,
+			PVCName:       pvcName.String,
+			PVCUID:        types.UID(pvcUID.String),
+			ReadOnly:      readOnly.Bool,
+
+			PodDeleteTimeSource: p.DeleteTimeSource,
+		})
+	}
+	return rows.Err()
+}
+
+func (m *mySQLManager) PrunePods(uids []types.UID) error {
+	return m.runTx(func(tx *sql.Tx) error {
+		for _, uid := range uids {
+			if err := m.prunePod(tx, uid); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// prunePod summarizes the mounts of the pod with the given UID and removes
+// it, if it has been deleted.
+func (m *mySQLManager) prunePod(tx *sql.Tx, uid types.UID) error {
+	var (
+		namespace              string
+		createTime, deleteTime mysql.NullTime
+		pvcs                   [][2]string
+	)
+
+	err := tx.Stmt(m.pruneQueries["pod"]).QueryRow(string(uid)).Scan(
+		&namespace, &createTime, &deleteTime)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to find pod %s:  %s", uid, err)
+	}
+
+	// The rows have to be closed before the transaction can be used again.
+	rows, err := tx.Stmt(m.pruneQueries["mountedPVCs"]).Query(string(uid))
+	if err != nil {
+		return fmt.Errorf("Unable to list mounts of %s:  %s", uid, err)
+	}
+	for rows.Next() {
+		var pvc [2]string
+		if err = rows.Scan(&pvc[0], &pvc[1]); err != nil {
+			rows.Close()
+			return fmt.Errorf("Unable to scan pod mount row:  %s", err)
+		}
+		pvcs = append(pvcs, pvc)
+	}
+	rows.Close()
+	if err = rows.Err(); err != nil {
+		return err
+	}
+
+	for _, pvc := range pvcs {
+		var id int64
+
+		err = tx.Stmt(m.pruneQueries["findSummary"]).QueryRow(pvc[0],
+			pvc[1], namespace).Scan(&id)
+		if err == sql.ErrNoRows {
+			_, err = tx.Stmt(m.pruneQueries["insertSummary"]).Exec(pvc[0],
+				pvc[1], namespace, createTime.Time, deleteTime.Time)
+		} else if err == nil {
+			_, err = tx.Stmt(m.pruneQueries["updateSummary"]).Exec(
+				createTime.Time, deleteTime.Time, id)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to summarize mount of %s by %s:  %s",
+				pvc[1], uid, err)
+		}
+	}
+	for _, name := range []string{"deleteMounts", "deleteContainers",
+		"deletePod", "deleteObjectRV", "deleteEvents"} {
+		if _, err = tx.Stmt(m.pruneQueries[name]).Exec(
+			string(uid)); err != nil {
+			return fmt.Errorf("Unable to prune pod %s:  %s", uid, err)
+		}
+	}
+	return nil
+}
+
+func (m *mySQLManager) ListMountSummaries() ([]dbmanager.MountSummaryRecord,
+	error) {
+
+	var ret []dbmanager.MountSummaryRecord
+
+	rows, err := m.pruneQueries["summaries"].Query()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list mount summaries:  %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			s                           dbmanager.MountSummaryRecord
+			pvcUID                      string
+			firstMounted, lastUnmounted mysql.NullTime
+		)
+		if err = rows.Scan(&pvcUID, &s.PVCName, &s.Namespace, &s.Pods,
+			&firstMounted, &lastUnmounted); err != nil {
+			return nil, fmt.Errorf("Unable to scan mount summary row:  %s",
+				err)
+		}
+		s.PVCUID = types.UID(pvcUID)
+		s.FirstMounted = firstMounted.Time
+		s.LastUnmounted = lastUnmounted.Time
+		ret = append(ret, s)
+	}
+	return ret, rows.Err()
+}
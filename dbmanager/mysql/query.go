@@ -0,0 +1,281 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+
+	"github.com/go-sql-driver/mysql"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+func (m *mySQLManager) initListQueries() (err error) {
+	m.listQueries = make(map[dbmanager.Table]*sql.Stmt)
+
+	m.listQueries[dbmanager.PV], err = m.db.Prepare(
+		"SELECT uid, name, create_time, delete_time, delete_time_source, " +
+			"storage, access_modes, json, nfs_id, iscsi_id FROM pv",
+	)
+	if err != nil {
+		log.Print("Unable to create PV list query: ", err)
+		delete(m.listQueries, dbmanager.PV)
+		return
+	}
+	m.listQueries[dbmanager.PVC], err = m.db.Prepare(
+		"SELECT uid, name, namespace, create_time, bind_time, delete_time, " +
+			"bind_time_source, delete_time_source, storage, access_modes, " +
+			"json, pv_uid FROM pvc",
+	)
+	if err != nil {
+		log.Print("Unable to create PVC list query: ", err)
+		delete(m.listQueries, dbmanager.PVC)
+		return
+	}
+	m.listQueries[dbmanager.PodMount], err = m.db.Prepare(
+		"SELECT m.pod_uid, p.name, p.namespace, p.create_time, " +
+			"p.delete_time, p.delete_time_source, m.container_name, " +
+			"m.pvc_name, m.pvc_uid, m.read_only FROM pod_mount m JOIN pod p " +
+			"ON m.pod_uid = p.uid",
+	)
+	if err != nil {
+		log.Print("Unable to create pod mount list query: ", err)
+		delete(m.listQueries, dbmanager.PodMount)
+		return
+	}
+	m.listQueries[dbmanager.Container], err = m.db.Prepare(
+		"SELECT pod_uid, name, image, command FROM container",
+	)
+	if err != nil {
+		log.Print("Unable to create container list query: ", err)
+		delete(m.listQueries, dbmanager.Container)
+		return
+	}
+	m.listQueries[dbmanager.NFS], err = m.db.Prepare(
+		"SELECT id, inet_ntoa(ip_addr), path FROM nfs",
+	)
+	if err != nil {
+		log.Print("Unable to create NFS list query: ", err)
+		delete(m.listQueries, dbmanager.NFS)
+		return
+	}
+	m.listQueries[dbmanager.ISCSI], err = m.db.Prepare(
+		"SELECT id, target_portal, iqn, lun, fs_type FROM iscsi",
+	)
+	if err != nil {
+		log.Print("Unable to create ISCSI list query: ", err)
+		delete(m.listQueries, dbmanager.ISCSI)
+		return
+	}
+	return
+}
+
+func (m *mySQLManager) destroyListQueries() {
+	if m.listQueries == nil {
+		return
+	}
+	for _, query := range m.listQueries {
+		query.Close()
+	}
+}
+
+func (m *mySQLManager) ListPVs() ([]dbmanager.PVRecord, error) {
+	var ret []dbmanager.PVRecord
+
+	rows, err := m.listQueries[dbmanager.PV].Query()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list PVs:  %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r                 dbmanager.PVRecord
+			uid               string
+			createTime        mysql.NullTime
+			deleteTime        mysql.NullTime
+			deleteSource      sql.NullString
+			accessModes, json sql.NullString
+			nfsID, iscsiID    sql.NullInt64
+		)
+		if err = rows.Scan(&uid, &r.Name, &createTime, &deleteTime,
+			&deleteSource, &r.Storage, &accessModes, &json, &nfsID,
+			&iscsiID); err != nil {
+			return nil, fmt.Errorf("Unable to scan PV row:  %s", err)
+		}
+		r.UID = types.UID(uid)
+		r.CreateTime = createTime.Time
+		r.DeleteTime = deleteTime.Time
+		r.DeleteTimeSource = dbmanager.TimeSource(deleteSource.String)
+		r.AccessModes = accessModes.String
+		r.JSON = json.String
+		switch {
+		case nfsID.Int64 > 0:
+			r.BackendType = dbmanager.NFS
+			r.BackendID = int(nfsID.Int64)
+		case iscsiID.Int64 > 0:
+			r.BackendType = dbmanager.ISCSI
+			r.BackendID = int(iscsiID.Int64)
+		}
+		ret = append(ret, r)
+	}
+	return ret, rows.Err()
+}
+
+func (m *mySQLManager) ListPVCs() ([]dbmanager.PVCRecord, error) {
+	var ret []dbmanager.PVCRecord
+
+	rows, err := m.listQueries[dbmanager.PVC].Query()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list PVCs:  %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r                                dbmanager.PVCRecord
+			uid                              string
+			name, namespace, accessModes     sql.NullString
+			json, pvUID                      sql.NullString
+			createTime, bindTime, deleteTime mysql.NullTime
+			bindSource, deleteSource         sql.NullString
+			storage                          sql.NullInt64
+		)
+		if err = rows.Scan(&uid, &name, &namespace, &createTime, &bindTime,
+			&deleteTime, &bindSource, &deleteSource, &storage, &accessModes,
+			&json, &pvUID); err != nil {
+			return nil, fmt.Errorf("Unable to scan PVC row:  %s", err)
+		}
+		r.UID = types.UID(uid)
+		r.Name = name.String
+		r.Namespace = namespace.String
+		r.CreateTime = createTime.Time
+		r.BindTime = bindTime.Time
+		r.DeleteTime = deleteTime.Time
+		r.BindTimeSource = dbmanager.TimeSource(bindSource.String)
+		r.DeleteTimeSource = dbmanager.TimeSource(deleteSource.String)
+		r.Storage = storage.Int64
+		r.AccessModes = accessModes.String
+		r.JSON = json.String
+		r.PVUID = types.UID(pvUID.String)
+		ret = append(ret, r)
+	}
+	return ret, rows.Err()
+}
+
+func (m *mySQLManager) ListPodMounts() ([]dbmanager.PodMountRecord, error) {
+	var ret []dbmanager.PodMountRecord
+
+	rows, err := m.listQueries[dbmanager.PodMount].Query()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list pod mounts:  %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r                      dbmanager.PodMountRecord
+			podUID                 string
+			createTime, deleteTime mysql.NullTime
+			deleteSource           sql.NullString
+			containerName, pvcName sql.NullString
+			pvcUID                 sql.NullString
+			readOnly               sql.NullBool
+		)
+		if err = rows.Scan(&podUID, &r.PodName, &r.Namespace, &createTime,
+			&deleteTime, &deleteSource, &containerName, &pvcName, &pvcUID,
+			&readOnly); err != nil {
+			return nil, fmt.Errorf("Unable to scan pod mount row:  %s", err)
+		}
+		r.PodUID = types.UID(podUID)
+		r.PodCreateTime = createTime.Time
+		r.PodDeleteTime = deleteTime.Time
+		r.PodDeleteTimeSource = dbmanager.TimeSource(deleteSource.String)
+		r.ContainerName = containerName.String
+		r.PVCName = pvcName.String
+		r.PVCUID = types.UID(pvcUID.String)
+		r.ReadOnly = readOnly.Bool
+		ret = append(ret, r)
+	}
+	return ret, rows.Err()
+}
+
+func (m *mySQLManager) ListContainers() ([]dbmanager.ContainerRecord, error) {
+	var ret []dbmanager.ContainerRecord
+
+	rows, err := m.listQueries[dbmanager.Container].Query()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list containers:  %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r       dbmanager.ContainerRecord
+			podUID  string
+			command sql.NullString
+		)
+		if err = rows.Scan(&podUID, &r.Name, &r.Image, &command); err != nil {
+			return nil, fmt.Errorf("Unable to scan container row:  %s", err)
+		}
+		r.PodUID = types.UID(podUID)
+		r.Command = command.String
+		ret = append(ret, r)
+	}
+	return ret, rows.Err()
+}
+
+func (m *mySQLManager) ListNFS() ([]dbmanager.NFSRecord, error) {
+	var ret []dbmanager.NFSRecord
+
+	rows, err := m.listQueries[dbmanager.NFS].Query()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list NFS sources:  %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var r dbmanager.NFSRecord
+		if err = rows.Scan(&r.ID, &r.Server, &r.Path); err != nil {
+			return nil, fmt.Errorf("Unable to scan NFS row:  %s", err)
+		}
+		ret = append(ret, r)
+	}
+	return ret, rows.Err()
+}
+
+func (m *mySQLManager) ListISCSI() ([]dbmanager.ISCSIRecord, error) {
+	var ret []dbmanager.ISCSIRecord
+
+	rows, err := m.listQueries[dbmanager.ISCSI].Query()
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list ISCSI sources:  %s", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r      dbmanager.ISCSIRecord
+			fsType sql.NullString
+		)
+		if err = rows.Scan(&r.ID, &r.TargetPortal, &r.IQN, &r.LUN,
+			&fsType); err != nil {
+			return nil, fmt.Errorf("Unable to scan ISCSI row:  %s", err)
+		}
+		r.FSType = fsType.String
+		ret = append(ret, r)
+	}
+	return ret, rows.Err()
+}
@@ -0,0 +1,230 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mysql
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// timeMatches compares a time retrieved from the database with the one that
+// was stored, accounting for truncation to the microsecond.
+func timeMatches(stored time.Time, expected unversioned.Time) bool {
+	return stored.Equal(expected.Time.Truncate(time.Microsecond))
+}
+
+func TestListPVs(t *testing.T) {
+	manager.clearTestTables()
+
+	nfsID := manager.InsertNFS(nfs_server, nfs_path)
+	pvTime := unversioned.Now()
+	deleteTime := unversioned.NewTime(pvTime.Add(time.Second))
+	manager.InsertPV(pv_uid, pv_name, pvTime, nfsID, dbmanager.NFS,
+		pv_storage, pv_access_modes, pv_json, "800")
+	manager.DeletePV(pv_uid, deleteTime, dbmanager.TimeExact, "801")
+
+	pvs, err := manager.ListPVs()
+	if err != nil {
+		t.Fatal("Unable to list PVs: ", err)
+	}
+	found := false
+	for _, pv := range pvs {
+		if pv.UID != pv_uid {
+			continue
+		}
+		found = true
+		if pv.Name != pv_name || pv.Storage != pv_storage ||
+			pv.AccessModes != GetAccessModeString(pv_access_modes) ||
+			pv.JSON != pv_json {
+			t.Errorf("Incorrect attributes for listed PV:  %v", pv)
+		}
+		if pv.BackendType != dbmanager.NFS || pv.BackendID != nfsID {
+			t.Errorf("Incorrect backend for listed PV; expected %s %d, got "+
+				"%s %d", dbmanager.NFS, nfsID, pv.BackendType, pv.BackendID)
+		}
+		if !timeMatches(pv.CreateTime, pvTime) ||
+			!timeMatches(pv.DeleteTime, deleteTime) {
+			t.Errorf("Incorrect times for listed PV:  %s, %s", pv.CreateTime,
+				pv.DeleteTime)
+		}
+	}
+	if !found {
+		t.Error("Test PV not listed.")
+	}
+}
+
+func TestListPVCs(t *testing.T) {
+	manager.clearTestTables()
+
+	// Bind before inserting, so that one of the PVCs only has partial data.
+	bindTime := unversioned.Now()
+	manager.BindPVC(pv_uid, pvc_other_uid, bindTime, dbmanager.TimeObserved,
+		"810")
+	pvcTime := unversioned.Now()
+	manager.InsertPVC(pvc_uid, pvc_name, pvcTime, test_ns, pvc_storage,
+		pvc_access_modes, pvc_json, watcher_ns, "811")
+
+	pvcs, err := manager.ListPVCs()
+	if err != nil {
+		t.Fatal("Unable to list PVCs: ", err)
+	}
+	var sawComplete, sawPartial bool
+	for _, pvc := range pvcs {
+		switch pvc.UID {
+		case pvc_uid:
+			sawComplete = true
+			if pvc.Name != pvc_name || pvc.Namespace != test_ns ||
+				pvc.Storage != pvc_storage || pvc.JSON != pvc_json ||
+				pvc.PVUID != "" || !pvc.BindTime.IsZero() {
+				t.Errorf("Incorrect attributes for listed PVC:  %v", pvc)
+			}
+			if !timeMatches(pvc.CreateTime, pvcTime) {
+				t.Errorf("Incorrect create time for listed PVC:  %s",
+					pvc.CreateTime)
+			}
+		case pvc_other_uid:
+			sawPartial = true
+			if pvc.PVUID != pv_uid || !timeMatches(pvc.BindTime, bindTime) ||
+				!pvc.CreateTime.IsZero() || pvc.Name != "" {
+				t.Errorf("Incorrect attributes for partial PVC:  %v", pvc)
+			}
+		}
+	}
+	if !sawComplete || !sawPartial {
+		t.Error("Test PVCs not listed.")
+	}
+}
+
+func TestListPodMounts(t *testing.T) {
+	manager.clearTestTables()
+
+	pvcTime := unversioned.Now()
+	podTime := unversioned.NewTime(pvcTime.Add(time.Second))
+	deleteTime := unversioned.NewTime(pvcTime.Add(2 * time.Second))
+	manager.InsertPVC(pvc_uid, pvc_name, pvcTime, test_ns, pvc_storage,
+		pvc_access_modes, pvc_json, watcher_ns, "820")
+	manager.InsertPod(vol_pod_uid, vol_pod_name, podTime, test_ns,
+		[]resources.ContainerDesc{volContainer1}, vol_pod_json, watcher_ns,
+		"821")
+	manager.DeletePod(vol_pod_uid, deleteTime, dbmanager.TimeExact,
+		watcher_ns, "822")
+
+	mounts, err := manager.ListPodMounts()
+	if err != nil {
+		t.Fatal("Unable to list pod mounts: ", err)
+	}
+	found := false
+	for _, m := range mounts {
+		if m.PodUID != vol_pod_uid {
+			continue
+		}
+		found = true
+		if m.PodName != vol_pod_name || m.Namespace != test_ns ||
+			m.ContainerName != volContainer1.Name || m.PVCName != pvc_name ||
+			m.PVCUID != pvc_uid || m.ReadOnly != readOnlyDefault {
+			t.Errorf("Incorrect attributes for listed pod mount:  %v", m)
+		}
+		if !timeMatches(m.PodCreateTime, podTime) ||
+			!timeMatches(m.PodDeleteTime, deleteTime) {
+			t.Errorf("Incorrect times for listed pod mount:  %s, %s",
+				m.PodCreateTime, m.PodDeleteTime)
+		}
+	}
+	if !found {
+		t.Error("Test pod mount not listed.")
+	}
+}
+
+func TestListContainers(t *testing.T) {
+	manager.clearTestTables()
+
+	manager.InsertPod(pod_uid, pod_name, unversioned.Now(), test_ns,
+		[]resources.ContainerDesc{container1, container2}, pod_json,
+		watcher_ns, "830")
+
+	containers, err := manager.ListContainers()
+	if err != nil {
+		t.Fatal("Unable to list containers: ", err)
+	}
+	found := 0
+	for _, c := range containers {
+		if c.PodUID != pod_uid {
+			continue
+		}
+		found++
+		expected := container1
+		if c.Name == container2.Name {
+			expected = container2
+		}
+		if c.Name != expected.Name || c.Image != expected.Image ||
+			c.Command != expected.Command {
+			t.Errorf("Incorrect attributes for listed container:  %v", c)
+		}
+	}
+	if found != 2 {
+		t.Errorf("Expected 2 test containers listed; got %d", found)
+	}
+}
+
+func TestListBackends(t *testing.T) {
+	manager.clearTestTables()
+
+	nfsID := manager.InsertNFS(nfs_server, nfs_path)
+	iscsiID := manager.InsertISCSI(iscsiPortal, iscsiIQN, iscsiLUN,
+		iscsiFSType)
+
+	nfs, err := manager.ListNFS()
+	if err != nil {
+		t.Fatal("Unable to list NFS sources: ", err)
+	}
+	found := false
+	for _, n := range nfs {
+		if n.ID == nfsID {
+			found = true
+			if n.Server != nfs_server || n.Path != nfs_path {
+				t.Errorf("Incorrect attributes for listed NFS source:  %v", n)
+			}
+		}
+	}
+	if !found {
+		t.Error("Test NFS source not listed.")
+	}
+
+	iscsi, err := manager.ListISCSI()
+	if err != nil {
+		t.Fatal("Unable to list ISCSI sources: ", err)
+	}
+	found = false
+	for _, i := range iscsi {
+		if i.ID == iscsiID {
+			found = true
+			if i.TargetPortal != iscsiPortal || i.IQN != iscsiIQN ||
+				i.LUN != iscsiLUN || i.FSType != iscsiFSType {
+				t.Errorf("Incorrect attributes for listed ISCSI source:  %v",
+					i)
+			}
+		}
+	}
+	if !found {
+		t.Error("Test ISCSI source not listed.")
+	}
+}
@@ -21,6 +21,9 @@ import (
 	"fmt"
 	"log"
 
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
 	"github.com/netapp/kubevoltracker/resources"
 )
 
@@ -41,6 +44,27 @@ func (m *mySQLManager) initRVQueries() (err error) {
 		m.getRVQuery = nil
 		return
 	}
+
+	m.rvQueries = make(map[string]*sql.Stmt)
+	queries := map[string]string{
+		"lock": "SELECT resource_version FROM resource_version WHERE " +
+			"resource = ? AND namespace = ? FOR UPDATE",
+		"getObject": "SELECT resource_version FROM object_version WHERE " +
+			"uid = ?",
+		"lockObject": "SELECT resource_version FROM object_version WHERE " +
+			"uid = ? FOR UPDATE",
+		"updateObject": "INSERT INTO object_version (uid, " +
+			"resource_version) VALUES (?, ?) ON DUPLICATE KEY UPDATE " +
+			"resource_version = ?",
+	}
+	for name, query := range queries {
+		m.rvQueries[name], err = m.db.Prepare(query)
+		if err != nil {
+			log.Printf("Unable to create resource version %s query:  %s",
+				name, err)
+			return
+		}
+	}
 	return
 }
 
@@ -51,11 +75,55 @@ func (m *mySQLManager) destroyRVQueries() {
 	if m.getRVQuery != nil {
 		m.getRVQuery.Close()
 	}
+	for _, stmt := range m.rvQueries {
+		stmt.Close()
+	}
 }
 
+// lockedRV returns the resource version selected by query, which locks the
+// row it selects, or an empty string if there is no such row.
+func lockedRV(tx *sql.Tx, query *sql.Stmt, args ...interface{}) (string,
+	error) {
+
+	var rv string
+	err := tx.Stmt(query).QueryRow(args...).Scan(&rv)
+	if err == sql.ErrNoRows {
+		return "", nil
+	}
+	return rv, err
+}
+
+// updateRV records rv as the latest resource version for resource in the
+// watched namespace, and for the object with the given UID, unless either
+// has already seen a newer one.
 func (m *mySQLManager) updateRV(tx *sql.Tx, resource resources.ResourceType,
-	namespace, rv string) error {
+	namespace string, uid types.UID, rv string) error {
 
+	if rv == "" {
+		return nil
+	}
+	last, err := lockedRV(tx, m.rvQueries["lockObject"], string(uid))
+	if err != nil {
+		return fmt.Errorf("Unable to get rv of %s:  %s", uid, err)
+	}
+	if dbmanager.NewerRV(rv, last) {
+		_, err = tx.Stmt(m.rvQueries["updateObject"]).Exec(string(uid), rv,
+			rv)
+		if err != nil {
+			return fmt.Errorf("Unable to update %s with rv %s:  %s", uid,
+				rv, err)
+		}
+	}
+
+	last, err = lockedRV(tx, m.rvQueries["lock"], string(resource),
+		namespace)
+	if err != nil {
+		return fmt.Errorf("Unable to get rv of %s in namespace %s:  %s",
+			resource, namespace, err)
+	}
+	if !dbmanager.NewerRV(rv, last) {
+		return nil
+	}
 	result, err := tx.Stmt(m.updateRVQuery).Exec(string(resource), namespace,
 		rv, rv)
 	if err != nil {
@@ -89,3 +157,15 @@ func (m *mySQLManager) GetRV(resource resources.ResourceType,
 	}
 	return rv
 }
+
+func (m *mySQLManager) ObjectRV(uid types.UID) string {
+	var rv string
+	err := m.rvQueries["getObject"].QueryRow(string(uid)).Scan(&rv)
+	if err == sql.ErrNoRows {
+		return ""
+	}
+	if err != nil {
+		log.Panicf("Unable to get resource version for %s:  %s", uid, err)
+	}
+	return rv
+}
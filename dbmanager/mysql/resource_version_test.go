@@ -20,6 +20,8 @@ import (
 	"database/sql"
 	"testing"
 
+	"k8s.io/kubernetes/pkg/types"
+
 	"github.com/netapp/kubevoltracker/resources"
 )
 
@@ -30,9 +32,11 @@ func TestResourceVersion(t *testing.T) {
 
 	testRV1 := "1456"
 	testRV2 := "1457"
+	testUID := types.UID("test-rv-001")
 	err = manager.runTx(
 		func(tx *sql.Tx) error {
-			err = manager.updateRV(tx, resources.Pods, watcher_ns_alt, testRV1)
+			err = manager.updateRV(tx, resources.Pods, watcher_ns_alt,
+				testUID, testRV1)
 			return err
 		},
 	)
@@ -46,7 +50,8 @@ func TestResourceVersion(t *testing.T) {
 	// Check that update of existing key works.
 	err = manager.runTx(
 		func(tx *sql.Tx) error {
-			err = manager.updateRV(tx, resources.Pods, watcher_ns_alt, testRV2)
+			err = manager.updateRV(tx, resources.Pods, watcher_ns_alt,
+				testUID, testRV2)
 			return err
 		},
 	)
@@ -54,4 +59,25 @@ func TestResourceVersion(t *testing.T) {
 	if rv != testRV2 {
 		t.Errorf("Retrieved incorrect RV; expected %s, got %s", testRV2, rv)
 	}
+	if rv = manager.ObjectRV(testUID); rv != testRV2 {
+		t.Errorf("Retrieved incorrect object RV; expected %s, got %s",
+			testRV2, rv)
+	}
+	// Check that an older RV doesn't replace a newer one.
+	err = manager.runTx(
+		func(tx *sql.Tx) error {
+			return manager.updateRV(tx, resources.Pods, watcher_ns_alt,
+				testUID, testRV1)
+		},
+	)
+	if err != nil {
+		t.Fatal("Unable to update RV: ", err)
+	}
+	if rv = manager.GetRV(resources.Pods, watcher_ns_alt); rv != testRV2 {
+		t.Errorf("RV went backwards; expected %s, got %s", testRV2, rv)
+	}
+	if rv = manager.ObjectRV(testUID); rv != testRV2 {
+		t.Errorf("Object RV went backwards; expected %s, got %s", testRV2,
+			rv)
+	}
 }
@@ -0,0 +1,198 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package mysql
+
+import (
+	"database/sql"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/go-sql-driver/mysql"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+func (m *mySQLManager) initRevisionQueries() (err error) {
+	m.revisionQueries = make(map[string]*sql.Stmt)
+	queries := map[string]string{
+		"insert": "INSERT INTO resource_revision (uid, resource_version, " +
+			"resource, event_type, event_time, body) VALUES (?, ?, ?, ?, " +
+			"?, ?) ON DUPLICATE KEY UPDATE resource = ?, event_type = ?, " +
+			"event_time = ?, body = ?",
+		"get": "SELECT resource, event_type, event_time, body FROM " +
+			"resource_revision WHERE uid = ? AND resource_version = ?",
+		"list": "SELECT resource_version, resource, event_type, " +
+			"event_time, body FROM resource_revision WHERE uid = ? " +
+			"ORDER BY id",
+		"latest": "SELECT MAX(id) FROM resource_revision WHERE uid = ?",
+		// Returns the id of the newest revision that falls outside the
+		// per-object limit, given as the offset.
+		"cutoff": "SELECT id FROM resource_revision WHERE uid = ? ORDER BY " +
+			"id DESC LIMIT 1 OFFSET ?",
+		"pruneOld": "DELETE FROM resource_revision WHERE uid = ? AND " +
+			"event_time < ? AND id < ?",
+		"pruneExcess": "DELETE FROM resource_revision WHERE uid = ? AND " +
+			"id <= ?",
+	}
+	for name, query := range queries {
+		m.revisionQueries[name], err = m.db.Prepare(query)
+		if err != nil {
+			log.Printf("Unable to create revision %s query:  %s", name, err)
+			return
+		}
+	}
+	return
+}
+
+func (m *mySQLManager) destroyRevisionQueries() {
+	for _, stmt := range m.revisionQueries {
+		stmt.Close()
+	}
+}
+
+func (m *mySQLManager) SetRevisionRetention(
+	policy dbmanager.RevisionRetention) {
+
+	m.retentionMutex.Lock()
+	defer m.retentionMutex.Unlock()
+	m.retention = policy
+}
+
+func (m *mySQLManager) RecordRevision(r dbmanager.RevisionRecord) error {
+	body, err := dbmanager.CompressRevision(r.JSON)
+	if err != nil {
+		return err
+	}
+	m.retentionMutex.Lock()
+	policy := m.retention
+	m.retentionMutex.Unlock()
+
+	return m.runTx(func(tx *sql.Tx) error {
+		_, err := tx.Stmt(m.revisionQueries["insert"]).Exec(string(r.UID),
+			r.ResourceVersion, string(r.Resource), r.EventType, r.EventTime,
+			body, string(r.Resource), r.EventType, r.EventTime, body)
+		if err != nil {
+			return fmt.Errorf("Unable to insert revision %s of %s:  %s",
+				r.ResourceVersion, r.UID, err)
+		}
+		return m.pruneRevisions(tx, r.UID, policy)
+	})
+}
+
+// pruneRevisions applies policy to the revisions of the object with the
+// given UID.
+func (m *mySQLManager) pruneRevisions(tx *sql.Tx, uid types.UID,
+	policy dbmanager.RevisionRetention) error {
+
+	if policy.MaxAge > 0 {
+		var latest int64
+
+		err := tx.Stmt(m.revisionQueries["latest"]).QueryRow(
+			string(uid)).Scan(&latest)
+		if err != nil {
+			return fmt.Errorf("Unable to find latest revision of %s:  %s",
+				uid, err)
+		}
+		_, err = tx.Stmt(m.revisionQueries["pruneOld"]).Exec(string(uid),
+			time.Now().Add(-policy.MaxAge), latest)
+		if err != nil {
+			return fmt.Errorf("Unable to prune old revisions of %s:  %s",
+				uid, err)
+		}
+	}
+	if policy.MaxPerObject > 0 {
+		var cutoff int64
+
+		err := tx.Stmt(m.revisionQueries["cutoff"]).QueryRow(string(uid),
+			policy.MaxPerObject).Scan(&cutoff)
+		if err == sql.ErrNoRows {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to find revision cutoff for %s:  %s",
+				uid, err)
+		}
+		_, err = tx.Stmt(m.revisionQueries["pruneExcess"]).Exec(string(uid),
+			cutoff)
+		if err != nil {
+			return fmt.Errorf("Unable to prune excess revisions of %s:  %s",
+				uid, err)
+		}
+	}
+	return nil
+}
+
+func (m *mySQLManager) GetRevision(uid types.UID,
+	rv string) (dbmanager.RevisionRecord, error) {
+
+	var (
+		r         = dbmanager.RevisionRecord{UID: uid, ResourceVersion: rv}
+		resource  string
+		eventTime mysql.NullTime
+		body      []byte
+	)
+
+	err := m.revisionQueries["get"].QueryRow(string(uid), rv).Scan(&resource,
+		&r.EventType, &eventTime, &body)
+	if err == sql.ErrNoRows {
+		return r, dbmanager.ErrNoRevision
+	}
+	if err != nil {
+		return r, fmt.Errorf("Unable to get revision %s of %s:  %s", rv, uid,
+			err)
+	}
+	r.Resource = resources.ResourceType(resource)
+	r.EventTime = eventTime.Time
+	r.JSON, err = dbmanager.DecompressRevision(body)
+	return r, err
+}
+
+func (m *mySQLManager) ListRevisions(
+	uid types.UID) ([]dbmanager.RevisionRecord, error) {
+
+	var ret []dbmanager.RevisionRecord
+
+	rows, err := m.revisionQueries["list"].Query(string(uid))
+	if err != nil {
+		return nil, fmt.Errorf("Unable to list revisions of %s:  %s", uid,
+			err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var (
+			r         = dbmanager.RevisionRecord{UID: uid}
+			resource  string
+			eventTime mysql.NullTime
+			body      []byte
+		)
+		if err = rows.Scan(&r.ResourceVersion, &resource, &r.EventType,
+			&eventTime, &body); err != nil {
+			return nil, fmt.Errorf("Unable to scan revision row:  %s", err)
+		}
+		r.Resource = resources.ResourceType(resource)
+		r.EventTime = eventTime.Time
+		if r.JSON, err = dbmanager.DecompressRevision(body); err != nil {
+			return nil, err
+		}
+		ret = append(ret, r)
+	}
+	return ret, rows.Err()
+}
@@ -23,6 +23,7 @@ CREATE TABLE IF NOT EXISTS pv (
 	name VARCHAR(256) NOT NULL,
 	create_time TIMESTAMP(6) NOT NULL,
 	delete_time TIMESTAMP(6),
+	delete_time_source VARCHAR(16), -- See dbmanager.TimeSource.
 	storage BIGINT NOT NULL,
 	access_modes VARCHAR(128), -- This is more than we need, but it should work.
 	json TEXT NOT NULL,
@@ -37,6 +38,8 @@ CREATE TABLE IF NOT EXISTS pvc (
 	create_time TIMESTAMP(6),
 	delete_time TIMESTAMP(6),
 	bind_time TIMESTAMP(6),
+	bind_time_source VARCHAR(16),
+	delete_time_source VARCHAR(16),
 	namespace VARCHAR(256),
 	storage BIGINT,
 	access_modes VARCHAR(128), -- This is more than we need, but it should work.
@@ -48,6 +51,7 @@ CREATE TABLE IF NOT EXISTS pod (
 	name VARCHAR(256) NOT NULL,
 	create_time TIMESTAMP(6) NOT NULL,
 	delete_time TIMESTAMP(6),
+	delete_time_source VARCHAR(16),
 	namespace VARCHAR(256) NOT NULL,
 	json TEXT NOT NULL
 	);
@@ -82,3 +86,56 @@ CREATE TABLE IF NOT EXISTS resource_version (
 	resource_version VARCHAR(32) NOT NULL,
 	UNIQUE KEY (resource, namespace)
 	);
+-- The resource version last applied to each object, used to drop events that
+-- are older than, or duplicates of, ones already applied.  Existing databases
+-- can be upgraded by loading this file again.
+CREATE TABLE IF NOT EXISTS object_version (
+	uid VARCHAR(64) PRIMARY KEY,
+	resource_version VARCHAR(32) NOT NULL
+	);
+-- Used for leader election between multiple trackers.  expire_time is always
+-- computed by the database, so trackers' clocks needn't agree.
+CREATE TABLE IF NOT EXISTS lease (
+	name VARCHAR(64) PRIMARY KEY,
+	holder VARCHAR(256) NOT NULL,
+	token BIGINT NOT NULL,
+	expire_time DATETIME(6) NOT NULL
+	);
+-- Every observed body of each pod, PV, and PVC, gzip-compressed.  ids
+-- increase in the order revisions were recorded.
+CREATE TABLE IF NOT EXISTS resource_revision (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	uid VARCHAR(64) NOT NULL,
+	resource_version VARCHAR(32) NOT NULL,
+	resource VARCHAR(64) NOT NULL,
+	event_type VARCHAR(16) NOT NULL,
+	event_time TIMESTAMP(6) NOT NULL,
+	body MEDIUMBLOB NOT NULL,
+	UNIQUE KEY (uid, resource_version)
+	);
+-- The mounts of pods that have been pruned, summarized by PVC.  pvc_uid is
+-- empty for mounts that were never matched to a PVC.
+CREATE TABLE IF NOT EXISTS mount_summary (
+	id INT AUTO_INCREMENT PRIMARY KEY,
+	pvc_uid VARCHAR(64) NOT NULL,
+	pvc_name VARCHAR(256) NOT NULL,
+	namespace VARCHAR(256) NOT NULL,
+	pods INT NOT NULL,
+	first_mounted TIMESTAMP(6) NOT NULL,
+	last_unmounted TIMESTAMP(6) NOT NULL,
+	KEY (pvc_uid)
+	);
+-- Every watch event, appended before it's applied to the tables above so
+-- that they can be rebuilt from it.  ids increase in the order events were
+-- received.  uid is that of the object the event describes, so that the
+-- events of pruned pods can be removed with them.
+CREATE TABLE IF NOT EXISTS event_log (
+	id BIGINT AUTO_INCREMENT PRIMARY KEY,
+	receive_time TIMESTAMP(6) NOT NULL,
+	resource VARCHAR(64) NOT NULL,
+	namespace VARCHAR(256) NOT NULL,
+	uid VARCHAR(64) NOT NULL DEFAULT '',
+	body MEDIUMTEXT NOT NULL,
+	resync BOOL NOT NULL DEFAULT FALSE,
+	KEY (uid)
+	);
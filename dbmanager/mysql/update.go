@@ -85,7 +85,7 @@ func (m *mySQLManager) UpdatePV(
 			); err != nil {
 				return err
 			}
-			err = m.updateRV(tx, resources.PVs, resources.PVNamespace, rv)
+			err = m.updateRV(tx, resources.PVs, resources.PVNamespace, uid, rv)
 			return err
 		},
 	)
@@ -107,7 +107,7 @@ func (m *mySQLManager) UpdatePVC(uid types.UID, storage int64,
 			); err != nil {
 				return err
 			}
-			err = m.updateRV(tx, resources.PVCs, watcherNS, rv)
+			err = m.updateRV(tx, resources.PVCs, watcherNS, uid, rv)
 			return err
 		},
 	)
@@ -0,0 +1,69 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dbmanager
+
+import (
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+)
+
+// PodRecord describes a single pod as stored by the backend, along with its
+// containers and PVC mounts.
+type PodRecord struct {
+	UID        types.UID
+	Name       string
+	Namespace  string
+	CreateTime time.Time
+	DeleteTime time.Time
+	// DeleteTimeSource says where DeleteTime came from.
+	DeleteTimeSource TimeSource
+	JSON             string
+	Containers       []ContainerRecord
+	Mounts           []PodMountRecord
+}
+
+// MountSummaryRecord is what remains of the mounts of a single PVC by pods
+// that have been pruned.
+type MountSummaryRecord struct {
+	PVCUID    types.UID // Empty if the PVC was never seen.
+	PVCName   string
+	Namespace string
+	// Pods is the number of pruned pods that mounted the PVC.
+	Pods int
+	// FirstMounted is the earliest creation time of those pods, and
+	// LastUnmounted is the latest deletion time.
+	FirstMounted  time.Time
+	LastUnmounted time.Time
+}
+
+// Pruner is implemented by backends that can discard the records of pods
+// deleted long ago, so that history doesn't grow without bound.  As with
+// Querier, callers should type-assert for it.
+type Pruner interface {
+	// DeletedPods returns up to limit pods deleted before cutoff, oldest
+	// deletion first, so that they can be archived before being pruned.
+	DeletedPods(cutoff time.Time, limit int) ([]PodRecord, error)
+	// PrunePods removes the deleted pods with the given UIDs, along with
+	// their containers, mounts, resource versions, and, for backends that
+	// implement EventLog, logged events, after adding the mounts to the
+	// mount summaries.  Pods that haven't been deleted are left alone.
+	PrunePods(uids []types.UID) error
+	// ListMountSummaries returns the summaries of the mounts of every
+	// pruned pod.
+	ListMountSummaries() ([]MountSummaryRecord, error)
+}
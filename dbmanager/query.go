@@ -0,0 +1,127 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dbmanager
+
+import (
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+)
+
+// PVRecord describes a single PV as stored by the backend.  Times that have
+// not been recorded (e.g., the delete time of a PV that still exists) are
+// left as the zero time.
+type PVRecord struct {
+	UID        types.UID
+	Name       string
+	CreateTime time.Time
+	DeleteTime time.Time
+	// DeleteTimeSource says where DeleteTime came from.
+	DeleteTimeSource TimeSource
+	Storage          int64
+	AccessModes      string
+	// BackendType is the table holding the PV's volume source (NFS or
+	// ISCSI), and BackendID is the ID of the source within that table.
+	BackendType Table
+	BackendID   int
+	JSON        string
+}
+
+// PVCRecord describes a single PVC as stored by the backend.  As with
+// PVRecord, unrecorded times are left as the zero time.  Because binds can
+// be processed before the PVC itself, records may be missing everything but
+// their UID, PV UID, and bind time.
+type PVCRecord struct {
+	UID        types.UID
+	Name       string
+	Namespace  string
+	CreateTime time.Time
+	BindTime   time.Time
+	DeleteTime time.Time
+	// BindTimeSource and DeleteTimeSource say where BindTime and DeleteTime
+	// came from.
+	BindTimeSource   TimeSource
+	DeleteTimeSource TimeSource
+	Storage          int64
+	AccessModes      string
+	PVUID            types.UID // Empty if the PVC has never been bound.
+	JSON             string
+}
+
+// PodMountRecord describes a PVC mounted by a container, along with the
+// lifetime of the pod the container belongs to.
+type PodMountRecord struct {
+	PodUID        types.UID
+	PodName       string
+	Namespace     string
+	PodCreateTime time.Time
+	PodDeleteTime time.Time
+	// PodDeleteTimeSource says where PodDeleteTime came from.
+	PodDeleteTimeSource TimeSource
+	ContainerName       string
+	PVCName             string
+	PVCUID              types.UID // Empty if the PVC hasn't been seen yet.
+	ReadOnly            bool
+}
+
+// ContainerRecord describes a single container in a pod.  Containers are
+// identified by their pod and name, which is also how pod mounts refer to
+// them.
+type ContainerRecord struct {
+	PodUID  types.UID
+	Name    string
+	Image   string
+	Command string
+}
+
+// NFSRecord describes an NFS volume source.
+type NFSRecord struct {
+	ID     int
+	Server string
+	Path   string
+}
+
+// ISCSIRecord describes an ISCSI volume source.
+type ISCSIRecord struct {
+	ID           int
+	TargetPortal string
+	IQN          string
+	LUN          int
+	FSType       string
+}
+
+// Querier is implemented by backends that can answer read-side queries
+// about the state they have recorded.  It is kept separate from DBManager
+// so that write-only backends remain valid; callers should type-assert
+// for it.
+type Querier interface {
+	// ListPVs returns every PV the backend has recorded, including deleted
+	// ones.
+	ListPVs() ([]PVRecord, error)
+	// ListPVCs returns every PVC the backend has recorded, including deleted
+	// ones.
+	ListPVCs() ([]PVCRecord, error)
+	// ListPodMounts returns every PVC mount the backend has recorded,
+	// including those for deleted pods.
+	ListPodMounts() ([]PodMountRecord, error)
+	// ListContainers returns every container the backend has recorded.
+	ListContainers() ([]ContainerRecord, error)
+	// ListNFS returns every NFS volume source the backend has recorded.
+	ListNFS() ([]NFSRecord, error)
+	// ListISCSI returns every ISCSI volume source the backend has recorded.
+	ListISCSI() ([]ISCSIRecord, error)
+}
@@ -0,0 +1,39 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dbmanager
+
+import "strconv"
+
+// NewerRV returns true if rv is newer than last, the resource version of the
+// last event applied to the same object (or watch), which is empty if none
+// has been.  Kubernetes documents resource versions as opaque, but they are
+// etcd revisions, and so integers that only increase; any that aren't
+// integers can only be compared for equality.
+func NewerRV(rv, last string) bool {
+	if last == "" {
+		return true
+	}
+	newer, err := strconv.ParseUint(rv, 10, 64)
+	if err != nil {
+		return rv != last
+	}
+	older, err := strconv.ParseUint(last, 10, 64)
+	if err != nil {
+		return rv != last
+	}
+	return newer > older
+}
@@ -0,0 +1,101 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dbmanager
+
+import (
+	"bytes"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// ErrNoRevision is returned when a requested revision isn't stored, either
+// because it was never observed or because it has been pruned.
+var ErrNoRevision = errors.New("No such revision")
+
+// RevisionRecord is a single observed version of a pod, PV, or PVC.
+type RevisionRecord struct {
+	UID             types.UID
+	ResourceVersion string
+	Resource        resources.ResourceType
+	EventType       string    // The type of the event carrying the object.
+	EventTime       time.Time // When the event was processed.
+	JSON            string    // The object's body, as sent by the API server.
+}
+
+// RevisionRetention limits the revisions kept for each object.  Zero fields
+// impose no limit.  The most recent revision of an object is always kept.
+type RevisionRetention struct {
+	// MaxAge is how long revisions are kept after their event time.
+	MaxAge time.Duration
+	// MaxPerObject is the number of most recent revisions kept per object.
+	MaxPerObject int
+}
+
+// RevisionStore is implemented by backends that keep every observed
+// revision of each object, rather than only its latest body.  As with
+// Querier, callers should type-assert for it.
+type RevisionStore interface {
+	// RecordRevision stores r, replacing any revision of the same object
+	// with the same resource version, and then applies the retention
+	// policy to that object's revisions.
+	RecordRevision(r RevisionRecord) error
+	// SetRevisionRetention sets the policy applied by subsequent calls to
+	// RecordRevision.  By default, every revision is kept.
+	SetRevisionRetention(policy RevisionRetention)
+	// GetRevision returns the revision of the object with the given UID at
+	// the given resource version, or ErrNoRevision.
+	GetRevision(uid types.UID, rv string) (RevisionRecord, error)
+	// ListRevisions returns every stored revision of the object with the
+	// given UID, in the order they were recorded.
+	ListRevisions(uid types.UID) ([]RevisionRecord, error)
+}
+
+// CompressRevision returns the gzip-compressed form of a revision body, as
+// stored by backends.
+func CompressRevision(json string) ([]byte, error) {
+	var buf bytes.Buffer
+
+	zw := gzip.NewWriter(&buf)
+	if _, err := zw.Write([]byte(json)); err != nil {
+		return nil, fmt.Errorf("Unable to compress revision:  %s", err)
+	}
+	if err := zw.Close(); err != nil {
+		return nil, fmt.Errorf("Unable to compress revision:  %s", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// DecompressRevision reverses CompressRevision.
+func DecompressRevision(body []byte) (string, error) {
+	zr, err := gzip.NewReader(bytes.NewReader(body))
+	if err != nil {
+		return "", fmt.Errorf("Unable to decompress revision:  %s", err)
+	}
+	defer zr.Close()
+	json, err := ioutil.ReadAll(zr)
+	if err != nil {
+		return "", fmt.Errorf("Unable to decompress revision:  %s", err)
+	}
+	return string(json), nil
+}
@@ -0,0 +1,70 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package dbmanager
+
+import "fmt"
+
+// TimeSource records where a recorded time came from, so that readers can
+// tell how far to trust it.  Creation times always come from the objects
+// themselves, so only bind and delete times carry a source.
+type TimeSource string
+
+const (
+	// TimeExact times come from a field of the object itself (e.g., a
+	// pod's deletion timestamp).
+	TimeExact TimeSource = "exact"
+	// TimeObserved times are when the tracker processed the event reporting
+	// the change, which may lag the change itself.
+	TimeObserved TimeSource = "observed"
+	// TimeInferred times are when the tracker processed an event delivered
+	// during a resync (e.g., the initial events after a restart), so the
+	// change may have happened long before.
+	TimeInferred TimeSource = "inferred"
+	// TimeUnknown is reported for times recorded without a source, such as
+	// those recorded by older versions of the tracker.
+	TimeUnknown TimeSource = ""
+)
+
+var timeSourceRank = map[TimeSource]int{
+	TimeUnknown:  0,
+	TimeInferred: 1,
+	TimeObserved: 2,
+	TimeExact:    3,
+}
+
+// AtLeast returns true if s is at least as trustworthy as min.
+func (s TimeSource) AtLeast(min TimeSource) bool {
+	return timeSourceRank[s] >= timeSourceRank[min]
+}
+
+func (s TimeSource) String() string {
+	if s == TimeUnknown {
+		return "unknown"
+	}
+	return string(s)
+}
+
+// ParseTimeSource returns the TimeSource named by value:  exact, observed,
+// or inferred.
+func ParseTimeSource(value string) (TimeSource, error) {
+	s := TimeSource(value)
+	if s == TimeUnknown || timeSourceRank[s] == 0 {
+		return TimeUnknown, fmt.Errorf("Unknown time source %s; expected "+
+			"exact, observed, or inferred.", value)
+	}
+	return s, nil
+}
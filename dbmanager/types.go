@@ -39,6 +39,10 @@ const (
 	ISCSI     Table = "iscsi"
 	PodMount  Table = "pod_mount"
 	Container Table = "container"
+	// MountSummary holds the mounts of pods that have been pruned.
+	MountSummary Table = "mount_summary"
+	// ObjectVersion holds the last resource version applied to each object.
+	ObjectVersion Table = "object_version"
 )
 
 type DBManager interface {
@@ -83,21 +87,39 @@ type DBManager interface {
 		json, watcherNS, rv string)
 
 	// BindPVC records a binding between the PV and PVC whose UIDs are specified
-	// in the parameters.
+	// in the parameters.  timeSource says where bindTime came from.
 	BindPVC(pvUID types.UID, pvcUID types.UID, bindTime unversioned.Time,
-		rv string)
+		timeSource TimeSource, rv string)
 
-	// DeletePod records the time a Pod was deleted.
-	DeletePod(uid types.UID, deleteTime unversioned.Time, watcherNS,
-		rv string)
+	// DeletePod records the time a Pod was deleted.  As with BindPVC,
+	// timeSource says where deleteTime came from.
+	DeletePod(uid types.UID, deleteTime unversioned.Time,
+		timeSource TimeSource, watcherNS, rv string)
 	// DeletePV records the time a PV was deleted.
-	DeletePV(uid types.UID, deleteTime unversioned.Time, rv string)
+	DeletePV(uid types.UID, deleteTime unversioned.Time,
+		timeSource TimeSource, rv string)
 	// DeletePVC records the time a PVC was deleted.
-	DeletePVC(uid types.UID, deleteTime unversioned.Time, watcherNS,
-		rv string)
+	DeletePVC(uid types.UID, deleteTime unversioned.Time,
+		timeSource TimeSource, watcherNS, rv string)
 
 	// GetRV returns the most recent resource version for the given resource
 	// type in the given namespace.  This can be used to resume resource watches
 	// from the last observed point.
 	GetRV(resource resources.ResourceType, namespace string) string
+	// ObjectRV returns the most recent resource version applied to the
+	// object with the given UID, or an empty string if none has been.  Each
+	// of the methods above taking an rv records it for the object whose UID
+	// is its first argument (the PV, for BindPVC).  As with GetRV, the
+	// resource versions recorded only advance (see NewerRV), so that events
+	// older than those already applied can be recognized and dropped.
+	ObjectRV(uid types.UID) string
+}
+
+// Pinger is implemented by backends whose connection can be checked once,
+// without ValidateConnection's waiting, e.g., for a readiness probe.  As
+// with Querier, callers should type-assert for it.
+type Pinger interface {
+	// Ping returns an error if the database doesn't respond to a single
+	// request.
+	Ping() error
 }
@@ -0,0 +1,100 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"log"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// rebuildBatch is the number of logged events read at a time by Rebuild.
+const rebuildBatch = 1000
+
+// appendEvent appends an event line describing the object with the given
+// UID, received as described by rc on the watch for resource in namespace,
+// to the backend's event log, if it keeps one.  As with the backends' own
+// writes, failure is fatal; applying an event that wasn't logged would leave
+// tables that can't be rebuilt.
+func (w *Watcher) appendEvent(resource resources.ResourceType,
+	namespace string, uid types.UID, line string, rc receipt) {
+
+	el, ok := w.dbm.(dbmanager.EventLog)
+	if !ok || w.rebuilding {
+		return
+	}
+	err := el.AppendEvent(dbmanager.EventRecord{
+		Time:      rc.time,
+		Resource:  resource,
+		Namespace: namespace,
+		UID:       uid,
+		JSON:      line,
+		Resync:    rc.resync,
+	})
+	if err != nil {
+		log.Fatal("Unable to log event: ", err)
+	}
+}
+
+// Rebuild clears the tables derived from the backend's event log and replays
+// every logged event through the current handlers, so that changes to them
+// apply to events that have already been processed.  Nothing else may write
+// to the backend while it runs.  Rebuild returns the number of events
+// replayed.
+func (w *Watcher) Rebuild() (int, error) {
+	var (
+		replayed int
+		after    int64
+	)
+
+	el, ok := w.dbm.(dbmanager.EventLog)
+	if !ok {
+		return 0, errors.New("Backend does not keep an event log.")
+	}
+	if err := el.ClearDerived(); err != nil {
+		return 0, err
+	}
+	w.rebuilding = true
+	defer func() { w.rebuilding = false }()
+	for {
+		events, err := el.ListEvents(after, rebuildBatch)
+		if err != nil {
+			return replayed, err
+		}
+		if len(events) == 0 {
+			return replayed, nil
+		}
+		for _, e := range events {
+			after = e.ID
+			ok, err := w.handleLine(e.Resource, e.Namespace, e.JSON,
+				receipt{time: e.Time, resync: e.Resync})
+			if err != nil {
+				return replayed, err
+			}
+			if !ok {
+				log.Printf("Skipping logged event %d that can't be "+
+					"decoded:  %s", e.ID, e.JSON)
+				continue
+			}
+			replayed++
+		}
+	}
+}
@@ -0,0 +1,193 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory"
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+func TestRebuild(t *testing.T) {
+	const deleteLine = `{"type":"DELETED","object":{"metadata":{` +
+		`"name":"pod-1","namespace":"ns","uid":"pod-1",` +
+		`"resourceVersion":"11",` +
+		`"deletionTimestamp":"2016-06-01T00:00:00Z"}}}`
+
+	manager := memory.New()
+	el := manager.(dbmanager.EventLog)
+	q := manager.(dbmanager.Querier)
+	received := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	w := newReplayWatcher(manager)
+	for i, line := range []string{podEventLine("pod-1", "ns"), deleteLine} {
+		_, err := w.handleLine(resources.Pods, "ns", line,
+			receipt{time: received.Add(time.Duration(i) * time.Second)})
+		if err != nil {
+			t.Fatal("Unable to handle line: ", err)
+		}
+	}
+	events, err := el.ListEvents(0, 10)
+	if err != nil || len(events) != 2 {
+		t.Fatalf("Expected two logged events; got %v, %v", events, err)
+	}
+	if events[1].JSON != deleteLine || events[1].Namespace != "ns" ||
+		events[1].Resource != resources.Pods ||
+		!events[1].Time.Equal(received.Add(time.Second)) {
+		t.Error("Event logged incorrectly:  ", events[1])
+	}
+
+	// Anything written without going through the log is lost.
+	nfsID := manager.InsertNFS("192.0.2.1", "/stray")
+	manager.InsertPV("stray-pv", "stray", unversioned.Now(), nfsID,
+		dbmanager.NFS, 1, nil, "{}", "20")
+
+	replayed, err := newReplayWatcher(manager).Rebuild()
+	if err != nil {
+		t.Fatal("Unable to rebuild: ", err)
+	}
+	if replayed != 2 {
+		t.Errorf("Expected to replay two events; replayed %d", replayed)
+	}
+	if pvs, _ := q.ListPVs(); len(pvs) != 0 {
+		t.Error("Expected the stray PV to be cleared; got ", pvs)
+	}
+	if events, _ = el.ListEvents(0, 10); len(events) != 2 {
+		t.Error("Expected the log to be unchanged; got ", events)
+	}
+	revs, err := manager.(dbmanager.RevisionStore).ListRevisions("pod-1")
+	if err != nil || len(revs) != 2 || !revs[0].EventTime.Equal(received) {
+		t.Errorf("Expected revisions with the logged times; got %v, %v",
+			revs, err)
+	}
+
+	if _, err = newReplayWatcher(mock.New(false)).Rebuild(); err == nil {
+		t.Error("Expected an error rebuilding a backend without a log.")
+	}
+}
+
+func TestRebuildTimeSources(t *testing.T) {
+	const (
+		pvLine = `{"type":"ADDED","object":{"metadata":{"name":"pv-1",` +
+			`"uid":"pv-1","resourceVersion":"5"},` +
+			`"spec":{"nfs":{"server":"192.0.2.1","path":"/pv-1"},` +
+			`"claimRef":{"uid":"pvc-1"}}}}`
+		pvcLine = `{"type":"DELETED","object":{"metadata":{` +
+			`"name":"pvc-1","namespace":"ns","uid":"pvc-1",` +
+			`"resourceVersion":"6"}}}`
+	)
+
+	manager := memory.New()
+	q := manager.(dbmanager.Querier)
+	received := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	w := newReplayWatcher(manager)
+	// The PV arrives with the initial events, so its bind time is only
+	// inferred; the claim's deletion is seen as it happens.
+	if _, err := w.handleLine(resources.PVs, "", pvLine,
+		receipt{time: received, resync: true}); err != nil {
+		t.Fatal("Unable to handle line: ", err)
+	}
+	if _, err := w.handleLine(resources.PVCs, "ns", pvcLine,
+		receipt{time: received.Add(time.Second)}); err != nil {
+		t.Fatal("Unable to handle line: ", err)
+	}
+
+	check := func(when string) {
+		pvcs, err := q.ListPVCs()
+		if err != nil || len(pvcs) != 1 {
+			t.Fatalf("Expected one PVC %s; got %v, %v", when, pvcs, err)
+		}
+		pvc := pvcs[0]
+		if !pvc.BindTime.Equal(received) ||
+			pvc.BindTimeSource != dbmanager.TimeInferred ||
+			!pvc.DeleteTime.Equal(received.Add(time.Second)) ||
+			pvc.DeleteTimeSource != dbmanager.TimeObserved {
+			t.Errorf("Incorrect times for PVC %s:  %+v", when, pvc)
+		}
+	}
+	check("before rebuilding")
+	if _, err := newReplayWatcher(manager).Rebuild(); err != nil {
+		t.Fatal("Unable to rebuild: ", err)
+	}
+	check("after rebuilding")
+}
+
+func TestRebuildAfterPrune(t *testing.T) {
+	const (
+		addLine = `{"type":"ADDED","object":{"metadata":{"name":"pod-1",` +
+			`"namespace":"ns","uid":"pod-1","resourceVersion":"10",` +
+			`"creationTimestamp":"2016-06-01T00:00:00Z"},` +
+			`"spec":{"volumes":[{"name":"data",` +
+			`"persistentVolumeClaim":{"claimName":"claim-1"}}],` +
+			`"containers":[{"name":"c1","image":"busybox",` +
+			`"volumeMounts":[{"name":"data","mountPath":"/data"}]}]}}}`
+		deleteLine = `{"type":"DELETED","object":{"metadata":{` +
+			`"name":"pod-1","namespace":"ns","uid":"pod-1",` +
+			`"resourceVersion":"11",` +
+			`"deletionTimestamp":"2016-06-01T01:00:00Z"}}}`
+	)
+
+	manager := memory.New()
+	p := manager.(dbmanager.Pruner)
+	q := manager.(dbmanager.Querier)
+	received := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	w := newReplayWatcher(manager)
+	for _, line := range []string{addLine, deleteLine,
+		podEventLine("pod-2", "ns")} {
+		if _, err := w.handleLine(resources.Pods, "ns", line,
+			receipt{time: received}); err != nil {
+			t.Fatal("Unable to handle line: ", err)
+		}
+	}
+	pruned, err := prunePods(p, pruneOptions{
+		Before: received.Add(2 * time.Hour)})
+	if err != nil || pruned != 1 {
+		t.Fatalf("Expected to prune one pod; got %d, %v", pruned, err)
+	}
+
+	replayed, err := newReplayWatcher(manager).Rebuild()
+	if err != nil {
+		t.Fatal("Unable to rebuild: ", err)
+	}
+	if replayed != 1 {
+		t.Errorf("Expected to replay only the event of pod-2; replayed %d",
+			replayed)
+	}
+	if pods, err := p.DeletedPods(received.Add(time.Hour*24),
+		10); err != nil || len(pods) != 0 {
+		t.Errorf("Expected the pruned pod to stay gone; got %v, %v", pods,
+			err)
+	}
+	if mounts, _ := q.ListPodMounts(); len(mounts) != 0 {
+		t.Error("Expected the pruned mount to stay gone; got ", mounts)
+	}
+	if containers, _ := q.ListContainers(); len(containers) != 0 {
+		t.Error("Expected the pruned container to stay gone; got ",
+			containers)
+	}
+	summaries, err := p.ListMountSummaries()
+	if err != nil || len(summaries) != 1 || summaries[0].Pods != 1 ||
+		summaries[0].PVCName != "claim-1" {
+		t.Errorf("Expected the mount summary to survive; got %v, %v",
+			summaries, err)
+	}
+}
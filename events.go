@@ -18,6 +18,7 @@ package main
 
 import (
 	"fmt"
+	"sync"
 
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/unversioned"
@@ -34,7 +35,9 @@ const (
 	Added    EventType = "ADDED"
 	Modified EventType = "MODIFIED"
 	Deleted  EventType = "DELETED"
-	Error    EventType = "ERROR"
+	// ERROR events carry a Status rather than a resource, so APIClient.Watch
+	// reports them as StatusErrors, and they never reach the handlers.
+	Error EventType = "ERROR"
 
 	StatusTooOld = 410
 )
@@ -80,25 +83,61 @@ var resourceFactoryMap = map[resources.ResourceType]ResourceFactory{
 	resources.PVCs: func() ResourceEvent { return new(PVCEvent) },
 }
 
+// eventPools holds the events of each resource type that are no longer in
+// use, so that decoding a watch stream doesn't allocate a new event, with
+// its sizeable API object, for every line.
+var eventPools = make(map[resources.ResourceType]*sync.Pool)
+
+func init() {
+	for resource, factory := range resourceFactoryMap {
+		factory := factory
+		eventPools[resource] = &sync.Pool{
+			New: func() interface{} { return factory() },
+		}
+	}
+}
+
+// getEvent returns an empty event for the given resource type.  Once
+// nothing refers to the event or to its resource, it should be handed to
+// releaseEvent.
+func getEvent(resource resources.ResourceType) ResourceEvent {
+	return eventPools[resource].Get().(ResourceEvent)
+}
+
+// releaseEvent empties e and returns it to the pool for its resource type.
+// Since e is emptied rather than decoded into again, anything the handlers
+// kept from it (e.g., slices passed to the DBManager) is left alone.
+func releaseEvent(resource resources.ResourceType, e ResourceEvent) {
+	e.reset()
+	eventPools[resource].Put(e)
+}
+
 // ResourceEvent provides an abstraction around the different event types so
 // that we can unify their handling.
 type ResourceEvent interface {
 	GetResource() resources.Resource
 	GetType() EventType
 	String() string
+	// reset empties the event for reuse.
+	reset()
 }
 
-/* TODO:  Reduce the copying that happens here by changing stuff to pointers. */
+// The resources returned by GetResource point into the events, rather than
+// copying the API objects.
 func (p *PodEvent) GetResource() resources.Resource {
-	return &resources.PodResource{Pod: p.Resource}
+	return &resources.PodResource{Pod: &p.Resource}
 }
 func (p *PVEvent) GetResource() resources.Resource {
-	return &resources.PVResource{PersistentVolume: p.Resource}
+	return &resources.PVResource{PersistentVolume: &p.Resource}
 }
 func (p *PVCEvent) GetResource() resources.Resource {
-	return &resources.PVCResource{PersistentVolumeClaim: p.Resource}
+	return &resources.PVCResource{PersistentVolumeClaim: &p.Resource}
 }
 
+func (p *PodEvent) reset() { *p = PodEvent{} }
+func (p *PVEvent) reset()  { *p = PVEvent{} }
+func (p *PVCEvent) reset() { *p = PVCEvent{} }
+
 func (p *PodEvent) GetType() EventType { return p.Type }
 func (p *PVEvent) GetType() EventType  { return p.Type }
 func (p *PVCEvent) GetType() EventType { return p.Type }
@@ -0,0 +1,174 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// benchmarkPodLine is a watch event for a pod with the volumes, labels, and
+// status typical of those the tracker sees.
+const benchmarkPodLine = `{"type":"MODIFIED","object":{"kind":"Pod",` +
+	`"apiVersion":"v1","metadata":{"name":"web-3799136547-x0p1z",` +
+	`"generateName":"web-3799136547-","namespace":"billing",` +
+	`"selfLink":"/api/v1/namespaces/billing/pods/web-3799136547-x0p1z",` +
+	`"uid":"6d8a2c5e-3b1f-11e6-9d4c-42010af00002",` +
+	`"resourceVersion":"8812365",` +
+	`"creationTimestamp":"2016-06-21T17:03:12Z",` +
+	`"labels":{"app":"web","pod-template-hash":"3799136547",` +
+	`"tier":"frontend"},"annotations":{"kubernetes.io/created-by":` +
+	`"{\"kind\":\"SerializedReference\",\"apiVersion\":\"v1\"}"}},` +
+	`"spec":{"volumes":[{"name":"data","persistentVolumeClaim":` +
+	`{"claimName":"web-data"}},{"name":"default-token-4mh1x","secret":` +
+	`{"secretName":"default-token-4mh1x"}}],"containers":[{"name":"web",` +
+	`"image":"nginx:1.11","command":["nginx","-g","daemon off;"],` +
+	`"ports":[{"containerPort":80,"protocol":"TCP"}],"resources":{},` +
+	`"volumeMounts":[{"name":"data","mountPath":"/usr/share/nginx/html"},` +
+	`{"name":"default-token-4mh1x","readOnly":true,"mountPath":` +
+	`"/var/run/secrets/kubernetes.io/serviceaccount"}],` +
+	`"terminationMessagePath":"/dev/termination-log",` +
+	`"imagePullPolicy":"IfNotPresent"},{"name":"sidecar",` +
+	`"image":"busybox","command":["sh","-c","sleep 3600"],` +
+	`"resources":{},"volumeMounts":[{"name":"data","readOnly":true,` +
+	`"mountPath":"/data"}]}],"restartPolicy":"Always",` +
+	`"dnsPolicy":"ClusterFirst","nodeName":"node-7"},` +
+	`"status":{"phase":"Running","conditions":[{"type":"Ready",` +
+	`"status":"True","lastTransitionTime":"2016-06-21T17:03:20Z"}],` +
+	`"hostIP":"10.240.0.7","podIP":"10.244.3.12",` +
+	`"startTime":"2016-06-21T17:03:12Z"}}}` + "\n"
+
+// repeatReader endlessly repeats a single line.
+type repeatReader struct {
+	line []byte
+	off  int
+}
+
+func (r *repeatReader) Read(p []byte) (int, error) {
+	n := copy(p, r.line[r.off:])
+	r.off = (r.off + n) % len(r.line)
+	return n, nil
+}
+
+var benchmarkSink resources.Resource
+
+// BenchmarkDecodeWatchLines decodes a watch stream of pod events as
+// APIClient.Watch used to, a line at a time into a new event whose pod is
+// then copied into its Resource wrapper.  Compare it with
+// BenchmarkDecodeWatchStream, which uses the streaming decoder and pooled
+// events that Watch uses now.  Each op decodes one event.
+func BenchmarkDecodeWatchLines(b *testing.B) {
+	reader := bufio.NewReader(&repeatReader{line: []byte(benchmarkPodLine)})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			b.Fatal(err)
+		}
+		e := new(PodEvent)
+		if err = json.Unmarshal(line, e); err != nil {
+			b.Fatal(err)
+		}
+		pod := new(api.Pod)
+		*pod = e.Resource
+		_ = string(line)
+		benchmarkSink = &resources.PodResource{Pod: pod}
+	}
+}
+
+// BenchmarkDecodeWatchStream decodes the same stream as
+// BenchmarkDecodeWatchLines with the decoder APIClient.Watch uses.
+func BenchmarkDecodeWatchStream(b *testing.B) {
+	stream := newEventStream(resources.Pods, &repeatReader{
+		line: []byte(benchmarkPodLine)})
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		event, _ := stream.next()
+		if event.Err != nil {
+			b.Fatal(event.Err)
+		}
+		e := event.JSONEvent.(ResourceEvent)
+		benchmarkSink = e.GetResource()
+		releaseEvent(resources.Pods, e)
+	}
+}
+
+// TestPooledEventsReset checks that an event returned to the pool doesn't
+// carry anything over into the next one decoded into it.
+func TestPooledEventsReset(t *testing.T) {
+	const bareLine = `{"type":"ADDED","object":{"metadata":{` +
+		`"name":"pod-2","uid":"pod-2"}}}`
+
+	event := decodeWatchLine(resources.Pods, []byte(benchmarkPodLine))
+	e := event.JSONEvent.(*PodEvent)
+	pod := e.GetResource().(*resources.PodResource)
+	labels := pod.Labels
+	releaseEvent(resources.Pods, e)
+	if len(labels) != 3 || labels["app"] != "web" {
+		t.Error("Released event changed labels handed out earlier: ", labels)
+	}
+
+	for i := 0; i < 10; i++ {
+		event = decodeWatchLine(resources.Pods, []byte(bareLine))
+		r := event.JSONEvent.(ResourceEvent).GetResource()
+		p := r.(*resources.PodResource)
+		if p.Name != "pod-2" || len(p.Labels) != 0 ||
+			len(p.Spec.Containers) != 0 || p.Status.HostIP != "" {
+			t.Fatalf("Event decoded into pooled event kept old fields:  %s",
+				r)
+		}
+		releaseEvent(resources.Pods, event.JSONEvent.(ResourceEvent))
+	}
+}
+
+// TestEventStream checks that the stream returns each event along with its
+// JSON, however the reads are split up.
+func TestEventStream(t *testing.T) {
+	const errorLine = `{"type":"ERROR","object":{"kind":"Status",` +
+		`"reason":"Gone","code":410}}`
+	lines := []string{podEventLine("pod-1", "ns"), benchmarkPodLine,
+		errorLine}
+
+	for _, r := range []io.Reader{strings.NewReader(strings.Join(lines, "")),
+		iotest.OneByteReader(strings.NewReader(strings.Join(lines, "")))} {
+
+		stream := newEventStream(resources.Pods, r)
+		for i, expected := range lines {
+			event, line := stream.next()
+			expected = strings.TrimSpace(expected)
+			if string(line) != expected || event.JSON != expected {
+				t.Errorf("Expected line %d to be %s; got %s (%s)", i,
+					expected, line, event.JSON)
+			}
+			if e, ok := event.JSONEvent.(ResourceEvent); ok {
+				releaseEvent(resources.Pods, e)
+			}
+		}
+		event, line := stream.next()
+		if event.Err != io.EOF || line != nil {
+			t.Errorf("Expected EOF; got %v, %s", event.Err, line)
+		}
+	}
+}
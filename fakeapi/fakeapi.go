@@ -0,0 +1,560 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package fakeapi provides an in-process fake of the parts of the Kubernetes
+// API server that the tracker uses, so that the watcher can be tested
+// without a cluster.  Tests push events with Add, Modify, Delete and
+// PushError, and the server delivers them to any matching watches, replaying
+// them to watches that resume from an earlier resource version.  Calling
+// Expire makes the server respond to resumed watches with 410 Gone.
+//
+// Selectors are recorded with each watch request but aren't applied.
+package fakeapi
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// initialRV is the resource version the server starts at.  Like a
+// long-running cluster, the server has no history before this point, so
+// resuming from an earlier resource version returns 410 Gone.
+const initialRV = 1000
+
+// watchBuffer is the number of events that may be queued for a watch before
+// the server gives up on it and closes its stream, as the real API server
+// does for watchers that fall behind.
+const watchBuffer = 100
+
+// WatchRequest describes a watch opened on the server.  Namespace is empty
+// for watches across all namespaces.
+type WatchRequest struct {
+	Resource        resources.ResourceType
+	Namespace       string
+	ResourceVersion string
+	LabelSelector   string
+	FieldSelector   string
+}
+
+// event is an event pushed to the server, already encoded as a line of the
+// watch stream.
+type event struct {
+	resource  resources.ResourceType
+	namespace string
+	name      string
+	rv        int64
+	object    json.RawMessage
+	line      []byte
+}
+
+type objectKey struct {
+	resource  resources.ResourceType
+	namespace string
+	name      string
+}
+
+// watch is a single open watch stream.
+type watch struct {
+	resource  resources.ResourceType
+	namespace string
+	lines     chan []byte
+	closed    chan struct{}
+}
+
+func (w *watch) matches(resource resources.ResourceType,
+	namespace string) bool {
+
+	return w.resource == resource &&
+		(w.namespace == "" || w.namespace == namespace)
+}
+
+// Server is a fake API server.  Its methods are safe for concurrent use.
+type Server struct {
+	server *httptest.Server
+
+	mutex      sync.Mutex
+	rv         int64 // The last resource version assigned.
+	compacted  int64 // Resuming from before this RV returns 410 Gone.
+	history    []event
+	objects    map[objectKey]event
+	watches    map[*watch]bool
+	namespaces map[string]map[string]string
+	requests   []WatchRequest
+	errors     []error
+}
+
+// New starts a fake API server.  Callers should call Close when done with
+// it.
+func New() *Server {
+	s := &Server{
+		rv:         initialRV,
+		compacted:  initialRV + 1,
+		objects:    make(map[objectKey]event),
+		watches:    make(map[*watch]bool),
+		namespaces: make(map[string]map[string]string),
+	}
+	s.server = httptest.NewServer(http.HandlerFunc(s.serveHTTP))
+	return s
+}
+
+// Host returns the host:port of the server, suitable for passing to
+// NewAPIClient.
+func (s *Server) Host() string {
+	return strings.TrimPrefix(s.server.URL, "http://")
+}
+
+// Close ends every open watch and shuts the server down.
+func (s *Server) Close() {
+	s.CloseWatches()
+	s.server.Close()
+}
+
+// Add pushes an ADDED event for obj, which must be an *api.Pod,
+// *api.PersistentVolume or *api.PersistentVolumeClaim.  The server assigns
+// obj its next resource version, along with a UID and creation time if it
+// doesn't have them, and returns the new resource version.
+func (s *Server) Add(obj interface{}) (string, error) {
+	return s.push("ADDED", obj)
+}
+
+// Modify pushes a MODIFIED event for obj; see Add.
+func (s *Server) Modify(obj interface{}) (string, error) {
+	return s.push("MODIFIED", obj)
+}
+
+// Delete pushes a DELETED event for obj; see Add.  obj is given a deletion
+// time if it doesn't have one.
+func (s *Server) Delete(obj interface{}) (string, error) {
+	return s.push("DELETED", obj)
+}
+
+func (s *Server) push(eventType string, obj interface{}) (string, error) {
+	var resource resources.ResourceType
+	var meta *api.ObjectMeta
+	switch o := obj.(type) {
+	case *api.Pod:
+		resource, meta = resources.Pods, &o.ObjectMeta
+	case *api.PersistentVolume:
+		resource, meta = resources.PVs, &o.ObjectMeta
+	case *api.PersistentVolumeClaim:
+		resource, meta = resources.PVCs, &o.ObjectMeta
+	default:
+		return "", fmt.Errorf("Unsupported object type %T", obj)
+	}
+	if meta.Name == "" {
+		return "", fmt.Errorf("Object of type %T has no name", obj)
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.rv++
+	meta.ResourceVersion = strconv.FormatInt(s.rv, 10)
+	if meta.UID == "" {
+		meta.UID = types.UID(fmt.Sprintf("fake-uid-%d", s.rv))
+	}
+	if meta.CreationTimestamp.IsZero() {
+		meta.CreationTimestamp = unversioned.Now()
+	}
+	if eventType == "DELETED" && meta.DeletionTimestamp == nil {
+		now := unversioned.Now()
+		meta.DeletionTimestamp = &now
+	}
+	// Encode the object now, so that later changes by the caller don't
+	// affect what gets replayed.
+	object, err := json.Marshal(obj)
+	if err != nil {
+		return "", fmt.Errorf("Unable to encode %s:  %s", meta.Name, err)
+	}
+	line, err := encodeEvent(eventType, json.RawMessage(object))
+	if err != nil {
+		return "", err
+	}
+	e := event{
+		resource:  resource,
+		namespace: meta.Namespace,
+		name:      meta.Name,
+		rv:        s.rv,
+		object:    object,
+		line:      line,
+	}
+
+	key := objectKey{resource, meta.Namespace, meta.Name}
+	if eventType == "DELETED" {
+		delete(s.objects, key)
+	} else {
+		s.objects[key] = e
+	}
+	s.history = append(s.history, e)
+	s.send(resource, meta.Namespace, line)
+	return meta.ResourceVersion, nil
+}
+
+// PushError sends an ERROR event carrying status to every open watch on
+// resource.  Error events aren't replayed to later watches.
+func (s *Server) PushError(resource resources.ResourceType,
+	status unversioned.Status) error {
+
+	line, err := encodeEvent("ERROR", status)
+	if err != nil {
+		return err
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for w := range s.watches {
+		if w.resource == resource {
+			s.queue(w, line)
+		}
+	}
+	return nil
+}
+
+// Compact discards the event history, so that watches resuming from any
+// resource version issued so far get 410 Gone.
+func (s *Server) Compact() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.compacted = s.rv + 1
+	s.history = nil
+}
+
+// CloseWatches ends every open watch stream, forcing clients to reconnect.
+func (s *Server) CloseWatches() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	for w := range s.watches {
+		s.closeWatch(w)
+	}
+}
+
+// Expire compacts the history and closes every open watch, so that clients
+// get 410 Gone when they try to resume.
+func (s *Server) Expire() {
+	s.Compact()
+	s.CloseWatches()
+}
+
+// AddNamespace creates a namespace with the given labels, for use by
+// namespace listings.
+func (s *Server) AddNamespace(name string, labels map[string]string) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.namespaces[name] = labels
+}
+
+// OpenWatches returns the number of watch streams currently open.
+func (s *Server) OpenWatches() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.watches)
+}
+
+// Requests returns every watch request the server has received, in order.
+func (s *Server) Requests() []WatchRequest {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]WatchRequest(nil), s.requests...)
+}
+
+// Errors returns the invalid requests the server has received, such as
+// watches resuming from a resource version it never issued.
+func (s *Server) Errors() []error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return append([]error(nil), s.errors...)
+}
+
+// send queues line on every open watch matching resource and namespace.
+// The caller must hold the mutex.
+func (s *Server) send(resource resources.ResourceType, namespace string,
+	line []byte) {
+
+	for w := range s.watches {
+		if w.matches(resource, namespace) {
+			s.queue(w, line)
+		}
+	}
+}
+
+// queue queues line on w, closing w if it has fallen too far behind.  The
+// caller must hold the mutex.
+func (s *Server) queue(w *watch, line []byte) {
+	select {
+	case w.lines <- line:
+	default:
+		s.closeWatch(w)
+	}
+}
+
+// closeWatch ends w's stream.  The caller must hold the mutex.
+func (s *Server) closeWatch(w *watch) {
+	if s.watches[w] {
+		close(w.closed)
+		delete(s.watches, w)
+	}
+}
+
+// invalid records an invalid request.  The caller must hold the mutex.
+func (s *Server) invalid(format string, args ...interface{}) string {
+	err := fmt.Errorf(format, args...)
+	s.errors = append(s.errors, err)
+	return err.Error()
+}
+
+func (s *Server) serveHTTP(rw http.ResponseWriter, r *http.Request) {
+	// APIClient's watch URLs contain a double slash.
+	path := strings.Replace(r.URL.Path, "//", "/", -1)
+	parts := strings.Split(strings.TrimPrefix(path, "/api/v1/"), "/")
+	switch {
+	case len(parts) == 1 && parts[0] == "namespaces":
+		s.serveNamespaces(rw, r)
+	case len(parts) == 2 && parts[0] == "watch":
+		s.serveWatch(rw, r, resources.ResourceType(parts[1]), "")
+	case len(parts) == 4 && parts[0] == "watch" &&
+		parts[1] == "namespaces" && parts[3] != string(resources.PVs):
+		s.serveWatch(rw, r, resources.ResourceType(parts[3]), parts[2])
+	default:
+		s.mutex.Lock()
+		msg := s.invalid("Unexpected request for %s", r.URL)
+		s.mutex.Unlock()
+		writeStatus(rw, http.StatusNotFound, unversioned.StatusReasonNotFound,
+			msg)
+	}
+}
+
+func (s *Server) serveNamespaces(rw http.ResponseWriter, r *http.Request) {
+	selector := parseSelector(r.URL.Query().Get("labelSelector"))
+
+	s.mutex.Lock()
+	var list api.NamespaceList
+	for name, labels := range s.namespaces {
+		if selector.matches(labels) {
+			ns := api.Namespace{}
+			ns.Name = name
+			ns.Labels = labels
+			list.Items = append(list.Items, ns)
+		}
+	}
+	s.mutex.Unlock()
+
+	sort.Sort(namespacesByName(list.Items))
+	rw.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(rw).Encode(list)
+}
+
+func (s *Server) serveWatch(rw http.ResponseWriter, r *http.Request,
+	resource resources.ResourceType, namespace string) {
+
+	query := r.URL.Query()
+	rvString := query.Get("resourceVersion")
+
+	s.mutex.Lock()
+	s.requests = append(s.requests, WatchRequest{
+		Resource:        resource,
+		Namespace:       namespace,
+		ResourceVersion: rvString,
+		LabelSelector:   query.Get("labelSelector"),
+		FieldSelector:   query.Get("fieldSelector"),
+	})
+	if resource != resources.Pods && resource != resources.PVs &&
+		resource != resources.PVCs {
+
+		msg := s.invalid("Unsupported resource %s", resource)
+		s.mutex.Unlock()
+		writeStatus(rw, http.StatusNotFound, unversioned.StatusReasonNotFound,
+			msg)
+		return
+	}
+
+	var backlog [][]byte
+	if rvString == "" || rvString == "0" {
+		// As with the real API server, a watch without a resource version
+		// starts with an ADDED event for every existing object.
+		var current []event
+		for key, e := range s.objects {
+			if key.resource == resource &&
+				(namespace == "" || key.namespace == namespace) {
+				current = append(current, e)
+			}
+		}
+		sort.Sort(eventsByRV(current))
+		for _, e := range current {
+			line, err := encodeEvent("ADDED", e.object)
+			if err != nil {
+				s.mutex.Unlock()
+				http.Error(rw, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			backlog = append(backlog, line)
+		}
+	} else {
+		rv, err := strconv.ParseInt(rvString, 10, 64)
+		if err != nil || rv < 0 || rv > s.rv {
+			msg := s.invalid("Watch on %s resumed from resource version "+
+				"%q, which was never issued (latest is %d)", resource,
+				rvString, s.rv)
+			s.mutex.Unlock()
+			writeStatus(rw, http.StatusBadRequest,
+				unversioned.StatusReasonBadRequest, msg)
+			return
+		}
+		if rv < s.compacted {
+			msg := fmt.Sprintf("too old resource version: %d (%d)", rv,
+				s.compacted)
+			s.mutex.Unlock()
+			writeStatus(rw, http.StatusGone, unversioned.StatusReasonGone,
+				msg)
+			return
+		}
+		for _, e := range s.history {
+			if e.rv > rv && e.resource == resource &&
+				(namespace == "" || e.namespace == namespace) {
+				backlog = append(backlog, e.line)
+			}
+		}
+	}
+	w := &watch{
+		resource:  resource,
+		namespace: namespace,
+		lines:     make(chan []byte, watchBuffer),
+		closed:    make(chan struct{}),
+	}
+	s.watches[w] = true
+	s.mutex.Unlock()
+
+	defer func() {
+		s.mutex.Lock()
+		s.closeWatch(w)
+		s.mutex.Unlock()
+	}()
+
+	rw.Header().Set("Content-Type", "application/json")
+	flusher, _ := rw.(http.Flusher)
+	// gone stays nil if the client's departure can't be detected; the watch
+	// then ends only when it's closed or a write fails.
+	var gone <-chan bool
+	if notifier, ok := rw.(http.CloseNotifier); ok {
+		gone = notifier.CloseNotify()
+	}
+	for _, line := range backlog {
+		rw.Write(line)
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	for {
+		select {
+		case line := <-w.lines:
+			if _, err := rw.Write(line); err != nil {
+				return
+			}
+			if flusher != nil {
+				flusher.Flush()
+			}
+		case <-w.closed:
+			return
+		case <-gone:
+			return
+		}
+	}
+}
+
+// encodeEvent encodes a single line of a watch stream.
+func encodeEvent(eventType string, obj interface{}) ([]byte, error) {
+	line, err := json.Marshal(struct {
+		Type   string      `json:"type"`
+		Object interface{} `json:"object"`
+	}{eventType, obj})
+	if err != nil {
+		return nil, fmt.Errorf("Unable to encode %s event:  %s", eventType,
+			err)
+	}
+	return append(line, '\n'), nil
+}
+
+// writeStatus responds with a bare Status object, as the API server does
+// when it can't start a watch.
+func writeStatus(rw http.ResponseWriter, code int,
+	reason unversioned.StatusReason, message string) {
+
+	rw.Header().Set("Content-Type", "application/json")
+	rw.WriteHeader(code)
+	json.NewEncoder(rw).Encode(unversioned.Status{
+		TypeMeta: unversioned.TypeMeta{Kind: "Status", APIVersion: "v1"},
+		Status:   unversioned.StatusFailure,
+		Message:  message,
+		Reason:   reason,
+		Code:     int32(code),
+	})
+}
+
+// selector is a parsed equality-based label selector, such as
+// "app=web,tier!=test".
+type selector []selectorTerm
+
+type selectorTerm struct {
+	key, value string
+	equal      bool
+}
+
+func parseSelector(s string) selector {
+	var sel selector
+	for _, term := range strings.Split(s, ",") {
+		if term == "" {
+			continue
+		}
+		if i := strings.Index(term, "!="); i >= 0 {
+			sel = append(sel, selectorTerm{term[:i], term[i+2:], false})
+		} else if i := strings.Index(term, "="); i >= 0 {
+			value := strings.TrimPrefix(term[i+1:], "=")
+			sel = append(sel, selectorTerm{term[:i], value, true})
+		}
+	}
+	return sel
+}
+
+func (sel selector) matches(labels map[string]string) bool {
+	for _, term := range sel {
+		if (labels[term.key] == term.value) != term.equal {
+			return false
+		}
+	}
+	return true
+}
+
+type eventsByRV []event
+
+func (e eventsByRV) Len() int           { return len(e) }
+func (e eventsByRV) Swap(i, j int)      { e[i], e[j] = e[j], e[i] }
+func (e eventsByRV) Less(i, j int) bool { return e[i].rv < e[j].rv }
+
+type namespacesByName []api.Namespace
+
+func (n namespacesByName) Len() int           { return len(n) }
+func (n namespacesByName) Swap(i, j int)      { n[i], n[j] = n[j], n[i] }
+func (n namespacesByName) Less(i, j int) bool { return n[i].Name < n[j].Name }
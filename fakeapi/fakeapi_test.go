@@ -0,0 +1,244 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package fakeapi
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"net/http"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+type testEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// openWatch opens the watch at path, returning the response and a reader
+// for its body.
+func openWatch(t *testing.T, s *Server, path string) (*http.Response,
+	*bufio.Reader) {
+
+	resp, err := http.Get("http://" + s.Host() + path)
+	if err != nil {
+		t.Fatal("Unable to open watch: ", err)
+	}
+	return resp, bufio.NewReader(resp.Body)
+}
+
+// readPod reads the next event from reader, which must be for a pod.
+func readPod(t *testing.T, reader *bufio.Reader) (string, *api.Pod) {
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatal("Unable to read event: ", err)
+	}
+	var e testEvent
+	var pod api.Pod
+	if err := json.Unmarshal(line, &e); err != nil {
+		t.Fatal("Unable to decode event: ", err)
+	}
+	if err := json.Unmarshal(e.Object, &pod); err != nil {
+		t.Fatal("Unable to decode pod: ", err)
+	}
+	return e.Type, &pod
+}
+
+func newPod(name, namespace string) *api.Pod {
+	pod := &api.Pod{}
+	pod.Name = name
+	pod.Namespace = namespace
+	return pod
+}
+
+func TestWatch(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	pod := newPod("pod-a", "ns")
+	rv, err := s.Add(pod)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pod.UID == "" || pod.CreationTimestamp.IsZero() {
+		t.Error("Pod not given a UID and creation time.")
+	}
+	resp, reader := openWatch(t, s, "/api/v1/watch/namespaces/ns/pods")
+	defer resp.Body.Close()
+
+	eventType, got := readPod(t, reader)
+	if eventType != "ADDED" || got.Name != "pod-a" ||
+		got.ResourceVersion != rv {
+		t.Errorf("Got %s for %s at RV %s; expected ADDED for pod-a at %s",
+			eventType, got.Name, got.ResourceVersion, rv)
+	}
+
+	// Events in other namespaces shouldn't be delivered.
+	if _, err := s.Add(newPod("pod-b", "ns-extra")); err != nil {
+		t.Fatal(err)
+	}
+	if rv, err = s.Delete(pod); err != nil {
+		t.Fatal(err)
+	}
+	eventType, got = readPod(t, reader)
+	if eventType != "DELETED" || got.Name != "pod-a" ||
+		got.ResourceVersion != rv {
+		t.Errorf("Got %s for %s at RV %s; expected DELETED for pod-a at %s",
+			eventType, got.Name, got.ResourceVersion, rv)
+	}
+	if got.DeletionTimestamp == nil {
+		t.Error("Deleted pod has no deletion time.")
+	}
+	requests := s.Requests()
+	if len(requests) != 1 || requests[0].Resource != resources.Pods ||
+		requests[0].Namespace != "ns" {
+		t.Errorf("Unexpected requests %v", requests)
+	}
+}
+
+func TestWatchResume(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	var rvs []string
+	for _, name := range []string{"pod-a", "pod-b", "pod-c"} {
+		rv, err := s.Add(newPod(name, "ns"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		rvs = append(rvs, rv)
+	}
+	resp, reader := openWatch(t, s,
+		"/api/v1//watch/pods?resourceVersion="+rvs[0])
+	defer resp.Body.Close()
+	for _, expected := range []string{"pod-b", "pod-c"} {
+		if _, got := readPod(t, reader); got.Name != expected {
+			t.Errorf("Got %s; expected %s", got.Name, expected)
+		}
+	}
+	if errs := s.Errors(); len(errs) > 0 {
+		t.Error("Unexpected errors: ", errs)
+	}
+}
+
+func TestWatchStatus(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	rv, err := s.Add(newPod("pod-a", "ns"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Expire()
+	for _, test := range []struct {
+		rv     string
+		code   int
+		reason unversioned.StatusReason
+		errors int
+	}{
+		{"1", http.StatusGone, unversioned.StatusReasonGone, 0},
+		{rv, http.StatusGone, unversioned.StatusReasonGone, 0},
+		{rv + "0", http.StatusBadRequest,
+			unversioned.StatusReasonBadRequest, 1},
+		{"x", http.StatusBadRequest, unversioned.StatusReasonBadRequest, 2},
+	} {
+		path := "/api/v1/watch/pods?resourceVersion=" + test.rv
+		resp, reader := openWatch(t, s, path)
+		var status unversioned.Status
+		err := json.NewDecoder(reader).Decode(&status)
+		resp.Body.Close()
+		if err != nil {
+			t.Fatalf("Unable to decode status for RV %s:  %s", test.rv, err)
+		}
+		if resp.StatusCode != test.code || int(status.Code) != test.code ||
+			status.Reason != test.reason {
+			t.Errorf("Got %d (%d, %s) for RV %s; expected %d (%s)",
+				resp.StatusCode, status.Code, status.Reason, test.rv,
+				test.code, test.reason)
+		}
+		if errs := s.Errors(); len(errs) != test.errors {
+			t.Errorf("Got %d errors for RV %s; expected %d", len(errs),
+				test.rv, test.errors)
+		}
+	}
+}
+
+func TestPushErrorAndClose(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	resp, reader := openWatch(t, s, "/api/v1/watch/pods")
+	defer resp.Body.Close()
+	// Make sure the watch is registered before pushing to it.
+	if _, err := s.Add(newPod("pod-a", "ns")); err != nil {
+		t.Fatal(err)
+	}
+	readPod(t, reader)
+
+	err := s.PushError(resources.Pods, unversioned.Status{
+		Code:   http.StatusGone,
+		Reason: unversioned.StatusReasonGone,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	line, err := reader.ReadBytes('\n')
+	if err != nil {
+		t.Fatal("Unable to read error event: ", err)
+	}
+	var e testEvent
+	if err := json.Unmarshal(line, &e); err != nil || e.Type != "ERROR" {
+		t.Errorf("Got %s (%v); expected an ERROR event", line, err)
+	}
+
+	s.CloseWatches()
+	if _, err := reader.ReadBytes('\n'); err != io.EOF {
+		t.Error("Expected EOF after closing watches; got ", err)
+	}
+	if n := s.OpenWatches(); n != 0 {
+		t.Errorf("Got %d open watches after closing them", n)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	s := New()
+	defer s.Close()
+
+	s.AddNamespace("ns-b", map[string]string{"tenant": "a"})
+	s.AddNamespace("ns-a", map[string]string{"tenant": "a"})
+	s.AddNamespace("ns-c", map[string]string{"tenant": "b"})
+
+	resp, err := http.Get("http://" + s.Host() +
+		"/api/v1/namespaces?labelSelector=tenant%3Da")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var list api.NamespaceList
+	if err := json.NewDecoder(resp.Body).Decode(&list); err != nil {
+		t.Fatal("Unable to decode namespaces: ", err)
+	}
+	if len(list.Items) != 2 || list.Items[0].Name != "ns-a" ||
+		list.Items[1].Name != "ns-b" {
+		t.Errorf("Unexpected namespaces %v", list.Items)
+	}
+}
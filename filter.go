@@ -0,0 +1,103 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// Reasons an event was dropped by an EventFilter, used to label
+// eventsFiltered.
+const (
+	filteredNamespace = "namespace"
+	filteredLabel     = "label"
+	// filteredSelector is used for DELETED events sent when objects stop
+	// matching the API server's selectors.
+	filteredSelector = "selector"
+)
+
+// EventFilter decides on the client side which objects the Watcher records,
+// for rules the API server's selectors can't express.  Namespace rules are
+// shell patterns (e.g., "ci-*"); label rules are either "key=value" or just
+// "key", which matches any value.  An object is recorded if it matches some
+// include rule (or there are none) and no exclude rule.  Namespace rules
+// don't apply to PVs.
+type EventFilter struct {
+	IncludeNamespaces []string
+	ExcludeNamespaces []string
+	IncludeLabels     []string
+	ExcludeLabels     []string
+}
+
+// Validate returns an error if any of the namespace patterns are malformed.
+func (f *EventFilter) Validate() error {
+	for _, pattern := range append(append([]string{}, f.IncludeNamespaces...),
+		f.ExcludeNamespaces...) {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("Invalid namespace pattern %s:  %s", pattern,
+				err)
+		}
+	}
+	return nil
+}
+
+// matchNamespace returns whether namespace matches any of patterns.
+func matchNamespace(patterns []string, namespace string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, namespace); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// matchLabels returns whether labels satisfy any of rules.
+func matchLabels(rules []string, labels map[string]string) bool {
+	for _, rule := range rules {
+		parts := strings.SplitN(rule, "=", 2)
+		value, ok := labels[parts[0]]
+		if ok && (len(parts) == 1 || value == parts[1]) {
+			return true
+		}
+	}
+	return false
+}
+
+// reject returns the reason the filter drops r (filteredNamespace or
+// filteredLabel), or an empty string if r should be recorded.
+func (f *EventFilter) reject(resource resources.ResourceType,
+	r resources.Resource) string {
+
+	if resource != resources.PVs {
+		ns := r.GetNamespace()
+		if (len(f.IncludeNamespaces) > 0 &&
+			!matchNamespace(f.IncludeNamespaces, ns)) ||
+			matchNamespace(f.ExcludeNamespaces, ns) {
+			return filteredNamespace
+		}
+	}
+	labels := r.GetLabels()
+	if (len(f.IncludeLabels) > 0 && !matchLabels(f.IncludeLabels, labels)) ||
+		matchLabels(f.ExcludeLabels, labels) {
+		return filteredLabel
+	}
+	return ""
+}
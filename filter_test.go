@@ -0,0 +1,272 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+func getFilterPod(namespace string,
+	labels map[string]string) resources.Resource {
+
+	return &resources.PodResource{Pod: &api.Pod{ObjectMeta: api.ObjectMeta{
+		Namespace: namespace, Labels: labels}}}
+}
+
+func TestEventFilter(t *testing.T) {
+	filter := EventFilter{
+		IncludeNamespaces: []string{"team-*", "prod"},
+		ExcludeNamespaces: []string{"team-ci-*"},
+		IncludeLabels:     []string{"app", "tier=db"},
+		ExcludeLabels:     []string{"scratch=true"},
+	}
+	if err := filter.Validate(); err != nil {
+		t.Fatal("Valid filter failed validation: ", err)
+	}
+	tests := []struct {
+		resource  resources.ResourceType
+		namespace string
+		labels    map[string]string
+		expected  string
+	}{
+		{resources.Pods, "team-a", map[string]string{"app": "web"}, ""},
+		{resources.PVCs, "prod", map[string]string{"tier": "db"}, ""},
+		{resources.Pods, "kube-system", map[string]string{"app": "dns"},
+			filteredNamespace},
+		{resources.Pods, "team-ci-42", map[string]string{"app": "web"},
+			filteredNamespace},
+		{resources.Pods, "team-a", map[string]string{"tier": "web"},
+			filteredLabel},
+		{resources.Pods, "team-a", nil, filteredLabel},
+		{resources.Pods, "team-a", map[string]string{"app": "web",
+			"scratch": "true"}, filteredLabel},
+		// Namespace rules don't apply to PVs.
+		{resources.PVs, "", map[string]string{"app": "nfs"}, ""},
+	}
+	for _, test := range tests {
+		r := getFilterPod(test.namespace, test.labels)
+		if reason := filter.reject(test.resource, r); reason !=
+			test.expected {
+			t.Errorf("Expected %q for %s in %q with labels %v; got %q",
+				test.expected, test.resource, test.namespace, test.labels,
+				reason)
+		}
+	}
+
+	var empty EventFilter
+	if reason := empty.reject(resources.Pods,
+		getFilterPod("kube-system", nil)); reason != "" {
+		t.Errorf("Empty filter rejected pod:  %s", reason)
+	}
+	bad := EventFilter{ExcludeNamespaces: []string{"["}}
+	if err := bad.Validate(); err == nil {
+		t.Error("Malformed pattern passed validation")
+	}
+}
+
+func TestWatchSelectorsAndFilters(t *testing.T) {
+	queries := make(chan string, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+
+		queries <- r.URL.RawQuery
+		fmt.Fprint(w, podEventLine("kept", "team-a")+
+			podEventLine("dropped", "kube-system"))
+		w.(http.Flusher).Flush()
+		<-w.(http.CloseNotifier).CloseNotify()
+	}))
+	defer server.Close()
+
+	manager := &lockedManager{MockManager: mock.New(false).(*mock.MockManager)}
+	w, err := NewWatcher(nil, strings.TrimPrefix(server.URL, "http://"),
+		manager)
+	if err != nil {
+		t.Fatal("Unable to create watcher: ", err)
+	}
+	if err = w.SetWatchOptions(WatchOptions{LabelSelector: "app=web",
+		FieldSelector: "metadata.namespace!=default"}); err != nil {
+		t.Fatal("Unable to set watch options: ", err)
+	}
+	if err = w.SetFilter(EventFilter{
+		ExcludeNamespaces: []string{"kube-*"}}); err != nil {
+		t.Fatal("Unable to set filter: ", err)
+	}
+	before := eventsFiltered.Value(string(resources.Pods), filteredNamespace)
+	if err = w.Watch(resources.Pods, false); err != nil {
+		t.Fatal("Unable to watch pods: ", err)
+	}
+	defer w.Stop(resources.Pods)
+
+	query := <-queries
+	for _, s := range []string{"labelSelector=app%3Dweb",
+		"fieldSelector=metadata.namespace%21%3Ddefault"} {
+		if !strings.Contains(query, s) {
+			t.Errorf("Watch query %q missing %s", query, s)
+		}
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for eventsFiltered.Value(string(resources.Pods),
+		filteredNamespace) == before {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for event to be filtered")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !manager.hasPod("kept") || manager.hasPod("dropped") {
+		t.Error("Filter recorded the wrong pods")
+	}
+}
+
+// relabeledPodLine returns a watch event for the pod uid in ns-a, labeled
+// with labels (a JSON object).  Like the events the API server sends when
+// objects leave a selector, it has no deletion time.
+func relabeledPodLine(eventType, uid, labels, rv string) string {
+	return fmt.Sprintf(`{"type":"%s","object":{"metadata":{"name":"%s",`+
+		`"namespace":"ns-a","uid":"%s","resourceVersion":"%s",`+
+		`"labels":%s}}}`, eventType, uid, uid, rv, labels)
+}
+
+func TestRelabelUnderSelector(t *testing.T) {
+	manager := mock.New(false).(*mock.MockManager)
+	w, err := NewWatcher(nil, "localhost:8080", manager)
+	if err != nil {
+		t.Fatal("Unable to create watcher: ", err)
+	}
+	if err = w.SetWatchOptions(WatchOptions{
+		LabelSelector: "app in (web,api)"}); err != nil {
+		t.Fatal("Unable to set watch options: ", err)
+	}
+	if err = w.SetFilter(EventFilter{
+		ExcludeLabels: []string{"scratch"}}); err != nil {
+		t.Fatal("Unable to set filter: ", err)
+	}
+	key := watchKey{resources.Pods, ""}
+	state := w.getWatchState(key)
+	handle := func(line string) {
+		e := decodeWatchLine(resources.Pods, []byte(line))
+		if e.Err != nil {
+			t.Fatal("Unable to decode event: ", e.Err)
+		}
+		w.handleEvent(key, state, w.handlePods,
+			e.JSONEvent.(ResourceEvent), e.JSON, false)
+	}
+
+	// pod-1 is relabeled out of the selector, so the API server reports it
+	// as deleted, although it isn't.
+	before := eventsFiltered.Value(string(resources.Pods), filteredSelector)
+	handle(relabeledPodLine("ADDED", "pod-1", `{"app":"web"}`, "10"))
+	handle(relabeledPodLine("DELETED", "pod-1", `{"app":"db"}`, "11"))
+	if _, ok := manager.PodForUID["pod-1"]; !ok || manager.Deletions != 0 {
+		t.Error("Pod leaving the selector was recorded as deleted")
+	}
+	if eventsFiltered.Value(string(resources.Pods),
+		filteredSelector) != before+1 {
+		t.Error("Pod leaving the selector wasn't counted")
+	}
+
+	// pod-2 is relabeled out of the client-side filter and then deleted;
+	// its deletion is still recorded.
+	handle(relabeledPodLine("ADDED", "pod-2", `{"app":"api"}`, "12"))
+	handle(relabeledPodLine("MODIFIED", "pod-2",
+		`{"app":"api","scratch":"true"}`, "13"))
+	handle(relabeledPodLine("DELETED", "pod-2",
+		`{"app":"api","scratch":"true"}`, "14"))
+	if _, ok := manager.PodForUID["pod-2"]; ok || manager.Deletions != 1 {
+		t.Error("Deletion of relabeled pod wasn't recorded")
+	}
+
+	// Deletions of objects that were never recorded are still filtered.
+	handle(relabeledPodLine("DELETED", "pod-3",
+		`{"app":"web","scratch":"true"}`, "15"))
+	if manager.Deletions != 1 {
+		t.Error("Deletion of filtered pod was recorded")
+	}
+}
+
+func TestSelectorMatches(t *testing.T) {
+	pod := &resources.PodResource{Pod: &api.Pod{}}
+	pod.Namespace = "team-a"
+	pod.Labels = map[string]string{"app": "web", "tier": "frontend",
+		"domain": "internal", "app.kubernetes.io/instance": "main"}
+	pod.Status.Phase = api.PodRunning
+	for _, test := range []struct {
+		opts     WatchOptions
+		expected bool
+	}{
+		{WatchOptions{}, true},
+		{WatchOptions{LabelSelector: "app=web, tier==frontend"}, true},
+		{WatchOptions{LabelSelector: "app!=web"}, false},
+		{WatchOptions{LabelSelector: "env!=prod,!env,tier"}, true},
+		{WatchOptions{LabelSelector: "env"}, false},
+		{WatchOptions{LabelSelector: "app in (api, web),env notin (a)"},
+			true},
+		{WatchOptions{LabelSelector: "app notin (api,web)"}, false},
+		// Keys containing "in" aren't mistaken for the operator.
+		{WatchOptions{LabelSelector: "domain notin (x)"}, true},
+		{WatchOptions{LabelSelector: "domain in (internal)"}, true},
+		{WatchOptions{LabelSelector: "domain in (x, y)"}, false},
+		{WatchOptions{LabelSelector: "!inactive,tier in (frontend)"},
+			true},
+		{WatchOptions{
+			LabelSelector: "app.kubernetes.io/instance in (main,canary)"},
+			true},
+		{WatchOptions{
+			LabelSelector: "app.kubernetes.io/instance notin (main)"},
+			false},
+		{WatchOptions{LabelSelector: "app.kubernetes.io/instance=main"},
+			true},
+		{WatchOptions{FieldSelector: "metadata.namespace!=team-a"}, false},
+		{WatchOptions{FieldSelector: "status.phase=Running"}, true},
+		{WatchOptions{FieldSelector: "status.phase!=Running"}, false},
+		// Fields that can't be read are assumed to match.
+		{WatchOptions{FieldSelector: "spec.serviceAccountName=x"}, true},
+		{WatchOptions{FieldSelector: "spec.serviceAccountName!=x," +
+			"status.phase=Running"}, true},
+		{WatchOptions{FieldSelector: "spec.serviceAccountName=x," +
+			"status.phase=Pending"}, false},
+	} {
+		if actual := test.opts.matches(pod); actual != test.expected {
+			t.Errorf("Expected %t for %+v; got %t", test.expected, test.opts,
+				actual)
+		}
+	}
+}
+
+func TestSetWatchOptionsInvalid(t *testing.T) {
+	w, err := NewWatcher(nil, "localhost:8080", mock.New(false))
+	if err != nil {
+		t.Fatal("Unable to create watcher: ", err)
+	}
+	for _, opts := range []WatchOptions{
+		{LabelSelector: "app in web"},
+		{FieldSelector: "status.phase"},
+	} {
+		if err = w.SetWatchOptions(opts); err == nil {
+			t.Errorf("Expected an error for %+v", opts)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// The defaults for how long a newly opened watch must go without delivering
+// an event before we consider its initial events delivered, and how long
+// after the watch opens we consider them delivered regardless; see
+// Watcher.syncQuiet.
+const (
+	defaultSyncQuiet = time.Second
+	defaultSyncLimit = 30 * time.Second
+)
+
+// readyPingTimeout bounds how long readiness checks wait for the database,
+// so that they answer within a probe's default one-second timeout.
+const readyPingTimeout = 500 * time.Millisecond
+
+// watchState tracks the progress of a single watch goroutine so that health
+// checks can report on it.
+type watchState struct {
+	mutex     sync.Mutex
+	open      bool
+	synced    bool
+	busySince time.Time // Zero while waiting for events.
+}
+
+// opened records that the API server has accepted a new stream.  Its
+// initial events need to be delivered again before the watch is ready.
+func (s *watchState) opened() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.open = true
+	s.synced = false
+}
+
+// closed records that the current stream has ended.
+func (s *watchState) closed() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.open = false
+}
+
+// setSynced records that the current stream has delivered its initial
+// events.
+func (s *watchState) setSynced() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.synced = true
+}
+
+// setBusy records that the goroutine has started work (e.g., handling an
+// event) that should finish promptly.
+func (s *watchState) setBusy() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.busySince = time.Now()
+}
+
+// setIdle records that the goroutine has gone back to waiting for events.
+func (s *watchState) setIdle() {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.busySince = time.Time{}
+}
+
+// ready returns an error describing why the watch isn't ready, if it isn't.
+func (s *watchState) ready() error {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if !s.open {
+		return errors.New("no open stream")
+	}
+	if !s.synced {
+		return errors.New("initial events not yet delivered")
+	}
+	return nil
+}
+
+// busyFor returns how long the goroutine has been working on its current
+// task, or zero if it is waiting for events.
+func (s *watchState) busyFor(now time.Time) time.Duration {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	if s.busySince.IsZero() {
+		return 0
+	}
+	return now.Sub(s.busySince)
+}
+
+// checkWatches applies check to the state of every watch, returning an
+// error listing the watches for which it failed.
+func (w *Watcher) checkWatches(check func(*watchState) error) error {
+	w.statesMutex.Lock()
+	defer w.statesMutex.Unlock()
+
+	var failures []string
+	for key, state := range w.states {
+		if err := check(state); err != nil {
+			failures = append(failures, fmt.Sprintf("%s:  %s", key, err))
+		}
+	}
+	if len(failures) == 0 {
+		return nil
+	}
+	sort.Strings(failures)
+	return errors.New(strings.Join(failures, "; "))
+}
+
+// Ready returns nil if every requested watch has an open stream that has
+// delivered its initial events.
+func (w *Watcher) Ready() error {
+	w.statesMutex.Lock()
+	started := len(w.states) > 0
+	w.statesMutex.Unlock()
+	if !started {
+		return errors.New("No watches started")
+	}
+	return w.checkWatches((*watchState).ready)
+}
+
+// Live returns an error if any watch goroutine has been stuck on a single
+// task (e.g., handling an event) for longer than threshold.
+func (w *Watcher) Live(threshold time.Duration) error {
+	now := time.Now()
+	return w.checkWatches(func(s *watchState) error {
+		if busy := s.busyFor(now); busy > threshold {
+			return fmt.Errorf("stuck for %s", busy)
+		}
+		return nil
+	})
+}
+
+// getWatchState returns the state for the watch identified by key, creating
+// it if necessary.
+func (w *Watcher) getWatchState(key watchKey) *watchState {
+	w.statesMutex.Lock()
+	defer w.statesMutex.Unlock()
+	state, ok := w.states[key]
+	if !ok {
+		state = &watchState{}
+		w.states[key] = state
+	}
+	return state
+}
+
+// removeWatchStates stops tracking every watch on resource.
+func (w *Watcher) removeWatchStates(resource resources.ResourceType) {
+	w.statesMutex.Lock()
+	defer w.statesMutex.Unlock()
+	for key := range w.states {
+		if key.resource == resource {
+			delete(w.states, key)
+		}
+	}
+}
+
+// pingDB returns an error if dbm's database doesn't respond to a single
+// ping within timeout.  Backends that don't implement dbmanager.Pinger have
+// no connection to check.
+func pingDB(dbm dbmanager.DBManager, timeout time.Duration) error {
+	p, ok := dbm.(dbmanager.Pinger)
+	if !ok {
+		return nil
+	}
+	// The ping can't be cancelled, so it's left to finish on its own if it
+	// takes too long.
+	result := make(chan error, 1)
+	go func() {
+		result <- p.Ping()
+	}()
+	select {
+	case err := <-result:
+		return err
+	case <-time.After(timeout):
+		return fmt.Errorf("No response within %s", timeout)
+	}
+}
+
+// addHealthHandlers registers the /healthz (liveness) and /readyz
+// (readiness) endpoints for w on mux.  Liveness fails if a watch goroutine
+// has been stuck for longer than stuckThreshold; readiness fails unless the
+// database is reachable and every watch is ready.  If e is non-nil and does
+// not hold the leader lease, the tracker is a standby with no watches, so
+// only the database is checked.
+func addHealthHandlers(mux *http.ServeMux, w *Watcher, e *elector,
+	stuckThreshold time.Duration) {
+
+	mux.HandleFunc("/healthz", func(rw http.ResponseWriter,
+		r *http.Request) {
+
+		if err := w.Live(stuckThreshold); err != nil {
+			http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(rw, "ok")
+	})
+	mux.HandleFunc("/readyz", func(rw http.ResponseWriter,
+		r *http.Request) {
+
+		if err := pingDB(w.dbm, readyPingTimeout); err != nil {
+			http.Error(rw, "Database unavailable:  "+err.Error(),
+				http.StatusServiceUnavailable)
+			return
+		}
+		if e != nil && !e.isLeader() {
+			fmt.Fprintln(rw, "ok (standby)")
+			return
+		}
+		if err := w.Ready(); err != nil {
+			http.Error(rw, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		fmt.Fprintln(rw, "ok")
+	})
+}
@@ -0,0 +1,309 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+func getHealthWatcher() *Watcher {
+	return &Watcher{
+		dbm:          mock.New(false),
+		stopChannels: make(map[resources.ResourceType]chan<- struct{}),
+		states:       make(map[watchKey]*watchState),
+	}
+}
+
+func healthGet(t *testing.T, mux *http.ServeMux, path string) int {
+	req, err := http.NewRequest("GET", path, nil)
+	if err != nil {
+		t.Fatal("Unable to create request: ", err)
+	}
+	rec := httptest.NewRecorder()
+	mux.ServeHTTP(rec, req)
+	return rec.Code
+}
+
+func TestReady(t *testing.T) {
+	w := getHealthWatcher()
+	if err := w.Ready(); err == nil {
+		t.Error("Watcher with no watches reported ready")
+	}
+
+	pods := w.getWatchState(watchKey{resources.Pods, ""})
+	pvs := w.getWatchState(watchKey{resources.PVs, ""})
+	pods.opened()
+	pods.setSynced()
+	if err := w.Ready(); err == nil {
+		t.Error("Watcher reported ready without an open PV stream")
+	}
+	pvs.opened()
+	if err := w.Ready(); err == nil {
+		t.Error("Watcher reported ready before initial PV events")
+	}
+	pvs.setSynced()
+	if err := w.Ready(); err != nil {
+		t.Error("Watcher not ready with all streams synced: ", err)
+	}
+
+	// Reopening the stream requires the initial events to be redelivered.
+	pvs.closed()
+	pvs.opened()
+	if err := w.Ready(); err == nil {
+		t.Error("Watcher reported ready after reopening PV stream")
+	}
+	w.removeWatchStates(resources.PVs)
+	if err := w.Ready(); err != nil {
+		t.Error("Stopped watch still affects readiness: ", err)
+	}
+}
+
+func TestLive(t *testing.T) {
+	w := getHealthWatcher()
+	state := w.getWatchState(watchKey{resources.Pods, ""})
+	state.opened()
+	if err := w.Live(time.Minute); err != nil {
+		t.Error("Idle watch reported as stuck: ", err)
+	}
+	state.setBusy()
+	if err := w.Live(time.Minute); err != nil {
+		t.Error("Briefly busy watch reported as stuck: ", err)
+	}
+	state.busySince = time.Now().Add(-2 * time.Minute)
+	if err := w.Live(time.Minute); err == nil {
+		t.Error("Watch busy past threshold not reported as stuck")
+	}
+	state.setIdle()
+	if err := w.Live(time.Minute); err != nil {
+		t.Error("Watch reported as stuck after going idle: ", err)
+	}
+}
+
+func TestHealthHandlers(t *testing.T) {
+	w := getHealthWatcher()
+	mux := http.NewServeMux()
+	addHealthHandlers(mux, w, nil, time.Minute)
+
+	state := w.getWatchState(watchKey{resources.PVCs, ""})
+	state.opened()
+	if code := healthGet(t, mux, "/readyz"); code !=
+		http.StatusServiceUnavailable {
+		t.Errorf("Expected unsynced watch to fail readiness; got %d", code)
+	}
+	state.setSynced()
+	if code := healthGet(t, mux, "/readyz"); code != http.StatusOK {
+		t.Errorf("Expected readiness to succeed; got %d", code)
+	}
+
+	state.busySince = time.Now().Add(-time.Hour)
+	if code := healthGet(t, mux, "/healthz"); code !=
+		http.StatusServiceUnavailable {
+		t.Errorf("Expected stuck watch to fail liveness; got %d", code)
+	}
+	state.setIdle()
+	if code := healthGet(t, mux, "/healthz"); code != http.StatusOK {
+		t.Errorf("Expected liveness to succeed; got %d", code)
+	}
+}
+
+// slowPinger is a DBManager whose pings take delay to return err.
+type slowPinger struct {
+	dbmanager.DBManager
+	delay time.Duration
+	err   error
+}
+
+func (p *slowPinger) Ping() error {
+	time.Sleep(p.delay)
+	return p.err
+}
+
+func TestPingDB(t *testing.T) {
+	if err := pingDB(mock.New(false), time.Millisecond); err != nil {
+		t.Error("Backend without a connection reported as unreachable: ",
+			err)
+	}
+	down := errors.New("connection refused")
+	if err := pingDB(&slowPinger{err: down}, time.Second); err != down {
+		t.Error("Expected the ping's error; got ", err)
+	}
+	start := time.Now()
+	err := pingDB(&slowPinger{delay: time.Second}, 50*time.Millisecond)
+	if err == nil {
+		t.Error("Expected a slow ping to time out")
+	}
+	if elapsed := time.Since(start); elapsed > 500*time.Millisecond {
+		t.Error("Slow ping not abandoned at its deadline; took ", elapsed)
+	}
+}
+
+// getSyncWatcher returns a Watcher on server with short sync timings.
+func getSyncWatcher(t *testing.T, server *httptest.Server) *Watcher {
+	w, err := NewWatcher(nil, strings.TrimPrefix(server.URL, "http://"),
+		mock.New(false))
+	if err != nil {
+		t.Fatal("Unable to create watcher: ", err)
+	}
+	w.syncQuiet = 50 * time.Millisecond
+	w.syncLimit = 300 * time.Millisecond
+	return w
+}
+
+// TestReadyAfterResponse checks that a watch isn't ready until the API
+// server responds to it.
+func TestReadyAfterResponse(t *testing.T) {
+	respond := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter,
+		r *http.Request) {
+
+		<-respond
+	}))
+	defer server.Close()
+	defer close(respond)
+
+	w := getSyncWatcher(t, server)
+	if err := w.Watch(resources.PVs, false); err != nil {
+		t.Fatal("Unable to watch PVs: ", err)
+	}
+	defer w.Stop(resources.PVs)
+	time.Sleep(4 * w.syncQuiet)
+	if err := w.Ready(); err == nil {
+		t.Error("Watch reported ready before the API server responded")
+	}
+}
+
+// TestWatchClosedBeforeOpened checks that a watch closed before anything
+// is read from it still releases its stream.
+func TestWatchClosedBeforeOpened(t *testing.T) {
+	released := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter,
+		r *http.Request) {
+
+		rw.(http.Flusher).Flush()
+		<-rw.(http.CloseNotifier).CloseNotify()
+		close(released)
+	}))
+	defer server.Close()
+
+	client, err := NewAPIClient(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal("Unable to create client: ", err)
+	}
+	events, done := client.Watch(resources.PVs, "", "", WatchOptions{})
+	close(done)
+	select {
+	case <-released:
+	case <-time.After(2 * time.Second):
+		t.Fatal("Stream not released after the watch was closed")
+	}
+	for range events {
+	}
+}
+
+// TestReadyOnBusyStream checks that a watch whose stream never goes quiet
+// is ready once the sync limit passes.
+func TestReadyOnBusyStream(t *testing.T) {
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter,
+		r *http.Request) {
+
+		for i := 0; ; i++ {
+			fmt.Fprint(rw, podEventLine(fmt.Sprintf("pod-%d", i), "ns"))
+			rw.(http.Flusher).Flush()
+			select {
+			case <-stop:
+				return
+			case <-time.After(10 * time.Millisecond):
+			}
+		}
+	}))
+	defer server.Close()
+	defer close(stop)
+
+	w := getSyncWatcher(t, server)
+	if err := w.Watch(resources.Pods, false); err != nil {
+		t.Fatal("Unable to watch pods: ", err)
+	}
+	defer w.Stop(resources.Pods)
+	deadline := time.Now().Add(10 * w.syncLimit)
+	for w.Ready() != nil {
+		if time.Now().After(deadline) {
+			t.Fatal("Busy watch never became ready: ", w.Ready())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// TestResyncOnlyWithoutRV checks that only the initial events of a watch
+// started without a resource version are treated as a resync.
+func TestResyncOnlyWithoutRV(t *testing.T) {
+	stop := make(chan struct{})
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter,
+		r *http.Request) {
+
+		if r.URL.Query().Get("resourceVersion") == "" {
+			fmt.Fprintln(rw, relabeledPodLine("ADDED", "initial", `{}`,
+				"10"))
+		} else {
+			fmt.Fprintln(rw, relabeledPodLine("ADDED", "resumed", `{}`,
+				"11"))
+		}
+		rw.(http.Flusher).Flush()
+		<-stop
+	}))
+	defer server.Close()
+	defer close(stop)
+
+	w := getSyncWatcher(t, server)
+	resyncs := make(chan bool, 1)
+	handler := func(eventType EventType, r resources.Resource, json,
+		watcherNS string, rc receipt) {
+
+		w.handlePods(eventType, r, json, watcherNS, rc)
+		resyncs <- rc.resync
+	}
+	key := watchKey{resources.Pods, ""}
+	for _, initialize := range []bool{true, false} {
+		state := w.getWatchState(key)
+		stopWatch := make(chan struct{})
+		go w.watchNamespace(key, state, initialize, handler, stopWatch)
+		select {
+		case resync := <-resyncs:
+			if resync != initialize {
+				t.Errorf("Expected resync %t with initialize %t", initialize,
+					initialize)
+			}
+		case <-time.After(2 * time.Second):
+			t.Fatal("Timed out waiting for event")
+		}
+		// A resumed watch is ready as soon as it opens.
+		if err := state.ready(); !initialize && err != nil {
+			t.Error("Resumed watch not ready: ", err)
+		}
+		close(stopWatch)
+	}
+}
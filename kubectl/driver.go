@@ -0,0 +1,52 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kubectl
+
+import (
+	"os/exec"
+)
+
+// Driver carries out a kubectl action on a resource file written by this
+// package.
+type Driver interface {
+	Run(action KubeAction, file string, validate bool) error
+}
+
+// binaryDriver runs the kubectl binary against the configured cluster.  If
+// validate is false, it uses the --validate=false parameter.  If deleting, it
+// appends the --grace-period=0 flag so that tests do not have to wait for
+// pods to terminate gracefully.
+type binaryDriver struct{}
+
+func (binaryDriver) Run(action KubeAction, file string, validate bool) error {
+	args := []string{string(action), "-f", file}
+	if action == Delete {
+		args = append(args, "--grace-period=0")
+	}
+	if !validate {
+		args = append(args, "--validate=false")
+	}
+	return exec.Command("kubectl", args...).Run()
+}
+
+var driver Driver = binaryDriver{}
+
+// SetDriver sets the driver used to create, update and delete resources.
+// By default, resources are managed with the kubectl binary.
+func SetDriver(d Driver) {
+	driver = d
+}
@@ -0,0 +1,344 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kubectl
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"sort"
+	"sync"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"github.com/netapp/kubevoltracker/fakeapi"
+)
+
+// fakeServer is the fake API server used when $KUBECTL_DRIVER is "fake".
+var fakeServer *fakeapi.Server
+
+// useFakeDriver starts a fake API server and sends all resources to it,
+// filling in placeholder values for any unset NFS and ISCSI variables.
+// Exports are created under a temporary directory unless $LOCAL_EXPORT_ROOT
+// is set.
+func useFakeDriver() {
+	fakeServer = fakeapi.New()
+	SetDriver(NewFakeDriver(fakeServer))
+	if filerIP == "" {
+		filerIP = "192.0.2.1"
+	}
+	if exportRoot == "" {
+		exportRoot = "/export"
+	}
+	if localRoot == "" {
+		dir, err := ioutil.TempDir("", "kubectl-exports")
+		if err != nil {
+			log.Fatal("Unable to create local export root: ", err)
+		}
+		localRoot = dir
+	}
+	if targetPortal == "" {
+		targetPortal = "192.0.2.1:3260"
+	}
+	if iqn == "" {
+		iqn = "iqn.1992-08.com.netapp:fake"
+	}
+}
+
+// FakeAPIServer returns the fake API server that resources are sent to, or
+// nil if this package is managing resources on a real cluster.
+func FakeAPIServer() *fakeapi.Server {
+	return fakeServer
+}
+
+type objectKey struct {
+	namespace string
+	name      string
+}
+
+// FakeDriver turns kubectl actions into events on a fake API server.  It
+// also stands in for the PV controller, binding pending PVCs to available
+// PVs and releasing PVs when their claims are deleted, so that tests see the
+// same sequence of events that they would on a real cluster.
+type FakeDriver struct {
+	server *fakeapi.Server
+
+	mutex sync.Mutex
+	pods  map[objectKey]*api.Pod
+	pvs   map[string]*api.PersistentVolume
+	pvcs  map[objectKey]*api.PersistentVolumeClaim
+}
+
+// NewFakeDriver returns a driver that sends resources to server.
+func NewFakeDriver(server *fakeapi.Server) *FakeDriver {
+	return &FakeDriver{
+		server: server,
+		pods:   make(map[objectKey]*api.Pod),
+		pvs:    make(map[string]*api.PersistentVolume),
+		pvcs:   make(map[objectKey]*api.PersistentVolumeClaim),
+	}
+}
+
+// Run performs action on the resource in file.  As with kubectl, creating
+// an existing resource or deleting a missing one is an error, and applying a
+// missing resource creates it.  validate is ignored.
+func (d *FakeDriver) Run(action KubeAction, file string, validate bool) error {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return err
+	}
+	var typeMeta unversioned.TypeMeta
+	if err = json.Unmarshal(data, &typeMeta); err != nil {
+		return fmt.Errorf("Unable to decode %s:  %s", file, err)
+	}
+
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
+
+	switch typeMeta.Kind {
+	case "Pod":
+		pod := &api.Pod{}
+		if err = json.Unmarshal(data, pod); err == nil {
+			err = d.runPod(action, pod)
+		}
+	case "PersistentVolume":
+		pv := &api.PersistentVolume{}
+		if err = json.Unmarshal(data, pv); err == nil {
+			err = d.runPV(action, pv)
+		}
+	case "PersistentVolumeClaim":
+		pvc := &api.PersistentVolumeClaim{}
+		if err = json.Unmarshal(data, pvc); err == nil {
+			err = d.runPVC(action, pvc)
+		}
+	default:
+		return fmt.Errorf("Unsupported kind %q in %s", typeMeta.Kind, file)
+	}
+	if err != nil {
+		return fmt.Errorf("Unable to %s %s:  %s", action, file, err)
+	}
+	return nil
+}
+
+func (d *FakeDriver) runPod(action KubeAction, pod *api.Pod) error {
+	key := objectKey{pod.Namespace, pod.Name}
+	old, ok := d.pods[key]
+	switch {
+	case action == Create && ok:
+		return fmt.Errorf("Pod %s already exists", pod.Name)
+	case action == Delete && !ok:
+		return fmt.Errorf("Pod %s not found", pod.Name)
+	case action == Delete:
+		delete(d.pods, key)
+		_, err := d.server.Delete(old)
+		return err
+	case ok:
+		pod.ObjectMeta = old.ObjectMeta
+		pod.Status = old.Status
+		d.pods[key] = pod
+		_, err := d.server.Modify(pod)
+		return err
+	}
+	pod.Status.Phase = api.PodPending
+	d.pods[key] = pod
+	_, err := d.server.Add(pod)
+	return err
+}
+
+func (d *FakeDriver) runPV(action KubeAction, pv *api.PersistentVolume) error {
+	old, ok := d.pvs[pv.Name]
+	switch {
+	case action == Create && ok:
+		return fmt.Errorf("PV %s already exists", pv.Name)
+	case action == Delete && !ok:
+		return fmt.Errorf("PV %s not found", pv.Name)
+	case action == Delete:
+		delete(d.pvs, pv.Name)
+		if _, err := d.server.Delete(old); err != nil {
+			return err
+		}
+		// The claim loses its volume.
+		if ref := old.Spec.ClaimRef; ref != nil {
+			pvc, ok := d.pvcs[objectKey{ref.Namespace, ref.Name}]
+			if ok && pvc.UID == ref.UID {
+				pvc.Status.Phase = api.ClaimLost
+				_, err := d.server.Modify(pvc)
+				return err
+			}
+		}
+		return nil
+	case ok:
+		pv.ObjectMeta = old.ObjectMeta
+		pv.Spec.ClaimRef = old.Spec.ClaimRef
+		pv.Status = old.Status
+		d.pvs[pv.Name] = pv
+		if _, err := d.server.Modify(pv); err != nil {
+			return err
+		}
+		return d.bind()
+	}
+	// New volumes start out pending until the controller makes them
+	// available.
+	pv.Status.Phase = api.VolumePending
+	d.pvs[pv.Name] = pv
+	if _, err := d.server.Add(pv); err != nil {
+		return err
+	}
+	pv.Status.Phase = api.VolumeAvailable
+	if _, err := d.server.Modify(pv); err != nil {
+		return err
+	}
+	return d.bind()
+}
+
+func (d *FakeDriver) runPVC(action KubeAction,
+	pvc *api.PersistentVolumeClaim) error {
+
+	key := objectKey{pvc.Namespace, pvc.Name}
+	old, ok := d.pvcs[key]
+	switch {
+	case action == Create && ok:
+		return fmt.Errorf("PVC %s already exists", pvc.Name)
+	case action == Delete && !ok:
+		return fmt.Errorf("PVC %s not found", pvc.Name)
+	case action == Delete:
+		delete(d.pvcs, key)
+		if _, err := d.server.Delete(old); err != nil {
+			return err
+		}
+		// Volumes are retained once their claims are deleted.
+		if pv, ok := d.pvs[old.Spec.VolumeName]; ok &&
+			pv.Spec.ClaimRef != nil && pv.Spec.ClaimRef.UID == old.UID {
+			pv.Status.Phase = api.VolumeReleased
+			_, err := d.server.Modify(pv)
+			return err
+		}
+		return nil
+	case ok:
+		pvc.ObjectMeta = old.ObjectMeta
+		pvc.Spec.VolumeName = old.Spec.VolumeName
+		pvc.Status = old.Status
+		d.pvcs[key] = pvc
+		if _, err := d.server.Modify(pvc); err != nil {
+			return err
+		}
+		return d.bind()
+	}
+	pvc.Status.Phase = api.ClaimPending
+	d.pvcs[key] = pvc
+	if _, err := d.server.Add(pvc); err != nil {
+		return err
+	}
+	return d.bind()
+}
+
+// bind binds every pending PVC for which there's a suitable available PV,
+// choosing the smallest such PV.  The caller must hold the mutex.
+func (d *FakeDriver) bind() error {
+	keys := make([]objectKey, 0, len(d.pvcs))
+	for key, pvc := range d.pvcs {
+		if pvc.Status.Phase == api.ClaimPending {
+			keys = append(keys, key)
+		}
+	}
+	sort.Sort(objectKeys(keys))
+	for _, key := range keys {
+		pvc := d.pvcs[key]
+		pv := d.findPV(pvc)
+		if pv == nil {
+			continue
+		}
+		pv.Spec.ClaimRef = &api.ObjectReference{
+			Kind:            "PersistentVolumeClaim",
+			APIVersion:      "v1",
+			Namespace:       pvc.Namespace,
+			Name:            pvc.Name,
+			UID:             pvc.UID,
+			ResourceVersion: pvc.ResourceVersion,
+		}
+		pv.Status.Phase = api.VolumeBound
+		if _, err := d.server.Modify(pv); err != nil {
+			return err
+		}
+		pvc.Spec.VolumeName = pv.Name
+		pvc.Status.Phase = api.ClaimBound
+		pvc.Status.AccessModes = pv.Spec.AccessModes
+		pvc.Status.Capacity = pv.Spec.Capacity
+		if _, err := d.server.Modify(pvc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// findPV returns the smallest available PV that satisfies pvc's storage
+// request and access modes, or nil if there is none.
+func (d *FakeDriver) findPV(
+	pvc *api.PersistentVolumeClaim) *api.PersistentVolume {
+
+	request := pvc.Spec.Resources.Requests[api.ResourceStorage]
+	var (
+		best     *api.PersistentVolume
+		bestSize int64
+	)
+	for _, pv := range d.pvs {
+		if pv.Status.Phase != api.VolumeAvailable || pv.Spec.ClaimRef != nil {
+			continue
+		}
+		capacity := pv.Spec.Capacity[api.ResourceStorage]
+		size := (&capacity).Value()
+		if size < (&request).Value() ||
+			!hasAccessModes(pv.Spec.AccessModes, pvc.Spec.AccessModes) {
+			continue
+		}
+		if best == nil || size < bestSize ||
+			(size == bestSize && pv.Name < best.Name) {
+			best, bestSize = pv, size
+		}
+	}
+	return best
+}
+
+// hasAccessModes returns true if every mode in wanted is in modes.
+func hasAccessModes(modes, wanted []api.PersistentVolumeAccessMode) bool {
+	for _, w := range wanted {
+		found := false
+		for _, m := range modes {
+			if m == w {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type objectKeys []objectKey
+
+func (k objectKeys) Len() int      { return len(k) }
+func (k objectKeys) Swap(i, j int) { k[i], k[j] = k[j], k[i] }
+func (k objectKeys) Less(i, j int) bool {
+	if k[i].namespace != k[j].namespace {
+		return k[i].namespace < k[j].namespace
+	}
+	return k[i].name < k[j].name
+}
@@ -0,0 +1,91 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package kubectl
+
+import (
+	"bufio"
+	"encoding/json"
+	"net/http"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+)
+
+type fakeEvent struct {
+	Type   string          `json:"type"`
+	Object json.RawMessage `json:"object"`
+}
+
+// TestFakeDriverBinding checks the events produced by the fake PV controller
+// as a claim is bound and then deleted.
+func TestFakeDriverBinding(t *testing.T) {
+	server := FakeAPIServer()
+	if server == nil {
+		t.Skip("Not using the fake driver")
+	}
+	resp, err := http.Get("http://" + server.Host() +
+		"/api/v1/watch/persistentvolumes")
+	if err != nil {
+		t.Fatal("Unable to watch PVs: ", err)
+	}
+	defer resp.Body.Close()
+	reader := bufio.NewReader(resp.Body)
+
+	modes := []api.PersistentVolumeAccessMode{api.ReadWriteOnce}
+	pvFile, err := CreatePV("fake-bind-pv", 2, modes)
+	if err != nil {
+		t.Fatal("Unable to create PV: ", err)
+	}
+	defer RunKubectl(Delete, pvFile, true)
+	pvcFile, err := CreatePVC("fake-bind-pvc", namespace, 1, modes)
+	if err != nil {
+		t.Fatal("Unable to create PVC: ", err)
+	}
+	if err = RunKubectl(Delete, pvcFile, true); err != nil {
+		t.Fatal("Unable to delete PVC: ", err)
+	}
+	if err = RunKubectl(Delete, pvcFile, true); err == nil {
+		t.Error("Deleted PVC twice")
+	}
+
+	for _, expected := range []api.PersistentVolumePhase{api.VolumePending,
+		api.VolumeAvailable, api.VolumeBound, api.VolumeReleased} {
+
+		var pv api.PersistentVolume
+		for pv.Name != "fake-bind-pv" {
+			line, err := reader.ReadBytes('\n')
+			if err != nil {
+				t.Fatal("Unable to read PV event: ", err)
+			}
+			var e fakeEvent
+			if err = json.Unmarshal(line, &e); err == nil {
+				err = json.Unmarshal(e.Object, &pv)
+			}
+			if err != nil {
+				t.Fatal("Unable to decode PV event: ", err)
+			}
+		}
+		if pv.Status.Phase != expected {
+			t.Fatalf("Got PV phase %s; expected %s", pv.Status.Phase,
+				expected)
+		}
+		if expected == api.VolumeBound && (pv.Spec.ClaimRef == nil ||
+			pv.Spec.ClaimRef.Name != "fake-bind-pvc") {
+			t.Error("PV bound without a claim reference to the PVC")
+		}
+	}
+}
@@ -22,7 +22,9 @@
    relatively inflexible.
 
    All create and update functions return the filename of the YAML they have
-   written, along with any error that may have occurred.
+   written, along with any error that may have occurred.  Setting
+   $KUBECTL_DRIVER to "fake" replaces kubectl and the cluster with a fake API
+   server, so that tests can run without either.
    TODO:  Communicate directly with the API server, rather than going through
    kubectl
 */
@@ -62,9 +64,14 @@ const (
 )
 
 // init validates the variables that take their values from environment
-// variables and performs some basic directory setup, as needed.
+// variables and performs some basic directory setup, as needed.  If
+// $KUBECTL_DRIVER is "fake", resources are sent to an in-process fake API
+// server (see FakeAPIServer) rather than a cluster.
 func init() {
 	exit := false
+	if os.Getenv("KUBECTL_DRIVER") == "fake" {
+		useFakeDriver()
+	}
 	st, err := os.Stat(baseDir)
 	if os.IsNotExist(err) {
 		err = os.Mkdir(baseDir, 0755)
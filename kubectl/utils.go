@@ -21,7 +21,6 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path"
 
 	"github.com/netapp/kubevoltracker/resources"
@@ -79,18 +78,9 @@ func makeExportDirectory(export string) {
 }
 
 // RunKubectl performs one of the kubectl actions (defined as a  KubeAction
-// value) on the specified file.  If validate is false, it uses the
-// --validate=false parameter.  If deleting, it appends the --grace-period=0
-// flag so that tests do not have to wait for pods to terminate gracefully.
+// value) on the specified file using the current Driver.
 func RunKubectl(action KubeAction, file string, validate bool) error {
-	args := []string{string(action), "-f", file}
-	if action == Delete {
-		args = append(args, "--grace-period=0")
-	}
-	if !validate {
-		args = append(args, "--validate=false")
-	}
-	return exec.Command("kubectl", args...).Run()
+	return driver.Run(action, file, validate)
 }
 
 // DeleteTestResources calls kubectl delete for every resource found in
@@ -104,9 +94,7 @@ func DeleteTestResources() {
 		log.Fatalf("Unable to read %s:  %s", baseDir, err)
 	}
 	for _, file := range files {
-		err = exec.Command("kubectl", "delete",
-			"--grace-period=0",
-			"-f", path.Join(baseDir, file.Name())).Run()
+		err = RunKubectl(Delete, path.Join(baseDir, file.Name()), true)
 	}
 	fmt.Println("Cleared test resources.")
 }
@@ -17,19 +17,44 @@
 package main
 
 import (
+	"errors"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
+	"strings"
+	"sync"
 	"syscall"
+	"time"
 
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory"
 	"github.com/netapp/kubevoltracker/dbmanager/mysql"
 	"github.com/netapp/kubevoltracker/resources"
 )
 
 var (
-	mySQLUser     string
-	mySQLPassword string
+	mySQLUser      string
+	mySQLPassword  string
+	backend        string
+	listenAddr     string
+	stuckThreshold time.Duration
+	leaderElect    bool
+	leaseDuration  time.Duration
+	namespaces     string
+	nsSelector     string
+	watchOptions   WatchOptions
+	recordDir      string
+	protobuf       bool
+	retention      dbmanager.RevisionRetention
+	pruneAfter     time.Duration
+	pruneInterval  time.Duration
+	pruneOpts      pruneOptions
+	filterFlags    struct {
+		includeNamespaces, excludeNamespaces string
+		includeLabels, excludeLabels         string
+	}
 )
 
 func init() {
@@ -45,31 +70,256 @@ func init() {
 	flag.StringVar(&mySQLPassword, "password", defaultPassword, passwordUsage)
 	flag.StringVar(&mySQLPassword, "p", defaultPassword, passwordUsage+
 		" (shorthand)")
-	if os.Getenv("MYSQL_IP") == "" {
-		log.Fatal("ERROR: Must specify IP address of MYSQL server in MYSQL_IP.")
+	flag.StringVar(&backend, "backend", "mysql", "Backend to record into:  "+
+		"mysql, or memory to keep everything in memory until exit")
+	flag.StringVar(&listenAddr, "listen", ":8090", "Address to serve the "+
+		"HTTP API on while watching; empty to disable")
+	flag.DurationVar(&stuckThreshold, "stuck-threshold", 5*time.Minute,
+		"How long a watch may spend on one event before /healthz fails")
+	flag.BoolVar(&leaderElect, "leader-elect", false, "Only watch while "+
+		"holding a lease in the database, so that several trackers can "+
+		"share it")
+	flag.DurationVar(&leaseDuration, "lease-duration", 10*time.Second,
+		"How long the leader lease lasts without renewal")
+	flag.StringVar(&namespaces, "namespaces", "", "Comma-separated list of "+
+		"namespaces to watch; empty to watch all of them")
+	flag.StringVar(&nsSelector, "namespace-selector", "", "Label selector "+
+		"choosing the namespaces to watch when the tracker starts")
+	flag.StringVar(&watchOptions.LabelSelector, "label-selector", "",
+		"Label selector the API server applies to every watch")
+	flag.StringVar(&watchOptions.FieldSelector, "field-selector", "",
+		"Field selector the API server applies to every watch")
+	flag.StringVar(&filterFlags.includeNamespaces, "include-namespaces", "",
+		"Comma-separated namespace patterns (e.g., team-*) to record; "+
+			"empty to record all")
+	flag.StringVar(&filterFlags.excludeNamespaces, "exclude-namespaces", "",
+		"Comma-separated namespace patterns (e.g., kube-system,ci-*) not "+
+			"to record")
+	flag.StringVar(&filterFlags.includeLabels, "include-labels", "",
+		"Comma-separated key=value or key labels, one of which objects "+
+			"must have to be recorded")
+	flag.StringVar(&filterFlags.excludeLabels, "exclude-labels", "",
+		"Comma-separated key=value or key labels that keep objects from "+
+			"being recorded")
+	flag.DurationVar(&retention.MaxAge, "revision-max-age", 0, "How long "+
+		"to keep each object's past revisions; 0 to keep them forever")
+	flag.IntVar(&retention.MaxPerObject, "revisions-per-object", 0,
+		"Number of revisions to keep for each object; 0 for no limit")
+	flag.DurationVar(&pruneAfter, "prune-after", 0, "Periodically prune "+
+		"pods deleted at least this long ago; 0 to keep them forever")
+	flag.DurationVar(&pruneInterval, "prune-interval", time.Hour, "How "+
+		"often to prune with -prune-after")
+	flag.StringVar(&pruneOpts.ArchiveDir, "prune-archive", "", "Directory "+
+		"in which to archive pruned pods; empty to discard them")
+	flag.StringVar(&pruneOpts.ArchiveFormat, "prune-archive-format",
+		"jsonl", "Format of pruned pod archives:  jsonl or csv")
+	flag.StringVar(&recordDir, "record", "", "Directory in which to record "+
+		"the raw watch streams for the replay command")
+	flag.BoolVar(&protobuf, "protobuf", false, "Ask the API server to "+
+		"send watches as protobuf, falling back to JSON if it can't")
+	flag.Usage = usage
+}
+
+func usage() {
+	fmt.Fprintf(os.Stderr, "Usage:  %s [flags] [command [command flags]]\n\n"+
+		"With no command, watches the API server and records volume usage.\n"+
+		"Commands:\n", os.Args[0])
+	for _, name := range commandNames() {
+		fmt.Fprintf(os.Stderr, "  %-12s %s\n", name, commands[name].usage)
 	}
-	if os.Getenv("KUBERNETES_MASTER") == "" {
-		log.Fatal("ERROR: Must specify IP address of Kubernetes master in " +
-			"KUBERNETES_MASTER.")
+	fmt.Fprintln(os.Stderr, "\nFlags:")
+	flag.PrintDefaults()
+}
+
+// getEnv returns the value of the specified environment variable, exiting
+// if it has not been set.
+func getEnv(name, desc string) string {
+	value := os.Getenv(name)
+	if value == "" {
+		log.Fatalf("ERROR: Must specify %s in %s.", desc, name)
 	}
+	return value
 }
 
-func main() {
-	flag.Parse()
-	manager := mysql.New(mySQLUser, mySQLPassword, os.Getenv("MYSQL_IP"))
-	w, err := NewWatcher("", os.Getenv("KUBERNETES_MASTER"), manager)
+// getManager returns a DBManager for the backend chosen by -backend.  For
+// MySQL, this is the database specified in $MYSQL_IP, using the credentials
+// provided on the command line.
+func getManager() dbmanager.DBManager {
+	switch backend {
+	case "mysql":
+		return mysql.New(mySQLUser, mySQLPassword,
+			getEnv("MYSQL_IP", "IP address of MYSQL server"))
+	case "memory":
+		return memory.New()
+	}
+	log.Fatalf("Unknown backend %s; expected mysql or memory.", backend)
+	return nil
+}
+
+// newWatcherFromFlags creates a Watcher for the namespaces chosen by the
+// -namespaces or -namespace-selector flags, with the selectors and filters
+// given by the remaining flags.
+func newWatcherFromFlags(master string,
+	manager dbmanager.DBManager) (w *Watcher, err error) {
+
+	if nsSelector != "" {
+		if namespaces != "" {
+			return nil, errors.New("Only one of -namespaces and " +
+				"-namespace-selector may be given.")
+		}
+		w, err = NewWatcherForSelector(nsSelector, master, manager)
+	} else {
+		w, err = NewWatcher(splitList(namespaces), master, manager)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err = w.SetWatchOptions(watchOptions); err != nil {
+		return nil, err
+	}
+	err = w.SetFilter(EventFilter{
+		IncludeNamespaces: splitList(filterFlags.includeNamespaces),
+		ExcludeNamespaces: splitList(filterFlags.excludeNamespaces),
+		IncludeLabels:     splitList(filterFlags.includeLabels),
+		ExcludeLabels:     splitList(filterFlags.excludeLabels),
+	})
+	return w, err
+}
+
+// watch runs the tracker itself, watching the API server until terminated.
+// With -leader-elect, it only watches while it holds the leader lease.
+func watch() {
+	var (
+		e       *elector
+		pruner  dbmanager.Pruner
+		pruning sync.WaitGroup
+	)
+
+	manager := getManager()
+	w, err := newWatcherFromFlags(getEnv("KUBERNETES_MASTER",
+		"IP address of Kubernetes master"), manager)
 	if err != nil {
 		log.Fatal("Unable to create watcher: ", err)
 	}
 	defer w.Destroy()
+	// Later watches refine the estimate, so a failure here isn't fatal.
+	if err = w.client.SyncClock(); err != nil {
+		log.Print("Unable to estimate the API server's clock offset: ", err)
+	} else {
+		log.Printf("API server's clock is offset by %s", w.client.ClockOffset())
+	}
+
+	w.SetProtobuf(protobuf)
+	if stores := partialJSONStores(manager, recordDir != ""); protobuf &&
+		len(stores) > 0 {
+
+		log.Printf("WARNING:  With -protobuf, the %s only hold the "+
+			"fields the Volume Tracker decodes, not whole objects, for "+
+			"watches the API server sends as protobuf.  Omit -protobuf to "+
+			"keep the full JSON.", strings.Join(stores, ", "))
+	}
+
+	if recordDir != "" {
+		recorder, err := NewRecorder(recordDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+		defer recorder.Close()
+		w.SetRecorder(recorder)
+	}
+
+	rs, ok := manager.(dbmanager.RevisionStore)
+	if ok {
+		rs.SetRevisionRetention(retention)
+	}
+
+	if pruneAfter > 0 {
+		if pruner, ok = manager.(dbmanager.Pruner); !ok {
+			log.Fatal("Backend does not support pruning.")
+		}
+		if err = pruneOpts.validate(); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	if leaderElect {
+		leaser, ok := manager.(dbmanager.Leaser)
+		if !ok {
+			log.Fatal("Backend does not support leader election.")
+		}
+		e = newElector(leaser, leaseDuration)
+	}
+
+	if listenAddr != "" {
+		q, ok := manager.(dbmanager.Querier)
+		if ok {
+			registerInventoryMetrics(q)
+		}
+		mux := newAPIHandler(q)
+		addHealthHandlers(mux, w, e, stuckThreshold)
+		addRevisionHandlers(mux, rs)
+		go serveAPI(listenAddr, mux)
+	}
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	w.Watch(resources.Pods, false)
-	w.Watch(resources.PVs, false)
-	w.Watch(resources.PVCs, false)
+	stop := make(chan struct{})
+	// Only the leader prunes, so that pods aren't archived twice.
+	startWatches := func() {
+		w.Watch(resources.Pods, false)
+		w.Watch(resources.PVs, false)
+		w.Watch(resources.PVCs, false)
+		if pruner != nil {
+			pruning.Add(1)
+			go func() {
+				defer pruning.Done()
+				runPruner(pruner, pruneAfter, pruneInterval, pruneOpts,
+					stop)
+			}()
+		}
+	}
+	if e == nil {
+		startWatches()
+		<-c
+		log.Print("Shutting down")
+		close(stop)
+		pruning.Wait()
+		return
+	}
 
-	<-c
+	go func() {
+		<-c
+		close(stop)
+	}()
+	if err = e.run(startWatches, stop); err != nil {
+		// Exiting is the only reliable way to stop the watches from
+		// trying to write; fencing will reject any that do.
+		log.Fatal(err)
+	}
 	log.Print("Shutting down")
+	for _, resource := range []resources.ResourceType{resources.Pods,
+		resources.PVs, resources.PVCs} {
+		// Errors just mean that we never started watching.
+		w.Stop(resource)
+	}
+	pruning.Wait()
+	e.release()
+}
+
+func main() {
+	flag.Parse()
+	if flag.NArg() == 0 {
+		watch()
+		return
+	}
+	cmd, ok := commands[flag.Arg(0)]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "Unknown command %s\n", flag.Arg(0))
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := cmd.run(flag.Args()[1:]); err != nil {
+		log.Fatalf("%s failed:  %s", flag.Arg(0), err)
+	}
 }
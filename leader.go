@@ -0,0 +1,134 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+// leaseName is the name of the lease that trackers sharing a database
+// compete for.
+const leaseName = "watcher"
+
+var errLeaseLost = errors.New("Lost leader lease")
+
+// elector runs the tracker's watches only while it holds the leader lease,
+// so that several replicas can share a database without applying every
+// event more than once.
+type elector struct {
+	leaser dbmanager.Leaser
+	holder string
+	// ttl is how long the lease is held without renewal; the lease is
+	// renewed, and standbys try to acquire it, every retry.
+	ttl   time.Duration
+	retry time.Duration
+
+	mutex   sync.Mutex
+	leading bool
+}
+
+// newElector returns an elector competing for the lease with the given ttl.
+// The holder name identifies this process, so that a restarted tracker
+// doesn't mistake its predecessor's lease for its own.
+func newElector(leaser dbmanager.Leaser, ttl time.Duration) *elector {
+	host, err := os.Hostname()
+	if err != nil {
+		host = "unknown"
+	}
+	return &elector{
+		leaser: leaser,
+		holder: fmt.Sprintf("%s-%d-%d", host, os.Getpid(),
+			time.Now().UnixNano()),
+		ttl:   ttl,
+		retry: ttl / 3,
+	}
+}
+
+// isLeader returns whether the elector currently holds the lease.
+func (e *elector) isLeader() bool {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	return e.leading
+}
+
+func (e *elector) setLeader(leading bool) {
+	e.mutex.Lock()
+	defer e.mutex.Unlock()
+	e.leading = leading
+	if leading {
+		leaderGauge.Set(1)
+	} else {
+		leaderGauge.Set(0)
+	}
+}
+
+// run waits until it acquires the lease, fences writes with the lease's
+// token, and calls lead.  It then renews the lease until stop is closed, in
+// which case it returns nil, or until it loses the lease, in which case it
+// returns errLeaseLost.  Writes made after losing the lease fail, but
+// callers should still exit promptly, since lead's work can't be undone.
+func (e *elector) run(lead func(), stop <-chan struct{}) error {
+	var renewed time.Time
+
+	ticker := time.NewTicker(e.retry)
+	defer ticker.Stop()
+	defer e.setLeader(false)
+
+	for {
+		token, held, err := e.leaser.AcquireLease(leaseName, e.holder, e.ttl)
+		switch {
+		case err != nil:
+			log.Print("Unable to acquire leader lease: ", err)
+		case held:
+			renewed = time.Now()
+			if !e.isLeader() {
+				log.Printf("Acquired leader lease with token %d as %s",
+					token, e.holder)
+				e.leaser.Fence(leaseName, token)
+				e.setLeader(true)
+				lead()
+			}
+		case e.isLeader():
+			return errLeaseLost
+		}
+		// If renewals keep failing, another tracker may have taken over
+		// by now.
+		if e.isLeader() && time.Since(renewed) > e.ttl {
+			return errLeaseLost
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return nil
+		}
+	}
+}
+
+// release gives up the lease so that a standby can take over without
+// waiting for it to expire.  Callers should stop writing first.
+func (e *elector) release() {
+	if err := e.leaser.ReleaseLease(leaseName, e.holder); err != nil {
+		log.Print("Unable to release leader lease: ", err)
+	}
+}
@@ -0,0 +1,129 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+)
+
+const testLeaseTTL = 150 * time.Millisecond
+
+// startElector runs e in the background, returning channels that are closed
+// when it starts leading and when run returns, along with run's error.
+func startElector(e *elector, stop <-chan struct{}) (<-chan struct{},
+	<-chan error) {
+
+	led := make(chan struct{})
+	done := make(chan error, 1)
+	go func() {
+		done <- e.run(func() { close(led) }, stop)
+	}()
+	return led, done
+}
+
+func TestElectorTakeover(t *testing.T) {
+	mock.ResetLeases()
+	m1 := mock.New(false).(*mock.MockManager)
+	m2 := mock.New(false).(*mock.MockManager)
+	e1 := newElector(m1, testLeaseTTL)
+	e2 := newElector(m2, testLeaseTTL)
+
+	stop1 := make(chan struct{})
+	led1, done1 := startElector(e1, stop1)
+	select {
+	case <-led1:
+	case <-time.After(time.Second):
+		t.Fatal("First elector never acquired the lease")
+	}
+
+	stop2 := make(chan struct{})
+	defer close(stop2)
+	led2, _ := startElector(e2, stop2)
+	select {
+	case <-led2:
+		t.Fatal("Second elector acquired a held lease")
+	case <-time.After(2 * testLeaseTTL):
+	}
+	if e2.isLeader() {
+		t.Error("Standby reports itself as leader")
+	}
+
+	close(stop1)
+	if err := <-done1; err != nil {
+		t.Error("Stopped elector returned error: ", err)
+	}
+	e1.release()
+	select {
+	case <-led2:
+	case <-time.After(time.Second):
+		t.Fatal("Standby never took over the lease")
+	}
+	if m1.FenceToken != 1 || m2.FenceToken != 2 {
+		t.Errorf("Expected fence tokens 1 and 2; got %d and %d",
+			m1.FenceToken, m2.FenceToken)
+	}
+}
+
+func TestElectorLosesLease(t *testing.T) {
+	mock.ResetLeases()
+	m := mock.New(false).(*mock.MockManager)
+	e := newElector(m, testLeaseTTL)
+
+	stop := make(chan struct{})
+	defer close(stop)
+	led, done := startElector(e, stop)
+	select {
+	case <-led:
+	case <-time.After(time.Second):
+		t.Fatal("Elector never acquired the lease")
+	}
+
+	// Simulate another tracker taking over behind the leader's back.
+	mock.ResetLeases()
+	if _, held, _ := m.AcquireLease(leaseName, "intruder",
+		time.Minute); !held {
+		t.Fatal("Unable to acquire lease for intruder")
+	}
+	select {
+	case err := <-done:
+		if err != errLeaseLost {
+			t.Errorf("Expected errLeaseLost; got %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("Elector never noticed losing the lease")
+	}
+}
+
+func TestReadyWhileStandby(t *testing.T) {
+	mock.ResetLeases()
+	m := mock.New(false).(*mock.MockManager)
+	if _, held, _ := m.AcquireLease(leaseName, "leader",
+		time.Minute); !held {
+		t.Fatal("Unable to acquire lease for leader")
+	}
+
+	w := getHealthWatcher()
+	mux := http.NewServeMux()
+	addHealthHandlers(mux, w, newElector(m, time.Minute), time.Minute)
+	if code := healthGet(t, mux, "/readyz"); code != http.StatusOK {
+		t.Errorf("Expected standby to be ready; got %d", code)
+	}
+}
@@ -0,0 +1,523 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package loadgen generates synthetic cluster activity for load testing.
+// It is a port of the action model in load_test/load_test.py:  it randomly
+// creates and deletes pods, PVs and PVCs, never deleting resources that are
+// in use, and returns the watch events that a cluster would produce for
+// each action instead of driving a cluster through kubectl.
+package loadgen
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+	"strconv"
+
+	"k8s.io/kubernetes/pkg/api"
+	k8sresource "k8s.io/kubernetes/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// These match the parameters of the Python load test.
+const (
+	maxSize              = 10 // Maximum size of a PV or PVC, in MiB.
+	meanVolsPerContainer = 1
+	maxVolsPerContainer  = 5
+	nfsServer            = "192.0.2.1"
+	exportRoot           = "/export/load-test"
+)
+
+var prefixes = map[resources.ResourceType]string{
+	resources.Pods: "load-test-pod",
+	resources.PVs:  "load-test-pv",
+	resources.PVCs: "load-test-pvc",
+}
+
+var accessModes = []api.PersistentVolumeAccessMode{api.ReadWriteMany}
+
+// Event is a synthetic watch event.  Object is an *api.Pod,
+// *api.PersistentVolume or *api.PersistentVolumeClaim, according to
+// Resource.
+type Event struct {
+	Resource resources.ResourceType
+	Type     string // ADDED, MODIFIED or DELETED
+	Object   interface{}
+}
+
+// Config holds the parameters of a load test.  As with the Python load
+// test, there must be no more PVCs than PVs and no more pods than PVCs.
+type Config struct {
+	MaxPVs    int
+	MaxPVCs   int
+	MaxPods   int
+	Namespace string
+	Seed      int64
+	// UIDPrefix starts every generated UID; it defaults to "load-test-SEED".
+	UIDPrefix string
+}
+
+type pod struct {
+	obj  *api.Pod
+	pvcs []*pvc
+}
+
+type pvc struct {
+	obj      *api.PersistentVolumeClaim
+	pv       *pv
+	size     int
+	mounters int
+}
+
+type pv struct {
+	obj  *api.PersistentVolume
+	pvc  *pvc
+	size int
+}
+
+// Generator produces a random sequence of actions.  It isn't safe for
+// concurrent use.
+type Generator struct {
+	config  Config
+	rng     *rand.Rand
+	rv      int64
+	uids    int
+	events  []Event
+	max     map[resources.ResourceType]int
+	indices map[resources.ResourceType]int
+	created map[resources.ResourceType]int
+
+	pods map[string]*pod
+	pvs  map[string]*pv
+	pvcs map[string]*pvc
+}
+
+// New returns a generator for config.  Runs with the same configuration
+// (including the seed) produce the same actions.
+func New(config Config) (*Generator, error) {
+	if config.MaxPVs <= 0 {
+		return nil, fmt.Errorf("Must allow at least one PV.")
+	}
+	if config.MaxPVCs > config.MaxPVs {
+		return nil, fmt.Errorf("Must not specify more PVCs than PVs.")
+	}
+	if config.MaxPods > config.MaxPVCs {
+		return nil, fmt.Errorf("Must not specify more pods than PVCs.")
+	}
+	if config.UIDPrefix == "" {
+		config.UIDPrefix = fmt.Sprintf("load-test-%d", config.Seed)
+	}
+	return &Generator{
+		config: config,
+		rng:    rand.New(rand.NewSource(config.Seed)),
+		max: map[resources.ResourceType]int{
+			resources.Pods: config.MaxPods,
+			resources.PVs:  config.MaxPVs,
+			resources.PVCs: config.MaxPVCs,
+		},
+		indices: make(map[resources.ResourceType]int),
+		created: make(map[resources.ResourceType]int),
+		pods:    make(map[string]*pod),
+		pvs:     make(map[string]*pv),
+		pvcs:    make(map[string]*pvc),
+	}, nil
+}
+
+// Created returns the number of resources of each type created so far.
+func (g *Generator) Created() map[resources.ResourceType]int {
+	created := make(map[resources.ResourceType]int, len(g.created))
+	for r, n := range g.created {
+		created[r] = n
+	}
+	return created
+}
+
+// count returns the number of existing resources of the given type.
+func (g *Generator) count(r resources.ResourceType) int {
+	switch r {
+	case resources.Pods:
+		return len(g.pods)
+	case resources.PVs:
+		return len(g.pvs)
+	}
+	return len(g.pvcs)
+}
+
+func (g *Generator) total() int {
+	return len(g.pods) + len(g.pvs) + len(g.pvcs)
+}
+
+// Next performs a single action, chosen as in the Python load test, and
+// returns the events it produced.  It returns no events if no action was
+// possible.
+func (g *Generator) Next() []Event {
+	g.events = nil
+
+	type choice struct {
+		action func() bool
+		p      float64
+	}
+	var choices []choice
+
+	// Delete with a probability proportional to how close the cluster is to
+	// holding the maximum number of resources.
+	deleteProbability := float64(g.total()) /
+		float64(g.config.MaxPods+g.config.MaxPVs+g.config.MaxPVCs)
+	if g.rng.Float64() < deleteProbability {
+		for _, c := range []struct {
+			r      resources.ResourceType
+			action func() bool
+		}{
+			{resources.Pods, g.deletePod},
+			{resources.PVCs, g.deletePVC},
+			{resources.PVs, g.deletePV},
+		} {
+			if n := g.count(c.r); n > 0 {
+				choices = append(choices, choice{c.action,
+					float64(n) / float64(g.total())})
+			}
+		}
+	} else {
+		// Pods are created in proportion to the number of PVCs and vice
+		// versa; with neither, create a volume.
+		podP := 0.0
+		if n := len(g.pods) + len(g.pvcs); n > 0 {
+			podP = float64(len(g.pvcs)) / float64(n)
+		}
+		if len(g.pods) < g.config.MaxPods {
+			choices = append(choices, choice{g.createPod, podP})
+		}
+		if len(g.pvcs) < g.config.MaxPVCs {
+			choices = append(choices, choice{g.createVol, 1 - podP})
+		}
+	}
+
+	// Try actions in random order, weighted by their probabilities, until
+	// one succeeds.
+	for len(choices) > 0 {
+		total := 0.0
+		for _, c := range choices {
+			total += c.p
+		}
+		n := g.rng.Float64() * total
+		i, cumulative := 0, 0.0
+		for ; i < len(choices)-1; i++ {
+			if cumulative+choices[i].p > n {
+				break
+			}
+			cumulative += choices[i].p
+		}
+		action := choices[i].action
+		choices = append(choices[:i], choices[i+1:]...)
+		if action() {
+			break
+		}
+	}
+	return g.events
+}
+
+// newName returns a name for a new resource of type r, sometimes reusing
+// the name of a deleted resource.
+func (g *Generator) newName(r resources.ResourceType,
+	inUse func(string) bool) string {
+
+	// Reuse a name only once at least one resource has been deleted, so
+	// that a name is sure to be available.
+	if g.rng.Float64() < .75 || g.indices[r] <= g.max[r] {
+		name := fmt.Sprintf("%s-%d", prefixes[r], g.indices[r])
+		g.indices[r]++
+		return name
+	}
+	for {
+		name := fmt.Sprintf("%s-%d", prefixes[r], g.rng.Intn(g.indices[r]))
+		if !inUse(name) {
+			return name
+		}
+	}
+}
+
+// meta returns the metadata for a new object.
+func (g *Generator) meta(name, namespace string) api.ObjectMeta {
+	g.uids++
+	return api.ObjectMeta{
+		Name:      name,
+		Namespace: namespace,
+		UID: types.UID(fmt.Sprintf("%s-%d", g.config.UIDPrefix,
+			g.uids)),
+		CreationTimestamp: unversioned.Now(),
+	}
+}
+
+// emit records an event for obj, assigning it the next resource version.
+// The event holds a shallow copy of obj; the generator replaces fields
+// rather than modifying what they point to, so later changes don't affect
+// the event.
+func (g *Generator) emit(r resources.ResourceType, eventType string,
+	obj interface{}) {
+
+	g.rv++
+	rv := strconv.FormatInt(g.rv, 10)
+	switch o := obj.(type) {
+	case *api.Pod:
+		o.ResourceVersion = rv
+		c := *o
+		obj = &c
+	case *api.PersistentVolume:
+		o.ResourceVersion = rv
+		c := *o
+		obj = &c
+	case *api.PersistentVolumeClaim:
+		o.ResourceVersion = rv
+		c := *o
+		obj = &c
+	}
+	g.events = append(g.events, Event{r, eventType, obj})
+}
+
+func quantity(mb int) k8sresource.Quantity {
+	return *k8sresource.NewQuantity(int64(mb)*1024*1024,
+		k8sresource.BinarySI)
+}
+
+func (g *Generator) createPV() *pv {
+	if len(g.pvs) == g.config.MaxPVs {
+		return nil
+	}
+	name := g.newName(resources.PVs, func(n string) bool {
+		_, ok := g.pvs[n]
+		return ok
+	})
+	size := g.rng.Intn(maxSize) + 1
+	p := &pv{size: size, obj: &api.PersistentVolume{
+		ObjectMeta: g.meta(name, ""),
+		Spec: api.PersistentVolumeSpec{
+			AccessModes: accessModes,
+			Capacity: api.ResourceList{
+				api.ResourceStorage: quantity(size),
+			},
+			PersistentVolumeSource: api.PersistentVolumeSource{
+				NFS: &api.NFSVolumeSource{
+					Server: nfsServer,
+					Path:   exportRoot + "/" + name,
+				},
+			},
+		},
+	}}
+	g.pvs[name] = p
+	g.created[resources.PVs]++
+	p.obj.Status.Phase = api.VolumePending
+	g.emit(resources.PVs, "ADDED", p.obj)
+	p.obj.Status.Phase = api.VolumeAvailable
+	g.emit(resources.PVs, "MODIFIED", p.obj)
+	return p
+}
+
+// createVol creates a PV and a PVC that binds to it, deleting an unused PV
+// first if there are already too many.
+func (g *Generator) createVol() bool {
+	v := g.createPV()
+	for v == nil {
+		if !g.deletePV() {
+			return false
+		}
+		v = g.createPV()
+	}
+
+	name := g.newName(resources.PVCs, func(n string) bool {
+		_, ok := g.pvcs[n]
+		return ok
+	})
+	size := g.rng.Intn(v.size) + 1
+	c := &pvc{size: size, pv: v, obj: &api.PersistentVolumeClaim{
+		ObjectMeta: g.meta(name, g.config.Namespace),
+		Spec: api.PersistentVolumeClaimSpec{
+			AccessModes: accessModes,
+			Resources: api.ResourceRequirements{
+				Requests: api.ResourceList{
+					api.ResourceStorage: quantity(size),
+				},
+			},
+		},
+	}}
+	g.pvcs[name] = c
+	g.created[resources.PVCs]++
+	c.obj.Status.Phase = api.ClaimPending
+	g.emit(resources.PVCs, "ADDED", c.obj)
+
+	v.pvc = c
+	v.obj.Spec.ClaimRef = &api.ObjectReference{
+		Kind:      "PersistentVolumeClaim",
+		Namespace: c.obj.Namespace,
+		Name:      c.obj.Name,
+		UID:       c.obj.UID,
+	}
+	v.obj.Status.Phase = api.VolumeBound
+	g.emit(resources.PVs, "MODIFIED", v.obj)
+	c.obj.Spec.VolumeName = v.obj.Name
+	c.obj.Status.Phase = api.ClaimBound
+	g.emit(resources.PVCs, "MODIFIED", c.obj)
+	return true
+}
+
+// createPod creates a pod that mounts a random selection of PVCs.
+func (g *Generator) createPod() bool {
+	if len(g.pods) == g.config.MaxPods {
+		return false
+	}
+	count := int(math.Min(math.Min(
+		math.Floor(g.rng.ExpFloat64()/meanVolsPerContainer+.5),
+		maxVolsPerContainer), float64(len(g.pvcs))))
+	names := sortedKeys(g.pvcs)
+	var pvcs []*pvc
+	for _, i := range g.rng.Perm(len(names))[:count] {
+		pvcs = append(pvcs, g.pvcs[names[i]])
+	}
+
+	name := g.newName(resources.Pods, func(n string) bool {
+		_, ok := g.pods[n]
+		return ok
+	})
+	container := api.Container{
+		Name:    "busybox",
+		Image:   "busybox",
+		Command: []string{"sleep", "3600"},
+	}
+	var volumes []api.Volume
+	for i, c := range pvcs {
+		c.mounters++
+		volName := fmt.Sprintf("nfs-%d", i)
+		container.VolumeMounts = append(container.VolumeMounts,
+			api.VolumeMount{
+				Name:      volName,
+				MountPath: fmt.Sprintf("/mnt/nfs-%d", i),
+			})
+		volumes = append(volumes, api.Volume{
+			Name: volName,
+			VolumeSource: api.VolumeSource{
+				PersistentVolumeClaim: &api.PersistentVolumeClaimVolumeSource{
+					ClaimName: c.obj.Name,
+				},
+			},
+		})
+	}
+	p := &pod{pvcs: pvcs, obj: &api.Pod{
+		ObjectMeta: g.meta(name, g.config.Namespace),
+		Spec: api.PodSpec{
+			Containers: []api.Container{container},
+			Volumes:    volumes,
+		},
+	}}
+	p.obj.Labels = map[string]string{"app": "demo"}
+	g.pods[name] = p
+	g.created[resources.Pods]++
+	g.emit(resources.Pods, "ADDED", p.obj)
+	return true
+}
+
+// pickDeletable returns the name of a random resource for which canDelete
+// returns true, or "" if there is none.
+func (g *Generator) pickDeletable(names []string,
+	canDelete func(string) bool) string {
+
+	for _, i := range g.rng.Perm(len(names)) {
+		if canDelete(names[i]) {
+			return names[i]
+		}
+	}
+	return ""
+}
+
+func setDeleted(meta *api.ObjectMeta) {
+	now := unversioned.Now()
+	meta.DeletionTimestamp = &now
+}
+
+// deletePod deletes a random pod; pods can always be deleted.
+func (g *Generator) deletePod() bool {
+	name := g.pickDeletable(sortedKeys(g.pods),
+		func(string) bool { return true })
+	if name == "" {
+		return false
+	}
+	p := g.pods[name]
+	delete(g.pods, name)
+	for _, c := range p.pvcs {
+		c.mounters--
+	}
+	setDeleted(&p.obj.ObjectMeta)
+	g.emit(resources.Pods, "DELETED", p.obj)
+	return true
+}
+
+// deletePVC deletes a random PVC that no pod mounts, releasing its PV.
+func (g *Generator) deletePVC() bool {
+	name := g.pickDeletable(sortedKeys(g.pvcs), func(n string) bool {
+		return g.pvcs[n].mounters == 0
+	})
+	if name == "" {
+		return false
+	}
+	c := g.pvcs[name]
+	delete(g.pvcs, name)
+	setDeleted(&c.obj.ObjectMeta)
+	g.emit(resources.PVCs, "DELETED", c.obj)
+	// PVs are never rebound, but they can be deleted once released.
+	c.pv.pvc = nil
+	c.pv.obj.Status.Phase = api.VolumeReleased
+	g.emit(resources.PVs, "MODIFIED", c.pv.obj)
+	return true
+}
+
+// deletePV deletes a random PV that isn't bound to a PVC.
+func (g *Generator) deletePV() bool {
+	name := g.pickDeletable(sortedKeys(g.pvs), func(n string) bool {
+		return g.pvs[n].pvc == nil
+	})
+	if name == "" {
+		return false
+	}
+	p := g.pvs[name]
+	delete(g.pvs, name)
+	setDeleted(&p.obj.ObjectMeta)
+	g.emit(resources.PVs, "DELETED", p.obj)
+	return true
+}
+
+// sortedKeys returns the keys of m in sorted order, so that random choices
+// depend only on the seed.
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	switch m := m.(type) {
+	case map[string]*pod:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*pv:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	case map[string]*pvc:
+		for k := range m {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,161 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package loadgen
+
+import (
+	"fmt"
+	"strconv"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+var testConfig = Config{
+	MaxPVs:    6,
+	MaxPVCs:   4,
+	MaxPods:   3,
+	Namespace: "test-namespace",
+	Seed:      42,
+}
+
+// describe returns a summary of e that doesn't depend on the time.
+func describe(e Event) string {
+	var meta api.ObjectMeta
+	switch o := e.Object.(type) {
+	case *api.Pod:
+		meta = o.ObjectMeta
+	case *api.PersistentVolume:
+		meta = o.ObjectMeta
+	case *api.PersistentVolumeClaim:
+		meta = o.ObjectMeta
+	}
+	return fmt.Sprintf("%s %s %s %s", e.Type, e.Resource, meta.Name,
+		meta.ResourceVersion)
+}
+
+func TestNew(t *testing.T) {
+	for _, config := range []Config{
+		{MaxPVs: 0},
+		{MaxPVs: 1, MaxPVCs: 2},
+		{MaxPVs: 2, MaxPVCs: 1, MaxPods: 2},
+	} {
+		if _, err := New(config); err == nil {
+			t.Errorf("Accepted invalid config %+v", config)
+		}
+	}
+}
+
+func TestSeed(t *testing.T) {
+	g1, _ := New(testConfig)
+	g2, _ := New(testConfig)
+	for i := 0; i < 500; i++ {
+		e1, e2 := g1.Next(), g2.Next()
+		if len(e1) != len(e2) {
+			t.Fatalf("Action %d produced %d and %d events", i, len(e1),
+				len(e2))
+		}
+		for j := range e1 {
+			if describe(e1[j]) != describe(e2[j]) {
+				t.Fatalf("Action %d produced %q and %q", i,
+					describe(e1[j]), describe(e2[j]))
+			}
+		}
+	}
+}
+
+// TestInvariants checks that the generated history respects the limits in
+// the configuration and never deletes resources that are in use.
+func TestInvariants(t *testing.T) {
+	g, _ := New(testConfig)
+	var (
+		lastRV  int64
+		live    = make(map[resources.ResourceType]map[string]bool)
+		mounted = make(map[string]int)      // PVC name to mounting pods
+		claims  = make(map[string][]string) // Pod name to PVC names
+	)
+	for _, r := range []resources.ResourceType{resources.Pods, resources.PVs,
+		resources.PVCs} {
+		live[r] = make(map[string]bool)
+	}
+	for i := 0; i < 2000; i++ {
+		for _, e := range g.Next() {
+			var meta api.ObjectMeta
+			switch o := e.Object.(type) {
+			case *api.Pod:
+				meta = o.ObjectMeta
+				if e.Type == "ADDED" {
+					for _, v := range o.Spec.Volumes {
+						name := v.PersistentVolumeClaim.ClaimName
+						claims[o.Name] = append(claims[o.Name], name)
+						mounted[name]++
+					}
+				} else if e.Type == "DELETED" {
+					for _, name := range claims[o.Name] {
+						mounted[name]--
+					}
+					delete(claims, o.Name)
+				}
+			case *api.PersistentVolume:
+				meta = o.ObjectMeta
+				if e.Type == "DELETED" && o.Spec.ClaimRef != nil &&
+					o.Status.Phase == api.VolumeBound {
+					t.Fatalf("Deleted bound PV %s", o.Name)
+				}
+			case *api.PersistentVolumeClaim:
+				meta = o.ObjectMeta
+				if e.Type == "DELETED" && mounted[o.Name] > 0 {
+					t.Fatalf("Deleted PVC %s mounted by %d pods", o.Name,
+						mounted[o.Name])
+				}
+			}
+			rv, err := strconv.ParseInt(meta.ResourceVersion, 10, 64)
+			if err != nil || rv <= lastRV {
+				t.Fatalf("Got RV %s after %d", meta.ResourceVersion, lastRV)
+			}
+			lastRV = rv
+			switch e.Type {
+			case "ADDED":
+				if live[e.Resource][meta.Name] {
+					t.Fatalf("Added existing %s", describe(e))
+				}
+				live[e.Resource][meta.Name] = true
+			case "DELETED":
+				if !live[e.Resource][meta.Name] {
+					t.Fatalf("Deleted missing %s", describe(e))
+				}
+				if meta.DeletionTimestamp == nil {
+					t.Fatalf("No deletion time for %s", describe(e))
+				}
+				delete(live[e.Resource], meta.Name)
+			}
+		}
+		if len(live[resources.Pods]) > testConfig.MaxPods ||
+			len(live[resources.PVs]) > testConfig.MaxPVs ||
+			len(live[resources.PVCs]) > testConfig.MaxPVCs {
+			t.Fatalf("Too many resources after action %d:  %d pods, %d "+
+				"PVs, %d PVCs", i, len(live[resources.Pods]),
+				len(live[resources.PVs]), len(live[resources.PVCs]))
+		}
+	}
+	created := g.Created()
+	if created[resources.Pods] == 0 || created[resources.PVs] == 0 ||
+		created[resources.PVCs] == 0 {
+		t.Error("Resources of some type were never created: ", created)
+	}
+}
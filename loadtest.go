@@ -0,0 +1,215 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/netapp/kubevoltracker/loadgen"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// maxIdleActions is the number of consecutive actions that may produce no
+// events before a load test gives up.
+const maxIdleActions = 1000
+
+// loadEvent is a synthetic event on its way to the Watcher.
+type loadEvent struct {
+	resource resources.ResourceType
+	line     string
+	emitted  time.Time
+}
+
+// loadStats accumulates the measurements from a load test.  dbLatency is the
+// time spent in the handler for each event, which is almost entirely spent
+// in the backend, and lag is the time from when each event was due to be
+// emitted until it had been handled.
+type loadStats struct {
+	mutex     sync.Mutex
+	events    map[resources.ResourceType]int
+	skipped   int
+	dbLatency []time.Duration
+	lag       []time.Duration
+	elapsed   time.Duration
+}
+
+func (s *loadStats) record(resource resources.ResourceType, dbLatency,
+	lag time.Duration) {
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	s.events[resource]++
+	s.dbLatency = append(s.dbLatency, dbLatency)
+	s.lag = append(s.lag, lag)
+}
+
+func (s *loadStats) total() int {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+	return len(s.lag)
+}
+
+// percentile returns the pth percentile (0 < p <= 1) of sorted, which must be
+// in ascending order.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted))*p+.5) - 1
+	if i < 0 {
+		i = 0
+	} else if i >= len(sorted) {
+		i = len(sorted) - 1
+	}
+	return sorted[i]
+}
+
+type durations []time.Duration
+
+func (d durations) Len() int           { return len(d) }
+func (d durations) Swap(i, j int)      { d[i], d[j] = d[j], d[i] }
+func (d durations) Less(i, j int) bool { return d[i] < d[j] }
+
+// summarize returns the median, 90th and 99th percentiles, and maximum of d
+// as a string.
+func summarize(d []time.Duration) string {
+	sorted := append(durations(nil), d...)
+	sort.Sort(sorted)
+	return fmt.Sprintf("p50 %s, p90 %s, p99 %s, max %s",
+		percentile(sorted, .5), percentile(sorted, .9),
+		percentile(sorted, .99), percentile(sorted, 1))
+}
+
+// report writes a summary of the load test to out.
+func (s *loadStats) report(out io.Writer) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	total := len(s.lag)
+	rate := 0.0
+	if s.elapsed > 0 {
+		rate = float64(total) / s.elapsed.Seconds()
+	}
+	fmt.Fprintf(out, "Handled %d events in %s (%.1f events/s):  %d pod, "+
+		"%d PV, %d PVC\n", total, s.elapsed, rate,
+		s.events[resources.Pods], s.events[resources.PVs],
+		s.events[resources.PVCs])
+	if s.skipped > 0 {
+		fmt.Fprintf(out, "Skipped %d events that failed to decode\n",
+			s.skipped)
+	}
+	fmt.Fprintf(out, "DB latency:  %s\n", summarize(s.dbLatency))
+	fmt.Fprintf(out, "End-to-end lag:  %s\n", summarize(s.lag))
+}
+
+// encodeLoadEvent encodes e as a line of a watch stream.
+func encodeLoadEvent(e loadgen.Event) (string, error) {
+	line, err := json.Marshal(struct {
+		Type   string      `json:"type"`
+		Object interface{} `json:"object"`
+	}{e.Type, e.Object})
+	if err != nil {
+		return "", fmt.Errorf("Unable to encode %s event:  %s", e.Resource,
+			err)
+	}
+	return string(line), nil
+}
+
+// runLoad feeds events from gen to w's handlers for duration, or until
+// maxEvents events have been emitted if maxEvents is positive.  Events are
+// emitted at rate events per second, or as fast as they can be handled if
+// rate is zero.  As with live watches, each resource type is handled by its
+// own goroutine, so events for different types may be handled out of order.
+func runLoad(w *Watcher, gen *loadgen.Generator, rate float64,
+	duration time.Duration, maxEvents int) (*loadStats, error) {
+
+	stats := &loadStats{events: make(map[resources.ResourceType]int)}
+	channels := make(map[resources.ResourceType]chan loadEvent)
+	var wg sync.WaitGroup
+	for _, r := range []resources.ResourceType{resources.Pods,
+		resources.PVs, resources.PVCs} {
+
+		ch := make(chan loadEvent, 1000)
+		channels[r] = ch
+		wg.Add(1)
+		go func(ch <-chan loadEvent) {
+			defer wg.Done()
+			for e := range ch {
+				start := time.Now()
+				ok, err := w.handleLine(e.resource, "", e.line,
+					receipt{time: start})
+				end := time.Now()
+				if err != nil || !ok {
+					log.Printf("Unable to handle %s event:  %v",
+						e.resource, err)
+					stats.mutex.Lock()
+					stats.skipped++
+					stats.mutex.Unlock()
+					continue
+				}
+				stats.record(e.resource, end.Sub(start),
+					end.Sub(e.emitted))
+			}
+		}(ch)
+	}
+
+	var err error
+	start := time.Now()
+	emitted, idle := 0, 0
+	for time.Since(start) < duration &&
+		(maxEvents <= 0 || emitted < maxEvents) && idle < maxIdleActions {
+
+		events := gen.Next()
+		if len(events) == 0 {
+			idle++
+			continue
+		}
+		idle = 0
+		for _, e := range events {
+			if maxEvents > 0 && emitted == maxEvents {
+				break
+			}
+			var line string
+			if line, err = encodeLoadEvent(e); err != nil {
+				break
+			}
+			due := time.Now()
+			if rate > 0 {
+				due = start.Add(time.Duration(float64(emitted) /
+					rate * float64(time.Second)))
+				time.Sleep(due.Sub(time.Now()))
+			}
+			channels[e.Resource] <- loadEvent{e.Resource, line, due}
+			emitted++
+		}
+		if err != nil {
+			break
+		}
+	}
+	for _, ch := range channels {
+		close(ch)
+	}
+	wg.Wait()
+	stats.elapsed = time.Since(start)
+	return stats, err
+}
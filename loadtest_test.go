@@ -0,0 +1,102 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/loadgen"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+func TestPercentile(t *testing.T) {
+	sorted := []time.Duration{1, 2, 3, 4, 5, 6, 7, 8, 9, 10}
+	for _, test := range []struct {
+		p        float64
+		expected time.Duration
+	}{
+		{.5, 5}, {.9, 9}, {.99, 10}, {1, 10}, {.01, 1},
+	} {
+		if got := percentile(sorted, test.p); got != test.expected {
+			t.Errorf("Got %d for p%.0f; expected %d", got, test.p*100,
+				test.expected)
+		}
+	}
+	if got := percentile(nil, .5); got != 0 {
+		t.Errorf("Got %d for empty list", got)
+	}
+}
+
+func TestRunLoad(t *testing.T) {
+	gen, err := loadgen.New(loadgen.Config{MaxPVs: 10, MaxPVCs: 8,
+		MaxPods: 5, Namespace: "test-namespace", Seed: 1})
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := mock.New(false).(*mock.MockManager)
+	stats, err := runLoad(newReplayWatcher(manager), gen, 0, time.Minute,
+		500)
+	if err != nil {
+		t.Fatal("Load test failed: ", err)
+	}
+	if total := stats.total(); total != 500 || stats.skipped != 0 {
+		t.Errorf("Handled %d events and skipped %d; expected 500 and 0",
+			total, stats.skipped)
+	}
+	if len(manager.PodForUID) > 5 || len(manager.PVForUID) > 10 ||
+		len(manager.PVCForUID) > 8 {
+		t.Errorf("Backend holds %d pods, %d PVs, %d PVCs; more than the "+
+			"generator allows", len(manager.PodForUID),
+			len(manager.PVForUID), len(manager.PVCForUID))
+	}
+	created := gen.Created()
+	if len(manager.PVForUID)+manager.Deletions == 0 ||
+		created[resources.PVs] == 0 {
+		t.Error("No PVs reached the backend")
+	}
+
+	var out bytes.Buffer
+	stats.report(&out)
+	for _, s := range []string{"Handled 500 events", "DB latency:  p50",
+		"End-to-end lag:  p50"} {
+		if !strings.Contains(out.String(), s) {
+			t.Errorf("Report missing %q:\n%s", s, out.String())
+		}
+	}
+}
+
+func TestRunLoadRate(t *testing.T) {
+	gen, _ := loadgen.New(loadgen.Config{MaxPVs: 2, MaxPVCs: 2, MaxPods: 1,
+		Seed: 1})
+	start := time.Now()
+	stats, err := runLoad(newReplayWatcher(mock.New(false)), gen, 1000,
+		time.Minute, 50)
+	if err != nil {
+		t.Fatal("Load test failed: ", err)
+	}
+	// The last of 50 events at 1000 per second is due at 49ms.
+	if elapsed := time.Since(start); elapsed < 49*time.Millisecond {
+		t.Errorf("Emitted 50 events in %s at 1000 events/s", elapsed)
+	}
+	if total := stats.total(); total != 50 {
+		t.Errorf("Handled %d events; expected 50", total)
+	}
+}
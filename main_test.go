@@ -26,6 +26,10 @@ import (
 const watcherNS = "test"
 
 func TestMain(m *testing.M) {
+	// Point the watchers at the fake API server if kubectl is using one.
+	if server := kubectl.FakeAPIServer(); server != nil {
+		os.Setenv("KUBERNETES_MASTER", server.Host())
+	}
 	kubectl.DeleteTestResources()
 	v := m.Run()
 	if v == 0 {
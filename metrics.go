@@ -0,0 +1,115 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"log"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/metrics"
+	"github.com/netapp/kubevoltracker/reports"
+)
+
+var (
+	eventsProcessed = metrics.NewCounterVec(
+		"kubevoltracker_events_total",
+		"Watch events processed, by resource and event type.",
+		"resource", "type",
+	)
+	eventsFiltered = metrics.NewCounterVec(
+		"kubevoltracker_events_filtered_total",
+		"Watch events dropped by the client-side filters, by resource and "+
+			"the kind of rule (namespace, label, or selector) that dropped "+
+			"them.",
+		"resource", "reason",
+	)
+	eventsStale = metrics.NewCounterVec(
+		"kubevoltracker_events_stale_total",
+		"Watch events dropped because they were no newer than the last "+
+			"event applied to the same object, by resource.",
+		"resource",
+	)
+	watchReconnects = metrics.NewCounterVec(
+		"kubevoltracker_watch_reconnects_total",
+		"Watches restarted after their stream ended.",
+		"resource",
+	)
+	watchErrors = metrics.NewCounterVec(
+		"kubevoltracker_watch_errors_total",
+		"Status errors reported by the API server on watches, by resource "+
+			"and reason.",
+		"resource", "reason",
+	)
+	watchResets = metrics.NewCounterVec(
+		"kubevoltracker_watch_resets_total",
+		"Watches restarted from scratch after their resource version "+
+			"expired.",
+		"resource",
+	)
+	leaderGauge = metrics.NewGaugeVec(
+		"kubevoltracker_leader",
+		"1 if this tracker holds the leader lease and runs the watches.",
+	)
+	clockOffset = metrics.NewGaugeVec(
+		"kubevoltracker_clock_offset_seconds",
+		"Estimated offset of the API server's clock from the local clock; "+
+			"positive if the API server is ahead.",
+	)
+
+	pvCount = metrics.NewGaugeVec(
+		"kubevoltracker_pvs",
+		"Existing PVs, by backend type and status.",
+		"backend", "status",
+	)
+	pvBytes = metrics.NewGaugeVec(
+		"kubevoltracker_pv_bytes",
+		"Total capacity of existing PVs in bytes, by backend type and "+
+			"status.",
+		"backend", "status",
+	)
+)
+
+// inventoryStatusLabels maps PV statuses to the values of the status label
+// on the inventory gauges.
+var inventoryStatusLabels = map[reports.PVStatus]string{
+	reports.StatusBound:    "bound",
+	reports.StatusReleased: "released",
+	reports.StatusUnbound:  "unused",
+}
+
+// registerInventoryMetrics arranges for the PV inventory gauges to be
+// computed from q whenever metrics are collected.
+func registerInventoryMetrics(q dbmanager.Querier) {
+	metrics.DefaultRegistry.OnCollect(func() {
+		rows, err := reports.PVInventory(q)
+		if err != nil {
+			log.Print("Unable to compute PV inventory: ", err)
+			return
+		}
+		pvCount.Reset()
+		pvBytes.Reset()
+		for _, row := range rows {
+			backend := string(row.Backend)
+			if backend == "" {
+				backend = "other"
+			}
+			status := inventoryStatusLabels[row.Status]
+			pvCount.Set(float64(row.Count), backend, status)
+			pvBytes.Set(float64(row.Bytes), backend, status)
+		}
+	})
+}
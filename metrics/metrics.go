@@ -0,0 +1,410 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package metrics provides a minimal set of counters, gauges, and histograms
+// that can be exposed in the Prometheus text exposition format.  Metrics
+// created with the New functions are registered with DefaultRegistry, so
+// packages can declare them as globals and have them show up on the
+// /metrics endpoint automatically.
+package metrics
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefBuckets are the default histogram buckets, in seconds, suitable for
+// measuring latencies.
+var DefBuckets = []float64{.005, .01, .025, .05, .1, .25, .5, 1, 2.5, 5, 10}
+
+// Collector is a metric family that can write itself in the text format.
+type Collector interface {
+	Name() string
+	Write(w io.Writer) error
+}
+
+// Registry holds a set of Collectors, along with hooks that are run
+// before each collection (e.g., to update gauges computed from the DB).
+type Registry struct {
+	mutex      sync.Mutex
+	collectors map[string]Collector
+	hooks      []func()
+}
+
+// NewRegistry returns an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{collectors: make(map[string]Collector)}
+}
+
+// DefaultRegistry is the registry used by the New functions and Handler.
+var DefaultRegistry = NewRegistry()
+
+// Register adds c to the registry.  It panics if a collector with the same
+// name has already been registered, as that's a programming error.
+func (r *Registry) Register(c Collector) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	if _, ok := r.collectors[c.Name()]; ok {
+		panic(fmt.Sprintf("Metric %s registered twice", c.Name()))
+	}
+	r.collectors[c.Name()] = c
+}
+
+// OnCollect adds a hook that is run at the start of every Write.
+func (r *Registry) OnCollect(hook func()) {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	r.hooks = append(r.hooks, hook)
+}
+
+// Write runs any collection hooks and writes every registered metric to
+// w, sorted by name.
+func (r *Registry) Write(w io.Writer) error {
+	r.mutex.Lock()
+	hooks := append([]func(){}, r.hooks...)
+	names := make([]string, 0, len(r.collectors))
+	for name := range r.collectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	collectors := make([]Collector, len(names))
+	for i, name := range names {
+		collectors[i] = r.collectors[name]
+	}
+	r.mutex.Unlock()
+
+	for _, hook := range hooks {
+		hook()
+	}
+	for _, c := range collectors {
+		if err := c.Write(w); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Handler returns an http.Handler that serves the metrics in r.
+func (r *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		var buf bytes.Buffer
+		if err := r.Write(&buf); err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		w.Write(buf.Bytes())
+	})
+}
+
+// Handler returns an http.Handler that serves DefaultRegistry.
+func Handler() http.Handler {
+	return DefaultRegistry.Handler()
+}
+
+// family holds the common parts of a labeled metric family.
+type family struct {
+	name       string
+	help       string
+	metricType string
+	labels     []string
+	mutex      sync.Mutex
+}
+
+func (f *family) Name() string { return f.name }
+
+// key joins label values into a map key, checking their count.
+func (f *family) key(values []string) string {
+	if len(values) != len(f.labels) {
+		panic(fmt.Sprintf("Metric %s expects %d label values; got %d",
+			f.name, len(f.labels), len(values)))
+	}
+	return strings.Join(values, "\xff")
+}
+
+func (f *family) writeHeader(w io.Writer) error {
+	_, err := fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", f.name,
+		escapeHelp(f.help), f.name, f.metricType)
+	return err
+}
+
+// labelString formats label names and values as {a="x",b="y"}, appending
+// any extra pairs.
+func labelString(names, values []string, extra ...string) string {
+	if len(names) == 0 && len(extra) == 0 {
+		return ""
+	}
+	pairs := make([]string, 0, len(names)+len(extra)/2)
+	for i, name := range names {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", name,
+			escapeLabel(values[i])))
+	}
+	for i := 0; i+1 < len(extra); i += 2 {
+		pairs = append(pairs, fmt.Sprintf("%s=\"%s\"", extra[i],
+			escapeLabel(extra[i+1])))
+	}
+	return "{" + strings.Join(pairs, ",") + "}"
+}
+
+var (
+	helpEscaper  = strings.NewReplacer(`\`, `\\`, "\n", `\n`)
+	labelEscaper = strings.NewReplacer(`\`, `\\`, "\n", `\n`, `"`, `\"`)
+)
+
+func escapeHelp(s string) string  { return helpEscaper.Replace(s) }
+func escapeLabel(s string) string { return labelEscaper.Replace(s) }
+
+func formatFloat(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// sample is a single labeled value.
+type sample struct {
+	values []string
+	value  float64
+}
+
+// sortedSamples returns the samples in m ordered by label values.
+func sortedSamples(m map[string]*sample) []*sample {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	ret := make([]*sample, len(keys))
+	for i, k := range keys {
+		ret[i] = m[k]
+	}
+	return ret
+}
+
+// valueVec is a family of float values, used for both counters and gauges.
+type valueVec struct {
+	family
+	samples map[string]*sample
+}
+
+func newValueVec(name, help, metricType string, labels []string) valueVec {
+	return valueVec{
+		family: family{name: name, help: help, metricType: metricType,
+			labels: labels},
+		samples: make(map[string]*sample),
+	}
+}
+
+func (v *valueVec) update(values []string, f func(*sample)) {
+	k := v.key(values)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	s, ok := v.samples[k]
+	if !ok {
+		s = &sample{values: append([]string{}, values...)}
+		v.samples[k] = s
+	}
+	f(s)
+}
+
+// Value returns the current value for the given label values, or zero if
+// it has never been set.
+func (v *valueVec) Value(values ...string) float64 {
+	k := v.key(values)
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if s, ok := v.samples[k]; ok {
+		return s.value
+	}
+	return 0
+}
+
+func (v *valueVec) Write(w io.Writer) error {
+	v.mutex.Lock()
+	defer v.mutex.Unlock()
+	if err := v.writeHeader(w); err != nil {
+		return err
+	}
+	for _, s := range sortedSamples(v.samples) {
+		_, err := fmt.Fprintf(w, "%s%s %s\n", v.name,
+			labelString(v.labels, s.values), formatFloat(s.value))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CounterVec is a family of monotonically increasing counters.
+type CounterVec struct {
+	valueVec
+}
+
+// NewCounterVec creates a CounterVec with the given label names and
+// registers it with DefaultRegistry.
+func NewCounterVec(name, help string, labels ...string) *CounterVec {
+	c := &CounterVec{newValueVec(name, help, "counter", labels)}
+	DefaultRegistry.Register(c)
+	return c
+}
+
+// Inc increments the counter for the given label values by one.
+func (c *CounterVec) Inc(values ...string) {
+	c.Add(1, values...)
+}
+
+// Add increments the counter for the given label values by delta, which
+// must not be negative.
+func (c *CounterVec) Add(delta float64, values ...string) {
+	if delta < 0 {
+		panic(fmt.Sprintf("Counter %s cannot decrease", c.name))
+	}
+	c.update(values, func(s *sample) { s.value += delta })
+}
+
+// GaugeVec is a family of values that can go up and down.
+type GaugeVec struct {
+	valueVec
+}
+
+// NewGaugeVec creates a GaugeVec with the given label names and registers
+// it with DefaultRegistry.
+func NewGaugeVec(name, help string, labels ...string) *GaugeVec {
+	g := &GaugeVec{newValueVec(name, help, "gauge", labels)}
+	DefaultRegistry.Register(g)
+	return g
+}
+
+// Set sets the gauge for the given label values.
+func (g *GaugeVec) Set(value float64, values ...string) {
+	g.update(values, func(s *sample) { s.value = value })
+}
+
+// Add adds delta, which may be negative, to the gauge for the given label
+// values.
+func (g *GaugeVec) Add(delta float64, values ...string) {
+	g.update(values, func(s *sample) { s.value += delta })
+}
+
+// Reset removes every label combination from the gauge, so that values
+// that are no longer set aren't reported.
+func (g *GaugeVec) Reset() {
+	g.mutex.Lock()
+	defer g.mutex.Unlock()
+	g.samples = make(map[string]*sample)
+}
+
+// histogramSample holds the observations for a single label combination.
+type histogramSample struct {
+	values []string
+	counts []uint64 // Per bucket, not cumulative.
+	sum    float64
+	count  uint64
+}
+
+// HistogramVec is a family of histograms with fixed buckets.
+type HistogramVec struct {
+	family
+	buckets []float64
+	samples map[string]*histogramSample
+}
+
+// NewHistogramVec creates a HistogramVec with the given upper bucket bounds,
+// which must be sorted, and registers it with DefaultRegistry.
+func NewHistogramVec(name, help string, buckets []float64,
+	labels ...string) *HistogramVec {
+
+	h := &HistogramVec{
+		family: family{name: name, help: help, metricType: "histogram",
+			labels: labels},
+		buckets: buckets,
+		samples: make(map[string]*histogramSample),
+	}
+	DefaultRegistry.Register(h)
+	return h
+}
+
+// Observe records v for the given label values.
+func (h *HistogramVec) Observe(v float64, values ...string) {
+	k := h.key(values)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	s, ok := h.samples[k]
+	if !ok {
+		s = &histogramSample{values: append([]string{}, values...),
+			counts: make([]uint64, len(h.buckets))}
+		h.samples[k] = s
+	}
+	if i := sort.SearchFloat64s(h.buckets, v); i < len(h.buckets) {
+		s.counts[i]++
+	}
+	s.sum += v
+	s.count++
+}
+
+// Count returns the number of observations for the given label values.
+func (h *HistogramVec) Count(values ...string) uint64 {
+	k := h.key(values)
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if s, ok := h.samples[k]; ok {
+		return s.count
+	}
+	return 0
+}
+
+func (h *HistogramVec) Write(w io.Writer) error {
+	h.mutex.Lock()
+	defer h.mutex.Unlock()
+	if err := h.writeHeader(w); err != nil {
+		return err
+	}
+	keys := make([]string, 0, len(h.samples))
+	for k := range h.samples {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	for _, k := range keys {
+		s := h.samples[k]
+		var cumulative uint64
+		for i, bound := range h.buckets {
+			cumulative += s.counts[i]
+			fmt.Fprintf(w, "%s_bucket%s %d\n", h.name,
+				labelString(h.labels, s.values, "le", formatFloat(bound)),
+				cumulative)
+		}
+		fmt.Fprintf(w, "%s_bucket%s %d\n", h.name,
+			labelString(h.labels, s.values, "le", "+Inf"), s.count)
+		fmt.Fprintf(w, "%s_sum%s %s\n", h.name,
+			labelString(h.labels, s.values), formatFloat(s.sum))
+		_, err := fmt.Fprintf(w, "%s_count%s %d\n", h.name,
+			labelString(h.labels, s.values), s.count)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,114 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package metrics
+
+import (
+	"bytes"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var (
+	testCounter = NewCounterVec("test_events_total", "Events seen.",
+		"resource", "type")
+	testGauge     = NewGaugeVec("test_volumes", "Volumes.", "status")
+	testHistogram = NewHistogramVec("test_latency_seconds", "Latency.",
+		[]float64{.1, 1})
+)
+
+func checkOutput(t *testing.T, c Collector, expected string) {
+	var buf bytes.Buffer
+	if err := c.Write(&buf); err != nil {
+		t.Fatal("Unable to write metric: ", err)
+	}
+	if buf.String() != expected {
+		t.Errorf("Incorrect output for %s.\nExpected:\n%s\nGot:\n%s",
+			c.Name(), expected, buf.String())
+	}
+}
+
+func TestCounter(t *testing.T) {
+	testCounter.Inc("pods", "ADDED")
+	testCounter.Add(2, "pods", "ADDED")
+	testCounter.Inc("pvs", `quote"d`)
+	if v := testCounter.Value("pods", "ADDED"); v != 3 {
+		t.Error("Expected a value of 3; got ", v)
+	}
+	checkOutput(t, testCounter, "# HELP test_events_total Events seen.\n"+
+		"# TYPE test_events_total counter\n"+
+		"test_events_total{resource=\"pods\",type=\"ADDED\"} 3\n"+
+		"test_events_total{resource=\"pvs\",type=\"quote\\\"d\"} 1\n")
+}
+
+func TestGauge(t *testing.T) {
+	testGauge.Set(5, "bound")
+	testGauge.Add(-2, "bound")
+	testGauge.Set(1, "released")
+	testGauge.Reset()
+	testGauge.Set(4, "unused")
+	checkOutput(t, testGauge, "# HELP test_volumes Volumes.\n"+
+		"# TYPE test_volumes gauge\n"+
+		"test_volumes{status=\"unused\"} 4\n")
+}
+
+func TestHistogram(t *testing.T) {
+	testHistogram.Observe(.05)
+	testHistogram.Observe(.5)
+	testHistogram.Observe(5)
+	if c := testHistogram.Count(); c != 3 {
+		t.Error("Expected 3 observations; got ", c)
+	}
+	checkOutput(t, testHistogram, "# HELP test_latency_seconds Latency.\n"+
+		"# TYPE test_latency_seconds histogram\n"+
+		"test_latency_seconds_bucket{le=\"0.1\"} 1\n"+
+		"test_latency_seconds_bucket{le=\"1\"} 2\n"+
+		"test_latency_seconds_bucket{le=\"+Inf\"} 3\n"+
+		"test_latency_seconds_sum 5.55\n"+
+		"test_latency_seconds_count 3\n")
+}
+
+func TestHandler(t *testing.T) {
+	hookRan := false
+	DefaultRegistry.OnCollect(func() { hookRan = true })
+
+	req, err := http.NewRequest("GET", "/metrics", nil)
+	if err != nil {
+		t.Fatal("Unable to create request: ", err)
+	}
+	rec := httptest.NewRecorder()
+	Handler().ServeHTTP(rec, req)
+	if !hookRan {
+		t.Error("Collection hook not run.")
+	}
+	body := rec.Body.String()
+	if !strings.Contains(body, "# TYPE test_events_total counter") ||
+		strings.Index(body, "test_events_total") >
+			strings.Index(body, "test_volumes") {
+		t.Error("Incorrect metrics output:\n", body)
+	}
+}
+
+func TestRegisterTwice(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Error("Expected a panic when registering a name twice.")
+		}
+	}()
+	NewCounterVec("test_events_total", "Duplicate.")
+}
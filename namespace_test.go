@@ -0,0 +1,157 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// lockedManager serializes pod inserts and deletions in a MockManager, which
+// isn't safe for use by the concurrent per-namespace watches.
+type lockedManager struct {
+	*mock.MockManager
+	mutex sync.Mutex
+}
+
+func (m *lockedManager) InsertPod(uid types.UID, name string,
+	createTime unversioned.Time, namespace string,
+	containers []resources.ContainerDesc, json, watcherNS, rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.MockManager.InsertPod(uid, name, createTime, namespace, containers,
+		json, watcherNS, rv)
+}
+
+func (m *lockedManager) DeletePod(uid types.UID,
+	deleteTime unversioned.Time, timeSource dbmanager.TimeSource, watcherNS,
+	rv string) {
+
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	m.MockManager.DeletePod(uid, deleteTime, timeSource, watcherNS, rv)
+}
+
+func (m *lockedManager) hasPod(uid types.UID) bool {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	_, ok := m.PodForUID[uid]
+	return ok
+}
+
+func podEventLine(uid, namespace string) string {
+	return fmt.Sprintf(`{"type":"ADDED","object":{"metadata":{"name":"%s",`+
+		`"namespace":"%s","uid":"%s","resourceVersion":"10"}}}`+"\n", uid,
+		namespace, uid)
+}
+
+// getNamespaceServer returns a fake API server with two namespaces labeled
+// tenant=a.  The watch on ns-a also returns a pod from ns-a-extra, as if the
+// API server had matched the namespace by prefix.
+func getNamespaceServer(t *testing.T) *httptest.Server {
+	watches := map[string]string{
+		"/api/v1/watch/namespaces/ns-a/pods": podEventLine("a1", "ns-a") +
+			podEventLine("x1", "ns-a-extra"),
+		"/api/v1/watch/namespaces/ns-b/pods": podEventLine("b1", "ns-b"),
+	}
+	return httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+
+		if r.URL.Path == "/api/v1/namespaces" {
+			if r.URL.Query().Get("labelSelector") != "tenant=a" {
+				fmt.Fprint(w, `{"items":[]}`)
+				return
+			}
+			fmt.Fprint(w, `{"items":[{"metadata":{"name":"ns-a"}},`+
+				`{"metadata":{"name":"ns-b"}}]}`)
+			return
+		}
+		// APIClient's watch URLs contain a double slash.
+		events, ok := watches[strings.Replace(r.URL.Path, "//", "/", -1)]
+		if !ok {
+			t.Errorf("Unexpected request for %s", r.URL)
+			http.NotFound(w, r)
+			return
+		}
+		fmt.Fprint(w, events)
+		w.(http.Flusher).Flush()
+		// Keep the stream open until the watch is stopped.
+		<-w.(http.CloseNotifier).CloseNotify()
+	}))
+}
+
+func TestListNamespaces(t *testing.T) {
+	server := getNamespaceServer(t)
+	defer server.Close()
+
+	client, err := NewAPIClient(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal("Unable to create client: ", err)
+	}
+	names, err := client.ListNamespaces("tenant=a")
+	if err != nil {
+		t.Fatal("Unable to list namespaces: ", err)
+	}
+	if len(names) != 2 || names[0] != "ns-a" || names[1] != "ns-b" {
+		t.Errorf("Expected [ns-a ns-b]; got %v", names)
+	}
+	if _, err = NewWatcherForSelector("tenant=b",
+		strings.TrimPrefix(server.URL, "http://"),
+		mock.New(false)); err == nil {
+		t.Error("Expected error for selector matching no namespaces")
+	}
+}
+
+func TestWatchNamespaces(t *testing.T) {
+	server := getNamespaceServer(t)
+	defer server.Close()
+
+	manager := &lockedManager{MockManager: mock.New(false).(*mock.MockManager)}
+	w, err := NewWatcherForSelector("tenant=a",
+		strings.TrimPrefix(server.URL, "http://"), manager)
+	if err != nil {
+		t.Fatal("Unable to create watcher: ", err)
+	}
+	if err = w.Watch(resources.Pods, false); err != nil {
+		t.Fatal("Unable to watch pods: ", err)
+	}
+	defer w.Stop(resources.Pods)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for !(manager.hasPod("a1") && manager.hasPod("b1")) {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for pods from both namespaces")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if manager.hasPod("x1") {
+		t.Error("Recorded pod from namespace that wasn't watched")
+	}
+}
@@ -0,0 +1,343 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"os"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory"
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/dbmanager/mysql"
+	"github.com/netapp/kubevoltracker/loadgen"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// The ordering fuzzer checks that the backends are eventually consistent:
+// since the pod, PV, and PVC watches run in separate goroutines, their
+// events can be handled in any interleaving that preserves the order within
+// each stream (e.g., a PV can be bound before its PVC has been added), and
+// every interleaving should leave the backend in the same state as handling
+// the history in order.
+const (
+	orderingHistories   = 20  // Histories to generate for each backend.
+	orderingInterleaves = 5   // Random interleavings of each history.
+	orderingActions     = 150 // Actions in each history.
+
+	// runPlaceholder stands in for the UID prefix and namespace of each run,
+	// which are unique so that runs sharing a database don't collide.
+	runPlaceholder = "ordering-run"
+)
+
+// orderingBackend is a backend checked by the fuzzer.  unavailable, if set,
+// returns why the backend can't be checked, or an empty string if it can.
+// new returns a backend to deliver a run to, and snapshot describes
+// everything the backend has recorded for the run with the given prefix,
+// with the prefix replaced by runPlaceholder.
+type orderingBackend struct {
+	name        string
+	unavailable func() string
+	new         func(t *testing.T) dbmanager.DBManager
+	snapshot    func(t *testing.T, dbm dbmanager.DBManager,
+		prefix string) []string
+}
+
+var orderingBackends = []orderingBackend{
+	{
+		name: "mock",
+		new: func(t *testing.T) dbmanager.DBManager {
+			return mock.New(false)
+		},
+		snapshot: mockSnapshot,
+	},
+	{
+		name: "memory",
+		new: func(t *testing.T) dbmanager.DBManager {
+			m := memory.New()
+			return orderingMemory{m, m.(dbmanager.Querier)}
+		},
+		snapshot: querierSnapshot,
+	},
+	{
+		name: "mysql",
+		unavailable: func() string {
+			if os.Getenv("MYSQL_IP") == "" {
+				return "MYSQL_IP not set"
+			}
+			return ""
+		},
+		new: func(t *testing.T) dbmanager.DBManager {
+			return mysql.NewForDB("root", "root", os.Getenv("MYSQL_IP"),
+				testDB)
+		},
+		snapshot: querierSnapshot,
+	},
+}
+
+// orderingMemory hides everything but the write and read sides of the
+// in-memory backend from the watcher.  The snapshots don't include
+// revisions, and compressing them would take most of the fuzzer's time.
+type orderingMemory struct {
+	dbmanager.DBManager
+	dbmanager.Querier
+}
+
+// orderingLine is a single event of a generated history.
+type orderingLine struct {
+	resource resources.ResourceType
+	line     string
+}
+
+// generateHistory returns the events for a random history, in order, with
+// runPlaceholder in place of the run's prefix.
+func generateHistory(t *testing.T, seed int64) []orderingLine {
+	gen, err := loadgen.New(loadgen.Config{
+		MaxPVs:    6,
+		MaxPVCs:   5,
+		MaxPods:   4,
+		Namespace: runPlaceholder,
+		Seed:      seed,
+		UIDPrefix: runPlaceholder,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var history []orderingLine
+	for i := 0; i < orderingActions; i++ {
+		for _, e := range gen.Next() {
+			line, err := encodeLoadEvent(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			history = append(history, orderingLine{e.Resource, line})
+		}
+	}
+	return history
+}
+
+// interleave returns a random interleaving of the per-resource streams in
+// history, preserving the order of events within each stream.  Every
+// interleaving is equally likely.
+func interleave(history []orderingLine, rng *rand.Rand) []orderingLine {
+	streams := make(map[resources.ResourceType][]orderingLine)
+	for _, l := range history {
+		streams[l.resource] = append(streams[l.resource], l)
+	}
+	order := []resources.ResourceType{resources.Pods, resources.PVs,
+		resources.PVCs}
+	ret := make([]orderingLine, 0, len(history))
+	for remaining := len(history); remaining > 0; remaining-- {
+		// Choose a stream with probability proportional to its length.
+		n := rng.Intn(remaining)
+		for _, r := range order {
+			if n < len(streams[r]) {
+				ret = append(ret, streams[r][0])
+				streams[r] = streams[r][1:]
+				break
+			}
+			n -= len(streams[r])
+		}
+	}
+	return ret
+}
+
+// deliver hands each line of history, with runPlaceholder replaced by
+// prefix, to the handlers of a Watcher writing to dbm.
+func deliver(t *testing.T, dbm dbmanager.DBManager,
+	history []orderingLine, prefix string) {
+
+	w := newReplayWatcher(dbm)
+	for _, l := range history {
+		line := strings.Replace(l.line, runPlaceholder, prefix, -1)
+		ok, err := w.handleLine(l.resource, "", line,
+			receipt{time: time.Now()})
+		if err != nil || !ok {
+			t.Fatalf("Unable to handle %s event (%v):  %s", l.resource, err,
+				line)
+		}
+	}
+}
+
+// normalize sorts lines and replaces prefix with runPlaceholder.
+func normalize(lines []string, prefix string) []string {
+	for i, l := range lines {
+		lines[i] = strings.Replace(l, prefix, runPlaceholder, -1)
+	}
+	sort.Strings(lines)
+	return lines
+}
+
+// mockSnapshot describes the resources held by a MockManager.
+func mockSnapshot(t *testing.T, dbm dbmanager.DBManager,
+	prefix string) []string {
+
+	m := dbm.(*mock.MockManager)
+	lines := []string{fmt.Sprintf("deletions %d", m.Deletions)}
+	for _, attrs := range m.PodForUID {
+		lines = append(lines, fmt.Sprintf("pod %+v", *attrs.(*mock.PodAttrs)))
+	}
+	for _, attrs := range m.PVForUID {
+		lines = append(lines, fmt.Sprintf("pv %+v", *attrs.(*mock.PVAttrs)))
+	}
+	for _, attrs := range m.PVCForUID {
+		lines = append(lines, fmt.Sprintf("pvc %+v",
+			*attrs.(*mock.PVCAttrs)))
+	}
+	return normalize(lines, prefix)
+}
+
+// querierSnapshot describes the records that a backend implementing
+// dbmanager.Querier holds for the run with the given prefix.  Bind times are
+// left out, since the watcher records the time at which it handles a bind,
+// and volume sources are identified by their contents, not their IDs.
+func querierSnapshot(t *testing.T, dbm dbmanager.DBManager,
+	prefix string) []string {
+
+	q := dbm.(dbmanager.Querier)
+	var lines []string
+	fail := func(err error) {
+		if err != nil {
+			t.Fatal("Unable to query backend: ", err)
+		}
+	}
+
+	nfs, err := q.ListNFS()
+	fail(err)
+	iscsi, err := q.ListISCSI()
+	fail(err)
+	sources := make(map[string]string)
+	for _, n := range nfs {
+		sources[fmt.Sprintf("%s/%d", dbmanager.NFS, n.ID)] =
+			fmt.Sprintf("nfs %s:%s", n.Server, n.Path)
+	}
+	for _, i := range iscsi {
+		sources[fmt.Sprintf("%s/%d", dbmanager.ISCSI, i.ID)] =
+			fmt.Sprintf("iscsi %s %s %d", i.TargetPortal, i.IQN, i.LUN)
+	}
+
+	pvs, err := q.ListPVs()
+	fail(err)
+	for _, pv := range pvs {
+		if !strings.HasPrefix(string(pv.UID), prefix+"-") {
+			continue
+		}
+		source := sources[fmt.Sprintf("%s/%d", pv.BackendType,
+			pv.BackendID)]
+		pv.BackendID = 0
+		lines = append(lines, fmt.Sprintf("pv %+v on %s", pv, source))
+	}
+	pvcs, err := q.ListPVCs()
+	fail(err)
+	for _, pvc := range pvcs {
+		if !strings.HasPrefix(string(pvc.UID), prefix+"-") {
+			continue
+		}
+		bound := !pvc.BindTime.IsZero()
+		pvc.BindTime = time.Time{}
+		lines = append(lines, fmt.Sprintf("pvc %+v bound %t", pvc, bound))
+	}
+	mounts, err := q.ListPodMounts()
+	fail(err)
+	for _, m := range mounts {
+		if strings.HasPrefix(string(m.PodUID), prefix+"-") {
+			lines = append(lines, fmt.Sprintf("mount %+v", m))
+		}
+	}
+	containers, err := q.ListContainers()
+	fail(err)
+	for _, c := range containers {
+		if strings.HasPrefix(string(c.PodUID), prefix+"-") {
+			lines = append(lines, fmt.Sprintf("container %+v", c))
+		}
+	}
+	return normalize(lines, prefix)
+}
+
+// diffSnapshots returns a description of the lines that appear in only one
+// of expected and got, which must be sorted.
+func diffSnapshots(expected, got []string) string {
+	var diff []string
+	i, j := 0, 0
+	for i < len(expected) || j < len(got) {
+		switch {
+		case j == len(got) || (i < len(expected) && expected[i] < got[j]):
+			diff = append(diff, "- "+expected[i])
+			i++
+		case i == len(expected) || got[j] < expected[i]:
+			diff = append(diff, "+ "+got[j])
+			j++
+		default:
+			i++
+			j++
+		}
+	}
+	return strings.Join(diff, "\n")
+}
+
+func TestEventOrdering(t *testing.T) {
+	for _, backend := range orderingBackends {
+		if backend.unavailable != nil {
+			if reason := backend.unavailable(); reason != "" {
+				t.Logf("Skipping %s:  %s", backend.name, reason)
+				continue
+			}
+		}
+		for seed := int64(1); seed <= orderingHistories; seed++ {
+			if !checkOrdering(t, backend, seed) {
+				break
+			}
+		}
+	}
+}
+
+// checkOrdering delivers the history generated from seed to backend in
+// order and in several random interleavings, checking that each
+// interleaving leaves the backend in the same state.  It returns false at
+// the first interleaving that doesn't.
+func checkOrdering(t *testing.T, backend orderingBackend, seed int64) bool {
+	history := generateHistory(t, seed)
+	// Make prefixes unique across test runs, in case the backend is
+	// persistent.
+	base := fmt.Sprintf("ordering-%d-%d", time.Now().UnixNano(), seed)
+
+	prefix := base + "-in-order"
+	dbm := backend.new(t)
+	deliver(t, dbm, history, prefix)
+	expected := backend.snapshot(t, dbm, prefix)
+	dbm.Destroy()
+
+	rng := rand.New(rand.NewSource(seed))
+	for i := 0; i < orderingInterleaves; i++ {
+		prefix = fmt.Sprintf("%s-%d", base, i)
+		dbm = backend.new(t)
+		deliver(t, dbm, interleave(history, rng), prefix)
+		got := backend.snapshot(t, dbm, prefix)
+		dbm.Destroy()
+		if diff := diffSnapshots(expected, got); diff != "" {
+			t.Errorf("Interleaving %d of history %d differs from the "+
+				"in-order state on %s:\n%s", i, seed, backend.name, diff)
+			return false
+		}
+	}
+	return true
+}
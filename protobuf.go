@@ -0,0 +1,797 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/api/resource"
+	"k8s.io/kubernetes/pkg/api/unversioned"
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+/* The API server can send watches as protobuf rather than JSON, which is far
+   cheaper to parse.  The stream is a series of frames, each a 4-byte
+   big-endian length followed by a watch event (type = 1, object = 2), whose
+   object is a RawExtension (raw = 1).  The raw object is the protobuf magic
+   number followed by a runtime.Unknown (typeMeta = 1, raw = 2,
+   contentEncoding = 3), which holds the object's kind and its encoding as a
+   versioned (v1) API object.  Status responses to requests use the same
+   envelope.
+
+   The internal API types we decode into have no protobuf encoding of their
+   own, so rather than pull in the versioned types and the conversions
+   between them, the decoders below read only the fields that the tracker
+   uses, by their field numbers in the v1 types.  Everything else is
+   skipped. */
+
+const (
+	protobufContentType = "application/vnd.kubernetes.protobuf"
+	// protobufAccept asks for protobuf, falling back to JSON on API servers
+	// that don't support it.
+	protobufAccept = protobufContentType + ", application/json"
+
+	// maxFrameSize bounds the size of a single protobuf watch event, so that
+	// a corrupt length doesn't exhaust memory.
+	maxFrameSize = 16 * 1024 * 1024
+)
+
+var protobufMagic = []byte("k8s\x00")
+
+// protobufKinds maps each resource type to the kind of the objects in its
+// watches.
+var protobufKinds = map[resources.ResourceType]string{
+	resources.Pods: "Pod",
+	resources.PVs:  "PersistentVolume",
+	resources.PVCs: "PersistentVolumeClaim",
+}
+
+// isProtobuf returns whether resp is encoded as protobuf.  Anything else is
+// taken to be JSON.
+func isProtobuf(resp *http.Response) bool {
+	mediaType, _, err := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	return err == nil && mediaType == protobufContentType
+}
+
+// protobufStream decodes the events in a protobuf watch stream on a single
+// resource into pooled events.  Since the tracker stores and records the
+// JSON of each event, the decoded event is encoded as JSON, which, unlike
+// that from a JSON watch, only holds the fields that were decoded.
+type protobufStream struct {
+	resource resources.ResourceType
+	r        io.Reader
+	header   [4]byte
+	frame    []byte
+	line     bytes.Buffer
+	encoder  *json.Encoder
+}
+
+func newProtobufStream(resource resources.ResourceType,
+	r io.Reader) *protobufStream {
+
+	s := &protobufStream{resource: resource, r: r}
+	s.encoder = json.NewEncoder(&s.line)
+	return s
+}
+
+// next returns the next event in the stream, as eventStream.next does.  A
+// frame that can't be decoded ends the stream, as one that can't be read
+// does.
+func (s *protobufStream) next() (WatchEvent, []byte) {
+	if err := s.readFrame(); err != nil {
+		return WatchEvent{Err: err}, nil
+	}
+	eventType, object, err := decodeWatchFrame(s.frame)
+	if err != nil {
+		return s.fail(err)
+	}
+	meta, object, err := decodeUnknown(object)
+	if err != nil {
+		return s.fail(err)
+	}
+	if meta.Kind == "Status" {
+		status := unversioned.Status{TypeMeta: meta}
+		if err = decodeStatusProto(object, &status); err != nil {
+			return s.fail(err)
+		}
+		line, err := s.encode(StatusMessage{Type: eventType, Status: status})
+		if err != nil {
+			return s.fail(err)
+		}
+		return WatchEvent{Err: newStatusError(status), JSON: string(line)},
+			line
+	}
+	if meta.Kind != protobufKinds[s.resource] {
+		return s.fail(fmt.Errorf("Unexpected kind %s", meta.Kind))
+	}
+
+	e := getEvent(s.resource)
+	if err = decodeEvent(e, eventType, meta, object); err != nil {
+		releaseEvent(s.resource, e)
+		return s.fail(err)
+	}
+	line, err := s.encode(e)
+	if err != nil {
+		releaseEvent(s.resource, e)
+		return s.fail(err)
+	}
+	return finishEvent(s.resource, e, nil, line), line
+}
+
+func (s *protobufStream) fail(err error) (WatchEvent, []byte) {
+	return WatchEvent{Err: fmt.Errorf("Unable to decode protobuf for %s:  %s",
+		s.resource, err)}, nil
+}
+
+// readFrame reads the next frame of the stream into s.frame, reusing its
+// space.
+func (s *protobufStream) readFrame() error {
+	if _, err := io.ReadFull(s.r, s.header[:]); err != nil {
+		return err
+	}
+	size := binary.BigEndian.Uint32(s.header[:])
+	if size > maxFrameSize {
+		return fmt.Errorf("Frame of %d bytes exceeds the limit of %d",
+			size, maxFrameSize)
+	}
+	if cap(s.frame) < int(size) {
+		s.frame = make([]byte, size)
+	}
+	s.frame = s.frame[:size]
+	if _, err := io.ReadFull(s.r, s.frame); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	return nil
+}
+
+// encode returns the JSON of v, which is only valid until the next call.
+func (s *protobufStream) encode(v interface{}) ([]byte, error) {
+	s.line.Reset()
+	if err := s.encoder.Encode(v); err != nil {
+		return nil, err
+	}
+	return bytes.TrimSpace(s.line.Bytes()), nil
+}
+
+// partialJSONStores returns the stores that would only hold the JSON of
+// the fields decoded from protobuf, rather than that of the whole objects,
+// when watches are sent as protobuf:  dbm's pod, PV, and PVC records, if it
+// can read them back, its revisions and event log, if it keeps them, and
+// the recordings, if recording.
+func partialJSONStores(dbm dbmanager.DBManager, recording bool) []string {
+	var stores []string
+
+	if _, ok := dbm.(dbmanager.Querier); ok {
+		stores = append(stores, "pod, PV, and PVC records")
+	}
+	if _, ok := dbm.(dbmanager.RevisionStore); ok {
+		stores = append(stores, "revisions")
+	}
+	if _, ok := dbm.(dbmanager.EventLog); ok {
+		stores = append(stores, "event log")
+	}
+	if recording {
+		stores = append(stores, "recordings")
+	}
+	return stores
+}
+
+// decodeProtobufStatus returns the Status object in the body of a protobuf
+// response, or nil if it doesn't hold one.
+func decodeProtobufStatus(body []byte) *StatusError {
+	meta, object, err := decodeUnknown(body)
+	if err != nil || meta.Kind != "Status" {
+		return nil
+	}
+	status := unversioned.Status{TypeMeta: meta}
+	if decodeStatusProto(object, &status) != nil {
+		return nil
+	}
+	return newStatusError(status)
+}
+
+// protoField is a single field of a protobuf message.  Varints are held in
+// v and length-delimited fields (strings and embedded messages) in data,
+// which points into the message.  None of the fields we decode are of the
+// fixed-width types, so their values are skipped.
+type protoField struct {
+	num  int
+	v    uint64
+	data []byte
+}
+
+func (f protoField) str() string { return string(f.data) }
+
+var errTruncated = errors.New("Truncated protobuf message")
+
+// eachField calls fn with each field of the protobuf message in b, in order,
+// stopping at the first error.
+func eachField(b []byte, fn func(protoField) error) error {
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		if n <= 0 {
+			return errTruncated
+		}
+		b = b[n:]
+		f := protoField{num: int(key >> 3)}
+		switch key & 7 {
+		case 0: // varint
+			if f.v, n = binary.Uvarint(b); n <= 0 {
+				return errTruncated
+			}
+			b = b[n:]
+		case 1: // 64-bit
+			if len(b) < 8 {
+				return errTruncated
+			}
+			b = b[8:]
+		case 2: // length-delimited
+			size, n := binary.Uvarint(b)
+			if n <= 0 || size > uint64(len(b)-n) {
+				return errTruncated
+			}
+			f.data = b[n : n+int(size)]
+			b = b[n+int(size):]
+		case 5: // 32-bit
+			if len(b) < 4 {
+				return errTruncated
+			}
+			b = b[4:]
+		default:
+			return fmt.Errorf("Unsupported protobuf wire type %d", key&7)
+		}
+		if err := fn(f); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeWatchFrame returns the type of the watch event in a frame and the
+// raw object it carries.
+func decodeWatchFrame(b []byte) (EventType, []byte, error) {
+	var (
+		eventType EventType
+		object    []byte
+	)
+	err := eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1: // type
+			eventType = EventType(f.str())
+		case 2: // object
+			return eachField(f.data, func(f protoField) error {
+				if f.num == 1 { // raw
+					object = f.data
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+	return eventType, object, err
+}
+
+// decodeUnknown strips the envelope from an object encoded by the API
+// server, returning the object's type and encoding.
+func decodeUnknown(b []byte) (unversioned.TypeMeta, []byte, error) {
+	var (
+		meta   unversioned.TypeMeta
+		object []byte
+	)
+	if !bytes.HasPrefix(b, protobufMagic) {
+		return meta, nil, errors.New("Object is missing the protobuf prefix")
+	}
+	err := eachField(b[len(protobufMagic):], func(f protoField) error {
+		switch f.num {
+		case 1: // typeMeta
+			return eachField(f.data, func(f protoField) error {
+				switch f.num {
+				case 1:
+					meta.APIVersion = f.str()
+				case 2:
+					meta.Kind = f.str()
+				}
+				return nil
+			})
+		case 2: // raw
+			object = f.data
+		case 3: // contentEncoding
+			if len(f.data) > 0 {
+				return fmt.Errorf("Unsupported content encoding %s",
+					f.str())
+			}
+		}
+		return nil
+	})
+	return meta, object, err
+}
+
+// decodeEvent decodes a watch event's object into e, a pooled event.
+func decodeEvent(e ResourceEvent, eventType EventType,
+	meta unversioned.TypeMeta, b []byte) error {
+
+	switch e := e.(type) {
+	case *PodEvent:
+		e.Type, e.Resource.TypeMeta = eventType, meta
+		return decodePod(b, &e.Resource)
+	case *PVEvent:
+		e.Type, e.Resource.TypeMeta = eventType, meta
+		return decodePV(b, &e.Resource)
+	case *PVCEvent:
+		e.Type, e.Resource.TypeMeta = eventType, meta
+		return decodePVC(b, &e.Resource)
+	}
+	return fmt.Errorf("Unable to decode protobuf into %T", e)
+}
+
+func decodeStatusProto(b []byte, s *unversioned.Status) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 2:
+			s.Status = f.str()
+		case 3:
+			s.Message = f.str()
+		case 4:
+			s.Reason = unversioned.StatusReason(f.str())
+		case 6:
+			s.Code = int32(f.v)
+		}
+		return nil
+	})
+}
+
+func decodeObjectMeta(b []byte, m *api.ObjectMeta) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			m.Name = f.str()
+		case 2:
+			m.GenerateName = f.str()
+		case 3:
+			m.Namespace = f.str()
+		case 4:
+			m.SelfLink = f.str()
+		case 5:
+			m.UID = types.UID(f.str())
+		case 6:
+			m.ResourceVersion = f.str()
+		case 7:
+			m.Generation = int64(f.v)
+		case 8:
+			return decodeTime(f.data, &m.CreationTimestamp)
+		case 9:
+			m.DeletionTimestamp = new(unversioned.Time)
+			return decodeTime(f.data, m.DeletionTimestamp)
+		case 10:
+			seconds := int64(f.v)
+			m.DeletionGracePeriodSeconds = &seconds
+		case 11:
+			return decodeStringMap(f.data, &m.Labels)
+		case 12:
+			return decodeStringMap(f.data, &m.Annotations)
+		}
+		return nil
+	})
+}
+
+func decodeTime(b []byte, t *unversioned.Time) error {
+	var seconds, nanos int64
+	err := eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			seconds = int64(f.v)
+		case 2:
+			nanos = int64(int32(f.v))
+		}
+		return nil
+	})
+	t.Time = time.Unix(seconds, nanos)
+	return err
+}
+
+// decodeMapEntry returns the key and value of a single map entry.
+func decodeMapEntry(b []byte) (string, []byte, error) {
+	var (
+		key   string
+		value []byte
+	)
+	err := eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			key = f.str()
+		case 2:
+			value = f.data
+		}
+		return nil
+	})
+	return key, value, err
+}
+
+func decodeStringMap(b []byte, m *map[string]string) error {
+	key, value, err := decodeMapEntry(b)
+	if err != nil {
+		return err
+	}
+	if *m == nil {
+		*m = make(map[string]string)
+	}
+	(*m)[key] = string(value)
+	return nil
+}
+
+func decodeResourceList(b []byte, l *api.ResourceList) error {
+	key, value, err := decodeMapEntry(b)
+	if err != nil {
+		return err
+	}
+	var quantity string
+	err = eachField(value, func(f protoField) error {
+		if f.num == 1 {
+			quantity = f.str()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	q, err := resource.ParseQuantity(quantity)
+	if err != nil {
+		return err
+	}
+	if *l == nil {
+		*l = make(api.ResourceList)
+	}
+	(*l)[api.ResourceName(key)] = q
+	return nil
+}
+
+func decodePod(b []byte, p *api.Pod) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return decodeObjectMeta(f.data, &p.ObjectMeta)
+		case 2:
+			return decodePodSpec(f.data, &p.Spec)
+		case 3:
+			return decodePodStatus(f.data, &p.Status)
+		}
+		return nil
+	})
+}
+
+func decodePodSpec(b []byte, s *api.PodSpec) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			var v api.Volume
+			if err := decodeVolume(f.data, &v); err != nil {
+				return err
+			}
+			s.Volumes = append(s.Volumes, v)
+		case 2:
+			var c api.Container
+			if err := decodeContainer(f.data, &c); err != nil {
+				return err
+			}
+			s.Containers = append(s.Containers, c)
+		case 3:
+			s.RestartPolicy = f.str()
+		case 5:
+			seconds := int64(f.v)
+			s.ActiveDeadlineSeconds = &seconds
+		case 10:
+			s.NodeName = f.str()
+		}
+		return nil
+	})
+}
+
+func decodeVolume(b []byte, v *api.Volume) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			v.Name = f.str()
+		case 2:
+			return decodeVolumeSource(f.data, &v.VolumeSource)
+		}
+		return nil
+	})
+}
+
+func decodeVolumeSource(b []byte, s *api.VolumeSource) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			s.HostPath = new(api.HostPathVolumeSource)
+			return decodeHostPath(f.data, s.HostPath)
+		case 2:
+			s.EmptyDir = new(api.EmptyDirVolumeSource)
+		case 7:
+			s.NFS = new(api.NFSVolumeSource)
+			return decodeNFS(f.data, s.NFS)
+		case 8:
+			s.ISCSI = new(api.ISCSIVolumeSource)
+			return decodeISCSI(f.data, s.ISCSI)
+		case 10:
+			s.PersistentVolumeClaim =
+				new(api.PersistentVolumeClaimVolumeSource)
+			return eachField(f.data, func(f protoField) error {
+				switch f.num {
+				case 1:
+					s.PersistentVolumeClaim.ClaimName = f.str()
+				case 2:
+					s.PersistentVolumeClaim.ReadOnly = f.v != 0
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func decodeHostPath(b []byte, s *api.HostPathVolumeSource) error {
+	return eachField(b, func(f protoField) error {
+		if f.num == 1 {
+			s.Path = f.str()
+		}
+		return nil
+	})
+}
+
+func decodeNFS(b []byte, s *api.NFSVolumeSource) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			s.Server = f.str()
+		case 2:
+			s.Path = f.str()
+		case 3:
+			s.ReadOnly = f.v != 0
+		}
+		return nil
+	})
+}
+
+func decodeISCSI(b []byte, s *api.ISCSIVolumeSource) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			s.TargetPortal = f.str()
+		case 2:
+			s.IQN = f.str()
+		case 3:
+			s.Lun = int32(f.v)
+		case 4:
+			s.ISCSIInterface = f.str()
+		case 5:
+			s.FSType = f.str()
+		case 6:
+			s.ReadOnly = f.v != 0
+		}
+		return nil
+	})
+}
+
+func decodeContainer(b []byte, c *api.Container) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			c.Name = f.str()
+		case 2:
+			c.Image = f.str()
+		case 3:
+			c.Command = append(c.Command, f.str())
+		case 4:
+			c.Args = append(c.Args, f.str())
+		case 5:
+			c.WorkingDir = f.str()
+		case 9:
+			var m api.VolumeMount
+			err := eachField(f.data, func(f protoField) error {
+				switch f.num {
+				case 1:
+					m.Name = f.str()
+				case 2:
+					m.ReadOnly = f.v != 0
+				case 3:
+					m.MountPath = f.str()
+				case 4:
+					m.SubPath = f.str()
+				}
+				return nil
+			})
+			if err != nil {
+				return err
+			}
+			c.VolumeMounts = append(c.VolumeMounts, m)
+		}
+		return nil
+	})
+}
+
+func decodePodStatus(b []byte, s *api.PodStatus) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			s.Phase = api.PodPhase(f.str())
+		case 3:
+			s.Message = f.str()
+		case 4:
+			s.Reason = f.str()
+		case 5:
+			s.HostIP = f.str()
+		case 6:
+			s.PodIP = f.str()
+		case 7:
+			s.StartTime = new(unversioned.Time)
+			return decodeTime(f.data, s.StartTime)
+		}
+		return nil
+	})
+}
+
+func decodePV(b []byte, p *api.PersistentVolume) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return decodeObjectMeta(f.data, &p.ObjectMeta)
+		case 2:
+			return decodePVSpec(f.data, &p.Spec)
+		case 3:
+			return eachField(f.data, func(f protoField) error {
+				switch f.num {
+				case 1:
+					p.Status.Phase = api.PersistentVolumePhase(f.str())
+				case 2:
+					p.Status.Message = f.str()
+				case 3:
+					p.Status.Reason = f.str()
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func decodePVSpec(b []byte, s *api.PersistentVolumeSpec) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return decodeResourceList(f.data, &s.Capacity)
+		case 2:
+			return decodePVSource(f.data, &s.PersistentVolumeSource)
+		case 3:
+			s.AccessModes = append(s.AccessModes,
+				api.PersistentVolumeAccessMode(f.str()))
+		case 4:
+			s.ClaimRef = new(api.ObjectReference)
+			return decodeObjectReference(f.data, s.ClaimRef)
+		case 5:
+			s.PersistentVolumeReclaimPolicy =
+				api.PersistentVolumeReclaimPolicy(f.str())
+		}
+		return nil
+	})
+}
+
+func decodePVSource(b []byte, s *api.PersistentVolumeSource) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 3:
+			s.HostPath = new(api.HostPathVolumeSource)
+			return decodeHostPath(f.data, s.HostPath)
+		case 5:
+			s.NFS = new(api.NFSVolumeSource)
+			return decodeNFS(f.data, s.NFS)
+		case 7:
+			s.ISCSI = new(api.ISCSIVolumeSource)
+			return decodeISCSI(f.data, s.ISCSI)
+		}
+		return nil
+	})
+}
+
+func decodeObjectReference(b []byte, r *api.ObjectReference) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			r.Kind = f.str()
+		case 2:
+			r.Namespace = f.str()
+		case 3:
+			r.Name = f.str()
+		case 4:
+			r.UID = types.UID(f.str())
+		case 5:
+			r.APIVersion = f.str()
+		case 6:
+			r.ResourceVersion = f.str()
+		case 7:
+			r.FieldPath = f.str()
+		}
+		return nil
+	})
+}
+
+func decodePVC(b []byte, p *api.PersistentVolumeClaim) error {
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return decodeObjectMeta(f.data, &p.ObjectMeta)
+		case 2:
+			return eachField(f.data, func(f protoField) error {
+				switch f.num {
+				case 1:
+					p.Spec.AccessModes = append(p.Spec.AccessModes,
+						api.PersistentVolumeAccessMode(f.str()))
+				case 2:
+					return decodeResourceRequirements(f.data,
+						&p.Spec.Resources)
+				case 3:
+					p.Spec.VolumeName = f.str()
+				}
+				return nil
+			})
+		case 3:
+			return eachField(f.data, func(f protoField) error {
+				switch f.num {
+				case 1:
+					p.Status.Phase =
+						api.PersistentVolumeClaimPhase(f.str())
+				case 2:
+					p.Status.AccessModes = append(p.Status.AccessModes,
+						api.PersistentVolumeAccessMode(f.str()))
+				case 3:
+					return decodeResourceList(f.data,
+						&p.Status.Capacity)
+				}
+				return nil
+			})
+		}
+		return nil
+	})
+}
+
+func decodeResourceRequirements(b []byte,
+	r *api.ResourceRequirements) error {
+
+	return eachField(b, func(f protoField) error {
+		switch f.num {
+		case 1:
+			return decodeResourceList(f.data, &r.Limits)
+		case 2:
+			return decodeResourceList(f.data, &r.Requests)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,276 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory"
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// The fixtures in testdata hold the same watch streams as protobuf frames
+// and as JSON lines, so that each protobuf event can be checked against the
+// event decoded from its JSON.  The watch-*.pb fixtures only use fields that
+// the protobuf decoders read.  The watch-*-full.pb fixtures were encoded from
+// the JSON fixtures by the API server's own serializer (k8s.io/apimachinery
+// v0.34.1), after adding fields that a current API server fills in and the
+// decoders don't read, such as managed fields, tolerations, container ports
+// and statuses, and storage classes.  They weren't captured from a live
+// cluster.
+
+func readFixture(t *testing.T, name string) []byte {
+	data, err := ioutil.ReadFile(filepath.Join("testdata", name))
+	if err != nil {
+		t.Fatal("Unable to read fixture:  ", err)
+	}
+	return data
+}
+
+func fixtureLines(t *testing.T, name string) [][]byte {
+	var lines [][]byte
+	scanner := bufio.NewScanner(bytes.NewReader(readFixture(t, name)))
+	for scanner.Scan() {
+		lines = append(lines, append([]byte(nil), scanner.Bytes()...))
+	}
+	return lines
+}
+
+// checkEvent checks that got is the same event as want, or reports the same
+// Status error.
+func checkEvent(t *testing.T, got, want WatchEvent) {
+	if want.Err != nil {
+		if !reflect.DeepEqual(got.Err, want.Err) {
+			t.Errorf("Expected %v; got %v", want.Err, got.Err)
+		}
+		return
+	}
+	if got.Err != nil {
+		t.Fatal("Unable to decode event:  ", got.Err)
+	}
+	if !reflect.DeepEqual(got.JSONEvent, want.JSONEvent) {
+		t.Errorf("Expected %v; got %v", want.JSONEvent, got.JSONEvent)
+	}
+}
+
+func TestProtobufStream(t *testing.T) {
+	for _, resource := range []resources.ResourceType{resources.Pods,
+		resources.PVs, resources.PVCs} {
+
+		checkProtobufStream(t, resource, "watch-"+string(resource)+".pb")
+	}
+}
+
+// TestProtobufStreamSkipsUnknown checks that fields the decoders don't read
+// leave the decoded events unchanged.
+func TestProtobufStreamSkipsUnknown(t *testing.T) {
+	for _, resource := range []resources.ResourceType{resources.Pods,
+		resources.PVs, resources.PVCs} {
+
+		name := "watch-" + string(resource)
+		full, minimal := readFixture(t, name+"-full.pb"),
+			readFixture(t, name+".pb")
+		if len(full) <= len(minimal) {
+			t.Errorf("Expected %s-full.pb to hold more fields than %s.pb",
+				name, name)
+		}
+		checkProtobufStream(t, resource, name+"-full.pb")
+	}
+}
+
+// checkProtobufStream checks that each event in the protobuf fixture name
+// matches the event in resource's JSON fixture, and that the JSON kept for
+// it holds everything that was decoded.
+func checkProtobufStream(t *testing.T, resource resources.ResourceType,
+	name string) {
+
+	lines := fixtureLines(t, "watch-"+string(resource)+".json")
+	stream := newProtobufStream(resource, bytes.NewReader(
+		readFixture(t, name)))
+	for _, line := range lines {
+		got, gotLine := stream.next()
+		checkEvent(t, got, decodeWatchLine(resource, line))
+		if gotLine == nil {
+			t.Fatalf("No JSON for %s event", name)
+		}
+		checkEvent(t, decodeWatchLine(resource, gotLine), got)
+		if got.JSON != string(gotLine) {
+			t.Errorf("Expected JSON %s; got %s", gotLine, got.JSON)
+		}
+	}
+	if e, line := stream.next(); e.Err != io.EOF || line != nil {
+		t.Errorf("Expected the end of %s; got %v", name, e.Err)
+	}
+}
+
+func TestProtobufStreamErrors(t *testing.T) {
+	pods := readFixture(t, "watch-pods.pb")
+	for _, test := range []struct {
+		name     string
+		resource resources.ResourceType
+		data     []byte
+	}{
+		{"truncated", resources.Pods, pods[:len(pods)/2]},
+		{"wrong kind", resources.PVs, pods},
+		{"oversized", resources.Pods, []byte{0xff, 0xff, 0xff, 0xff}},
+		{"not protobuf", resources.Pods,
+			[]byte("\x00\x00\x00\x08{\"type\":}")},
+	} {
+		stream := newProtobufStream(test.resource, bytes.NewReader(test.data))
+		e, line := stream.next()
+		for e.Err == nil {
+			e, line = stream.next()
+		}
+		if e.Err == io.EOF || line != nil {
+			t.Errorf("%s:  Expected a decoding error; got %v", test.name,
+				e.Err)
+		}
+	}
+}
+
+func TestEachFieldSkipsUnknown(t *testing.T) {
+	// A container with an unknown field of each wire type, followed by its
+	// name.
+	b := []byte{
+		0xa8, 0x06, 0x96, 0x01, // field 101, varint
+		0xb1, 0x06, 1, 2, 3, 4, 5, 6, 7, 8, // field 102, 64-bit
+		0xba, 0x06, 2, 'h', 'i', // field 103, length-delimited
+		0xc5, 0x06, 1, 2, 3, 4, // field 104, 32-bit
+		0x0a, 5, 'n', 'g', 'i', 'n', 'x', // name
+	}
+	var c struct{ Name string }
+	err := eachField(b, func(f protoField) error {
+		if f.num == 1 {
+			c.Name = f.str()
+		}
+		return nil
+	})
+	if err != nil || c.Name != "nginx" {
+		t.Errorf("Expected nginx; got %s, %v", c.Name, err)
+	}
+	if err = eachField(b[:len(b)-1], func(protoField) error {
+		return nil
+	}); err != errTruncated {
+		t.Error("Expected a truncated message; got ", err)
+	}
+}
+
+// TestWatchProtobuf checks that Watch asks for protobuf only when it's set
+// to, and decodes whichever format the API server sends.
+func TestWatchProtobuf(t *testing.T) {
+	var accepts []string
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			accept := r.Header.Get("Accept")
+			accepts = append(accepts, accept)
+			switch {
+			case strings.Contains(r.URL.Path, "persistentvolumes"):
+				// An API server that can't send protobuf.
+				rw.Header().Set("Content-Type", "application/json")
+				rw.Write(readFixture(t, "watch-persistentvolumes.json"))
+			case strings.Contains(accept, protobufContentType):
+				rw.Header().Set("Content-Type",
+					protobufContentType+";stream=watch")
+				rw.Write(readFixture(t, "watch-pods.pb"))
+			default:
+				rw.Header().Set("Content-Type", "application/json")
+				rw.Write(readFixture(t, "watch-pods.json"))
+			}
+		}))
+	defer server.Close()
+
+	a, err := NewAPIClient(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, test := range []struct {
+		protobuf bool
+		resource resources.ResourceType
+	}{
+		{false, resources.Pods},
+		{true, resources.Pods},
+		{true, resources.PVs},
+	} {
+		a.protobuf = test.protobuf
+		lines := fixtureLines(t, "watch-"+string(test.resource)+".json")
+		events, done := a.Watch(test.resource, "", "", WatchOptions{})
+		if e := <-events; !e.Opened {
+			t.Fatal("Expected the watch to open; got ", e.Err)
+		}
+		for _, line := range lines {
+			checkEvent(t, <-events, decodeWatchLine(test.resource, line))
+		}
+		if e, ok := <-events; ok && e.Err != io.EOF {
+			t.Error("Expected the end of the watch; got ", e.Err)
+		}
+		close(done)
+	}
+	if accepts[0] != "" || accepts[1] != protobufAccept ||
+		accepts[2] != protobufAccept {
+		t.Error("Expected protobuf to be requested when set; got ", accepts)
+	}
+}
+
+func TestProtobufStatusResponse(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(
+		func(rw http.ResponseWriter, r *http.Request) {
+			rw.Header().Set("Content-Type", protobufContentType)
+			rw.WriteHeader(StatusTooOld)
+			rw.Write(readFixture(t, "status-expired.pb"))
+		}))
+	defer server.Close()
+
+	a, err := NewAPIClient(strings.TrimPrefix(server.URL, "http://"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a.protobuf = true
+	events, done := a.Watch(resources.PVs, "", "2004", WatchOptions{})
+	defer close(done)
+	e := <-events
+	statusErr, ok := e.Err.(*StatusError)
+	if !ok || statusErr.Code != StatusTooOld ||
+		statusErr.Reason != unversioned.StatusReasonExpired {
+		t.Error("Expected an expired status; got ", e.Err)
+	}
+}
+
+func TestPartialJSONStores(t *testing.T) {
+	stores := strings.Join(partialJSONStores(memory.New(), true), ", ")
+	if stores != "pod, PV, and PVC records, revisions, event log, "+
+		"recordings" {
+		t.Error("Expected every store to be reported; got ", stores)
+	}
+	// Write-only backends keep no JSON that could be read back.
+	writeOnly := struct{ dbmanager.DBManager }{mock.New(false)}
+	if stores := partialJSONStores(writeOnly, false); stores != nil {
+		t.Error("Expected no stores to be reported; got ", stores)
+	}
+}
@@ -0,0 +1,328 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+// pruneBatch is the number of pods archived and pruned at a time.
+const pruneBatch = 500
+
+// pruneOptions controls prunePods.
+type pruneOptions struct {
+	// Before is the cutoff; pods deleted before it are pruned.
+	Before time.Time
+	// ArchiveDir is the directory in which pruned pods are archived, or
+	// empty to discard them.
+	ArchiveDir string
+	// ArchiveFormat is jsonl or csv.
+	ArchiveFormat string
+}
+
+// validate checks the options that don't depend on there being pods to
+// prune, so that mistakes are caught up front.
+func (opts pruneOptions) validate() error {
+	if opts.ArchiveDir != "" && opts.ArchiveFormat != "jsonl" &&
+		opts.ArchiveFormat != "csv" {
+		return fmt.Errorf("Unknown archive format %s; expected jsonl or "+
+			"csv.", opts.ArchiveFormat)
+	}
+	return nil
+}
+
+// archivedPod is the form of a pod in JSONL archives.
+type archivedPod struct {
+	UID        types.UID           `json:"uid"`
+	Name       string              `json:"name"`
+	Namespace  string              `json:"namespace"`
+	CreateTime time.Time           `json:"create_time"`
+	DeleteTime time.Time           `json:"delete_time"`
+	JSON       string              `json:"json"`
+	Containers []archivedContainer `json:"containers"`
+	Mounts     []archivedMount     `json:"mounts"`
+
+	DeleteTimeSource dbmanager.TimeSource `json:"delete_time_source"`
+}
+
+type archivedContainer struct {
+	Name    string `json:"name"`
+	Image   string `json:"image"`
+	Command string `json:"command"`
+}
+
+type archivedMount struct {
+	ContainerName string    `json:"container_name"`
+	PVCName       string    `json:"pvc_name"`
+	PVCUID        types.UID `json:"pvc_uid,omitempty"`
+	ReadOnly      bool      `json:"read_only"`
+}
+
+// csvHeaders gives the columns of each file in a CSV archive, which has a
+// file per table.
+var csvHeaders = []struct {
+	table   dbmanager.Table
+	columns []string
+}{
+	{dbmanager.Pod, []string{"uid", "name", "namespace", "create_time",
+		"delete_time", "delete_time_source", "json"}},
+	{dbmanager.Container, []string{"pod_uid", "name", "image", "command"}},
+	{dbmanager.PodMount, []string{"pod_uid", "container_name", "pvc_name",
+		"pvc_uid", "read_only"}},
+}
+
+// podArchive writes pruned pods to gzip-compressed files.  A JSONL archive
+// is a single file with a line for each pod, holding its containers and
+// mounts; a CSV archive has a file for each of the pod, container, and
+// pod_mount tables.
+type podArchive struct {
+	files   []*os.File
+	zws     []*gzip.Writer
+	encoder *json.Encoder
+	csvs    []*csv.Writer
+}
+
+// newPodArchive creates the files of an archive in dir, named for the time
+// the archive was started.  Existing archives are never overwritten.
+func newPodArchive(dir, format string, started time.Time) (*podArchive,
+	error) {
+
+	var names []string
+
+	stamp := started.UTC().Format("20060102T150405Z")
+	switch format {
+	case "jsonl":
+		names = []string{"pods-" + stamp + ".jsonl.gz"}
+	case "csv":
+		for _, h := range csvHeaders {
+			names = append(names, fmt.Sprintf("%s-%s.csv.gz", h.table,
+				stamp))
+		}
+	default:
+		return nil, fmt.Errorf("Unknown archive format %s; expected jsonl "+
+			"or csv.", format)
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Unable to create archive directory:  %s",
+			err)
+	}
+
+	a := &podArchive{}
+	for _, name := range names {
+		f, err := os.OpenFile(filepath.Join(dir, name),
+			os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+		if err != nil {
+			a.Close()
+			return nil, fmt.Errorf("Unable to create archive:  %s", err)
+		}
+		zw := gzip.NewWriter(f)
+		a.files = append(a.files, f)
+		a.zws = append(a.zws, zw)
+	}
+	if format == "jsonl" {
+		a.encoder = json.NewEncoder(a.zws[0])
+		return a, nil
+	}
+	for i, h := range csvHeaders {
+		w := csv.NewWriter(a.zws[i])
+		w.Write(h.columns)
+		a.csvs = append(a.csvs, w)
+	}
+	return a, nil
+}
+
+// Write archives pods and flushes them to disk, so that they can safely be
+// pruned once it returns.
+func (a *podArchive) Write(pods []dbmanager.PodRecord) error {
+	for _, p := range pods {
+		var err error
+		if a.encoder != nil {
+			err = a.encoder.Encode(newArchivedPod(p))
+		} else {
+			err = a.writeCSV(p)
+		}
+		if err != nil {
+			return fmt.Errorf("Unable to archive pod %s:  %s", p.UID, err)
+		}
+	}
+	for _, w := range a.csvs {
+		w.Flush()
+		if err := w.Error(); err != nil {
+			return fmt.Errorf("Unable to archive pods:  %s", err)
+		}
+	}
+	for i, zw := range a.zws {
+		if err := zw.Flush(); err != nil {
+			return fmt.Errorf("Unable to archive pods:  %s", err)
+		}
+		if err := a.files[i].Sync(); err != nil {
+			return fmt.Errorf("Unable to archive pods:  %s", err)
+		}
+	}
+	return nil
+}
+
+func newArchivedPod(p dbmanager.PodRecord) archivedPod {
+	ret := archivedPod{
+		UID:        p.UID,
+		Name:       p.Name,
+		Namespace:  p.Namespace,
+		CreateTime: p.CreateTime,
+		DeleteTime: p.DeleteTime,
+		JSON:       p.JSON,
+		Containers: make([]archivedContainer, len(p.Containers)),
+		Mounts:     make([]archivedMount, len(p.Mounts)),
+
+		DeleteTimeSource: p.DeleteTimeSource,
+	}
+	for i, c := range p.Containers {
+		ret.Containers[i] = archivedContainer{Name: c.Name, Image: c.Image,
+			Command: c.Command}
+	}
+	for i, m := range p.Mounts {
+		ret.Mounts[i] = archivedMount{ContainerName: m.ContainerName,
+			PVCName: m.PVCName, PVCUID: m.PVCUID, ReadOnly: m.ReadOnly}
+	}
+	return ret
+}
+
+func (a *podArchive) writeCSV(p dbmanager.PodRecord) error {
+	err := a.csvs[0].Write([]string{string(p.UID), p.Name, p.Namespace,
+		p.CreateTime.Format(time.RFC3339Nano),
+		p.DeleteTime.Format(time.RFC3339Nano), string(p.DeleteTimeSource),
+		p.JSON})
+	if err != nil {
+		return err
+	}
+	for _, c := range p.Containers {
+		err = a.csvs[1].Write([]string{string(p.UID), c.Name, c.Image,
+			c.Command})
+		if err != nil {
+			return err
+		}
+	}
+	for _, m := range p.Mounts {
+		err = a.csvs[2].Write([]string{string(p.UID), m.ContainerName,
+			m.PVCName, string(m.PVCUID), strconv.FormatBool(m.ReadOnly)})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Close finishes the archive's files.  Its error must be checked, since the
+// files are only complete once the gzip streams have been closed.
+func (a *podArchive) Close() error {
+	var ret error
+
+	for i, f := range a.files {
+		if err := a.zws[i].Close(); err != nil && ret == nil {
+			ret = err
+		}
+		if err := f.Close(); err != nil && ret == nil {
+			ret = err
+		}
+	}
+	return ret
+}
+
+// prunePods archives and then prunes every pod deleted before opts.Before,
+// returning the number of pods pruned.  The archive is only created if
+// there is something to prune.
+func prunePods(p dbmanager.Pruner, opts pruneOptions) (pruned int,
+	err error) {
+
+	var archive *podArchive
+
+	defer func() {
+		if archive == nil {
+			return
+		}
+		if closeErr := archive.Close(); closeErr != nil && err == nil {
+			err = fmt.Errorf("Unable to finish archive:  %s", closeErr)
+		}
+	}()
+	for {
+		pods, err := p.DeletedPods(opts.Before, pruneBatch)
+		if err != nil {
+			return pruned, err
+		}
+		if len(pods) == 0 {
+			return pruned, nil
+		}
+		if opts.ArchiveDir != "" {
+			if archive == nil {
+				archive, err = newPodArchive(opts.ArchiveDir,
+					opts.ArchiveFormat, time.Now())
+				if err != nil {
+					return pruned, err
+				}
+			}
+			if err = archive.Write(pods); err != nil {
+				return pruned, err
+			}
+		}
+		uids := make([]types.UID, len(pods))
+		for i, pod := range pods {
+			uids[i] = pod.UID
+		}
+		if err = p.PrunePods(uids); err != nil {
+			return pruned, err
+		}
+		pruned += len(pods)
+		if len(pods) < pruneBatch {
+			return pruned, nil
+		}
+	}
+}
+
+// runPruner prunes pods deleted more than age ago every interval, until
+// stop is closed.  Failures are logged, and retried at the next interval.
+func runPruner(p dbmanager.Pruner, age, interval time.Duration,
+	opts pruneOptions, stop <-chan struct{}) {
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		opts.Before = time.Now().Add(-age)
+		pruned, err := prunePods(p, opts)
+		if err != nil {
+			log.Print("Unable to prune deleted pods: ", err)
+		} else if pruned > 0 {
+			log.Printf("Pruned %d pods deleted before %s", pruned,
+				opts.Before.Format(time.RFC3339))
+		}
+		select {
+		case <-ticker.C:
+		case <-stop:
+			return
+		}
+	}
+}
@@ -0,0 +1,186 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/csv"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory/testutils"
+)
+
+// getPruneFixture returns a memory backend holding a PVC, two pods that
+// mounted it and were deleted at hours 5 and 10, and a running pod.
+func getPruneFixture(base time.Time) dbmanager.DBManager {
+	hour := func(h int) time.Time {
+		return base.Add(time.Duration(h) * time.Hour)
+	}
+	f := testutils.Fixture{
+		PVCs: []dbmanager.PVCRecord{{UID: "pvc-1", Name: "claim",
+			Namespace: "ns", CreateTime: hour(0), Storage: 1, JSON: "{}"}},
+	}
+	deleted := []int{10, 5, 0}
+	for i, uid := range []types.UID{"pod-1", "pod-2", "pod-3"} {
+		p := dbmanager.PodRecord{UID: uid, Name: string(uid),
+			Namespace: "ns", CreateTime: hour(i + 1), JSON: `{"kind":"Pod"}`,
+			Containers: []dbmanager.ContainerRecord{{PodUID: uid,
+				Name: "c1", Image: "busybox", Command: "/bin/sh"}},
+			Mounts: []dbmanager.PodMountRecord{{PodUID: uid,
+				ContainerName: "c1", PVCName: "claim", PVCUID: "pvc-1",
+				ReadOnly: true}},
+		}
+		if deleted[i] != 0 {
+			p.DeleteTime = hour(deleted[i])
+			p.DeleteTimeSource = dbmanager.TimeExact
+		}
+		f.Pods = append(f.Pods, p)
+	}
+	return testutils.NewManager(f)
+}
+
+// readArchive returns the decompressed contents of the only file in dir
+// matching pattern.
+func readArchive(t *testing.T, dir, pattern string) []byte {
+	names, err := filepath.Glob(filepath.Join(dir, pattern))
+	if err != nil || len(names) != 1 {
+		t.Fatalf("Expected one archive matching %s; got %v, %v", pattern,
+			names, err)
+	}
+	f, err := os.Open(names[0])
+	if err != nil {
+		t.Fatal("Unable to open archive: ", err)
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		t.Fatal("Unable to decompress archive: ", err)
+	}
+	data, err := ioutil.ReadAll(zr)
+	if err != nil {
+		t.Fatal("Unable to decompress archive: ", err)
+	}
+	return data
+}
+
+func TestPruneJSONL(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubevoltracker-prune")
+	if err != nil {
+		t.Fatal("Unable to create archive directory: ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	m := getPruneFixture(base)
+	p := m.(dbmanager.Pruner)
+	pruned, err := prunePods(p, pruneOptions{Before: base.Add(7 * time.Hour),
+		ArchiveDir: dir, ArchiveFormat: "jsonl"})
+	if err != nil {
+		t.Fatal("Unable to prune: ", err)
+	}
+	if pruned != 1 {
+		t.Errorf("Expected to prune one pod; pruned %d", pruned)
+	}
+
+	var pod archivedPod
+	if err = json.Unmarshal(readArchive(t, dir, "pods-*.jsonl.gz"),
+		&pod); err != nil {
+		t.Fatal("Unable to decode archived pod: ", err)
+	}
+	if pod.UID != "pod-2" || pod.Namespace != "ns" ||
+		!pod.DeleteTime.Equal(base.Add(5*time.Hour)) ||
+		pod.JSON != `{"kind":"Pod"}` || len(pod.Containers) != 1 ||
+		pod.Containers[0].Image != "busybox" || len(pod.Mounts) != 1 ||
+		pod.Mounts[0].PVCUID != "pvc-1" || !pod.Mounts[0].ReadOnly {
+		t.Errorf("Pod archived incorrectly:  %+v", pod)
+	}
+
+	summaries, err := p.ListMountSummaries()
+	if err != nil || len(summaries) != 1 || summaries[0].Pods != 1 {
+		t.Errorf("Expected one summarized mount; got %v, %v", summaries, err)
+	}
+
+	// Nothing is left to prune, so no archive is started.
+	os.RemoveAll(dir)
+	pruned, err = prunePods(p, pruneOptions{Before: base.Add(7 * time.Hour),
+		ArchiveDir: dir, ArchiveFormat: "jsonl"})
+	if err != nil || pruned != 0 {
+		t.Errorf("Expected nothing to prune; got %d, %v", pruned, err)
+	}
+	if _, err = os.Stat(dir); !os.IsNotExist(err) {
+		t.Error("Archive directory created with nothing to prune.")
+	}
+}
+
+func TestPruneCSV(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubevoltracker-prune")
+	if err != nil {
+		t.Fatal("Unable to create archive directory: ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	base := time.Date(2016, 6, 1, 0, 0, 0, 0, time.UTC)
+	pruned, err := prunePods(getPruneFixture(base).(dbmanager.Pruner),
+		pruneOptions{Before: base.Add(20 * time.Hour), ArchiveDir: dir,
+			ArchiveFormat: "csv"})
+	if err != nil {
+		t.Fatal("Unable to prune: ", err)
+	}
+	if pruned != 2 {
+		t.Errorf("Expected to prune two pods; pruned %d", pruned)
+	}
+
+	expected := map[string][]string{
+		"pod-*.csv.gz":       {"uid", "pod-2", "pod-1"},
+		"container-*.csv.gz": {"pod_uid", "pod-2", "pod-1"},
+		"pod_mount-*.csv.gz": {"pod_uid", "pod-2", "pod-1"},
+	}
+	for pattern, firstColumn := range expected {
+		data := readArchive(t, dir, pattern)
+		records, err := csv.NewReader(bytes.NewReader(data)).ReadAll()
+		if err != nil {
+			t.Fatalf("Unable to parse %s:  %s", pattern, err)
+		}
+		var got []string
+		for _, r := range records {
+			got = append(got, r[0])
+		}
+		if strings.Join(got, ",") != strings.Join(firstColumn, ",") {
+			t.Errorf("Expected %v in %s; got %v", firstColumn, pattern, got)
+		}
+	}
+}
+
+func TestPruneOptionsValidate(t *testing.T) {
+	if err := (pruneOptions{ArchiveDir: "dir",
+		ArchiveFormat: "xml"}).validate(); err == nil {
+		t.Error("Expected an error for an unknown archive format.")
+	}
+	if err := (pruneOptions{ArchiveFormat: "xml"}).validate(); err != nil {
+		t.Error("Format checked without an archive directory: ", err)
+	}
+}
@@ -0,0 +1,213 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// recordedLine is a single line of a recording, as read from a watch stream.
+type recordedLine struct {
+	Time      time.Time              `json:"time"`
+	Resource  resources.ResourceType `json:"resource"`
+	Namespace string                 `json:"namespace,omitempty"`
+	Line      string                 `json:"line"`
+}
+
+// Recorder tees the raw lines read by APIClient.Watch into a JSONL file per
+// resource type, so that the streams can later be replayed with Replay.
+type Recorder struct {
+	dir   string
+	mutex sync.Mutex
+	files map[resources.ResourceType]*os.File
+}
+
+// recordingPath returns the path of the recording for resource within dir.
+func recordingPath(dir string, resource resources.ResourceType) string {
+	return filepath.Join(dir, string(resource)+".jsonl")
+}
+
+// NewRecorder returns a Recorder writing to files in dir, which is created
+// if necessary.  Existing recordings are appended to.
+func NewRecorder(dir string) (*Recorder, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("Unable to create recording directory:  %s",
+			err)
+	}
+	return &Recorder{dir: dir, files: make(map[resources.ResourceType]*os.File)},
+		nil
+}
+
+// Record appends line, read from the watch on resource in namespace, to the
+// recording for resource.  Errors are logged rather than returned, since a
+// failed recording shouldn't stop the watch.
+func (r *Recorder) Record(resource resources.ResourceType, namespace string,
+	line []byte) {
+
+	data, err := json.Marshal(recordedLine{Time: time.Now(),
+		Resource: resource, Namespace: namespace, Line: string(line)})
+	if err != nil {
+		log.Print("Unable to encode recorded line: ", err)
+		return
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	f, ok := r.files[resource]
+	if !ok {
+		f, err = os.OpenFile(recordingPath(r.dir, resource),
+			os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			log.Printf("Unable to open recording for %s:  %s", resource, err)
+			return
+		}
+		r.files[resource] = f
+	}
+	if _, err = f.Write(append(data, '\n')); err != nil {
+		log.Printf("Unable to record line for %s:  %s", resource, err)
+	}
+}
+
+// Close closes the recording files.
+func (r *Recorder) Close() {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	for _, f := range r.files {
+		f.Close()
+	}
+	r.files = make(map[resources.ResourceType]*os.File)
+}
+
+// recordedLines sorts lines by the time they were recorded.
+type recordedLines []recordedLine
+
+func (r recordedLines) Len() int           { return len(r) }
+func (r recordedLines) Swap(i, j int)      { r[i], r[j] = r[j], r[i] }
+func (r recordedLines) Less(i, j int) bool { return r[i].Time.Before(r[j].Time) }
+
+// readRecording reads every recorded line from f.
+func readRecording(f io.Reader) ([]recordedLine, error) {
+	var lines []recordedLine
+
+	scanner := bufio.NewScanner(f)
+	// Watch lines hold entire objects, so they can be long.
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		var line recordedLine
+		if err := json.Unmarshal(scanner.Bytes(), &line); err != nil {
+			return nil, fmt.Errorf("Unable to decode recorded line:  %s", err)
+		}
+		lines = append(lines, line)
+	}
+	return lines, scanner.Err()
+}
+
+// ReadRecordings reads the recordings for every resource type in dir,
+// merging them in the order they were recorded.
+func ReadRecordings(dir string) ([]recordedLine, error) {
+	var lines []recordedLine
+
+	for resource := range resourceFactoryMap {
+		f, err := os.Open(recordingPath(dir, resource))
+		if os.IsNotExist(err) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		recorded, err := readRecording(f)
+		f.Close()
+		if err != nil {
+			return nil, fmt.Errorf("Unable to read recording for %s:  %s",
+				resource, err)
+		}
+		lines = append(lines, recorded...)
+	}
+	sort.Stable(recordedLines(lines))
+	return lines, nil
+}
+
+// newReplayWatcher returns a Watcher that can only be used to replay
+// recordings into dbm, since it has no API server to watch.
+func newReplayWatcher(dbm dbmanager.DBManager) *Watcher {
+	return &Watcher{
+		dbm:          dbm,
+		clock:        systemClock{},
+		namespaces:   []string{""},
+		stopChannels: make(map[resources.ResourceType]chan<- struct{}),
+		states:       make(map[watchKey]*watchState),
+	}
+}
+
+// Replay feeds recorded lines to the Watcher's handlers, as though they had
+// come from the watches themselves.  speed scales the delays between lines:
+// 1 reproduces the original timing, 10 replays ten times as fast, and 0
+// replays without any delay.  Statuses and lines that can't be decoded are
+// skipped.  Replay returns the number of events handled.
+func (w *Watcher) Replay(lines []recordedLine, speed float64) (int, error) {
+	var handled int
+
+	for i, line := range lines {
+		if speed > 0 && i > 0 {
+			time.Sleep(time.Duration(
+				float64(line.Time.Sub(lines[i-1].Time)) / speed))
+		}
+		ok, err := w.handleLine(line.Resource, line.Namespace, line.Line,
+			receipt{time: line.Time})
+		if err != nil {
+			return handled, err
+		}
+		if !ok {
+			log.Printf("Skipping recorded line for %s that isn't an "+
+				"event:  %s", line.Resource, line.Line)
+			continue
+		}
+		handled++
+	}
+	return handled, nil
+}
+
+// handleLine decodes a single line of a watch stream on resource in the
+// watched namespace, received as described by rc, and dispatches the event
+// to the appropriate handler.  It returns false if the line isn't an event.
+func (w *Watcher) handleLine(resource resources.ResourceType, namespace,
+	line string, rc receipt) (bool, error) {
+
+	handler, err := w.getHandler(resource)
+	if err != nil {
+		return false, err
+	}
+	e := getEvent(resource)
+	defer releaseEvent(resource, e)
+	if err = json.Unmarshal([]byte(line), e); err != nil ||
+		e.GetType() == "" || e.GetType() == Error {
+		return false, nil
+	}
+	w.dispatch(handler, resource, namespace, e, line, rc)
+	return true, nil
+}
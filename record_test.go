@@ -0,0 +1,123 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+func TestRecordAndReplay(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kubevoltracker-record")
+	if err != nil {
+		t.Fatal("Unable to create recording directory: ", err)
+	}
+	defer os.RemoveAll(dir)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter,
+		r *http.Request) {
+
+		fmt.Fprint(w, podEventLine("pod-1", "ns")+
+			podEventLine("pod-2", "ns"))
+		w.(http.Flusher).Flush()
+		<-w.(http.CloseNotifier).CloseNotify()
+	}))
+	defer server.Close()
+
+	manager := &lockedManager{MockManager: mock.New(false).(*mock.MockManager)}
+	w, err := NewWatcher(nil, strings.TrimPrefix(server.URL, "http://"),
+		manager)
+	if err != nil {
+		t.Fatal("Unable to create watcher: ", err)
+	}
+	recorder, err := NewRecorder(dir)
+	if err != nil {
+		t.Fatal("Unable to create recorder: ", err)
+	}
+	w.SetRecorder(recorder)
+	if err = w.Watch(resources.Pods, false); err != nil {
+		t.Fatal("Unable to watch pods: ", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for !manager.hasPod("pod-2") {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for pods")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	w.Stop(resources.Pods)
+	recorder.Close()
+
+	lines, err := ReadRecordings(dir)
+	if err != nil {
+		t.Fatal("Unable to read recordings: ", err)
+	}
+	if len(lines) != 2 || lines[0].Resource != resources.Pods ||
+		lines[0].Namespace != "" {
+		t.Fatalf("Expected 2 recorded pod lines; got %v", lines)
+	}
+
+	replayed := mock.New(false).(*mock.MockManager)
+	handled, err := newReplayWatcher(replayed).Replay(lines, 0)
+	if err != nil || handled != 2 {
+		t.Fatalf("Expected to replay 2 events; got %d, %v", handled, err)
+	}
+	for _, uid := range []string{"pod-1", "pod-2"} {
+		if _, ok := replayed.PodForUID[types.UID(uid)]; !ok {
+			t.Errorf("Replay didn't record %s", uid)
+		}
+	}
+}
+
+func TestReplaySpeed(t *testing.T) {
+	start := time.Now()
+	lines := []recordedLine{
+		{Time: start, Resource: resources.Pods,
+			Line: podEventLine("pod-1", "ns")},
+		{Time: start.Add(time.Second), Resource: resources.Pods,
+			Line: `{"type":"ERROR","object":{"kind":"Status","code":410}}`},
+		{Time: start.Add(2 * time.Second), Resource: resources.Pods,
+			Line: "not json"},
+	}
+
+	replayed := mock.New(false).(*mock.MockManager)
+	handled, err := newReplayWatcher(replayed).Replay(lines, 10)
+	elapsed := time.Since(start)
+	if err != nil {
+		t.Fatal("Unable to replay: ", err)
+	}
+	// The ERROR event only carries a status, so it's skipped.
+	if handled != 1 || len(replayed.PodForUID) != 1 {
+		t.Errorf("Expected 1 event and 1 pod; got %d and %d", handled,
+			len(replayed.PodForUID))
+	}
+	if elapsed < 150*time.Millisecond || elapsed > time.Second {
+		t.Errorf("Expected 2s recording to replay in about 200ms at 10x; "+
+			"took %s", elapsed)
+	}
+}
@@ -0,0 +1,257 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+// Package reports computes summaries of storage usage from the state
+// recorded by a dbmanager backend.  Reports only rely on the read-side
+// methods in dbmanager.Querier, so they work with any backend that
+// implements it.
+package reports
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+const (
+	// BytesPerGB is the number of bytes in a GB, for the purposes of
+	// chargeback.  We use binary units, since that's what storage requests
+	// in Kubernetes are generally specified in.
+	BytesPerGB = 1024 * 1024 * 1024
+	// HoursPerMonth is the length of a billing month in hours (365 * 24 / 12).
+	HoursPerMonth = 730
+
+	// NoLabel is used as the key for claims that lack the requested label.
+	NoLabel = "<none>"
+)
+
+// Dimension identifies the way in which a ChargebackRow aggregates usage.
+type Dimension string
+
+const (
+	ByNamespace Dimension = "namespace"
+	ByLabel     Dimension = "label"
+	ByBackend   Dimension = "backend"
+)
+
+// ChargebackOptions controls the period and pricing for Chargeback.
+type ChargebackOptions struct {
+	Start time.Time
+	End   time.Time
+	// LabelKey is the PVC label whose values are used for the per-label
+	// breakdown.  If empty, no per-label rows are produced.
+	LabelKey string
+	// Prices maps a backend type to its price per GB-month.  Backends
+	// without a price are charged nothing.
+	Prices map[dbmanager.Table]float64
+}
+
+// ChargebackRow holds the usage for a single key (e.g., a namespace) on a
+// single backend type over the billing period.
+//
+// Requested usage is computed from the storage requested by the PVC, while
+// provisioned usage is computed from the capacity of the PV it was bound to;
+// cost is always based on provisioned usage.  For per-namespace and per-label
+// rows, usage accrues from the time a claim is bound until it (or its PV) is
+// deleted.  For per-backend rows, provisioned usage covers the entire
+// lifetime of each PV, bound or not.
+type ChargebackRow struct {
+	Dimension          Dimension
+	Key                string
+	Backend            dbmanager.Table
+	RequestedGBHours   float64
+	ProvisionedGBHours float64
+	Cost               float64
+}
+
+type chargebackKey struct {
+	dimension Dimension
+	key       string
+	backend   dbmanager.Table
+}
+
+// labelsFromJSON extracts the labels from the stored JSON for a resource,
+// which is the raw watch event received from the API server.
+func labelsFromJSON(rawJSON string) map[string]string {
+	var event struct {
+		Object struct {
+			Metadata struct {
+				Labels map[string]string `json:"labels"`
+			} `json:"metadata"`
+		} `json:"object"`
+	}
+	if rawJSON == "" {
+		return nil
+	}
+	if err := json.Unmarshal([]byte(rawJSON), &event); err != nil {
+		return nil
+	}
+	return event.Object.Metadata.Labels
+}
+
+// overlapHours returns the number of hours in which [start, end) overlaps
+// [periodStart, periodEnd).  A zero end is treated as still ongoing.
+func overlapHours(start, end, periodStart, periodEnd time.Time) float64 {
+	if end.IsZero() || end.After(periodEnd) {
+		end = periodEnd
+	}
+	if start.Before(periodStart) {
+		start = periodStart
+	}
+	if !end.After(start) {
+		return 0
+	}
+	return end.Sub(start).Hours()
+}
+
+// gbHours converts a size in bytes held for the given number of hours into
+// GB-hours.
+func gbHours(storage int64, hours float64) float64 {
+	return float64(storage) / BytesPerGB * hours
+}
+
+// Chargeback computes the GB-hours consumed per namespace, per value of
+// opts.LabelKey, and per backend type between opts.Start and opts.End.
+// Rows are sorted by dimension, key, and backend.
+func Chargeback(q dbmanager.Querier, opts ChargebackOptions) (
+	[]ChargebackRow, error) {
+
+	if !opts.End.After(opts.Start) {
+		return nil, fmt.Errorf("Billing period end %s is not after start %s",
+			opts.End, opts.Start)
+	}
+	pvs, err := q.ListPVs()
+	if err != nil {
+		return nil, err
+	}
+	pvcs, err := q.ListPVCs()
+	if err != nil {
+		return nil, err
+	}
+
+	totals := make(map[chargebackKey]*ChargebackRow)
+	add := func(k chargebackKey, requested, provisioned float64) {
+		row, ok := totals[k]
+		if !ok {
+			row = &ChargebackRow{Dimension: k.dimension, Key: k.key,
+				Backend: k.backend}
+			totals[k] = row
+		}
+		row.RequestedGBHours += requested
+		row.ProvisionedGBHours += provisioned
+	}
+
+	pvForUID := make(map[types.UID]dbmanager.PVRecord)
+	for _, pv := range pvs {
+		pvForUID[pv.UID] = pv
+		add(chargebackKey{ByBackend, string(pv.BackendType), pv.BackendType},
+			0, gbHours(pv.Storage, overlapHours(pv.CreateTime, pv.DeleteTime,
+				opts.Start, opts.End)))
+	}
+
+	for _, pvc := range pvcs {
+		pv, ok := pvForUID[pvc.PVUID]
+		if !ok || pvc.BindTime.IsZero() {
+			// Unbound claims don't consume anything.
+			continue
+		}
+		end := pvc.DeleteTime
+		if !pv.DeleteTime.IsZero() && (end.IsZero() ||
+			pv.DeleteTime.Before(end)) {
+			end = pv.DeleteTime
+		}
+		hours := overlapHours(pvc.BindTime, end, opts.Start, opts.End)
+		if hours == 0 {
+			continue
+		}
+		requested := gbHours(pvc.Storage, hours)
+		provisioned := gbHours(pv.Storage, hours)
+
+		add(chargebackKey{ByNamespace, pvc.Namespace, pv.BackendType},
+			requested, provisioned)
+		add(chargebackKey{ByBackend, string(pv.BackendType), pv.BackendType},
+			requested, 0)
+		if opts.LabelKey != "" {
+			value, ok := labelsFromJSON(pvc.JSON)[opts.LabelKey]
+			if !ok {
+				value = NoLabel
+			}
+			add(chargebackKey{ByLabel, value, pv.BackendType}, requested,
+				provisioned)
+		}
+	}
+
+	ret := make([]ChargebackRow, 0, len(totals))
+	for _, row := range totals {
+		row.Cost = row.ProvisionedGBHours / HoursPerMonth *
+			opts.Prices[row.Backend]
+		ret = append(ret, *row)
+	}
+	sort.Sort(chargebackRows(ret))
+	return ret, nil
+}
+
+var dimensionOrder = map[Dimension]int{
+	ByNamespace: 0,
+	ByLabel:     1,
+	ByBackend:   2,
+}
+
+type chargebackRows []ChargebackRow
+
+func (r chargebackRows) Len() int      { return len(r) }
+func (r chargebackRows) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r chargebackRows) Less(i, j int) bool {
+	if r[i].Dimension != r[j].Dimension {
+		return dimensionOrder[r[i].Dimension] < dimensionOrder[r[j].Dimension]
+	}
+	if r[i].Key != r[j].Key {
+		return r[i].Key < r[j].Key
+	}
+	return r[i].Backend < r[j].Backend
+}
+
+// WriteChargebackCSV writes rows as CSV, with a header row, to w.
+func WriteChargebackCSV(w io.Writer, rows []ChargebackRow,
+	opts ChargebackOptions) error {
+
+	writer := csv.NewWriter(w)
+	writer.Write([]string{"period_start", "period_end", "dimension", "key",
+		"backend", "requested_gb_hours", "provisioned_gb_hours",
+		"price_per_gb_month", "cost"})
+	for _, row := range rows {
+		writer.Write([]string{
+			opts.Start.Format(time.RFC3339),
+			opts.End.Format(time.RFC3339),
+			string(row.Dimension),
+			row.Key,
+			string(row.Backend),
+			fmt.Sprintf("%.4f", row.RequestedGBHours),
+			fmt.Sprintf("%.4f", row.ProvisionedGBHours),
+			fmt.Sprintf("%.4f", opts.Prices[row.Backend]),
+			fmt.Sprintf("%.2f", row.Cost),
+		})
+	}
+	writer.Flush()
+	return writer.Error()
+}
@@ -0,0 +1,173 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reports
+
+import (
+	"bytes"
+	"encoding/csv"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory/testutils"
+)
+
+// newQuerier returns an in-memory backend holding the records in f.
+func newQuerier(f testutils.Fixture) dbmanager.Querier {
+	return testutils.NewManager(f).(dbmanager.Querier)
+}
+
+var periodStart = time.Date(2016, time.July, 1, 0, 0, 0, 0, time.UTC)
+
+func hoursIn(h int) time.Time {
+	return periodStart.Add(time.Duration(h) * time.Hour)
+}
+
+const pvcJSONWithTeam = `{"type":"ADDED","object":{"metadata":` +
+	`{"name":"claim","labels":{"team":"storage"}}}}`
+
+func getChargebackFixture() dbmanager.Querier {
+	return newQuerier(testutils.Fixture{
+		PVs: []dbmanager.PVRecord{
+			{UID: "pv-nfs", Name: "pv-nfs", CreateTime: hoursIn(-10),
+				Storage: 2 * BytesPerGB, BackendType: dbmanager.NFS,
+				BackendID: 1},
+			{UID: "pv-iscsi", Name: "pv-iscsi", CreateTime: hoursIn(0),
+				DeleteTime: hoursIn(5), Storage: 4 * BytesPerGB,
+				BackendType: dbmanager.ISCSI, BackendID: 1},
+		},
+		PVCs: []dbmanager.PVCRecord{
+			// Bound before the period starts and deleted 10 hours in.
+			{UID: "pvc-1", Name: "claim", Namespace: "ns1",
+				CreateTime: hoursIn(-5), BindTime: hoursIn(-5),
+				DeleteTime: hoursIn(10), Storage: BytesPerGB,
+				PVUID: "pv-nfs", JSON: pvcJSONWithTeam},
+			// Outlives its PV, so it should stop accruing at 5 hours.
+			{UID: "pvc-2", Name: "claim", Namespace: "ns2",
+				CreateTime: hoursIn(1), BindTime: hoursIn(1),
+				Storage: 3 * BytesPerGB, PVUID: "pv-iscsi"},
+			// Never bound.
+			{UID: "pvc-3", Name: "pending", Namespace: "ns1",
+				CreateTime: hoursIn(1), Storage: BytesPerGB},
+		},
+	})
+}
+
+func floatEquals(a, b float64) bool {
+	return math.Abs(a-b) < 1e-9
+}
+
+func findRow(rows []ChargebackRow, d Dimension, key string,
+	backend dbmanager.Table) *ChargebackRow {
+
+	for i := range rows {
+		if rows[i].Dimension == d && rows[i].Key == key &&
+			rows[i].Backend == backend {
+			return &rows[i]
+		}
+	}
+	return nil
+}
+
+func TestChargeback(t *testing.T) {
+	opts := ChargebackOptions{
+		Start:    periodStart,
+		End:      hoursIn(20),
+		LabelKey: "team",
+		Prices: map[dbmanager.Table]float64{
+			dbmanager.NFS:   HoursPerMonth,
+			dbmanager.ISCSI: 2 * HoursPerMonth,
+		},
+	}
+	rows, err := Chargeback(getChargebackFixture(), opts)
+	if err != nil {
+		t.Fatal("Unable to compute chargeback: ", err)
+	}
+
+	expected := []struct {
+		dimension   Dimension
+		key         string
+		backend     dbmanager.Table
+		requested   float64
+		provisioned float64
+		cost        float64
+	}{
+		{ByNamespace, "ns1", dbmanager.NFS, 10, 20, 20},
+		{ByNamespace, "ns2", dbmanager.ISCSI, 12, 16, 32},
+		{ByLabel, "storage", dbmanager.NFS, 10, 20, 20},
+		{ByLabel, NoLabel, dbmanager.ISCSI, 12, 16, 32},
+		{ByBackend, "nfs", dbmanager.NFS, 10, 40, 40},
+		{ByBackend, "iscsi", dbmanager.ISCSI, 12, 20, 40},
+	}
+	if len(rows) != len(expected) {
+		t.Errorf("Expected %d rows; got %d", len(expected), len(rows))
+	}
+	for _, e := range expected {
+		row := findRow(rows, e.dimension, e.key, e.backend)
+		if row == nil {
+			t.Errorf("No row for %s %s on %s", e.dimension, e.key, e.backend)
+			continue
+		}
+		if !floatEquals(row.RequestedGBHours, e.requested) ||
+			!floatEquals(row.ProvisionedGBHours, e.provisioned) ||
+			!floatEquals(row.Cost, e.cost) {
+			t.Errorf("Incorrect row for %s %s on %s.\n\tExpected:  %v, %v, "+
+				"%v\n\tGot:  %v, %v, %v", e.dimension, e.key, e.backend,
+				e.requested, e.provisioned, e.cost, row.RequestedGBHours,
+				row.ProvisionedGBHours, row.Cost)
+		}
+	}
+	if rows[0].Dimension != ByNamespace ||
+		rows[len(rows)-1].Dimension != ByBackend {
+		t.Error("Rows not sorted by dimension.")
+	}
+}
+
+func TestChargebackBadPeriod(t *testing.T) {
+	_, err := Chargeback(getChargebackFixture(), ChargebackOptions{
+		Start: hoursIn(5),
+		End:   hoursIn(5),
+	})
+	if err == nil {
+		t.Error("Expected an error for an empty billing period.")
+	}
+}
+
+func TestWriteChargebackCSV(t *testing.T) {
+	var buf bytes.Buffer
+
+	opts := ChargebackOptions{Start: periodStart, End: hoursIn(20)}
+	rows, err := Chargeback(getChargebackFixture(), opts)
+	if err != nil {
+		t.Fatal("Unable to compute chargeback: ", err)
+	}
+	if err = WriteChargebackCSV(&buf, rows, opts); err != nil {
+		t.Fatal("Unable to write CSV: ", err)
+	}
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal("Unable to parse CSV output: ", err)
+	}
+	if len(records) != len(rows)+1 {
+		t.Errorf("Expected %d CSV records; got %d", len(rows)+1,
+			len(records))
+	}
+	if records[0][0] != "period_start" {
+		t.Error("Missing CSV header; got ", records[0])
+	}
+}
@@ -0,0 +1,362 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reports
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+// PVStatus summarizes the state of a PV as recorded by the tracker.
+type PVStatus string
+
+const (
+	// StatusUnbound PVs have never been bound to a claim.
+	StatusUnbound PVStatus = "Unbound"
+	// StatusBound PVs are bound to a claim that still exists.
+	StatusBound PVStatus = "Bound"
+	// StatusReleased PVs still exist, but the claim they were last bound to
+	// has been deleted.
+	StatusReleased PVStatus = "Released"
+	// StatusDeleted PVs have been deleted.
+	StatusDeleted PVStatus = "Deleted"
+)
+
+// lastBoundClaims returns the claim most recently bound to each PV, keyed by
+// the PV's UID.
+func lastBoundClaims(
+	pvcs []dbmanager.PVCRecord) map[types.UID]*dbmanager.PVCRecord {
+
+	ret := make(map[types.UID]*dbmanager.PVCRecord)
+	for i, pvc := range pvcs {
+		if pvc.PVUID == "" {
+			continue
+		}
+		last, ok := ret[pvc.PVUID]
+		if !ok || pvc.BindTime.After(last.BindTime) {
+			ret[pvc.PVUID] = &pvcs[i]
+		}
+	}
+	return ret
+}
+
+// pvStatus returns the status of pv, given the claim most recently bound to
+// it (or nil if it has never been bound).
+func pvStatus(pv dbmanager.PVRecord,
+	lastBound *dbmanager.PVCRecord) PVStatus {
+
+	switch {
+	case !pv.DeleteTime.IsZero():
+		return StatusDeleted
+	case lastBound == nil:
+		return StatusUnbound
+	case lastBound.DeleteTime.IsZero():
+		return StatusBound
+	}
+	return StatusReleased
+}
+
+// TimelineEventType identifies what happened at a point in a PV's history.
+type TimelineEventType string
+
+// Event types are listed in the order in which simultaneous events are
+// sorted.
+const (
+	PVCreated  TimelineEventType = "PVCreated"
+	PVCCreated TimelineEventType = "PVCCreated"
+	PVCBound   TimelineEventType = "PVCBound"
+	PodCreated TimelineEventType = "PodCreated"
+	PodDeleted TimelineEventType = "PodDeleted"
+	PVCDeleted TimelineEventType = "PVCDeleted"
+	PVDeleted  TimelineEventType = "PVDeleted"
+)
+
+var timelineOrder = map[TimelineEventType]int{
+	PVCreated:  0,
+	PVCCreated: 1,
+	PVCBound:   2,
+	PodCreated: 3,
+	PodDeleted: 4,
+	PVCDeleted: 5,
+	PVDeleted:  6,
+}
+
+// TimelineMount describes a single container's mount of a claim.
+type TimelineMount struct {
+	Container string `json:"container"`
+	Image     string `json:"image"`
+	Command   string `json:"command"`
+	ReadOnly  bool   `json:"read_only"`
+}
+
+// TimelineEvent is a single entry in a PV's history.  Namespace and Name
+// refer to the PVC or pod involved, if any, and Claim to the PVC through
+// which a pod mounted the PV.  Source records where Time came from.
+type TimelineEvent struct {
+	Time      time.Time            `json:"time"`
+	Source    dbmanager.TimeSource `json:"time_source"`
+	Type      TimelineEventType    `json:"type"`
+	UID       types.UID            `json:"uid"`
+	Namespace string               `json:"namespace,omitempty"`
+	Name      string               `json:"name"`
+	Claim     string               `json:"claim,omitempty"`
+	Mounts    []TimelineMount      `json:"mounts,omitempty"`
+}
+
+// PVHistory is the chronological history of a single PV.
+type PVHistory struct {
+	UID         types.UID       `json:"uid"`
+	Name        string          `json:"name"`
+	Status      PVStatus        `json:"status"`
+	Storage     int64           `json:"storage"`
+	AccessModes string          `json:"access_modes"`
+	BackendType dbmanager.Table `json:"backend_type"`
+	BackendID   int             `json:"backend_id"`
+	Events      []TimelineEvent `json:"events"`
+}
+
+type timelineEvents []TimelineEvent
+
+func (e timelineEvents) Len() int      { return len(e) }
+func (e timelineEvents) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e timelineEvents) Less(i, j int) bool {
+	if !e[i].Time.Equal(e[j].Time) {
+		return e[i].Time.Before(e[j].Time)
+	}
+	if e[i].Type != e[j].Type {
+		return timelineOrder[e[i].Type] < timelineOrder[e[j].Type]
+	}
+	return e[i].UID < e[j].UID
+}
+
+// podMounts groups the mounts of a single pod through a single claim.
+type podMounts struct {
+	record dbmanager.PodMountRecord
+	mounts []TimelineMount
+}
+
+// DescribePV returns the history of every PV, current or deleted, named
+// name, oldest first.  Each history includes every claim bound to the PV
+// and every pod that mounted it through one of those claims.  Events whose
+// time was never recorded (e.g., the creation of a claim whose bind was
+// processed first), or whose time is less trustworthy than minConfidence,
+// are omitted.
+func DescribePV(q dbmanager.Querier, name string,
+	minConfidence dbmanager.TimeSource) ([]PVHistory, error) {
+
+	pvs, err := q.ListPVs()
+	if err != nil {
+		return nil, err
+	}
+	var matches []dbmanager.PVRecord
+	for _, pv := range pvs {
+		if pv.Name == name {
+			matches = append(matches, pv)
+		}
+	}
+	if len(matches) == 0 {
+		return nil, nil
+	}
+
+	pvcs, err := q.ListPVCs()
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := q.ListPodMounts()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := q.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	type containerKey struct {
+		podUID types.UID
+		name   string
+	}
+	containerFor := make(map[containerKey]dbmanager.ContainerRecord)
+	for _, c := range containers {
+		containerFor[containerKey{c.PodUID, c.Name}] = c
+	}
+
+	type podClaimKey struct {
+		podUID types.UID
+		pvcUID types.UID
+	}
+	var podOrder []podClaimKey
+	podsFor := make(map[podClaimKey]*podMounts)
+	for _, m := range mounts {
+		if m.PVCUID == "" {
+			continue
+		}
+		k := podClaimKey{m.PodUID, m.PVCUID}
+		pm, ok := podsFor[k]
+		if !ok {
+			pm = &podMounts{record: m}
+			podsFor[k] = pm
+			podOrder = append(podOrder, k)
+		}
+		c := containerFor[containerKey{m.PodUID, m.ContainerName}]
+		pm.mounts = append(pm.mounts, TimelineMount{
+			Container: m.ContainerName,
+			Image:     c.Image,
+			Command:   c.Command,
+			ReadOnly:  m.ReadOnly,
+		})
+	}
+
+	lastBound := lastBoundClaims(pvcs)
+	ret := make([]PVHistory, 0, len(matches))
+	for _, pv := range matches {
+		h := PVHistory{
+			UID:         pv.UID,
+			Name:        pv.Name,
+			Storage:     pv.Storage,
+			AccessModes: pv.AccessModes,
+			BackendType: pv.BackendType,
+			BackendID:   pv.BackendID,
+		}
+		var events []TimelineEvent
+		add := func(t time.Time, source dbmanager.TimeSource,
+			e TimelineEvent) {
+
+			if t.IsZero() || !source.AtLeast(minConfidence) {
+				return
+			}
+			e.Time = t
+			e.Source = source
+			events = append(events, e)
+		}
+
+		// Creation times always come from the objects themselves.
+		add(pv.CreateTime, dbmanager.TimeExact, TimelineEvent{
+			Type: PVCreated, UID: pv.UID, Name: pv.Name})
+		add(pv.DeleteTime, pv.DeleteTimeSource, TimelineEvent{
+			Type: PVDeleted, UID: pv.UID, Name: pv.Name})
+
+		claimNames := make(map[types.UID]string)
+		for _, pvc := range pvcs {
+			if pvc.PVUID != pv.UID {
+				continue
+			}
+			claimNames[pvc.UID] = pvc.Name
+			e := TimelineEvent{UID: pvc.UID, Namespace: pvc.Namespace,
+				Name: pvc.Name}
+			e.Type = PVCCreated
+			add(pvc.CreateTime, dbmanager.TimeExact, e)
+			e.Type = PVCBound
+			add(pvc.BindTime, pvc.BindTimeSource, e)
+			e.Type = PVCDeleted
+			add(pvc.DeleteTime, pvc.DeleteTimeSource, e)
+		}
+		for _, k := range podOrder {
+			claim, ok := claimNames[k.pvcUID]
+			if !ok {
+				continue
+			}
+			pm := podsFor[k]
+			e := TimelineEvent{UID: k.podUID, Namespace: pm.record.Namespace,
+				Name: pm.record.PodName, Claim: claim}
+			e.Type = PodDeleted
+			add(pm.record.PodDeleteTime, pm.record.PodDeleteTimeSource, e)
+			e.Type = PodCreated
+			e.Mounts = pm.mounts
+			add(pm.record.PodCreateTime, dbmanager.TimeExact, e)
+		}
+
+		h.Status = pvStatus(pv, lastBound[pv.UID])
+		sort.Sort(timelineEvents(events))
+		h.Events = events
+		ret = append(ret, h)
+	}
+	sort.Sort(pvHistories(ret))
+	return ret, nil
+}
+
+type pvHistories []PVHistory
+
+func (h pvHistories) Len() int      { return len(h) }
+func (h pvHistories) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+func (h pvHistories) Less(i, j int) bool {
+	if len(h[i].Events) == 0 || len(h[j].Events) == 0 {
+		return len(h[i].Events) > len(h[j].Events)
+	}
+	return h[i].Events[0].Time.Before(h[j].Events[0].Time)
+}
+
+// describeEvent returns a one-line description of e.
+func describeEvent(e TimelineEvent) string {
+	name := e.Name
+	if e.Namespace != "" {
+		name = e.Namespace + "/" + e.Name
+	}
+	switch e.Type {
+	case PVCreated:
+		return "PV created"
+	case PVDeleted:
+		return "PV deleted"
+	case PVCCreated:
+		return fmt.Sprintf("PVC %s created", name)
+	case PVCBound:
+		return fmt.Sprintf("PVC %s bound", name)
+	case PVCDeleted:
+		return fmt.Sprintf("PVC %s deleted", name)
+	case PodCreated:
+		return fmt.Sprintf("Pod %s created, mounting %s", name, e.Claim)
+	case PodDeleted:
+		return fmt.Sprintf("Pod %s deleted, unmounting %s", name, e.Claim)
+	}
+	return string(e.Type)
+}
+
+// WritePVHistory writes h to w in a human-readable form.  Times that didn't
+// come from the objects themselves are followed by their source.
+func WritePVHistory(w io.Writer, h PVHistory) error {
+	fmt.Fprintf(w, "Name:\t\t%s\nUID:\t\t%s\nStatus:\t\t%s\n", h.Name, h.UID,
+		h.Status)
+	fmt.Fprintf(w, "Capacity:\t%d\nAccess Modes:\t%s\nBackend:\t%s %d\n",
+		h.Storage, h.AccessModes, h.BackendType, h.BackendID)
+	fmt.Fprintln(w, "Timeline:")
+	for _, e := range h.Events {
+		source := ""
+		if e.Source != dbmanager.TimeExact {
+			source = fmt.Sprintf(" (%s)", e.Source)
+		}
+		fmt.Fprintf(w, "  %s  %s%s\n", e.Time.Format(time.RFC3339),
+			describeEvent(e), source)
+		for _, m := range e.Mounts {
+			mode := "read-write"
+			if m.ReadOnly {
+				mode = "read-only"
+			}
+			_, err := fmt.Fprintf(w, "      container %s (image %s, command "+
+				"%q), %s\n", m.Container, m.Image, m.Command, mode)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
@@ -0,0 +1,169 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reports
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory/testutils"
+)
+
+func getDescribeFixture() dbmanager.Querier {
+	return newQuerier(testutils.Fixture{
+		PVs: []dbmanager.PVRecord{
+			{UID: "pv-old", Name: "vol", CreateTime: hoursIn(0),
+				DeleteTime: hoursIn(1), BackendType: dbmanager.NFS,
+				DeleteTimeSource: dbmanager.TimeInferred},
+			{UID: "pv-new", Name: "vol", CreateTime: hoursIn(2),
+				Storage: BytesPerGB, BackendType: dbmanager.NFS, BackendID: 3},
+			{UID: "pv-other", Name: "other", CreateTime: hoursIn(2),
+				BackendType: dbmanager.ISCSI},
+		},
+		PVCs: []dbmanager.PVCRecord{
+			{UID: "pvc-1", Name: "claim", Namespace: "ns",
+				CreateTime: hoursIn(3), BindTime: hoursIn(3),
+				DeleteTime: hoursIn(9), PVUID: "pv-new",
+				BindTimeSource:   dbmanager.TimeObserved,
+				DeleteTimeSource: dbmanager.TimeExact},
+			{UID: "pvc-other", Name: "claim", Namespace: "ns2",
+				CreateTime: hoursIn(3), BindTime: hoursIn(3),
+				PVUID: "pv-other", BindTimeSource: dbmanager.TimeInferred},
+		},
+		Mounts: []dbmanager.PodMountRecord{
+			{PodUID: "pod-1", PodName: "web", Namespace: "ns",
+				PodCreateTime: hoursIn(4), PodDeleteTime: hoursIn(8),
+				ContainerName: "app", PVCName: "claim", PVCUID: "pvc-1",
+				PodDeleteTimeSource: dbmanager.TimeExact},
+			{PodUID: "pod-1", PodName: "web", Namespace: "ns",
+				PodCreateTime: hoursIn(4), PodDeleteTime: hoursIn(8),
+				ContainerName: "backup", PVCName: "claim", PVCUID: "pvc-1",
+				ReadOnly: true, PodDeleteTimeSource: dbmanager.TimeExact},
+			{PodUID: "pod-2", PodName: "other", Namespace: "ns2",
+				PodCreateTime: hoursIn(4), ContainerName: "app",
+				PVCName: "claim", PVCUID: "pvc-other"},
+		},
+		Containers: []dbmanager.ContainerRecord{
+			{PodUID: "pod-1", Name: "app", Image: "nginx",
+				Command: "/bin/sh"},
+			{PodUID: "pod-1", Name: "backup", Image: "rsync"},
+		},
+	})
+}
+
+func TestDescribePV(t *testing.T) {
+	histories, err := DescribePV(getDescribeFixture(), "vol",
+		dbmanager.TimeUnknown)
+	if err != nil {
+		t.Fatal("Unable to describe PV: ", err)
+	}
+	if len(histories) != 2 {
+		t.Fatalf("Expected 2 PVs named vol; got %d", len(histories))
+	}
+	if histories[0].UID != "pv-old" || histories[0].Status != StatusDeleted {
+		t.Errorf("Incorrect history for deleted PV:  %v", histories[0])
+	}
+
+	h := histories[1]
+	if h.UID != "pv-new" || h.Status != StatusReleased {
+		t.Errorf("Expected pv-new to be released; got %s %s", h.UID,
+			h.Status)
+	}
+	expected := []TimelineEventType{PVCreated, PVCCreated, PVCBound,
+		PodCreated, PodDeleted, PVCDeleted}
+	if len(h.Events) != len(expected) {
+		t.Fatalf("Expected %d events; got %d:  %v", len(expected),
+			len(h.Events), h.Events)
+	}
+	for i, e := range expected {
+		if h.Events[i].Type != e {
+			t.Errorf("Expected event %d to be %s; got %s", i, e,
+				h.Events[i].Type)
+		}
+	}
+	created := h.Events[3]
+	if created.Name != "web" || created.Claim != "claim" ||
+		len(created.Mounts) != 2 {
+		t.Fatalf("Incorrect pod creation event:  %v", created)
+	}
+	if created.Mounts[0].Image != "nginx" || created.Mounts[0].ReadOnly ||
+		created.Mounts[1].Image != "rsync" || !created.Mounts[1].ReadOnly {
+		t.Errorf("Incorrect mounts for pod creation:  %v", created.Mounts)
+	}
+	if h.Events[0].Source != dbmanager.TimeExact ||
+		h.Events[2].Source != dbmanager.TimeObserved {
+		t.Errorf("Incorrect time sources:  %v", h.Events)
+	}
+}
+
+func TestDescribePVMinConfidence(t *testing.T) {
+	histories, err := DescribePV(getDescribeFixture(), "vol",
+		dbmanager.TimeExact)
+	if err != nil || len(histories) != 2 {
+		t.Fatalf("Unable to describe PV:  %v, %v", histories, err)
+	}
+	// The inferred deletion of pv-old and the observed bind of pvc-1 should
+	// be left out.
+	for i, expected := range [][]TimelineEventType{
+		{PVCreated},
+		{PVCreated, PVCCreated, PodCreated, PodDeleted, PVCDeleted},
+	} {
+		events := histories[i].Events
+		if len(events) != len(expected) {
+			t.Errorf("Expected %d events for %s; got %v", len(expected),
+				histories[i].UID, events)
+			continue
+		}
+		for j, e := range expected {
+			if events[j].Type != e {
+				t.Errorf("Expected event %d of %s to be %s; got %s", j,
+					histories[i].UID, e, events[j].Type)
+			}
+		}
+	}
+}
+
+func TestDescribePVNotFound(t *testing.T) {
+	histories, err := DescribePV(getDescribeFixture(), "missing",
+		dbmanager.TimeUnknown)
+	if err != nil || len(histories) != 0 {
+		t.Errorf("Expected no histories; got %v, %v", histories, err)
+	}
+}
+
+func TestWritePVHistory(t *testing.T) {
+	var buf bytes.Buffer
+
+	histories, err := DescribePV(getDescribeFixture(), "other",
+		dbmanager.TimeUnknown)
+	if err != nil || len(histories) != 1 {
+		t.Fatalf("Unable to describe PV:  %v, %v", histories, err)
+	}
+	if err = WritePVHistory(&buf, histories[0]); err != nil {
+		t.Fatal("Unable to write history: ", err)
+	}
+	out := buf.String()
+	for _, s := range []string{"Status:\t\tBound",
+		"PVC ns2/claim bound (inferred)",
+		"Pod ns2/other created, mounting claim\n", "read-write"} {
+		if !strings.Contains(out, s) {
+			t.Errorf("Output missing %q:\n%s", s, out)
+		}
+	}
+}
@@ -0,0 +1,523 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reports
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"sort"
+	"strconv"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+// EdgeType describes the relationship between two nodes in a Graph.  Edges
+// always point from the node depended upon to its dependent, so that the
+// blast radius of a node consists of its descendants.
+type EdgeType string
+
+const (
+	// Backs edges point from a volume source to the PVs using it.
+	Backs EdgeType = "backs"
+	// Binds edges point from a PV to the PVC bound to it.
+	Binds EdgeType = "binds"
+	// MountedBy edges point from a PVC to the containers mounting it.
+	MountedBy EdgeType = "mounted_by"
+	// Runs edges point from a pod to its containers.
+	Runs EdgeType = "runs"
+)
+
+// GraphNode is a single backend, PV, PVC, pod, or container.  Type is the
+// table the node's record is stored in.
+type GraphNode struct {
+	ID        string            `json:"id"`
+	Type      dbmanager.Table   `json:"type"`
+	Label     string            `json:"label"`
+	Namespace string            `json:"namespace,omitempty"`
+	Attrs     map[string]string `json:"attrs,omitempty"`
+}
+
+// GraphEdge is a directed edge between two nodes, identified by their IDs.
+type GraphEdge struct {
+	Source string            `json:"source"`
+	Target string            `json:"target"`
+	Type   EdgeType          `json:"type"`
+	Attrs  map[string]string `json:"attrs,omitempty"`
+}
+
+// Graph is the set of storage relationships in the cluster.
+type Graph struct {
+	Nodes []GraphNode `json:"nodes"`
+	Edges []GraphEdge `json:"edges"`
+}
+
+// GraphOptions controls the time and scope of StorageGraph.
+type GraphOptions struct {
+	// At is the time for which to build the graph.  If zero, the graph
+	// reflects the current state.
+	At time.Time
+	// Namespace restricts the graph to the PVCs and pods in a namespace,
+	// along with the PVs and backends they depend upon.
+	Namespace string
+	// Backend restricts the graph to volume sources of a given type (NFS or
+	// ISCSI) and everything that depends upon them.
+	Backend dbmanager.Table
+	// Server further restricts the graph to volume sources on the given NFS
+	// server or ISCSI target portal.
+	Server string
+}
+
+func nodeID(t dbmanager.Table, id string) string {
+	return string(t) + "/" + id
+}
+
+func backendID(t dbmanager.Table, id int) string {
+	return nodeID(t, strconv.Itoa(id))
+}
+
+func containerID(podUID types.UID, name string) string {
+	return nodeID(dbmanager.Container, string(podUID)+"/"+name)
+}
+
+// existsAt returns whether an object with the given lifetime existed at t,
+// or currently exists if t is zero.  Objects whose creation was never
+// recorded are only treated as current.
+func existsAt(createTime, deleteTime, t time.Time) bool {
+	if t.IsZero() {
+		return deleteTime.IsZero()
+	}
+	return !createTime.IsZero() && !createTime.After(t) &&
+		(deleteTime.IsZero() || deleteTime.After(t))
+}
+
+// graphBuilder accumulates nodes and edges, ignoring duplicates.
+type graphBuilder struct {
+	nodes    map[string]*GraphNode
+	edges    map[[2]string]*GraphEdge
+	children map[string][]string
+	parents  map[string][]string
+}
+
+func (b *graphBuilder) addNode(n GraphNode) {
+	if _, ok := b.nodes[n.ID]; !ok {
+		b.nodes[n.ID] = &n
+	}
+}
+
+func (b *graphBuilder) addEdge(e GraphEdge) {
+	k := [2]string{e.Source, e.Target}
+	if _, ok := b.edges[k]; ok {
+		return
+	}
+	b.edges[k] = &e
+	b.children[e.Source] = append(b.children[e.Source], e.Target)
+	b.parents[e.Target] = append(b.parents[e.Target], e.Source)
+}
+
+// walk adds every node reachable from ids through next to seen.
+func walk(ids []string, next map[string][]string, seen map[string]bool) {
+	for len(ids) > 0 {
+		id := ids[len(ids)-1]
+		ids = ids[:len(ids)-1]
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		ids = append(ids, next[id]...)
+	}
+}
+
+// StorageGraph builds the graph of volume sources, PVs, PVCs, pods, and
+// containers as of opts.At.  Only pods that mount at least one PVC in the
+// graph are included.
+func StorageGraph(q dbmanager.Querier, opts GraphOptions) (*Graph, error) {
+	nfs, err := q.ListNFS()
+	if err != nil {
+		return nil, err
+	}
+	iscsi, err := q.ListISCSI()
+	if err != nil {
+		return nil, err
+	}
+	pvs, err := q.ListPVs()
+	if err != nil {
+		return nil, err
+	}
+	pvcs, err := q.ListPVCs()
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := q.ListPodMounts()
+	if err != nil {
+		return nil, err
+	}
+	containers, err := q.ListContainers()
+	if err != nil {
+		return nil, err
+	}
+
+	b := &graphBuilder{
+		nodes:    make(map[string]*GraphNode),
+		edges:    make(map[[2]string]*GraphEdge),
+		children: make(map[string][]string),
+		parents:  make(map[string][]string),
+	}
+	backends := make(map[string]GraphNode)
+	var selectedBackends []string
+	for _, n := range nfs {
+		id := backendID(dbmanager.NFS, n.ID)
+		backends[id] = GraphNode{ID: id, Type: dbmanager.NFS,
+			Label: n.Server + ":" + n.Path,
+			Attrs: map[string]string{"server": n.Server, "path": n.Path}}
+		if (opts.Backend == "" || opts.Backend == dbmanager.NFS) &&
+			(opts.Server == "" || opts.Server == n.Server) {
+			selectedBackends = append(selectedBackends, id)
+		}
+	}
+	for _, i := range iscsi {
+		id := backendID(dbmanager.ISCSI, i.ID)
+		backends[id] = GraphNode{ID: id, Type: dbmanager.ISCSI,
+			Label: fmt.Sprintf("%s %s lun %d", i.TargetPortal, i.IQN, i.LUN),
+			Attrs: map[string]string{"target_portal": i.TargetPortal,
+				"iqn": i.IQN, "lun": strconv.Itoa(i.LUN),
+				"fs_type": i.FSType}}
+		if (opts.Backend == "" || opts.Backend == dbmanager.ISCSI) &&
+			(opts.Server == "" || opts.Server == i.TargetPortal) {
+			selectedBackends = append(selectedBackends, id)
+		}
+	}
+
+	for _, pv := range pvs {
+		if !existsAt(pv.CreateTime, pv.DeleteTime, opts.At) {
+			continue
+		}
+		id := nodeID(dbmanager.PV, string(pv.UID))
+		b.addNode(GraphNode{ID: id, Type: dbmanager.PV, Label: pv.Name,
+			Attrs: map[string]string{"uid": string(pv.UID),
+				"storage":      strconv.FormatInt(pv.Storage, 10),
+				"access_modes": pv.AccessModes}})
+		source := backendID(pv.BackendType, pv.BackendID)
+		if backend, ok := backends[source]; ok {
+			b.addNode(backend)
+			b.addEdge(GraphEdge{Source: source, Target: id, Type: Backs})
+		}
+	}
+
+	for _, pvc := range pvcs {
+		if pvc.CreateTime.IsZero() ||
+			!existsAt(pvc.CreateTime, pvc.DeleteTime, opts.At) {
+			continue
+		}
+		id := nodeID(dbmanager.PVC, string(pvc.UID))
+		b.addNode(GraphNode{ID: id, Type: dbmanager.PVC, Label: pvc.Name,
+			Namespace: pvc.Namespace,
+			Attrs: map[string]string{"uid": string(pvc.UID),
+				"storage": strconv.FormatInt(pvc.Storage, 10)}})
+		pvID := nodeID(dbmanager.PV, string(pvc.PVUID))
+		bound := !pvc.BindTime.IsZero() && (opts.At.IsZero() ||
+			!pvc.BindTime.After(opts.At))
+		if _, ok := b.nodes[pvID]; ok && bound {
+			b.addEdge(GraphEdge{Source: pvID, Target: id, Type: Binds})
+		}
+	}
+
+	podContainers := make(map[types.UID][]dbmanager.ContainerRecord)
+	for _, c := range containers {
+		podContainers[c.PodUID] = append(podContainers[c.PodUID], c)
+	}
+	for _, m := range mounts {
+		pvcID := nodeID(dbmanager.PVC, string(m.PVCUID))
+		if _, ok := b.nodes[pvcID]; !ok || m.PVCUID == "" ||
+			!existsAt(m.PodCreateTime, m.PodDeleteTime, opts.At) {
+			continue
+		}
+		podID := nodeID(dbmanager.Pod, string(m.PodUID))
+		if _, ok := b.nodes[podID]; !ok {
+			b.addNode(GraphNode{ID: podID, Type: dbmanager.Pod,
+				Label: m.PodName, Namespace: m.Namespace,
+				Attrs: map[string]string{"uid": string(m.PodUID)}})
+			for _, c := range podContainers[m.PodUID] {
+				cID := containerID(c.PodUID, c.Name)
+				b.addNode(GraphNode{ID: cID, Type: dbmanager.Container,
+					Label: c.Name, Namespace: m.Namespace,
+					Attrs: map[string]string{"image": c.Image,
+						"command": c.Command}})
+				b.addEdge(GraphEdge{Source: podID, Target: cID, Type: Runs})
+			}
+		}
+		cID := containerID(m.PodUID, m.ContainerName)
+		if _, ok := b.nodes[cID]; !ok {
+			b.addNode(GraphNode{ID: cID, Type: dbmanager.Container,
+				Label: m.ContainerName, Namespace: m.Namespace})
+			b.addEdge(GraphEdge{Source: podID, Target: cID, Type: Runs})
+		}
+		b.addEdge(GraphEdge{Source: pvcID, Target: cID, Type: MountedBy,
+			Attrs: map[string]string{
+				"read_only": strconv.FormatBool(m.ReadOnly)}})
+	}
+
+	return b.filter(opts, selectedBackends), nil
+}
+
+// filter returns the graph restricted to the nodes selected by opts.  The
+// backend filter selects the chosen backends, their descendants, and the
+// pods (and sibling containers) of any containers among them, while the
+// namespace filter selects the nodes in the namespace along with their
+// ancestors and descendants.  If both are specified, only nodes selected by
+// both are kept.
+func (b *graphBuilder) filter(opts GraphOptions,
+	selectedBackends []string) *Graph {
+
+	keep := func(string) bool { return true }
+	if opts.Backend != "" || opts.Server != "" {
+		byBackend := make(map[string]bool)
+		walk(selectedBackends, b.children, byBackend)
+		// Pods are parents of their containers rather than descendants of
+		// the claims they mount, but they're affected just the same, as are
+		// their other containers.
+		for _, e := range b.edges {
+			if e.Type == Runs && byBackend[e.Target] {
+				byBackend[e.Source] = true
+			}
+		}
+		for _, e := range b.edges {
+			if e.Type == Runs && byBackend[e.Source] {
+				byBackend[e.Target] = true
+			}
+		}
+		keep = func(id string) bool { return byBackend[id] }
+	}
+	if opts.Namespace != "" {
+		var inNS []string
+		for id, n := range b.nodes {
+			if n.Namespace == opts.Namespace {
+				inNS = append(inNS, id)
+			}
+		}
+		byNS := make(map[string]bool)
+		walk(inNS, b.children, byNS)
+		ancestors := make(map[string]bool)
+		walk(inNS, b.parents, ancestors)
+		keepBackend := keep
+		keep = func(id string) bool {
+			return keepBackend(id) && (byNS[id] || ancestors[id])
+		}
+	}
+
+	g := &Graph{Nodes: []GraphNode{}, Edges: []GraphEdge{}}
+	for id, n := range b.nodes {
+		if keep(id) {
+			g.Nodes = append(g.Nodes, *n)
+		}
+	}
+	for _, e := range b.edges {
+		if keep(e.Source) && keep(e.Target) {
+			g.Edges = append(g.Edges, *e)
+		}
+	}
+	sort.Sort(graphNodes(g.Nodes))
+	sort.Sort(graphEdges(g.Edges))
+	return g
+}
+
+var nodeOrder = map[dbmanager.Table]int{
+	dbmanager.NFS:       0,
+	dbmanager.ISCSI:     1,
+	dbmanager.PV:        2,
+	dbmanager.PVC:       3,
+	dbmanager.Pod:       4,
+	dbmanager.Container: 5,
+}
+
+type graphNodes []GraphNode
+
+func (n graphNodes) Len() int      { return len(n) }
+func (n graphNodes) Swap(i, j int) { n[i], n[j] = n[j], n[i] }
+func (n graphNodes) Less(i, j int) bool {
+	if n[i].Type != n[j].Type {
+		return nodeOrder[n[i].Type] < nodeOrder[n[j].Type]
+	}
+	return n[i].ID < n[j].ID
+}
+
+type graphEdges []GraphEdge
+
+func (e graphEdges) Len() int      { return len(e) }
+func (e graphEdges) Swap(i, j int) { e[i], e[j] = e[j], e[i] }
+func (e graphEdges) Less(i, j int) bool {
+	if e[i].Source != e[j].Source {
+		return e[i].Source < e[j].Source
+	}
+	return e[i].Target < e[j].Target
+}
+
+// sortedKeys returns the keys of attrs in sorted order.
+func sortedKeys(attrs map[string]string) []string {
+	keys := make([]string, 0, len(attrs))
+	for k := range attrs {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+var dotShapes = map[dbmanager.Table]string{
+	dbmanager.NFS:       "cylinder",
+	dbmanager.ISCSI:     "cylinder",
+	dbmanager.PV:        "box3d",
+	dbmanager.PVC:       "note",
+	dbmanager.Pod:       "box",
+	dbmanager.Container: "ellipse",
+}
+
+// WriteDOT writes g to w in the Graphviz DOT language.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	fmt.Fprintln(w, "digraph storage {")
+	fmt.Fprintln(w, "\trankdir=LR;")
+	for _, n := range g.Nodes {
+		label := n.Label
+		if n.Namespace != "" {
+			label = n.Namespace + "/" + n.Label
+		}
+		fmt.Fprintf(w, "\t%s [label=%s, shape=%s];\n", strconv.Quote(n.ID),
+			strconv.Quote(string(n.Type)+"\n"+label), dotShapes[n.Type])
+	}
+	for _, e := range g.Edges {
+		style := ""
+		if e.Attrs["read_only"] == "true" {
+			style = ", style=dashed"
+		}
+		fmt.Fprintf(w, "\t%s -> %s [label=%s%s];\n", strconv.Quote(e.Source),
+			strconv.Quote(e.Target), strconv.Quote(string(e.Type)), style)
+	}
+	_, err := fmt.Fprintln(w, "}")
+	return err
+}
+
+// WriteJSON writes g to w as a JSON node and edge list.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	return json.NewEncoder(w).Encode(g)
+}
+
+type graphMLData struct {
+	Key   string `xml:"key,attr"`
+	Value string `xml:",chardata"`
+}
+
+type graphMLKey struct {
+	ID   string `xml:"id,attr"`
+	For  string `xml:"for,attr"`
+	Name string `xml:"attr.name,attr"`
+	Type string `xml:"attr.type,attr"`
+}
+
+type graphMLNode struct {
+	ID   string        `xml:"id,attr"`
+	Data []graphMLData `xml:"data"`
+}
+
+type graphMLEdge struct {
+	Source string        `xml:"source,attr"`
+	Target string        `xml:"target,attr"`
+	Data   []graphMLData `xml:"data"`
+}
+
+type graphMLDoc struct {
+	XMLName xml.Name     `xml:"graphml"`
+	Xmlns   string       `xml:"xmlns,attr"`
+	Keys    []graphMLKey `xml:"key"`
+	Graph   struct {
+		ID          string        `xml:"id,attr"`
+		EdgeDefault string        `xml:"edgedefault,attr"`
+		Nodes       []graphMLNode `xml:"node"`
+		Edges       []graphMLEdge `xml:"edge"`
+	} `xml:"graph"`
+}
+
+// WriteGraphML writes g to w as GraphML.  Node and edge attributes are
+// written as string-valued data keys.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	doc := graphMLDoc{Xmlns: "http://graphml.graphdrawing.org/xmlns"}
+	doc.Graph.ID = "storage"
+	doc.Graph.EdgeDefault = "directed"
+
+	keys := make(map[string]bool)
+	addKey := func(domain, name string) string {
+		id := domain + "_" + name
+		if !keys[id] {
+			keys[id] = true
+			doc.Keys = append(doc.Keys, graphMLKey{ID: id, For: domain,
+				Name: name, Type: "string"})
+		}
+		return id
+	}
+	data := func(domain string, fixed [][2]string,
+		attrs map[string]string) []graphMLData {
+
+		var ret []graphMLData
+		for _, kv := range fixed {
+			if kv[1] != "" {
+				ret = append(ret, graphMLData{addKey(domain, kv[0]), kv[1]})
+			}
+		}
+		for _, k := range sortedKeys(attrs) {
+			ret = append(ret, graphMLData{addKey(domain, k), attrs[k]})
+		}
+		return ret
+	}
+
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, graphMLNode{ID: n.ID,
+			Data: data("node", [][2]string{{"type", string(n.Type)},
+				{"label", n.Label}, {"namespace", n.Namespace}}, n.Attrs)})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, graphMLEdge{
+			Source: e.Source, Target: e.Target,
+			Data: data("edge", [][2]string{{"type", string(e.Type)}},
+				e.Attrs)})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := fmt.Fprintln(w)
+	return err
+}
+
+// WriteGraph writes g to w in the named format:  dot, graphml, or json.
+func (g *Graph) WriteGraph(w io.Writer, format string) error {
+	switch format {
+	case "dot":
+		return g.WriteDOT(w)
+	case "graphml":
+		return g.WriteGraphML(w)
+	case "json":
+		return g.WriteJSON(w)
+	}
+	return fmt.Errorf("Unknown graph format %s", format)
+}
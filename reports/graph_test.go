@@ -0,0 +1,210 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reports
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory/testutils"
+)
+
+func getGraphFixture() dbmanager.Querier {
+	return newQuerier(testutils.Fixture{
+		NFS: []dbmanager.NFSRecord{
+			{ID: 1, Server: "10.0.0.5", Path: "/export/a"},
+			{ID: 2, Server: "10.0.0.6", Path: "/export/b"},
+		},
+		ISCSI: []dbmanager.ISCSIRecord{
+			{ID: 1, TargetPortal: "10.0.0.7:3260", IQN: "iqn.example", LUN: 0},
+		},
+		PVs: []dbmanager.PVRecord{
+			{UID: "pv-a", Name: "a", CreateTime: hoursIn(0),
+				BackendType: dbmanager.NFS, BackendID: 1},
+			{UID: "pv-b", Name: "b", CreateTime: hoursIn(0),
+				BackendType: dbmanager.NFS, BackendID: 2},
+			{UID: "pv-c", Name: "c", CreateTime: hoursIn(0),
+				DeleteTime: hoursIn(5), BackendType: dbmanager.ISCSI,
+				BackendID: 1},
+		},
+		PVCs: []dbmanager.PVCRecord{
+			{UID: "pvc-a", Name: "claim-a", Namespace: "ns1",
+				CreateTime: hoursIn(1), BindTime: hoursIn(1), PVUID: "pv-a"},
+			{UID: "pvc-b", Name: "claim-b", Namespace: "ns2",
+				CreateTime: hoursIn(1), BindTime: hoursIn(1), PVUID: "pv-b"},
+			{UID: "pvc-c", Name: "claim-c", Namespace: "ns1",
+				CreateTime: hoursIn(1), BindTime: hoursIn(2),
+				DeleteTime: hoursIn(4), PVUID: "pv-c"},
+		},
+		Mounts: []dbmanager.PodMountRecord{
+			{PodUID: "pod-1", PodName: "web", Namespace: "ns1",
+				PodCreateTime: hoursIn(2), ContainerName: "app",
+				PVCUID: "pvc-a"},
+			{PodUID: "pod-2", PodName: "db", Namespace: "ns2",
+				PodCreateTime: hoursIn(2), ContainerName: "app",
+				PVCUID: "pvc-b", ReadOnly: true},
+			{PodUID: "pod-3", PodName: "batch", Namespace: "ns1",
+				PodCreateTime: hoursIn(2), PodDeleteTime: hoursIn(3),
+				ContainerName: "job", PVCUID: "pvc-c"},
+		},
+		Containers: []dbmanager.ContainerRecord{
+			{PodUID: "pod-1", Name: "app", Image: "nginx"},
+			{PodUID: "pod-1", Name: "sidecar", Image: "logger"},
+			{PodUID: "pod-2", Name: "app", Image: "mysql"},
+			{PodUID: "pod-3", Name: "job", Image: "busybox"},
+		},
+	})
+}
+
+func nodeIDs(g *Graph) []string {
+	ids := make([]string, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ids = append(ids, n.ID)
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func checkNodes(t *testing.T, desc string, g *Graph, expected []string) {
+	sort.Strings(expected)
+	if ids := nodeIDs(g); !reflect.DeepEqual(ids, expected) {
+		t.Errorf("Incorrect nodes for %s.\n\tExpected:  %v\n\tGot:  %v",
+			desc, expected, ids)
+	}
+	for _, e := range g.Edges {
+		found := 0
+		for _, n := range g.Nodes {
+			if n.ID == e.Source || n.ID == e.Target {
+				found++
+			}
+		}
+		if found != 2 {
+			t.Errorf("Dangling edge in %s:  %v", desc, e)
+		}
+	}
+}
+
+func TestStorageGraphCurrent(t *testing.T) {
+	g, err := StorageGraph(getGraphFixture(), GraphOptions{})
+	if err != nil {
+		t.Fatal("Unable to build graph: ", err)
+	}
+	checkNodes(t, "current graph", g, []string{"nfs/1", "nfs/2", "pv/pv-a",
+		"pv/pv-b", "pvc/pvc-a", "pvc/pvc-b", "pod/pod-1", "pod/pod-2",
+		"container/pod-1/app", "container/pod-1/sidecar",
+		"container/pod-2/app"})
+	if len(g.Edges) != 9 {
+		t.Errorf("Expected 9 edges; got %d:  %v", len(g.Edges), g.Edges)
+	}
+}
+
+func TestStorageGraphPointInTime(t *testing.T) {
+	g, err := StorageGraph(getGraphFixture(), GraphOptions{At: hoursIn(2)})
+	if err != nil {
+		t.Fatal("Unable to build graph: ", err)
+	}
+	ids := nodeIDs(g)
+	for _, id := range []string{"iscsi/1", "pv/pv-c", "pvc/pvc-c",
+		"pod/pod-3", "container/pod-3/job"} {
+		if sort.SearchStrings(ids, id) == len(ids) ||
+			ids[sort.SearchStrings(ids, id)] != id {
+			t.Errorf("Expected %s in graph at hour 2; got %v", id, ids)
+		}
+	}
+}
+
+func TestStorageGraphFilters(t *testing.T) {
+	g, err := StorageGraph(getGraphFixture(), GraphOptions{
+		Backend: dbmanager.NFS,
+		Server:  "10.0.0.5",
+	})
+	if err != nil {
+		t.Fatal("Unable to build graph: ", err)
+	}
+	checkNodes(t, "NFS server filter", g, []string{"nfs/1", "pv/pv-a",
+		"pvc/pvc-a", "pod/pod-1", "container/pod-1/app",
+		"container/pod-1/sidecar"})
+
+	g, err = StorageGraph(getGraphFixture(), GraphOptions{Namespace: "ns2"})
+	if err != nil {
+		t.Fatal("Unable to build graph: ", err)
+	}
+	checkNodes(t, "namespace filter", g, []string{"nfs/2", "pv/pv-b",
+		"pvc/pvc-b", "pod/pod-2", "container/pod-2/app"})
+
+	g, err = StorageGraph(getGraphFixture(), GraphOptions{
+		Namespace: "ns2",
+		Backend:   dbmanager.ISCSI,
+	})
+	if err != nil {
+		t.Fatal("Unable to build graph: ", err)
+	}
+	checkNodes(t, "combined filter", g, []string{})
+}
+
+func TestWriteGraph(t *testing.T) {
+	g, err := StorageGraph(getGraphFixture(), GraphOptions{Namespace: "ns2"})
+	if err != nil {
+		t.Fatal("Unable to build graph: ", err)
+	}
+
+	var dot bytes.Buffer
+	if err = g.WriteGraph(&dot, "dot"); err != nil {
+		t.Fatal("Unable to write DOT: ", err)
+	}
+	if !strings.HasPrefix(dot.String(), "digraph storage {") ||
+		!strings.Contains(dot.String(), `"pv/pv-b" -> "pvc/pvc-b"`) ||
+		!strings.Contains(dot.String(), "style=dashed") {
+		t.Error("Incorrect DOT output:\n", dot.String())
+	}
+
+	var graphML bytes.Buffer
+	if err = g.WriteGraph(&graphML, "graphml"); err != nil {
+		t.Fatal("Unable to write GraphML: ", err)
+	}
+	var doc graphMLDoc
+	if err = xml.Unmarshal(graphML.Bytes(), &doc); err != nil {
+		t.Fatal("Unable to parse GraphML output: ", err)
+	}
+	if len(doc.Graph.Nodes) != len(g.Nodes) ||
+		len(doc.Graph.Edges) != len(g.Edges) {
+		t.Error("Incorrect GraphML output:\n", graphML.String())
+	}
+
+	var js bytes.Buffer
+	if err = g.WriteGraph(&js, "json"); err != nil {
+		t.Fatal("Unable to write JSON: ", err)
+	}
+	var decoded Graph
+	if err = json.Unmarshal(js.Bytes(), &decoded); err != nil {
+		t.Fatal("Unable to parse JSON output: ", err)
+	}
+	if !reflect.DeepEqual(&decoded, g) {
+		t.Errorf("JSON output doesn't round-trip.\n\tExpected:  %v\n\t"+
+			"Got:  %v", g, decoded)
+	}
+
+	if err = g.WriteGraph(&js, "png"); err == nil {
+		t.Error("Expected an error for an unknown format.")
+	}
+}
@@ -0,0 +1,249 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reports
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+// IdleOptions controls which volumes IdleVolumes reports.
+type IdleOptions struct {
+	// Now is the time against which idle durations are measured.
+	Now time.Time
+	// MinIdle omits volumes that have been idle for less than this.
+	MinIdle time.Duration
+	// ReclaimAfter flags volumes that have been idle for at least this long
+	// as candidates for reclamation.  If zero, nothing is flagged.
+	ReclaimAfter time.Duration
+	// MinConfidence omits volumes whose IdleSince is less trustworthy than
+	// this.  If unset, every volume is reported.
+	MinConfidence dbmanager.TimeSource
+}
+
+// IdleVolume describes a bound PVC or an existing PV that no running pod
+// currently mounts.
+type IdleVolume struct {
+	Type      dbmanager.Table `json:"type"`
+	UID       types.UID       `json:"uid"`
+	Name      string          `json:"name"`
+	Namespace string          `json:"namespace,omitempty"`
+	Storage   int64           `json:"storage"`
+	// LastUsed is the time that the last pod mounting the volume was deleted,
+	// or nil if no pod has ever mounted it.
+	LastUsed *time.Time `json:"last_used,omitempty"`
+	// IdleSince is LastUsed if set, and otherwise the time the PVC was bound
+	// or the PV was created.  IdleSinceSource records where it came from.
+	IdleSince        time.Time            `json:"idle_since"`
+	IdleSinceSource  dbmanager.TimeSource `json:"idle_since_source"`
+	ReclaimCandidate bool                 `json:"reclaim_candidate"`
+}
+
+// IdleFor returns how long the volume has been idle as of now.
+func (v IdleVolume) IdleFor(now time.Time) time.Duration {
+	return now.Sub(v.IdleSince)
+}
+
+// volumeUsage tracks the pods that have mounted a single PVC.
+type volumeUsage struct {
+	inUse          bool
+	lastUsed       time.Time
+	lastUsedSource dbmanager.TimeSource
+}
+
+func (u *volumeUsage) add(m dbmanager.PodMountRecord) {
+	if m.PodDeleteTime.IsZero() {
+		u.inUse = true
+	} else if m.PodDeleteTime.After(u.lastUsed) {
+		u.lastUsed = m.PodDeleteTime
+		u.lastUsedSource = m.PodDeleteTimeSource
+	}
+}
+
+func (u *volumeUsage) merge(other *volumeUsage) {
+	u.inUse = u.inUse || other.inUse
+	if other.lastUsed.After(u.lastUsed) {
+		u.lastUsed = other.lastUsed
+		u.lastUsedSource = other.lastUsedSource
+	}
+}
+
+// newIdleVolume returns an IdleVolume for a volume with the given usage,
+// falling back to fallback, from the given source, when it has never been
+// mounted.
+func newIdleVolume(t dbmanager.Table, uid types.UID, name, namespace string,
+	storage int64, usage volumeUsage, fallback time.Time,
+	fallbackSource dbmanager.TimeSource) IdleVolume {
+
+	v := IdleVolume{Type: t, UID: uid, Name: name, Namespace: namespace,
+		Storage: storage, IdleSince: fallback,
+		IdleSinceSource: fallbackSource}
+	if !usage.lastUsed.IsZero() {
+		lastUsed := usage.lastUsed
+		v.LastUsed = &lastUsed
+		v.IdleSince = lastUsed
+		v.IdleSinceSource = usage.lastUsedSource
+	}
+	return v
+}
+
+// IdleVolumes returns the bound PVCs and existing PVs that no running pod
+// mounts, ranked from longest to shortest idle.  A PV is idle if no pod
+// mounts any claim that has been bound to it, so it may accumulate usage
+// across several claims.  If q is also a dbmanager.Pruner, the mounts of
+// pruned pods count as well.
+func IdleVolumes(q dbmanager.Querier, opts IdleOptions) ([]IdleVolume,
+	error) {
+
+	pvs, err := q.ListPVs()
+	if err != nil {
+		return nil, err
+	}
+	pvcs, err := q.ListPVCs()
+	if err != nil {
+		return nil, err
+	}
+	mounts, err := q.ListPodMounts()
+	if err != nil {
+		return nil, err
+	}
+
+	pvcUsage := make(map[types.UID]*volumeUsage)
+	getUsage := func(uid types.UID) *volumeUsage {
+		u, ok := pvcUsage[uid]
+		if !ok {
+			u = &volumeUsage{}
+			pvcUsage[uid] = u
+		}
+		return u
+	}
+	for _, m := range mounts {
+		if m.PVCUID == "" {
+			continue
+		}
+		getUsage(m.PVCUID).add(m)
+	}
+	if p, ok := q.(dbmanager.Pruner); ok {
+		summaries, err := p.ListMountSummaries()
+		if err != nil {
+			return nil, err
+		}
+		for _, s := range summaries {
+			if s.PVCUID == "" {
+				continue
+			}
+			// Pod deletion times always come from the pods themselves.
+			getUsage(s.PVCUID).merge(&volumeUsage{
+				lastUsed: s.LastUnmounted, lastUsedSource: dbmanager.TimeExact})
+		}
+	}
+
+	var ret []IdleVolume
+	pvUsage := make(map[types.UID]*volumeUsage)
+	for _, pvc := range pvcs {
+		if pvc.PVUID == "" {
+			continue
+		}
+		usage := pvcUsage[pvc.UID]
+		if usage == nil {
+			usage = &volumeUsage{}
+		}
+		if _, ok := pvUsage[pvc.PVUID]; !ok {
+			pvUsage[pvc.PVUID] = &volumeUsage{}
+		}
+		pvUsage[pvc.PVUID].merge(usage)
+		if !pvc.DeleteTime.IsZero() || pvc.CreateTime.IsZero() ||
+			usage.inUse {
+			// Skip deleted claims and those we've only seen the bind for.
+			continue
+		}
+		ret = append(ret, newIdleVolume(dbmanager.PVC, pvc.UID, pvc.Name,
+			pvc.Namespace, pvc.Storage, *usage, pvc.BindTime,
+			pvc.BindTimeSource))
+	}
+	for _, pv := range pvs {
+		if !pv.DeleteTime.IsZero() {
+			continue
+		}
+		usage := pvUsage[pv.UID]
+		if usage == nil {
+			usage = &volumeUsage{}
+		}
+		if usage.inUse {
+			continue
+		}
+		ret = append(ret, newIdleVolume(dbmanager.PV, pv.UID, pv.Name, "",
+			pv.Storage, *usage, pv.CreateTime, dbmanager.TimeExact))
+	}
+
+	filtered := ret[:0]
+	for _, v := range ret {
+		idle := v.IdleFor(opts.Now)
+		if idle < opts.MinIdle ||
+			!v.IdleSinceSource.AtLeast(opts.MinConfidence) {
+			continue
+		}
+		v.ReclaimCandidate = opts.ReclaimAfter > 0 &&
+			idle >= opts.ReclaimAfter
+		filtered = append(filtered, v)
+	}
+	sort.Sort(idleVolumes(filtered))
+	return filtered, nil
+}
+
+type idleVolumes []IdleVolume
+
+func (v idleVolumes) Len() int      { return len(v) }
+func (v idleVolumes) Swap(i, j int) { v[i], v[j] = v[j], v[i] }
+func (v idleVolumes) Less(i, j int) bool {
+	if !v[i].IdleSince.Equal(v[j].IdleSince) {
+		return v[i].IdleSince.Before(v[j].IdleSince)
+	}
+	if v[i].Type != v[j].Type {
+		return v[i].Type < v[j].Type
+	}
+	return v[i].UID < v[j].UID
+}
+
+// WriteIdleTable writes vols to w as an aligned, human-readable table.
+func WriteIdleTable(w io.Writer, vols []IdleVolume, now time.Time) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "TYPE\tNAMESPACE\tNAME\tSIZE (GB)\tLAST USED\tIDLE\t"+
+		"SOURCE\tRECLAIM")
+	for _, v := range vols {
+		lastUsed := "never"
+		if v.LastUsed != nil {
+			lastUsed = v.LastUsed.Format(time.RFC3339)
+		}
+		reclaim := ""
+		if v.ReclaimCandidate {
+			reclaim = "yes"
+		}
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%.2f\t%s\t%s\t%s\t%s\n", v.Type,
+			v.Namespace, v.Name, float64(v.Storage)/BytesPerGB, lastUsed,
+			v.IdleFor(now)/time.Second*time.Second, v.IdleSinceSource,
+			reclaim)
+	}
+	return tw.Flush()
+}
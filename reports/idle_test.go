@@ -0,0 +1,240 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reports
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory/testutils"
+)
+
+func getIdleFixture() dbmanager.Querier {
+	return newQuerier(testutils.Fixture{
+		PVs: []dbmanager.PVRecord{
+			{UID: "pv-used", Name: "pv-used", CreateTime: hoursIn(0),
+				BackendType: dbmanager.NFS},
+			{UID: "pv-idle", Name: "pv-idle", CreateTime: hoursIn(0),
+				BackendType: dbmanager.NFS},
+			{UID: "pv-unbound", Name: "pv-unbound", CreateTime: hoursIn(2),
+				BackendType: dbmanager.NFS},
+			{UID: "pv-deleted", Name: "pv-deleted", CreateTime: hoursIn(0),
+				DeleteTime: hoursIn(1), BackendType: dbmanager.NFS},
+		},
+		PVCs: []dbmanager.PVCRecord{
+			// Mounted by a running pod.
+			{UID: "pvc-used", Name: "used", Namespace: "ns1",
+				CreateTime: hoursIn(1), BindTime: hoursIn(1),
+				PVUID: "pv-used"},
+			// Mounted by two pods, both since deleted.
+			{UID: "pvc-idle", Name: "idle", Namespace: "ns1",
+				CreateTime: hoursIn(1), BindTime: hoursIn(1),
+				PVUID: "pv-idle"},
+			// Bound, but never mounted.
+			{UID: "pvc-never", Name: "never", Namespace: "ns2",
+				CreateTime: hoursIn(3), BindTime: hoursIn(4),
+				PVUID: "pv-unbound", BindTimeSource: dbmanager.TimeInferred},
+			// Deleted claims previously bound to pv-unbound shouldn't be
+			// reported.
+			{UID: "pvc-deleted", Name: "deleted", Namespace: "ns2",
+				CreateTime: hoursIn(2), BindTime: hoursIn(2),
+				DeleteTime: hoursIn(3), PVUID: "pv-unbound"},
+			// Unbound claims aren't volumes.
+			{UID: "pvc-pending", Name: "pending", Namespace: "ns2",
+				CreateTime: hoursIn(2)},
+		},
+		Mounts: []dbmanager.PodMountRecord{
+			{PodUID: "pod-1", Namespace: "ns1", PodCreateTime: hoursIn(2),
+				PVCUID: "pvc-used"},
+			{PodUID: "pod-2", Namespace: "ns1", PodCreateTime: hoursIn(2),
+				PodDeleteTime: hoursIn(6), PVCUID: "pvc-idle",
+				PodDeleteTimeSource: dbmanager.TimeExact},
+			{PodUID: "pod-3", Namespace: "ns1", PodCreateTime: hoursIn(2),
+				PodDeleteTime: hoursIn(8), PVCUID: "pvc-idle",
+				PodDeleteTimeSource: dbmanager.TimeExact},
+			{PodUID: "pod-4", Namespace: "ns2", PodCreateTime: hoursIn(2),
+				PodDeleteTime: hoursIn(3), PVCUID: "pvc-deleted",
+				PodDeleteTimeSource: dbmanager.TimeExact},
+			// Unresolved mounts are ignored.
+			{PodUID: "pod-5", Namespace: "ns2", PodCreateTime: hoursIn(2),
+				PVCName: "missing"},
+		},
+	})
+}
+
+func TestIdleVolumes(t *testing.T) {
+	vols, err := IdleVolumes(getIdleFixture(), IdleOptions{
+		Now:          hoursIn(20),
+		ReclaimAfter: 15 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal("Unable to find idle volumes: ", err)
+	}
+
+	expected := []struct {
+		uid       string
+		idleSince time.Time
+		used      bool
+		reclaim   bool
+	}{
+		{"pv-unbound", hoursIn(3), true, true},
+		{"pvc-never", hoursIn(4), false, true},
+		{"pv-idle", hoursIn(8), true, false},
+		{"pvc-idle", hoursIn(8), true, false},
+	}
+	if len(vols) != len(expected) {
+		t.Fatalf("Expected %d idle volumes; got %d:  %v", len(expected),
+			len(vols), vols)
+	}
+	for i, e := range expected {
+		v := vols[i]
+		if string(v.UID) != e.uid || !v.IdleSince.Equal(e.idleSince) ||
+			(v.LastUsed != nil) != e.used || v.ReclaimCandidate != e.reclaim {
+			t.Errorf("Incorrect idle volume at rank %d.\n\tExpected:  %v\n\t"+
+				"Got:  %v", i, e, v)
+		}
+	}
+}
+
+func TestIdleVolumesMinIdle(t *testing.T) {
+	vols, err := IdleVolumes(getIdleFixture(), IdleOptions{
+		Now:     hoursIn(20),
+		MinIdle: 16 * time.Hour,
+	})
+	if err != nil {
+		t.Fatal("Unable to find idle volumes: ", err)
+	}
+	if len(vols) != 2 {
+		t.Errorf("Expected 2 volumes idle for at least 16 hours; got %d",
+			len(vols))
+	}
+	for _, v := range vols {
+		if v.ReclaimCandidate {
+			t.Errorf("%s flagged for reclamation with no threshold.", v.UID)
+		}
+	}
+}
+
+func TestIdleVolumesMinConfidence(t *testing.T) {
+	vols, err := IdleVolumes(getIdleFixture(), IdleOptions{
+		Now:           hoursIn(20),
+		MinConfidence: dbmanager.TimeObserved,
+	})
+	if err != nil {
+		t.Fatal("Unable to find idle volumes: ", err)
+	}
+	// pvc-never has only been idle since its bind, which was inferred.
+	if len(vols) != 3 {
+		t.Fatalf("Expected 3 volumes; got %d:  %v", len(vols), vols)
+	}
+	for _, v := range vols {
+		if v.UID == "pvc-never" {
+			t.Error("pvc-never reported despite its inferred idle time.")
+		}
+		if v.IdleSinceSource != dbmanager.TimeExact {
+			t.Errorf("Expected %s to be idle since an exact time; got %s",
+				v.UID, v.IdleSinceSource)
+		}
+	}
+}
+
+// prunedQuerier adds the mount summaries left by pruned pods to a
+// Querier.
+type prunedQuerier struct {
+	dbmanager.Querier
+	summaries []dbmanager.MountSummaryRecord
+}
+
+func (p *prunedQuerier) DeletedPods(time.Time,
+	int) ([]dbmanager.PodRecord, error) {
+
+	return nil, nil
+}
+
+func (p *prunedQuerier) PrunePods([]types.UID) error {
+	return nil
+}
+
+func (p *prunedQuerier) ListMountSummaries() (
+	[]dbmanager.MountSummaryRecord, error) {
+
+	return p.summaries, nil
+}
+
+func TestIdleVolumesPruned(t *testing.T) {
+	q := &prunedQuerier{
+		Querier: getIdleFixture(),
+		summaries: []dbmanager.MountSummaryRecord{
+			{PVCUID: "pvc-never", PVCName: "never", Namespace: "ns2",
+				Pods: 3, FirstMounted: hoursIn(4),
+				LastUnmounted: hoursIn(10)},
+			// Older than pod-3's mount, so it doesn't change anything.
+			{PVCUID: "pvc-idle", PVCName: "idle", Namespace: "ns1",
+				Pods: 1, FirstMounted: hoursIn(1),
+				LastUnmounted: hoursIn(5)},
+		},
+	}
+	vols, err := IdleVolumes(q, IdleOptions{Now: hoursIn(20)})
+	if err != nil {
+		t.Fatal("Unable to find idle volumes: ", err)
+	}
+	for _, v := range vols {
+		var expected time.Time
+
+		switch v.UID {
+		case "pvc-never", "pv-unbound":
+			expected = hoursIn(10)
+		case "pvc-idle", "pv-idle":
+			expected = hoursIn(8)
+		default:
+			continue
+		}
+		if v.LastUsed == nil || !v.LastUsed.Equal(expected) {
+			t.Errorf("Expected %s to be last used at %s; got %v", v.UID,
+				expected, v.LastUsed)
+		}
+	}
+}
+
+func TestWriteIdleTable(t *testing.T) {
+	var buf bytes.Buffer
+
+	now := hoursIn(20)
+	vols, err := IdleVolumes(getIdleFixture(), IdleOptions{Now: now})
+	if err != nil {
+		t.Fatal("Unable to find idle volumes: ", err)
+	}
+	if err = WriteIdleTable(&buf, vols, now); err != nil {
+		t.Fatal("Unable to write table: ", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != len(vols)+1 {
+		t.Errorf("Expected %d lines; got %d", len(vols)+1, len(lines))
+	}
+	if !strings.Contains(lines[1], "17h0m0s") {
+		t.Error("Incorrect row for pv-unbound:  ", lines[1])
+	}
+	if !strings.Contains(lines[2], "never") ||
+		!strings.Contains(lines[2], "inferred") {
+		t.Error("Incorrect row for pvc-never:  ", lines[2])
+	}
+}
@@ -0,0 +1,86 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reports
+
+import (
+	"sort"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+)
+
+// InventoryRow counts the existing PVs on a backend type with a given
+// status.
+type InventoryRow struct {
+	Backend dbmanager.Table
+	Status  PVStatus
+	Count   int
+	Bytes   int64
+}
+
+type inventoryKey struct {
+	backend dbmanager.Table
+	status  PVStatus
+}
+
+// PVInventory returns the number and total capacity of existing PVs, broken
+// down by backend type and status (bound, released, or unbound).  Rows
+// are sorted by backend and status.
+func PVInventory(q dbmanager.Querier) ([]InventoryRow, error) {
+	pvs, err := q.ListPVs()
+	if err != nil {
+		return nil, err
+	}
+	pvcs, err := q.ListPVCs()
+	if err != nil {
+		return nil, err
+	}
+
+	lastBound := lastBoundClaims(pvcs)
+	totals := make(map[inventoryKey]*InventoryRow)
+	for _, pv := range pvs {
+		status := pvStatus(pv, lastBound[pv.UID])
+		if status == StatusDeleted {
+			continue
+		}
+		k := inventoryKey{pv.BackendType, status}
+		row, ok := totals[k]
+		if !ok {
+			row = &InventoryRow{Backend: k.backend, Status: k.status}
+			totals[k] = row
+		}
+		row.Count++
+		row.Bytes += pv.Storage
+	}
+
+	ret := make([]InventoryRow, 0, len(totals))
+	for _, row := range totals {
+		ret = append(ret, *row)
+	}
+	sort.Sort(inventoryRows(ret))
+	return ret, nil
+}
+
+type inventoryRows []InventoryRow
+
+func (r inventoryRows) Len() int      { return len(r) }
+func (r inventoryRows) Swap(i, j int) { r[i], r[j] = r[j], r[i] }
+func (r inventoryRows) Less(i, j int) bool {
+	if r[i].Backend != r[j].Backend {
+		return r[i].Backend < r[j].Backend
+	}
+	return r[i].Status < r[j].Status
+}
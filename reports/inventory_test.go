@@ -0,0 +1,63 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package reports
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory/testutils"
+)
+
+func TestPVInventory(t *testing.T) {
+	q := newQuerier(testutils.Fixture{
+		PVs: []dbmanager.PVRecord{
+			{UID: "pv-bound", Storage: 10, BackendType: dbmanager.NFS},
+			{UID: "pv-released", Storage: 20, BackendType: dbmanager.NFS},
+			{UID: "pv-rebound", Storage: 40, BackendType: dbmanager.NFS},
+			{UID: "pv-unbound", Storage: 80, BackendType: dbmanager.NFS},
+			{UID: "pv-unbound-2", Storage: 160, BackendType: dbmanager.NFS},
+			{UID: "pv-iscsi", Storage: 320, BackendType: dbmanager.ISCSI},
+			{UID: "pv-deleted", Storage: 640, DeleteTime: hoursIn(1),
+				BackendType: dbmanager.ISCSI},
+		},
+		PVCs: []dbmanager.PVCRecord{
+			{UID: "pvc-1", BindTime: hoursIn(0), PVUID: "pv-bound"},
+			{UID: "pvc-2", BindTime: hoursIn(0), DeleteTime: hoursIn(1),
+				PVUID: "pv-released"},
+			// Released, then bound to a new claim.
+			{UID: "pvc-3", BindTime: hoursIn(0), DeleteTime: hoursIn(1),
+				PVUID: "pv-rebound"},
+			{UID: "pvc-4", BindTime: hoursIn(2), PVUID: "pv-rebound"},
+		},
+	})
+	rows, err := PVInventory(q)
+	if err != nil {
+		t.Fatal("Unable to compute inventory: ", err)
+	}
+	expected := []InventoryRow{
+		{dbmanager.ISCSI, StatusUnbound, 1, 320},
+		{dbmanager.NFS, StatusBound, 2, 50},
+		{dbmanager.NFS, StatusReleased, 1, 20},
+		{dbmanager.NFS, StatusUnbound, 2, 240},
+	}
+	if !reflect.DeepEqual(rows, expected) {
+		t.Errorf("Incorrect inventory.\n\tExpected:  %v\n\tGot:  %v",
+			expected, rows)
+	}
+}
@@ -23,11 +23,13 @@ import (
 )
 
 // Resource is used to wrap Kubernetes API elements to provide some degree
-// of polymorphism for basic methods (getting the UID and resource version of
-// an object, as well as its string representation).
+// of polymorphism for basic methods (getting the UID, resource version,
+// namespace, and labels of an object, as well as its string representation).
 type Resource interface {
 	GetUID() types.UID
 	GetRV() string
+	GetNamespace() string // Empty for PVs, which aren't namespaced.
+	GetLabels() map[string]string
 	String() string // Here for debugging purposes.
 }
 
@@ -39,6 +41,14 @@ func (p *PodResource) GetRV() string { return p.ResourceVersion }
 func (p *PVResource) GetRV() string  { return p.ResourceVersion }
 func (p *PVCResource) GetRV() string { return p.ResourceVersion }
 
+func (p *PodResource) GetNamespace() string { return p.Namespace }
+func (p *PVResource) GetNamespace() string  { return p.Namespace }
+func (p *PVCResource) GetNamespace() string { return p.Namespace }
+
+func (p *PodResource) GetLabels() map[string]string { return p.Labels }
+func (p *PVResource) GetLabels() map[string]string  { return p.Labels }
+func (p *PVCResource) GetLabels() map[string]string { return p.Labels }
+
 func (p *PodResource) String() string {
 	ret := fmt.Sprintf("Pod %s, host %s, RV %s",
 		p.Name,
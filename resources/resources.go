@@ -51,19 +51,20 @@ type ContainerDesc struct {
 	// TODO:  Include mount path?
 }
 
-// PodResource wraps an api.Pod and implements the Resource interface.
+// PodResource wraps an api.Pod and implements the Resource interface.  The
+// wrappers hold pointers, so that wrapping a decoded object doesn't copy it.
 type PodResource struct {
-	api.Pod
+	*api.Pod
 }
 
 // PVResource wraps an api.PersistentVolume and implements the Resource
 // interface.
 type PVResource struct {
-	api.PersistentVolume
+	*api.PersistentVolume
 }
 
 // PVResource wraps an api.PersistentVolumeClaim and implements the Resource
 // interface.
 type PVCResource struct {
-	api.PersistentVolumeClaim
+	*api.PersistentVolumeClaim
 }
@@ -0,0 +1,58 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// recordRevision stores the object carried by an event line, received at
+// the given time, as a new revision, if the backend keeps them.
+func (w *Watcher) recordRevision(resource resources.ResourceType,
+	eventType EventType, r resources.Resource, line string,
+	received time.Time) {
+
+	var event struct {
+		Object json.RawMessage `json:"object"`
+	}
+
+	rs, ok := w.dbm.(dbmanager.RevisionStore)
+	if !ok || eventType == Error {
+		return
+	}
+	if err := json.Unmarshal([]byte(line), &event); err != nil {
+		log.Printf("Unable to extract revision %s of %s:  %s", r.GetRV(),
+			r.GetUID(), err)
+		return
+	}
+	err := rs.RecordRevision(dbmanager.RevisionRecord{
+		UID:             r.GetUID(),
+		ResourceVersion: r.GetRV(),
+		Resource:        resource,
+		EventType:       string(eventType),
+		EventTime:       received,
+		JSON:            string(event.Object),
+	})
+	if err != nil {
+		log.Print("Unable to record revision: ", err)
+	}
+}
@@ -0,0 +1,123 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"fmt"
+
+	"k8s.io/kubernetes/pkg/fields"
+	"k8s.io/kubernetes/pkg/labels"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+/* When an object stops matching a watch's selectors (e.g., because it was
+   relabeled), the API server reports it as DELETED, even though it still
+   exists.  To tell these apart from real deletions, the Watcher checks
+   whether the object in a DELETED event still matches the selectors; a real
+   deletion reports the object as it was last seen, which did. */
+
+// unreadableField stands in for the value of a field that can't be read
+// here; no selector term compares against it.
+const unreadableField = "\x00"
+
+// selectors parses the selectors in opts, returning an error if the API
+// server would reject either of them.
+func (opts WatchOptions) selectors() (labels.Selector, fields.Selector,
+	error) {
+
+	labelSelector, err := labels.Parse(opts.LabelSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid label selector %q:  %v",
+			opts.LabelSelector, err)
+	}
+	fieldSelector, err := fields.ParseSelector(opts.FieldSelector)
+	if err != nil {
+		return nil, nil, fmt.Errorf("Invalid field selector %q:  %v",
+			opts.FieldSelector, err)
+	}
+	return labelSelector, fieldSelector, nil
+}
+
+// matches returns whether r matches the selectors in opts.  Field selector
+// terms on fields that can't be read here are assumed to match, as is
+// everything if the selectors can't be parsed.
+func (opts WatchOptions) matches(r resources.Resource) bool {
+	labelSelector, fieldSelector, err := opts.selectors()
+	if err != nil {
+		return true
+	}
+	if !labelSelector.Matches(labels.Set(r.GetLabels())) {
+		return false
+	}
+	set, err := fieldSet(fieldSelector, r)
+	if err != nil {
+		return true
+	}
+	return fieldSelector.Matches(set)
+}
+
+// fieldSet returns the values of the fields in selector for r.  Fields that
+// can't be read take the value selector requires of them, if any, so that
+// their terms match either way.
+func fieldSet(selector fields.Selector, r resources.Resource) (fields.Set,
+	error) {
+
+	set := fields.Set{}
+	_, err := selector.Transform(func(field, value string) (string, string,
+		error) {
+
+		if actual, ok := fieldValue(r, field); ok {
+			set[field] = actual
+		} else if required, ok := selector.RequiresExactMatch(field); ok {
+			set[field] = required
+		} else {
+			set[field] = unreadableField
+		}
+		return field, value, nil
+	})
+	return set, err
+}
+
+// fieldValue returns the value of one of the fields the API server accepts
+// in field selectors, or ok = false if it isn't one we know of.
+func fieldValue(r resources.Resource, field string) (value string, ok bool) {
+	switch field {
+	case "metadata.namespace":
+		return r.GetNamespace(), true
+	case "metadata.name":
+		switch r := r.(type) {
+		case *resources.PodResource:
+			return r.Name, true
+		case *resources.PVResource:
+			return r.Name, true
+		case *resources.PVCResource:
+			return r.Name, true
+		}
+	}
+	if p, isPod := r.(*resources.PodResource); isPod {
+		switch field {
+		case "spec.nodeName":
+			return p.Spec.NodeName, true
+		case "spec.restartPolicy":
+			return string(p.Spec.RestartPolicy), true
+		case "status.phase":
+			return string(p.Status.Phase), true
+		}
+	}
+	return "", false
+}
@@ -0,0 +1,316 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/metrics"
+	"github.com/netapp/kubevoltracker/reports"
+)
+
+const (
+	describePVPath = "/api/v1/describe/pv/"
+	revisionsPath  = "/api/v1/revisions/"
+)
+
+// newAPIHandler returns a handler serving the tracker's HTTP API.  q may be
+// nil if the backend does not support queries, in which case the query
+// endpoints return errors.
+func newAPIHandler(q dbmanager.Querier) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/api/v1/idle", queryHandler(q, serveIdle))
+	mux.HandleFunc(describePVPath, queryHandler(q, serveDescribePV))
+	mux.HandleFunc("/api/v1/graph", queryHandler(q, serveGraph))
+	mux.Handle("/metrics", metrics.Handler())
+	return mux
+}
+
+// serveAPI serves handler on addr until the process exits.
+func serveAPI(addr string, handler http.Handler) {
+	log.Print("Serving HTTP API on ", addr)
+	if err := http.ListenAndServe(addr, handler); err != nil {
+		log.Fatal("HTTP server failed: ", err)
+	}
+}
+
+// queryHandler wraps an endpoint that needs a Querier, rejecting requests
+// if q is nil.
+func queryHandler(q dbmanager.Querier,
+	serve func(dbmanager.Querier, http.ResponseWriter, *http.Request),
+) http.HandlerFunc {
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if q == nil {
+			http.Error(w, "Backend does not support queries.",
+				http.StatusNotImplemented)
+			return
+		}
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed.",
+				http.StatusMethodNotAllowed)
+			return
+		}
+		serve(q, w, r)
+	}
+}
+
+// addRevisionHandlers registers the revision endpoints on mux.  rs may be
+// nil if the backend does not keep revisions, in which case they return
+// errors.
+func addRevisionHandlers(mux *http.ServeMux, rs dbmanager.RevisionStore) {
+	mux.HandleFunc(revisionsPath, func(w http.ResponseWriter,
+		r *http.Request) {
+
+		if rs == nil {
+			http.Error(w, "Backend does not keep revisions.",
+				http.StatusNotImplemented)
+			return
+		}
+		if r.Method != "GET" {
+			http.Error(w, "Method not allowed.",
+				http.StatusMethodNotAllowed)
+			return
+		}
+		serveRevisions(rs, w, r)
+	})
+}
+
+// writeJSON writes v as the JSON body of a response.
+func writeJSON(w http.ResponseWriter, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		log.Print("Unable to write response: ", err)
+	}
+}
+
+// durationParam returns the value of the query parameter name as a
+// duration, or zero if it is absent.
+func durationParam(r *http.Request, name string) (time.Duration, error) {
+	value := r.URL.Query().Get(name)
+	if value == "" {
+		return 0, nil
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		return 0, fmt.Errorf("Invalid %s:  %s", name, err)
+	}
+	return d, nil
+}
+
+// confidenceParam returns the value of the min_confidence query parameter
+// as a time source, or dbmanager.TimeUnknown if it is absent.
+func confidenceParam(r *http.Request) (dbmanager.TimeSource, error) {
+	value := r.URL.Query().Get("min_confidence")
+	if value == "" {
+		return dbmanager.TimeUnknown, nil
+	}
+	return dbmanager.ParseTimeSource(value)
+}
+
+// serveIdle lists idle volumes.  The optional min_idle and reclaim_after
+// parameters correspond to the fields of reports.IdleOptions and take Go
+// duration strings (e.g., 720h); min_confidence takes a time source (e.g.,
+// observed).
+func serveIdle(q dbmanager.Querier, w http.ResponseWriter, r *http.Request) {
+	var (
+		opts = reports.IdleOptions{Now: time.Now()}
+		err  error
+	)
+
+	if opts.MinIdle, err = durationParam(r, "min_idle"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.ReclaimAfter, err = durationParam(r, "reclaim_after"); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if opts.MinConfidence, err = confidenceParam(r); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	vols, err := reports.IdleVolumes(q, opts)
+	if err != nil {
+		log.Print("Unable to find idle volumes: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if vols == nil {
+		vols = []reports.IdleVolume{}
+	}
+	writeJSON(w, struct {
+		Now     time.Time            `json:"now"`
+		Volumes []reports.IdleVolume `json:"volumes"`
+	}{opts.Now, vols})
+}
+
+// serveDescribePV returns the history of every PV with the name following
+// describePVPath.  The optional min_confidence parameter omits events whose
+// times are less trustworthy than the given time source.
+func serveDescribePV(q dbmanager.Querier, w http.ResponseWriter,
+	r *http.Request) {
+
+	name := strings.TrimPrefix(r.URL.Path, describePVPath)
+	if name == "" || strings.Contains(name, "/") {
+		http.Error(w, "Expected a PV name.", http.StatusBadRequest)
+		return
+	}
+	minConfidence, err := confidenceParam(r)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	histories, err := reports.DescribePV(q, name, minConfidence)
+	if err != nil {
+		log.Print("Unable to describe PV: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(histories) == 0 {
+		http.Error(w, fmt.Sprintf("No PV named %s found.", name),
+			http.StatusNotFound)
+		return
+	}
+	writeJSON(w, histories)
+}
+
+var graphContentTypes = map[string]string{
+	"json":    "application/json",
+	"dot":     "text/vnd.graphviz",
+	"graphml": "application/graphml+xml",
+}
+
+// serveGraph exports the storage graph.  The format parameter selects json
+// (the default), dot, or graphml; at takes an RFC 3339 time; and namespace,
+// backend, and server correspond to the fields of reports.GraphOptions.
+func serveGraph(q dbmanager.Querier, w http.ResponseWriter, r *http.Request) {
+	var (
+		params = r.URL.Query()
+		opts   = reports.GraphOptions{
+			Namespace: params.Get("namespace"),
+			Server:    params.Get("server"),
+		}
+		err error
+	)
+
+	format := params.Get("format")
+	if format == "" {
+		format = "json"
+	}
+	contentType, ok := graphContentTypes[format]
+	if !ok {
+		http.Error(w, "Unknown format "+format, http.StatusBadRequest)
+		return
+	}
+	if at := params.Get("at"); at != "" {
+		if opts.At, err = time.Parse(time.RFC3339, at); err != nil {
+			http.Error(w, fmt.Sprintf("Invalid at:  %s", err),
+				http.StatusBadRequest)
+			return
+		}
+	}
+	if backend := params.Get("backend"); backend != "" {
+		if opts.Backend, err = parseBackend(backend); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	g, err := reports.StorageGraph(q, opts)
+	if err != nil {
+		log.Print("Unable to build storage graph: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	if err = g.WriteGraph(w, format); err != nil {
+		log.Print("Unable to write response: ", err)
+	}
+}
+
+// revisionSummary describes a stored revision without its body.
+type revisionSummary struct {
+	ResourceVersion string    `json:"resource_version"`
+	Resource        string    `json:"resource"`
+	Type            string    `json:"type"`
+	Time            time.Time `json:"time"`
+}
+
+// serveRevisions lists the revisions of the object whose UID follows
+// revisionsPath or, if the UID is followed by a resource version, returns
+// the body of that revision.
+func serveRevisions(rs dbmanager.RevisionStore, w http.ResponseWriter,
+	r *http.Request) {
+
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, revisionsPath), "/")
+	if parts[0] == "" || len(parts) > 2 {
+		http.Error(w, "Expected a UID and optional resource version.",
+			http.StatusBadRequest)
+		return
+	}
+	uid := types.UID(parts[0])
+	if len(parts) == 2 {
+		rev, err := rs.GetRevision(uid, parts[1])
+		if err == dbmanager.ErrNoRevision {
+			http.Error(w, fmt.Sprintf("No revision %s of %s stored.",
+				parts[1], uid), http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Print("Unable to get revision: ", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		if _, err = io.WriteString(w, rev.JSON); err != nil {
+			log.Print("Unable to write response: ", err)
+		}
+		return
+	}
+
+	revs, err := rs.ListRevisions(uid)
+	if err != nil {
+		log.Print("Unable to list revisions: ", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	if len(revs) == 0 {
+		http.Error(w, fmt.Sprintf("No revisions of %s stored.", uid),
+			http.StatusNotFound)
+		return
+	}
+	summaries := make([]revisionSummary, len(revs))
+	for i, rev := range revs {
+		summaries[i] = revisionSummary{
+			ResourceVersion: rev.ResourceVersion,
+			Resource:        string(rev.Resource),
+			Type:            rev.EventType,
+			Time:            rev.EventTime,
+		}
+	}
+	writeJSON(w, summaries)
+}
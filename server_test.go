@@ -0,0 +1,253 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory"
+	"github.com/netapp/kubevoltracker/reports"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// stubQuerier serves canned records for API tests.
+type stubQuerier struct {
+	pvs        []dbmanager.PVRecord
+	pvcs       []dbmanager.PVCRecord
+	mounts     []dbmanager.PodMountRecord
+	containers []dbmanager.ContainerRecord
+	nfs        []dbmanager.NFSRecord
+	iscsi      []dbmanager.ISCSIRecord
+}
+
+func (s *stubQuerier) ListPVs() ([]dbmanager.PVRecord, error) {
+	return s.pvs, nil
+}
+
+func (s *stubQuerier) ListPVCs() ([]dbmanager.PVCRecord, error) {
+	return s.pvcs, nil
+}
+
+func (s *stubQuerier) ListPodMounts() ([]dbmanager.PodMountRecord, error) {
+	return s.mounts, nil
+}
+
+func (s *stubQuerier) ListContainers() ([]dbmanager.ContainerRecord, error) {
+	return s.containers, nil
+}
+
+func (s *stubQuerier) ListNFS() ([]dbmanager.NFSRecord, error) {
+	return s.nfs, nil
+}
+
+func (s *stubQuerier) ListISCSI() ([]dbmanager.ISCSIRecord, error) {
+	return s.iscsi, nil
+}
+
+func getStubQuerier() *stubQuerier {
+	created := time.Now().Add(-48 * time.Hour)
+	return &stubQuerier{
+		pvs: []dbmanager.PVRecord{
+			{UID: "pv-1", Name: "pv-1", CreateTime: created},
+		},
+		pvcs: []dbmanager.PVCRecord{
+			{UID: "pvc-1", Name: "claim", Namespace: "ns", CreateTime: created,
+				BindTime: created.Add(24 * time.Hour), PVUID: "pv-1"},
+		},
+	}
+}
+
+func apiGet(t *testing.T, handler http.Handler,
+	url string) *httptest.ResponseRecorder {
+
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		t.Fatal("Unable to create request: ", err)
+	}
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestServeIdle(t *testing.T) {
+	handler := newAPIHandler(getStubQuerier())
+
+	rec := apiGet(t, handler, "/api/v1/idle?min_idle=36h&reclaim_after=40h")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200; got %d:  %s", rec.Code, rec.Body)
+	}
+	var resp struct {
+		Volumes []reports.IdleVolume `json:"volumes"`
+	}
+	if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+		t.Fatal("Unable to decode response: ", err)
+	}
+	if len(resp.Volumes) != 1 || resp.Volumes[0].UID != "pv-1" ||
+		!resp.Volumes[0].ReclaimCandidate {
+		t.Error("Incorrect idle volumes returned:  ", resp.Volumes)
+	}
+
+	rec = apiGet(t, handler, "/api/v1/idle?min_idle=forever")
+	if rec.Code != http.StatusBadRequest {
+		t.Error("Expected status 400 for invalid duration; got ", rec.Code)
+	}
+}
+
+func TestServeDescribePV(t *testing.T) {
+	handler := newAPIHandler(getStubQuerier())
+
+	rec := apiGet(t, handler, "/api/v1/describe/pv/pv-1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200; got %d:  %s", rec.Code, rec.Body)
+	}
+	var histories []reports.PVHistory
+	if err := json.Unmarshal(rec.Body.Bytes(), &histories); err != nil {
+		t.Fatal("Unable to decode response: ", err)
+	}
+	if len(histories) != 1 || histories[0].Status != reports.StatusBound ||
+		len(histories[0].Events) != 3 {
+		t.Error("Incorrect history returned:  ", histories)
+	}
+
+	rec = apiGet(t, handler, "/api/v1/describe/pv/missing")
+	if rec.Code != http.StatusNotFound {
+		t.Error("Expected status 404 for missing PV; got ", rec.Code)
+	}
+}
+
+func TestServeGraph(t *testing.T) {
+	handler := newAPIHandler(getStubQuerier())
+
+	rec := apiGet(t, handler, "/api/v1/graph?namespace=ns")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200; got %d:  %s", rec.Code, rec.Body)
+	}
+	var g reports.Graph
+	if err := json.Unmarshal(rec.Body.Bytes(), &g); err != nil {
+		t.Fatal("Unable to decode response: ", err)
+	}
+	if len(g.Nodes) != 2 || len(g.Edges) != 1 {
+		t.Error("Incorrect graph returned:  ", g)
+	}
+
+	rec = apiGet(t, handler, "/api/v1/graph?format=dot&backend=iscsi")
+	if rec.Code != http.StatusOK ||
+		rec.Header().Get("Content-Type") != "text/vnd.graphviz" {
+		t.Errorf("Incorrect DOT response:  %d, %s", rec.Code, rec.Body)
+	}
+
+	for _, query := range []string{"format=png", "backend=ceph",
+		"at=yesterday"} {
+		rec = apiGet(t, handler, "/api/v1/graph?"+query)
+		if rec.Code != http.StatusBadRequest {
+			t.Errorf("Expected status 400 for %s; got %d", query, rec.Code)
+		}
+	}
+}
+
+func TestServeMetrics(t *testing.T) {
+	registerInventoryMetrics(getStubQuerier())
+	eventsProcessed.Inc("pods", "ADDED")
+
+	rec := apiGet(t, newAPIHandler(nil), "/metrics")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200; got %d:  %s", rec.Code, rec.Body)
+	}
+	body := rec.Body.String()
+	for _, s := range []string{
+		`kubevoltracker_events_total{resource="pods",type="ADDED"}`,
+		`kubevoltracker_pvs{backend="other",status="bound"} 1`,
+		`kubevoltracker_pv_bytes{backend="other",status="bound"} 0`,
+		"# TYPE kubevoltracker_watch_resets_total counter",
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("Metrics output missing %s:\n%s", s, body)
+		}
+	}
+}
+
+func TestServeWithoutQuerier(t *testing.T) {
+	rec := apiGet(t, newAPIHandler(nil), "/api/v1/idle")
+	if rec.Code != http.StatusNotImplemented {
+		t.Error("Expected status 501 without a querier; got ", rec.Code)
+	}
+}
+
+func TestServeRevisions(t *testing.T) {
+	const deleted = `{"metadata":{"name":"pod-1","namespace":"ns",` +
+		`"uid":"pod-1","resourceVersion":"11",` +
+		`"deletionTimestamp":"2016-06-01T00:00:00Z"}}`
+
+	manager := memory.New()
+	w := newReplayWatcher(manager)
+	for _, line := range []string{podEventLine("pod-1", "ns"),
+		`{"type":"DELETED","object":` + deleted + "}\n"} {
+		_, err := w.handleLine(resources.Pods, "", line,
+			receipt{time: time.Now()})
+		if err != nil {
+			t.Fatal("Unable to handle line: ", err)
+		}
+	}
+	mux := http.NewServeMux()
+	addRevisionHandlers(mux, manager.(dbmanager.RevisionStore))
+
+	rec := apiGet(t, mux, "/api/v1/revisions/pod-1")
+	if rec.Code != http.StatusOK {
+		t.Fatalf("Expected status 200; got %d:  %s", rec.Code, rec.Body)
+	}
+	var summaries []revisionSummary
+	if err := json.Unmarshal(rec.Body.Bytes(), &summaries); err != nil {
+		t.Fatal("Unable to decode response: ", err)
+	}
+	if len(summaries) != 2 || summaries[0].ResourceVersion != "10" ||
+		summaries[0].Type != "ADDED" || summaries[1].ResourceVersion != "11" ||
+		summaries[1].Type != "DELETED" ||
+		summaries[1].Resource != string(resources.Pods) {
+		t.Error("Incorrect revisions listed:  ", summaries)
+	}
+
+	rec = apiGet(t, mux, "/api/v1/revisions/pod-1/11")
+	if rec.Code != http.StatusOK || rec.Body.String() != deleted {
+		t.Errorf("Expected the deleted pod's body; got %d:  %s", rec.Code,
+			rec.Body)
+	}
+	for url, code := range map[string]int{
+		"/api/v1/revisions/pod-1/12":  http.StatusNotFound,
+		"/api/v1/revisions/missing":   http.StatusNotFound,
+		"/api/v1/revisions/":          http.StatusBadRequest,
+		"/api/v1/revisions/pod-1/1/2": http.StatusBadRequest,
+	} {
+		if rec = apiGet(t, mux, url); rec.Code != code {
+			t.Errorf("Expected status %d for %s; got %d", code, url,
+				rec.Code)
+		}
+	}
+
+	mux = http.NewServeMux()
+	addRevisionHandlers(mux, nil)
+	if rec = apiGet(t, mux, "/api/v1/revisions/pod-1"); rec.Code !=
+		http.StatusNotImplemented {
+		t.Error("Expected status 501 without a revision store; got ",
+			rec.Code)
+	}
+}
@@ -0,0 +1,81 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/netapp/kubevoltracker/dbmanager"
+	"github.com/netapp/kubevoltracker/dbmanager/memory"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// TestStaleEvents checks that events no newer than the last one applied to
+// an object are logged but not applied, whether they arrive on a watch or
+// are replayed from the log.
+func TestStaleEvents(t *testing.T) {
+	const deleteLine = `{"type":"DELETED","object":{"metadata":{` +
+		`"name":"pod-1","namespace":"ns","uid":"pod-1",` +
+		`"resourceVersion":"11",` +
+		`"deletionTimestamp":"2016-06-01T00:00:00Z"}}}`
+
+	manager := memory.New()
+	p := manager.(dbmanager.Pruner)
+	received := time.Date(2016, 6, 2, 0, 0, 0, 0, time.UTC)
+	stale := eventsStale.Value(string(resources.Pods))
+	w := newReplayWatcher(manager)
+	// The addition is delivered again after the deletion, as it would be by
+	// a watch restarted from an older RV, and the deletion is duplicated.
+	for _, line := range []string{podEventLine("pod-1", "ns"), deleteLine,
+		podEventLine("pod-1", "ns"), deleteLine} {
+
+		if _, err := w.handleLine(resources.Pods, "ns", line,
+			receipt{time: received}); err != nil {
+			t.Fatal("Unable to handle line: ", err)
+		}
+	}
+	if n := eventsStale.Value(string(resources.Pods)) - stale; n != 2 {
+		t.Errorf("Expected two stale events; got %v", n)
+	}
+
+	check := func(when string) {
+		pods, err := p.DeletedPods(received, 10)
+		if err != nil || len(pods) != 1 {
+			t.Fatalf("Expected pod to stay deleted %s; got %v, %v", when,
+				pods, err)
+		}
+		if rv := manager.ObjectRV("pod-1"); rv != "11" {
+			t.Errorf("Expected RV 11 for pod-1 %s; got %s", when, rv)
+		}
+	}
+	check("after handling")
+	revs, err := manager.(dbmanager.RevisionStore).ListRevisions("pod-1")
+	if err != nil || len(revs) != 2 {
+		t.Errorf("Expected only the applied revisions; got %v, %v", revs,
+			err)
+	}
+
+	replayed, err := newReplayWatcher(manager).Rebuild()
+	if err != nil {
+		t.Fatal("Unable to rebuild: ", err)
+	}
+	if replayed != 4 {
+		t.Errorf("Expected to replay four events; replayed %d", replayed)
+	}
+	check("after rebuilding")
+}
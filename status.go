@@ -0,0 +1,159 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+)
+
+// StatusError is an error reported by the API server as a Status object,
+// either in place of a response (e.g., when a watch can't be started) or
+// in an ERROR event on a watch stream, which the API server closes after
+// sending one.
+type StatusError struct {
+	Code    int32
+	Reason  unversioned.StatusReason
+	Message string
+}
+
+func newStatusError(status unversioned.Status) *StatusError {
+	return &StatusError{Code: status.Code, Reason: status.Reason,
+		Message: status.Message}
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("API server returned status %d (%s):  %s", e.Code,
+		e.reasonLabel(), e.Message)
+}
+
+// reasonLabel returns the reason for the error, or "Unknown" if the API
+// server didn't give one.
+func (e *StatusError) reasonLabel() string {
+	if e.Reason == unversioned.StatusReasonUnknown {
+		return "Unknown"
+	}
+	return string(e.Reason)
+}
+
+// The default delays before restarting a watch after a Status error; see
+// Watcher.retryDelay.
+const (
+	defaultRetryDelay    = time.Second
+	defaultMaxRetryDelay = time.Minute
+
+	// maxRetryDoublings bounds the doublings of the retry delay, so that
+	// the shift can't overflow.
+	maxRetryDoublings = 16
+)
+
+// statusRecovery is how a watch recovers from a StatusError.
+type statusRecovery int
+
+const (
+	// recoverRelist restarts the watch without a resource version, since
+	// the one it was using has expired.
+	recoverRelist statusRecovery = iota
+	// recoverRetry restarts the watch from the same resource version after
+	// a backoff, for errors that should clear up on their own.
+	recoverRetry
+	// recoverAuth also restarts the watch from the same resource version,
+	// but always after the longest backoff, since the error won't clear
+	// until the tracker's credentials or permissions are fixed.
+	recoverAuth
+)
+
+func (r statusRecovery) String() string {
+	switch r {
+	case recoverRelist:
+		return "relist"
+	case recoverAuth:
+		return "auth"
+	default:
+		return "retry"
+	}
+}
+
+// recovery returns how a watch should recover from e.  The reason is used
+// if there is one, since it's more specific than the code.
+func (e *StatusError) recovery() statusRecovery {
+	switch e.Reason {
+	case unversioned.StatusReasonExpired, unversioned.StatusReasonGone:
+		return recoverRelist
+	case unversioned.StatusReasonUnauthorized,
+		unversioned.StatusReasonForbidden:
+		return recoverAuth
+	case unversioned.StatusReasonUnknown:
+		switch e.Code {
+		case StatusTooOld:
+			return recoverRelist
+		case http.StatusUnauthorized, http.StatusForbidden:
+			return recoverAuth
+		}
+	}
+	// Everything else, including InternalError, ServerTimeout, and
+	// ServiceUnavailable, is retried.  Errors that the tracker can't fix by
+	// retrying (e.g., BadRequest) are logged, so they can be diagnosed.
+	return recoverRetry
+}
+
+// decodeStatus returns the Status object in line, which may be either an
+// ERROR event or a bare Status, or nil if line holds neither.
+func decodeStatus(line []byte) *StatusError {
+	var msg StatusMessage
+	if json.Unmarshal(line, &msg) == nil && msg.Type == Error {
+		return newStatusError(msg.Status)
+	}
+	var status unversioned.Status
+	if json.Unmarshal(line, &status) == nil &&
+		(status.Kind == "Status" ||
+			status.Status == unversioned.StatusFailure) {
+		return newStatusError(status)
+	}
+	return nil
+}
+
+// responseError returns the error described by an unsuccessful response,
+// which is a StatusError if the API server sent a Status object, and nil
+// for a successful response.
+func responseError(resp *http.Response) error {
+	if resp.StatusCode == http.StatusOK {
+		return nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(resp.Body, maxStatusSize))
+	if err == nil {
+		statusErr := decodeStatus(body)
+		if isProtobuf(resp) {
+			statusErr = decodeProtobufStatus(body)
+		}
+		if statusErr != nil {
+			return statusErr
+		}
+	}
+	return &StatusError{Code: int32(resp.StatusCode),
+		Message: resp.Status}
+}
+
+// maxStatusSize bounds how much of an unsuccessful response is read when
+// looking for a Status object.
+const maxStatusSize = 64 * 1024
@@ -0,0 +1,156 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api/unversioned"
+
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/fakeapi"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+func TestDecodeWatchLine(t *testing.T) {
+	const (
+		errorLine = `{"type":"ERROR","object":{"kind":"Status",` +
+			`"status":"Failure","message":"no access",` +
+			`"reason":"Forbidden","code":403}}`
+		statusLine = `{"kind":"Status","apiVersion":"v1",` +
+			`"status":"Failure","message":"too old","reason":"Gone",` +
+			`"code":410}`
+	)
+
+	e := decodeWatchLine(resources.Pods, []byte(podEventLine("pod-1", "ns")))
+	if _, ok := e.JSONEvent.(*PodEvent); !ok || e.Err != nil {
+		t.Errorf("Expected a pod event; got %v, %v", e.JSONEvent, e.Err)
+	}
+	for _, test := range []struct {
+		line   string
+		code   int32
+		reason unversioned.StatusReason
+	}{
+		{errorLine, http.StatusForbidden, unversioned.StatusReasonForbidden},
+		{statusLine, StatusTooOld, unversioned.StatusReasonGone},
+	} {
+		e = decodeWatchLine(resources.Pods, []byte(test.line))
+		statusErr, ok := e.Err.(*StatusError)
+		if !ok || statusErr.Code != test.code ||
+			statusErr.Reason != test.reason || e.JSON != test.line {
+			t.Errorf("Expected status %d (%s) for %s; got %v", test.code,
+				test.reason, test.line, e.Err)
+		}
+	}
+	e = decodeWatchLine(resources.Pods, []byte(`{"kind":"Pod"}`))
+	if _, ok := e.Err.(*StatusError); ok || e.Err == nil {
+		t.Error("Expected a decoding error; got ", e.Err)
+	}
+}
+
+func TestStatusRecovery(t *testing.T) {
+	for _, test := range []struct {
+		code     int32
+		reason   unversioned.StatusReason
+		recovery statusRecovery
+	}{
+		{StatusTooOld, unversioned.StatusReasonGone, recoverRelist},
+		{StatusTooOld, unversioned.StatusReasonExpired, recoverRelist},
+		{StatusTooOld, unversioned.StatusReasonUnknown, recoverRelist},
+		{http.StatusUnauthorized, unversioned.StatusReasonUnauthorized,
+			recoverAuth},
+		{http.StatusForbidden, unversioned.StatusReasonUnknown, recoverAuth},
+		{http.StatusInternalServerError,
+			unversioned.StatusReasonInternalError, recoverRetry},
+		{http.StatusGatewayTimeout, unversioned.StatusReasonTimeout,
+			recoverRetry},
+		{http.StatusBadRequest, unversioned.StatusReasonBadRequest,
+			recoverRetry},
+	} {
+		err := &StatusError{Code: test.code, Reason: test.reason}
+		if r := err.recovery(); r != test.recovery {
+			t.Errorf("Expected to %s after %s; got %s", test.recovery, err,
+				r)
+		}
+	}
+}
+
+// TestWatchStatusErrors checks that a watch resumes from where it left off
+// after errors that don't invalidate its resource version, and starts over
+// after one that does.
+func TestWatchStatusErrors(t *testing.T) {
+	server := fakeapi.New()
+	defer server.Close()
+
+	podA := newFakePod("pod-a")
+	rvA, err := server.Add(podA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	manager := &lockedManager{MockManager: mock.New(false).(*mock.MockManager)}
+	w, err := NewWatcher([]string{""}, server.Host(), manager)
+	if err != nil {
+		t.Fatal("Unable to create watcher: ", err)
+	}
+	w.retryDelay = 10 * time.Millisecond
+	w.maxRetryDelay = 50 * time.Millisecond
+	if err = w.Watch(resources.Pods, false); err != nil {
+		t.Fatal("Unable to watch pods: ", err)
+	}
+	defer w.Stop(resources.Pods)
+	waitForPod(t, manager, podA.UID, true)
+	waitForWatchRequests(t, server, 1)
+
+	statuses := []unversioned.Status{
+		{Code: http.StatusInternalServerError,
+			Reason: unversioned.StatusReasonInternalError},
+		{Code: http.StatusForbidden,
+			Reason: unversioned.StatusReasonForbidden},
+		{Code: StatusTooOld, Reason: unversioned.StatusReasonExpired},
+	}
+	before := make([]float64, len(statuses))
+	for i, status := range statuses {
+		before[i] = watchErrors.Value(string(resources.Pods),
+			string(status.Reason))
+	}
+	for i, status := range statuses {
+		if err = server.PushError(resources.Pods, status); err != nil {
+			t.Fatal(err)
+		}
+		waitForWatchRequests(t, server, i+2)
+	}
+
+	requests := waitForWatchRequests(t, server, 4)
+	for i, expected := range []string{"", rvA, rvA, ""} {
+		if requests[i].ResourceVersion != expected {
+			t.Errorf("Expected watch %d to start from %q; got %q", i,
+				expected, requests[i].ResourceVersion)
+		}
+	}
+	for i, status := range statuses {
+		n := watchErrors.Value(string(resources.Pods),
+			string(status.Reason)) - before[i]
+		if n != 1 {
+			t.Errorf("Expected one %s error; got %v", status.Reason, n)
+		}
+	}
+	if errs := server.Errors(); len(errs) > 0 {
+		t.Error("Invalid requests: ", errs)
+	}
+}
@@ -0,0 +1,106 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// watchStream decodes the events in a watch stream one at a time.
+type watchStream interface {
+	// next returns the next event in the stream, along with its JSON, which
+	// is only valid until the following call.  If the stream can't be read
+	// any further, the JSON is nil, and Err is io.EOF at the end of the
+	// stream.
+	next() (WatchEvent, []byte)
+}
+
+// newWatchStream returns a stream that decodes the events in resp, a
+// response to a watch on resource, in whichever format the API server sent.
+func newWatchStream(resource resources.ResourceType,
+	resp *http.Response) watchStream {
+
+	if isProtobuf(resp) {
+		return newProtobufStream(resource, resp.Body)
+	}
+	return newEventStream(resource, resp.Body)
+}
+
+// eventStream decodes the events in a watch stream on a single resource as
+// a stream of JSON values, straight into pooled events, without reading
+// each line into a new buffer first.
+type eventStream struct {
+	resource resources.ResourceType
+	in       *recordingReader
+	decoder  *json.Decoder
+	// consumed is how much of in.buf the decoder had consumed as of the
+	// last event.
+	consumed int
+}
+
+func newEventStream(resource resources.ResourceType,
+	r io.Reader) *eventStream {
+
+	in := &recordingReader{r: r}
+	return &eventStream{resource: resource, in: in,
+		decoder: json.NewDecoder(in)}
+}
+
+// next returns the next event in the stream, as decodeWatchLine would.
+func (s *eventStream) next() (WatchEvent, []byte) {
+	s.in.discard(s.consumed)
+	s.consumed = 0
+	e := getEvent(s.resource)
+	err := s.decoder.Decode(e)
+	if _, ok := err.(*json.UnmarshalTypeError); err != nil && !ok {
+		// The stream is unreadable past this point, unlike when a value
+		// doesn't match the event (e.g., for an ERROR event).
+		releaseEvent(s.resource, e)
+		return WatchEvent{Err: err}, nil
+	}
+	// Whatever the decoder has read but not consumed belongs to the events
+	// that follow.  Buffered doesn't promise any particular reader, so the
+	// bytes left in it are counted by draining it.
+	buffered, _ := io.Copy(ioutil.Discard, s.decoder.Buffered())
+	s.consumed = len(s.in.buf) - int(buffered)
+	line := bytes.TrimSpace(s.in.buf[:s.consumed])
+	return finishEvent(s.resource, e, err, line), line
+}
+
+// recordingReader keeps what it reads, from the last discard on, so that
+// the JSON of each decoded event can be recovered.
+type recordingReader struct {
+	r   io.Reader
+	buf []byte
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.buf = append(r.buf, p[:n]...)
+	return n, err
+}
+
+// discard drops the first n bytes kept, reusing the space they took.
+func (r *recordingReader) discard(n int) {
+	r.buf = r.buf[:copy(r.buf, r.buf[n:])]
+}
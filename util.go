@@ -32,3 +32,15 @@ func max(a int, b int) int {
 func GetCommandString(command []string) string {
 	return strings.Join(command, " ")
 }
+
+// splitList splits a comma-separated list, trimming whitespace and dropping
+// empty entries.
+func splitList(list string) []string {
+	var ret []string
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			ret = append(ret, item)
+		}
+	}
+	return ret
+}
@@ -21,6 +21,8 @@ import (
 	"fmt"
 	"io"
 	"log"
+	"sync"
+	"time"
 
 	"k8s.io/kubernetes/pkg/api"
 	"k8s.io/kubernetes/pkg/api/unversioned"
@@ -34,36 +36,119 @@ import (
 type Watcher struct {
 	dbm dbmanager.DBManager
 
-	client    *APIClient
-	namespace string
-	// TODO:  Figure out how this interfaces with the rest of the system.
+	client *APIClient
+	// clock supplies the times at which events are received.  By default,
+	// it estimates the API server's clock, so that the times the tracker
+	// records in place of those Kubernetes doesn't report are comparable
+	// with the ones it does.
+	clock Clock
+	// namespaces lists the namespaces to watch; a single empty namespace
+	// watches all of them.  Each namespaced resource gets a separate watch,
+	// with its own resource version, for each namespace.
+	namespaces []string
+
+	// options are passed to the API server on every watch, and filter is
+	// applied to the events it sends.
+	options WatchOptions
+	filter  EventFilter
 
+	// Each resource has one stop channel, shared by its per-namespace
+	// watches.
 	stopChannels map[resources.ResourceType]chan<- struct{}
+
+	// states tracks the progress of each watch for the health checks.
+	statesMutex sync.Mutex
+	states      map[watchKey]*watchState
+
+	// retryDelay is how long a watch waits before restarting after a
+	// Status error that's retried.  The delay doubles with each consecutive
+	// error, up to maxRetryDelay, which is also used for authorization
+	// errors.
+	retryDelay    time.Duration
+	maxRetryDelay time.Duration
+
+	// syncQuiet is how long a newly opened watch must go without
+	// delivering an event before its initial events are considered
+	// delivered.  The API server doesn't mark the end of the initial
+	// events, but they arrive in a burst, so a short gap is a reasonable
+	// signal.  On a busy cluster, the gap may never come, so they're
+	// considered delivered syncLimit after the watch opens regardless.
+	syncQuiet time.Duration
+	syncLimit time.Duration
+
+	// rebuilding is set while Rebuild replays the event log, so that the
+	// events aren't logged a second time.
+	rebuilding bool
+}
+
+// watchKey identifies a single watch stream.  Namespace is empty for PVs and
+// for watches on all namespaces.
+type watchKey struct {
+	resource  resources.ResourceType
+	namespace string
+}
+
+func (k watchKey) String() string {
+	if k.namespace == "" {
+		return string(k.resource)
+	}
+	return fmt.Sprintf("%s in %s", k.resource, k.namespace)
+}
+
+// eventHandler processes an event received by the watch on watcherNS.
+type eventHandler func(eventType EventType, r resources.Resource, json,
+	watcherNS string, rc receipt)
+
+// receipt records when an event was received.  The handlers fall back on it
+// for times that the API server doesn't report.
+type receipt struct {
+	time time.Time
+	// resync is set for the initial events of a watch started without a
+	// resource version (e.g., on the first start, or after the resource
+	// version expired), which may describe changes made long before they
+	// were received.
+	resync bool
 }
 
-type eventHandler func(EventType, resources.Resource, string)
+// fallbackTime returns the time at which the event was received, for use
+// in place of the time of the change it reports, along with its source.
+func (rc receipt) fallbackTime() (unversioned.Time, dbmanager.TimeSource) {
+	if rc.resync {
+		return unversioned.NewTime(rc.time), dbmanager.TimeInferred
+	}
+	return unversioned.NewTime(rc.time), dbmanager.TimeObserved
+}
 
-// getRV returns the latest known resource for the given type, if it exists.
-// If initialize is true, it returns an empty string.
-func (w *Watcher) getRV(resource resources.ResourceType, initialize bool) (rv string) {
-	var ns string
+// getRV returns the latest known resource for the given type in the given
+// watched namespace, if it exists.  If initialize is true, it returns an
+// empty string.
+func (w *Watcher) getRV(resource resources.ResourceType, namespace string,
+	initialize bool) (rv string) {
 
 	if initialize {
 		return ""
 	}
 	if resource == resources.PVs {
-		ns = resources.PVNamespace
-	} else {
-		ns = w.namespace
+		namespace = resources.PVNamespace
 	}
-	rv = w.dbm.GetRV(resource, ns)
+	rv = w.dbm.GetRV(resource, namespace)
 	log.Printf("Returning RV %s for %s in namespace %s", rv, resource,
-		w.namespace)
+		namespace)
 	return
 }
 
+// watchNamespaces returns the namespaces for which to watch resource.
+func (w *Watcher) watchNamespaces(resource resources.ResourceType) []string {
+	if resource == resources.PVs {
+		return []string{""}
+	}
+	return w.namespaces
+}
+
 // handlePods communicates Pod events down to the back-end DBManager.
-func (w *Watcher) handlePods(eventType EventType, r resources.Resource, json string) {
+func (w *Watcher) handlePods(eventType EventType, r resources.Resource, json,
+	watcherNS string, rc receipt) {
+
 	p := r.(*resources.PodResource)
 	uid := p.GetUID()
 	switch eventType {
@@ -93,20 +178,25 @@ func (w *Watcher) handlePods(eventType EventType, r resources.Resource, json str
 			}
 		}
 		w.dbm.InsertPod(uid, p.Name, p.CreationTimestamp, p.Namespace,
-			containers, json, w.namespace, p.ResourceVersion)
+			containers, json, watcherNS, p.ResourceVersion)
 	case Modified:
 		// TODO:  Special handling here?  At least store the RV?
-	case Error:
-		// TODO:  Special handling here?
 	case Deleted:
-		w.dbm.DeletePod(uid, *p.DeletionTimestamp, w.namespace,
-			p.ResourceVersion)
+		if p.DeletionTimestamp != nil {
+			w.dbm.DeletePod(uid, *p.DeletionTimestamp, dbmanager.TimeExact,
+				watcherNS, p.ResourceVersion)
+		} else {
+			// See the warnings about clock skew in handlePVs.
+			deleteTime, source := rc.fallbackTime()
+			w.dbm.DeletePod(uid, deleteTime, source, watcherNS,
+				p.ResourceVersion)
+		}
 	}
 }
 
 // handlePods communicates PV events down to the back-end DBManager.
 func (w *Watcher) handlePVs(eventType EventType, r resources.Resource,
-	json string) {
+	json, watcherNS string, rc receipt) {
 
 	p := r.(*resources.PVResource)
 	uid := p.GetUID()
@@ -129,7 +219,8 @@ func (w *Watcher) handlePVs(eventType EventType, r resources.Resource,
 			backend, (&storage).Value(), p.Spec.AccessModes, json,
 			p.ResourceVersion)
 		if p.Spec.ClaimRef != nil {
-			w.dbm.BindPVC(p.UID, p.Spec.ClaimRef.UID, unversioned.Now(),
+			bindTime, source := rc.fallbackTime()
+			w.dbm.BindPVC(p.UID, p.Spec.ClaimRef.UID, bindTime, source,
 				p.ResourceVersion)
 		}
 	case Modified:
@@ -140,8 +231,10 @@ func (w *Watcher) handlePVs(eventType EventType, r resources.Resource,
 			}
 			// TODO:  This is *REALLY* vulnerable to clock skew/processing
 			// delays, but at the moment, Kubernetes doesn't give us a
-			// timestamp for status changes.
-			w.dbm.BindPVC(p.UID, p.Spec.ClaimRef.UID, unversioned.Now(),
+			// timestamp for status changes.  The source recorded with the
+			// time at least lets readers know how far to trust it.
+			bindTime, source := rc.fallbackTime()
+			w.dbm.BindPVC(p.UID, p.Spec.ClaimRef.UID, bindTime, source,
 				p.ResourceVersion)
 		} else if p.Status.Phase == api.VolumeAvailable {
 			var (
@@ -161,21 +254,23 @@ func (w *Watcher) handlePVs(eventType EventType, r resources.Resource,
 			w.dbm.UpdatePV(p.UID, backendID, backend, (&storage).Value(),
 				p.Spec.AccessModes, json, p.ResourceVersion)
 		}
-	case Error:
-		// TODO:  Special handling here?
 	case Deleted:
 		if p.DeletionTimestamp != nil {
-			w.dbm.DeletePV(uid, *p.DeletionTimestamp, p.ResourceVersion)
+			w.dbm.DeletePV(uid, *p.DeletionTimestamp, dbmanager.TimeExact,
+				p.ResourceVersion)
 		} else {
 			// This is less than ideal, but we don't have a choice.  See
 			// warnings about clock skew in the comments for binding.
-			w.dbm.DeletePV(uid, unversioned.Now(), p.ResourceVersion)
+			deleteTime, source := rc.fallbackTime()
+			w.dbm.DeletePV(uid, deleteTime, source, p.ResourceVersion)
 		}
 	}
 }
 
 // handlePods communicates PVC events down to the back-end DBManager.
-func (w *Watcher) handlePVCs(eventType EventType, r resources.Resource, json string) {
+func (w *Watcher) handlePVCs(eventType EventType, r resources.Resource,
+	json, watcherNS string, rc receipt) {
+
 	p := r.(*resources.PVCResource)
 	uid := p.GetUID()
 	switch eventType {
@@ -184,30 +279,53 @@ func (w *Watcher) handlePVCs(eventType EventType, r resources.Resource, json str
 		// TODO:  Use p.Spec or p.Status?
 		w.dbm.InsertPVC(p.UID, p.Name, p.CreationTimestamp, p.Namespace,
 			(&storage).Value(), p.Spec.AccessModes,
-			json, w.namespace, p.ResourceVersion)
+			json, watcherNS, p.ResourceVersion)
 	case Modified:
 		// TODO:  Does anything need to happen here?  We currently manage
 		// everything in the PV update, which is probably enough.
 		if p.Status.Phase == api.ClaimPending {
 			storage := p.Spec.Resources.Requests[api.ResourceStorage]
 			w.dbm.UpdatePVC(p.UID, (&storage).Value(), p.Spec.AccessModes, json,
-				w.namespace, p.ResourceVersion)
+				watcherNS, p.ResourceVersion)
 		}
-	case Error:
-		// TODO:  Special handling here?
 	case Deleted:
 		if p.DeletionTimestamp != nil {
-			w.dbm.DeletePVC(uid, *p.DeletionTimestamp, w.namespace,
-				p.ResourceVersion)
+			w.dbm.DeletePVC(uid, *p.DeletionTimestamp, dbmanager.TimeExact,
+				watcherNS, p.ResourceVersion)
 		} else {
 			// This is less than ideal, but we don't have a choice.  See
 			// warnings about clock skew in the comments for binding.
-			w.dbm.DeletePVC(uid, unversioned.Now(), w.namespace,
+			deleteTime, source := rc.fallbackTime()
+			w.dbm.DeletePVC(uid, deleteTime, source, watcherNS,
 				p.ResourceVersion)
 		}
 	}
 }
 
+// dispatch applies an event received on the watch for resource in namespace:
+// it logs the event, passes it to handler, and records the revision it
+// carries.  Events whose resource version is no newer than the last one
+// applied to the same object are logged but otherwise dropped, since the
+// database already reflects them; dispatch returns false for those.
+func (w *Watcher) dispatch(handler eventHandler,
+	resource resources.ResourceType, namespace string, e ResourceEvent,
+	line string, rc receipt) bool {
+
+	r := e.GetResource()
+	w.appendEvent(resource, namespace, r.GetUID(), line, rc)
+	if last := w.dbm.ObjectRV(r.GetUID()); !dbmanager.NewerRV(r.GetRV(),
+		last) {
+
+		log.Printf("Got %s event for %s with RV %s, but already applied RV "+
+			"%s; skipping.\n", e.GetType(), r.GetUID(), r.GetRV(), last)
+		eventsStale.Inc(string(resource))
+		return false
+	}
+	handler(e.GetType(), r, line, namespace, rc)
+	w.recordRevision(resource, e.GetType(), r, line, rc.time)
+	return true
+}
+
 // getHandler returns the appropriate handler for a given resource type
 // (e.g., for resources.Pods, it returns w.handlePods).
 func (w *Watcher) getHandler(resource resources.ResourceType) (eventHandler, error) {
@@ -224,75 +342,246 @@ func (w *Watcher) getHandler(resource resources.ResourceType) (eventHandler, err
 	}
 }
 
-// Watch monitors a resource, starting a goroutine that uses the APIClient
-// to watch a given endpoint and then calling the appropriate handler method
-// for the events that come in.
-// Returns a channel used to signal the watch to stop.
+// Watch monitors a resource, starting a goroutine per watched namespace
+// that uses the APIClient to watch a given endpoint and then calling the
+// appropriate handler method for the events that come in.
 func (w *Watcher) Watch(resource resources.ResourceType, initialize bool) error {
-	var rv string
-
 	if _, ok := w.stopChannels[resource]; ok {
 		log.Printf("WARNING:  Attempting to watch resource %s multiple times."+
 			"  Returning.\n", resource)
 		return nil
 	}
 
-	stop := make(chan struct{})
-	w.stopChannels[resource] = stop
-
 	handler, err := w.getHandler(resource)
 	if err != nil {
 		return err
 	}
 
-	go func() {
-		var event WatchEvent
-		for {
-			rv = w.getRV(resource, initialize)
-			eventChan, done := w.client.Watch(resource, w.namespace, rv)
-			for open := true; open; {
-				select {
-				case event = <-eventChan:
-				case <-stop:
-					fmt.Printf("Stopping watch on %s\n", resource)
-					close(done)
-					return
-				}
-				if event.Err == io.EOF {
-					close(done)
-					if event.JSONEvent != nil {
-						status := event.JSONEvent.(unversioned.Status)
-						if status.Code == StatusTooOld {
-							// The resource version is expired, so just start
-							// the watch without one.
-							log.Print("Got expired RV; doing fresh " +
-								"initialization.")
-							initialize = true
-						}
-					}
-					open = false
-				} else if event.Err != nil {
-					// TODO:  Insert some kind of backoff/retry in case
-					// the error is transient?
-					close(done)
-					log.Fatal("Unable to read events: ", event.Err)
-				} else {
-					e := event.JSONEvent.(ResourceEvent)
-					r := e.GetResource()
-					if r.GetRV() == rv {
-						log.Printf("Got duplicate RV %s for resource %s; "+
-							"skipping.\n", rv, resource)
-						continue
-					}
-					handler(e.GetType(), r, event.JSON)
-					log.Println(e)
+	stop := make(chan struct{})
+	w.stopChannels[resource] = stop
+	for _, namespace := range w.watchNamespaces(resource) {
+		// Create the state up front, so that the watcher isn't ready until
+		// every watch has started.
+		key := watchKey{resource, namespace}
+		go w.watchNamespace(key, w.getWatchState(key), initialize, handler,
+			stop)
+	}
+	return nil
+}
+
+// watchNamespace runs the watch identified by key, on a single namespace (or
+// all namespaces, if the key's namespace is empty), until stop is closed.
+func (w *Watcher) watchNamespace(key watchKey, state *watchState,
+	initialize bool, handler eventHandler, stop <-chan struct{}) {
+
+	var event WatchEvent
+	var delay time.Duration
+	// failures counts the consecutive Status errors, for the backoff.
+	failures := 0
+
+	resource, namespace := key.resource, key.namespace
+	for reconnect := false; ; reconnect = true {
+		if reconnect {
+			watchReconnects.Inc(string(resource))
+		}
+		if delay > 0 {
+			select {
+			case <-time.After(delay):
+			case <-stop:
+				fmt.Printf("Stopping watch on %s\n", key)
+				return
+			}
+			delay = 0
+		}
+		state.setBusy()
+		rv := w.getRV(resource, namespace, initialize)
+		eventChan, done := w.client.Watch(resource, namespace, rv,
+			w.options)
+		state.setIdle()
+		// A stream resumed from a resource version only delivers changes
+		// made since, as they happen.  One started without begins by
+		// replaying every existing object; once it opens, consider those
+		// initial events delivered when it goes quiet for a moment, or
+		// after w.syncLimit, and treat them as a resync until then.
+		var quiet, limit <-chan time.Time
+		resync := false
+		for open := true; open; {
+			select {
+			case event = <-eventChan:
+			case <-quiet:
+				quiet, limit, resync = nil, nil, false
+				state.setSynced()
+				continue
+			case <-limit:
+				quiet, limit, resync = nil, nil, false
+				state.setSynced()
+				continue
+			case <-stop:
+				fmt.Printf("Stopping watch on %s\n", key)
+				close(done)
+				return
+			}
+			if event.Opened {
+				state.opened()
+				if rv != "" {
+					state.setSynced()
+					continue
 				}
+				resync = true
+				quiet = time.After(w.syncQuiet)
+				limit = time.After(w.syncLimit)
+				continue
+			}
+			if quiet != nil {
+				quiet = time.After(w.syncQuiet)
 			}
+			if event.Err == io.EOF {
+				state.closed()
+				close(done)
+				open = false
+			} else if statusErr, ok := event.Err.(*StatusError); ok {
+				state.closed()
+				close(done)
+				open = false
+				failures++
+				delay = w.recoverFromStatus(key, statusErr, failures,
+					&initialize)
+			} else if event.Err != nil {
+				// TODO:  Insert some kind of backoff/retry in case
+				// the error is transient?
+				close(done)
+				log.Fatal("Unable to read events: ", event.Err)
+			} else {
+				failures = 0
+				w.handleEvent(key, state, handler,
+					event.JSONEvent.(ResourceEvent), event.JSON, resync)
+			}
+		}
+	}
+}
+
+// handleEvent filters and dispatches an event received on the watch
+// identified by key, then releases it.  resync is set if the event is part
+// of the initial burst of a stream started without a resource version.
+func (w *Watcher) handleEvent(key watchKey, state *watchState,
+	handler eventHandler, e ResourceEvent, json string, resync bool) {
+
+	resource, namespace := key.resource, key.namespace
+	defer releaseEvent(resource, e)
+	r := e.GetResource()
+	// The API server has been seen to match namespaces by prefix, so make
+	// sure the event really belongs here.
+	if namespace != "" && r.GetNamespace() != namespace {
+		log.Printf("Got event for %s from namespace %s on watch for %s; "+
+			"skipping.\n", r.GetUID(), r.GetNamespace(), key)
+		return
+	}
+	if e.GetType() == Deleted && !w.options.matches(r) {
+		// The object still exists; it has just left the selectors, so
+		// there's no deletion to record.
+		log.Printf("Object %s no longer matches the watch's selectors; "+
+			"no longer tracking it.\n", r.GetUID())
+		eventsFiltered.Inc(string(resource), filteredSelector)
+		return
+	}
+	if reason := w.filter.reject(resource, r); reason != "" &&
+		!w.trackedDeletion(e, reason) {
+
+		eventsFiltered.Inc(string(resource), reason)
+		return
+	}
+	state.setBusy()
+	applied := w.dispatch(handler, resource, namespace, e, json,
+		receipt{time: w.clock.Now(), resync: resync})
+	state.setIdle()
+	if applied {
+		eventsProcessed.Inc(string(resource), string(e.GetType()))
+		log.Println(e)
+	}
+}
+
+// trackedDeletion returns whether e, which the filter rejected for reason,
+// should be recorded anyway because it deletes an object that's already
+// recorded, which may have been relabeled since.
+func (w *Watcher) trackedDeletion(e ResourceEvent, reason string) bool {
+	return reason == filteredLabel && e.GetType() == Deleted &&
+		w.dbm.ObjectRV(e.GetResource().GetUID()) != ""
+}
+
+// recoverFromStatus decides how the watch identified by key recovers from
+// err, the latest of failures consecutive Status errors.  It sets
+// *initialize if the watch must start over without a resource version, and
+// returns how long to wait before restarting it.
+func (w *Watcher) recoverFromStatus(key watchKey, err *StatusError,
+	failures int, initialize *bool) time.Duration {
+
+	resource := string(key.resource)
+	watchErrors.Inc(resource, err.reasonLabel())
+	recovery := err.recovery()
+	if recovery == recoverRelist {
+		// The resource version is expired, so just start the watch
+		// without one.
+		log.Printf("Got expired RV on watch for %s; doing fresh "+
+			"initialization.", key)
+		*initialize = true
+		watchResets.Inc(resource)
+		return 0
+	}
+
+	delay := w.maxRetryDelay
+	if recovery == recoverRetry && failures <= maxRetryDoublings {
+		delay = w.retryDelay << uint(failures-1)
+		if delay > w.maxRetryDelay {
+			delay = w.maxRetryDelay
 		}
-	}()
+	}
+	if recovery == recoverAuth {
+		log.Printf("WARNING:  Watch for %s isn't authorized (%s); check "+
+			"the tracker's credentials and permissions.  Retrying in %s.",
+			key, err, delay)
+	} else {
+		log.Printf("Watch for %s failed (%s); retrying in %s.", key, err,
+			delay)
+	}
+	return delay
+}
+
+// SetWatchOptions sets the selectors used for subsequent watches, returning
+// an error if either can't be parsed.
+func (w *Watcher) SetWatchOptions(opts WatchOptions) error {
+	if _, _, err := opts.selectors(); err != nil {
+		return err
+	}
+	w.options = opts
 	return nil
 }
 
+// SetClock sets the clock that supplies the times at which subsequent
+// events are received, in place of the estimate of the API server's clock.
+func (w *Watcher) SetClock(clock Clock) {
+	w.clock = clock
+}
+
+// SetFilter sets the client-side filter used for subsequent watches.
+func (w *Watcher) SetFilter(filter EventFilter) error {
+	if err := filter.Validate(); err != nil {
+		return err
+	}
+	w.filter = filter
+	return nil
+}
+
+// SetRecorder records the lines read by subsequent watches with r.
+func (w *Watcher) SetRecorder(r *Recorder) {
+	w.client.recorder = r
+}
+
+// SetProtobuf sets whether subsequent watches ask the API server for
+// protobuf rather than JSON.
+func (w *Watcher) SetProtobuf(protobuf bool) {
+	w.client.protobuf = protobuf
+}
+
 // Destroy stops all active goroutines associated with the Watcher, and
 // calls Destroy on the backing DBManager.
 func (w *Watcher) Destroy() {
@@ -310,13 +599,15 @@ func (w *Watcher) Stop(resource resources.ResourceType) error {
 	}
 	close(w.stopChannels[resource])
 	delete(w.stopChannels, resource)
+	w.removeWatchStates(resource)
 	return nil
 }
 
 // NewWatcher returns a new Watcher object that monitors the specified
-// namespace for the API Server located at masterIPPort, using the provided
-// DBManager instance for backing storage.
-func NewWatcher(namespace string, masterIPPort string,
+// namespaces for the API Server located at masterIPPort, using the provided
+// DBManager instance for backing storage.  If namespaces is empty, it
+// monitors all namespaces.
+func NewWatcher(namespaces []string, masterIPPort string,
 	dbm dbmanager.DBManager) (*Watcher, error) {
 
 	if dbm == nil {
@@ -326,10 +617,41 @@ func NewWatcher(namespace string, masterIPPort string,
 	if err != nil {
 		return nil, err
 	}
+	if len(namespaces) == 0 {
+		namespaces = []string{""}
+	}
 	return &Watcher{
 		client:       client,
+		clock:        client.ServerClock(),
 		dbm:          dbm,
-		namespace:    namespace,
+		namespaces:   namespaces,
 		stopChannels: make(map[resources.ResourceType]chan<- struct{}),
+		states:       make(map[watchKey]*watchState),
+
+		retryDelay:    defaultRetryDelay,
+		maxRetryDelay: defaultMaxRetryDelay,
+		syncQuiet:     defaultSyncQuiet,
+		syncLimit:     defaultSyncLimit,
 	}, nil
 }
+
+// NewWatcherForSelector wraps NewWatcher, monitoring the namespaces that
+// match the given label selector at the time it is called.  Namespaces
+// created later are not monitored.
+func NewWatcherForSelector(selector string, masterIPPort string,
+	dbm dbmanager.DBManager) (*Watcher, error) {
+
+	client, err := NewAPIClient(masterIPPort)
+	if err != nil {
+		return nil, err
+	}
+	namespaces, err := client.ListNamespaces(selector)
+	if err != nil {
+		return nil, err
+	}
+	if len(namespaces) == 0 {
+		return nil, fmt.Errorf("No namespaces match selector %s", selector)
+	}
+	log.Printf("Selector %s matches namespaces %v", selector, namespaces)
+	return NewWatcher(namespaces, masterIPPort, dbm)
+}
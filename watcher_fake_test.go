@@ -0,0 +1,139 @@
+/*
+   Copyright 2016 Chris Dragga <cdragga@netapp.com>
+
+   Licensed under the Apache License, Version 2.0 (the "License");
+   you may not use this file except in compliance with the License.
+   You may obtain a copy of the License at
+
+       http://www.apache.org/licenses/LICENSE-2.0
+
+   Unless required by applicable law or agreed to in writing, software
+   distributed under the License is distributed on an "AS IS" BASIS,
+   WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+   See the License for the specific language governing permissions and
+   limitations under the License.
+*/
+
+package main
+
+import (
+	"testing"
+	"time"
+
+	"k8s.io/kubernetes/pkg/api"
+	"k8s.io/kubernetes/pkg/types"
+
+	"github.com/netapp/kubevoltracker/dbmanager/mock"
+	"github.com/netapp/kubevoltracker/fakeapi"
+	"github.com/netapp/kubevoltracker/resources"
+)
+
+// waitForPod waits for the manager to have (or not have) the given pod.
+func waitForPod(t *testing.T, manager *lockedManager, uid types.UID,
+	present bool) {
+
+	deadline := time.Now().Add(2 * time.Second)
+	for manager.hasPod(uid) != present {
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for pod %s (present: %t)", uid,
+				present)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+// waitForWatchRequests waits for the server to have received n watch
+// requests and returns them.
+func waitForWatchRequests(t *testing.T, server *fakeapi.Server,
+	n int) []fakeapi.WatchRequest {
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		requests := server.Requests()
+		if len(requests) >= n {
+			return requests
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("Timed out waiting for %d watch requests; got %v", n,
+				requests)
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func newFakePod(name string) *api.Pod {
+	pod := &api.Pod{}
+	pod.Name = name
+	pod.Namespace = "ns"
+	pod.UID = types.UID(name)
+	return pod
+}
+
+// TestWatchFakeAPI runs a pod watch against the fake API server, checking
+// that the watcher resumes from the last recorded RV after a dropped stream
+// and starts over when that RV has expired.
+func TestWatchFakeAPI(t *testing.T) {
+	server := fakeapi.New()
+	defer server.Close()
+
+	podA, podB := newFakePod("pod-a"), newFakePod("pod-b")
+	if _, err := server.Add(podA); err != nil {
+		t.Fatal(err)
+	}
+	manager := &lockedManager{MockManager: mock.New(false).(*mock.MockManager)}
+	w, err := NewWatcher([]string{""}, server.Host(), manager)
+	if err != nil {
+		t.Fatal("Unable to create watcher: ", err)
+	}
+	if err = w.Watch(resources.Pods, false); err != nil {
+		t.Fatal("Unable to watch pods: ", err)
+	}
+	defer w.Stop(resources.Pods)
+
+	waitForPod(t, manager, podA.UID, true)
+	rvB, err := server.Add(podB)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForPod(t, manager, podB.UID, true)
+
+	// The watcher should pick up where it left off, receiving the deletion
+	// from the replayed history.
+	server.CloseWatches()
+	rvDelete, err := server.Delete(podA)
+	if err != nil {
+		t.Fatal(err)
+	}
+	waitForPod(t, manager, podA.UID, false)
+	requests := waitForWatchRequests(t, server, 2)
+	if requests[0].ResourceVersion != "" ||
+		requests[1].ResourceVersion != rvB {
+		t.Errorf("Watch resumed from %q, %q; expected \"\", %q",
+			requests[0].ResourceVersion, requests[1].ResourceVersion, rvB)
+	}
+
+	// Once the RV has expired, the watcher should start over and get the
+	// remaining pod again, which it drops since it's already applied.
+	stale := eventsStale.Value(string(resources.Pods))
+	server.Expire()
+	requests = waitForWatchRequests(t, server, 4)
+	deadline := time.Now().Add(2 * time.Second)
+	for eventsStale.Value(string(resources.Pods)) == stale {
+		if time.Now().After(deadline) {
+			t.Fatal("Timed out waiting for the relisted pod to be dropped")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !manager.hasPod(podB.UID) {
+		t.Errorf("Pod %s missing after restarting the watch", podB.UID)
+	}
+	if requests[2].ResourceVersion != rvDelete ||
+		requests[3].ResourceVersion != "" {
+		t.Errorf("Watch restarted from %q, %q; expected %q, \"\"",
+			requests[2].ResourceVersion, requests[3].ResourceVersion,
+			rvDelete)
+	}
+	if errs := server.Errors(); len(errs) > 0 {
+		t.Error("Invalid requests: ", errs)
+	}
+}
@@ -99,7 +99,8 @@ func QuiesceTableCounts(counts map[dbmanager.Table]int) {
 
 func GetMySQLWatcherForNamespace(namespace string) *Watcher {
 	manager := mysql.NewForDB("root", "root", os.Getenv("MYSQL_IP"), testDB)
-	w, err := NewWatcher(namespace, os.Getenv("KUBERNETES_MASTER"), manager)
+	w, err := NewWatcher([]string{namespace}, os.Getenv("KUBERNETES_MASTER"),
+		manager)
 	if err != nil {
 		log.Fatal("Unable to instantiate watcher; aborting: ", err)
 	}
@@ -679,7 +680,7 @@ func TestGetRV(t *testing.T) {
 			ns = watcherNS
 		}
 		dbRV = GetRV(resource, ns)
-		watcherRV = watcher.getRV(resource, false)
+		watcherRV = watcher.getRV(resource, watcherNS, false)
 		if dbRV != watcherRV {
 			t.Errorf("DB RV for %s differs from watcher RV; expected %s, got "+
 				"%s\n", resource, dbRV, watcherRV)
@@ -688,7 +689,7 @@ func TestGetRV(t *testing.T) {
 	for _, resource := range []resources.ResourceType{resources.Pods,
 		resources.PVs, resources.PVCs} {
 
-		watcherRV = watcher.getRV(resource, true)
+		watcherRV = watcher.getRV(resource, watcherNS, true)
 		if watcherRV != "" {
 			t.Errorf("Expected empty RV when specifying initialize with %s;"+
 				" got %s\n", resource, watcherRV)
@@ -700,14 +701,14 @@ func TestGetRV(t *testing.T) {
 	for _, resource := range []resources.ResourceType{resources.Pods,
 		resources.PVCs} {
 
-		watcherRV = altWatcher.getRV(resource, false)
+		watcherRV = altWatcher.getRV(resource, "unused-namespace", false)
 		if watcherRV != "" {
 			t.Errorf("Expected empty RV for unused namespace and resource %s; "+
 				"got %s\n", resource, watcherRV)
 		}
 	}
 	dbRV = GetRV(resources.PVs, resources.PVNamespace)
-	watcherRV = altWatcher.getRV(resources.PVs, false)
+	watcherRV = altWatcher.getRV(resources.PVs, "unused-namespace", false)
 	if watcherRV != dbRV {
 		t.Errorf("Expected %s for PVs from unused namespace watcher; got %s\n",
 			dbRV, watcherRV)
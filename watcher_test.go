@@ -34,7 +34,7 @@ import (
 var manager *mock.MockManager
 
 func GetWatcherForManager(manager dbmanager.DBManager) *Watcher {
-	w, err := NewWatcher(watcherNS, os.Getenv("KUBERNETES_MASTER"),
+	w, err := NewWatcher([]string{watcherNS}, os.Getenv("KUBERNETES_MASTER"),
 		manager)
 	if err != nil {
 		log.Fatal("Unable to create watcher; aborting test: ", err)
@@ -290,11 +290,11 @@ func TestStop(t *testing.T) {
 
 func TestBadWatcherParams(t *testing.T) {
 	manager = (mock.New(false)).(*mock.MockManager)
-	if _, err := NewWatcher(watcherNS, os.Getenv("KUBERNETES_MASTER"),
-		nil); err == nil {
+	if _, err := NewWatcher([]string{watcherNS},
+		os.Getenv("KUBERNETES_MASTER"), nil); err == nil {
 		t.Error("NewWatcher failed to validate nil database manager.")
 	}
-	if _, err := NewWatcher(watcherNS, "", manager); err == nil {
+	if _, err := NewWatcher([]string{watcherNS}, "", manager); err == nil {
 		t.Error("NewWatcher failed to validate API server address/port")
 	}
 }